@@ -0,0 +1,937 @@
+// Package agent runs the model/tool loop and exposes it over the CLI, HTTP, or in-process.
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/locale"
+	"github.com/kartikx/agent/providers"
+	"github.com/kartikx/agent/tools"
+	"github.com/kartikx/agent/workspace"
+)
+
+// Color constants for terminal output
+const (
+	GreenColor = "\033[32m"
+	BlueColor  = "\033[34m"
+	RedColor   = "\033[31m"
+	ResetColor = "\033[0m"
+)
+
+type Agent struct {
+	name string
+	port int
+
+	provider providers.Provider
+	tools    *tools.Registry
+
+	// Messages from all transports, and the transport the current one came from.
+	transportsMu sync.Mutex
+	transports   []Transport
+	inputs       chan transportInput
+	current      Transport
+	http         *HTTPTransport
+	webSocket    *WebSocketTransport
+	inProcess    *InProcessTransport
+
+	// Conversation histories, keyed by session ID.
+	sessions *SessionStore
+	// Encrypts the sessions and caches stored at rest, if enabled.
+	sealer *Sealer
+
+	// Snapshot of the current session, used for exports.
+	transcriptMu sync.Mutex
+	transcript   []anthropic.MessageParam
+
+	budget Budget
+	clock  Clock
+
+	// Disposable workspaces; file tools operate on the active one.
+	workspaces  *workspace.Manager
+	workspaceMu sync.Mutex
+	workspace   *workspace.Workspace
+
+	// Filesystem of the file tools, and the watcher reporting outside changes to it.
+	fs      tools.FS
+	watcher *FileWatcher
+	// What the file tools remember per filesystem, by filesKey, so switching
+	// users or staging keeps their conflict detection.
+	fileRecords map[any]*tools.FileRecords
+	// Runs the commands of the Go toolchain, project, shell and command tools.
+	runner tools.CommandRunner
+	// Tools declared in TOOLS_FILE that run through the runner, registered again
+	// whenever it changes.
+	commandTools []tools.CommandTool
+	// Overlay holding the turn's writes while its transport only proposes changes.
+	staged *tools.OverlayFS
+	// Fixes applied to the Go files the file tools write, if enabled.
+	goFixes tools.GoFixes
+	// Status of the task being answered, sent to HTTP clients as X-Agent-Status.
+	taskStatus string
+
+	// Token the next request must carry while ask_user waits for an answer.
+	askMu               sync.Mutex
+	pendingContinuation string
+	// Set when a question, which was the reply to the current message, went
+	// unanswered; the rest of the turn has nobody to reply to.
+	unanswered bool
+
+	eventsMu sync.Mutex
+	events   chan Event
+
+	// Extra system prompt blocks, e.g. citation instructions.
+	instructions []string
+	citeSources  bool
+	selfCheck    bool
+	// Whether Go changes are compiled after each round of tool calls, see VerifyBuilds.
+	verifyBuild bool
+	// Whether each session's edits wait for review, see ReviewChanges.
+	reviewChanges bool
+	// Where checkpoints are saved, if they're enabled.
+	checkpoints *Checkpoints
+	// When the model is told its context window runs low, if at all.
+	contextHints *ContextHints
+	// How the model samples responses, see SetSampling.
+	sampling Sampling
+	// Whether written Go code is scanned for dangerous constructs, see ScanSecurity.
+	securityScan bool
+	// Whether instruction-like lines are removed from untrusted tool results, see StripInjections.
+	stripInjections bool
+
+	// Answers to repeated queries, if enabled.
+	cache *ResponseCache
+
+	// Faults injected into tool calls, if enabled.
+	chaos *Chaos
+
+	// Voters answering ask_consensus questions, if enabled.
+	consensus *Consensus
+
+	// Reviewer of each turn's changes, if enabled.
+	critic *Critic
+
+	// Translations of user-facing text, nil for English.
+	catalog *locale.Catalog
+
+	// Whether tool calls are requested and run in parallel.
+	strategy ExecutionStrategy
+
+	// Whether file tools prefetch likely-needed files, see ReadAhead.
+	readAhead bool
+
+	// Workspace overview given to new sessions, see SummarizeWorkspace.
+	summaryEnabled bool
+	summaryMu      sync.Mutex
+	summary        string
+	// Describer of large repositories, if enabled.
+	repoSummary *RepoSummarizer
+
+	// Callers of a shared agent, see SetUsers, and whose turn is being handled.
+	users    *Users
+	user     *User
+	operator operatorState
+
+	// Append-only record of calls to tools that change something, if enabled.
+	auditLog *AuditLog
+
+	// Version of the capability manifest, sent with replies as X-Agent-Capabilities.
+	capabilitiesVersion string
+
+	// Server started by Start, and the channels closed when Shutdown is called
+	// and once Run has stopped between turns.
+	server   *http.Server
+	stopOnce sync.Once
+	stopping chan struct{}
+	stopped  chan struct{}
+}
+
+func NewCoderAgent(provider providers.Provider) *Agent {
+	agent := NewAgent(provider, tools.CoderTools, "coder", 8080)
+	agent.SummarizeWorkspace()
+	agent.SetRepoSummarizer(repoSummarizerFromEnv())
+	if os.Getenv("VERIFY_BUILD") == "on" {
+		agent.VerifyBuilds()
+	}
+	if os.Getenv("SECURITY_SCAN") == "on" {
+		agent.ScanSecurity()
+	}
+	
+	agent.AddHTTPTransport()
+	
+	return agent
+}
+
+func NewDocAgent(provider providers.Provider) *Agent {
+	fmt.Println("Creating doc agent")
+	agent := NewAgent(provider, tools.DocTools, "doc", 8081)
+	agent.CiteSources()
+	if os.Getenv("DOC_SELF_CHECK") == "on" {
+		agent.SelfCheck()
+	}
+	agent.SetResponseCache(responseCacheFromEnv())
+	
+	agent.AddHTTPTransport()
+	
+	return agent
+}
+
+// NewAgent creates an agent without transports; attach them with AddTransport.
+func NewAgent(provider providers.Provider, toolDefinitions []tools.ToolDefinition, name string, port int) *Agent {
+	agent := &Agent{
+		name: name,
+		provider: provider,
+		tools: tools.NewRegistry(toolDefinitions...),
+		port: port,
+		inputs: make(chan transportInput),
+		sessions: sessionStoreFromEnv(),
+		chaos: chaosFromEnv(),
+		strategy: executionStrategyFromEnv(),
+		budget: budgetFromEnv(),
+		clock: RealClock{},
+		fs: tools.OSFS{},
+		runner: tools.LocalRunner(""),
+		goFixes: goFixesFromEnv(),
+		stripInjections: stripInjectionsFromEnv(),
+		contextHints: contextHintsFromEnv(),
+		checkpoints: checkpointsFromEnv(),
+		critic: criticFromEnv(),
+		catalog: catalogFromEnv(),
+		stopping: make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	agent.tools.Register(agent.askUserDefinition())
+	if _, ok := agent.tools.Lookup("run_in_shell"); ok {
+		agent.tools.Register(agent.handOverShellDefinition())
+	}
+	agent.tools.Register(agent.currentTimeDefinition())
+	agent.tools.Register(agent.saveNoteDefinition())
+	agent.tools.Register(agent.readNotesDefinition())
+	agent.SetConsensus(consensusFromEnv())
+	agent.SetSampling(samplingFromEnv(name))
+
+	return agent
+}
+
+// SetPort overrides the port the HTTP server listens on.
+func (a *Agent) SetPort(port int) {
+	a.port = port
+}
+
+// AddHTTPTransport serves the agent at POST /<name> once started.
+func (a *Agent) AddHTTPTransport() {
+	a.http = NewHTTPTransport()
+	a.AddTransport(a.http)
+}
+
+// AddWebSocketTransport serves the agent at /<name>/ws once started.
+func (a *Agent) AddWebSocketTransport() {
+	a.webSocket = NewWebSocketTransport()
+	a.AddTransport(a.webSocket)
+}
+
+// SetFS makes the agent's file tools operate on fsys, e.g. an in-memory or overlay filesystem.
+func (a *Agent) SetFS(fsys tools.FS) {
+	a.fs = fsys
+	a.resetWorkspaceSummary()
+	if a.readAhead {
+		fsys = tools.NewReadAheadFS(fsys)
+	}
+	if a.watcher != nil {
+		fsys = watchedFS{FS: fsys, watcher: a.watcher}
+	}
+
+	for _, definition := range tools.NewFiles(fsys, a.recordsFor(a.fs)).Definitions() {
+		if _, ok := a.tools.Lookup(definition.Name); ok {
+			a.tools.Register(definition)
+		}
+	}
+	a.registerProjectTools()
+}
+
+// recordsFor returns the file tools' records of the files fsys serves.
+func (a *Agent) recordsFor(fsys tools.FS) *tools.FileRecords {
+	key := filesKey(fsys)
+	if key == nil {
+		return nil
+	}
+	if a.fileRecords == nil {
+		a.fileRecords = map[any]*tools.FileRecords{}
+	}
+	records, ok := a.fileRecords[key]
+	if !ok {
+		records = tools.NewFileRecords()
+		a.fileRecords[key] = records
+	}
+	return records
+}
+
+// filesKey identifies the files fsys serves: an OS directory by its root, an
+// overlay staging changes by its base, and other filesystems by themselves.
+func filesKey(fsys tools.FS) any {
+	switch fsys := fsys.(type) {
+	case nil:
+		return nil
+	case *tools.OverlayFS:
+		return filesKey(fsys.Base)
+	case tools.ReadOnlyFS:
+		return filesKey(fsys.FS)
+	case tools.OSFS:
+		root, err := filepath.Abs(fsys.Root)
+		if err != nil {
+			return nil
+		}
+		return tools.OSFS{Root: root}
+	}
+	if !reflect.TypeOf(fsys).Comparable() {
+		return nil
+	}
+	return fsys
+}
+
+// ReadAhead makes the file tools prefetch small, obviously relevant files (go.mod,
+// main.go, READMEs) whenever a directory is listed, so reading them is instant.
+func (a *Agent) ReadAhead() {
+	a.readAhead = true
+
+	// Re-wrap the current filesystem.
+	a.SetFS(a.fs)
+}
+
+// SetRunner makes the agent's Go toolchain, project, shell and command tools
+// run their commands through run, e.g. inside a workspace's container.
+func (a *Agent) SetRunner(run tools.CommandRunner) {
+	a.runner = run
+	definitions := append(tools.NewGoTools(run).Definitions(), tools.NewShellTools(run).Definitions()...)
+	for _, definition := range definitions {
+		if _, ok := a.tools.Lookup(definition.Name); ok {
+			a.tools.Register(definition)
+		}
+	}
+	a.registerProjectTools()
+	a.registerCommandTools()
+}
+
+// AddCommandTools registers tools declared in a TOOLS_FILE. Those without a dir
+// run their commands through the agent's runner, following it into workspaces
+// and users' roots.
+func (a *Agent) AddCommandTools(declarations []tools.CommandTool) error {
+	for _, declaration := range declarations {
+		// WASM tools are compiled once, here; they don't use the runner.
+		definition, err := declaration.Definition(a.runner)
+		if err != nil {
+			return err
+		}
+		a.tools.Register(definition)
+		if declaration.UsesRunner() {
+			a.commandTools = append(a.commandTools, declaration)
+		}
+	}
+	return nil
+}
+
+// registerCommandTools points the command tools using the runner at the current one.
+func (a *Agent) registerCommandTools() {
+	for _, declaration := range a.commandTools {
+		definition, err := declaration.Definition(a.runner)
+		if err != nil {
+			// AddCommandTools already checked the declaration; keep the tool from
+			// running its command anywhere else.
+			fmt.Printf("%s❌ Failed to move command tool %s to the new runner: %v%s\n", RedColor, declaration.Name, err, ResetColor)
+			definition.Name = declaration.Name
+			definition.Description = declaration.Description
+			definition.Function = func(context.Context, json.RawMessage) (string, error) {
+				return "", err
+			}
+		}
+		a.tools.Register(definition)
+	}
+}
+
+// registerProjectTools points the build, test and format tools, if the agent
+// has them, at the current filesystem and runner.
+func (a *Agent) registerProjectTools() {
+	for _, definition := range tools.NewProjectTools(a.fs, a.runner).Definitions() {
+		if _, ok := a.tools.Lookup(definition.Name); ok {
+			a.tools.Register(definition)
+		}
+	}
+}
+
+// Tools returns the agent's tool registry, which can be extended before Run.
+func (a *Agent) Tools() *tools.Registry {
+	return a.tools
+}
+
+func (a *Agent) Start() error {
+	// Tools are registered by now, so the manifest is final.
+	a.capabilitiesVersion = a.Capabilities().Version()
+
+	// Set up HTTP handlers
+	if a.http != nil {
+		a.http.SetCapabilitiesVersion(a.capabilitiesVersion)
+		http.Handle(fmt.Sprintf("/%s", a.name), a.http)
+	}
+	if a.webSocket != nil {
+		http.Handle(fmt.Sprintf("/%s/ws", a.name), a.webSocket.Handler())
+	}
+	http.HandleFunc(fmt.Sprintf("/%s/export", a.name), a.handleExport)
+	http.HandleFunc(fmt.Sprintf("/%s/metrics", a.name), a.handleMetrics)
+	http.HandleFunc(fmt.Sprintf("/%s/batch", a.name), a.handleBatch)
+	http.HandleFunc(fmt.Sprintf("/%s/capabilities", a.name), a.handleCapabilities)
+	if _, ok := a.tools.Lookup("search_documentation"); ok {
+		http.HandleFunc(fmt.Sprintf("/%s/lookup", a.name), a.handleLookup)
+	}
+	if a.workspaces != nil {
+		http.HandleFunc(fmt.Sprintf("/%s/workspace", a.name), a.handleWorkspace)
+	}
+	if a.users != nil {
+		http.HandleFunc(fmt.Sprintf("/%s/sessions", a.name), a.handleSessions)
+	}
+	if a.auditLog != nil {
+		http.HandleFunc(fmt.Sprintf("/%s/audit", a.name), a.handleAudit)
+	}
+	if a.reviewChanges {
+		http.HandleFunc(fmt.Sprintf("/%s/review", a.name), a.handleReview)
+	}
+	http.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		// Failing while draining takes the agent out of its Service's endpoints.
+		if a.draining() {
+			http.Error(w, fmt.Sprintf("%s agent is shutting down", a.name), http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(fmt.Sprintf("%s agent is healthy", a.name)))
+	})
+	
+	// Start the agent on the port.
+	a.server = &http.Server{Addr: fmt.Sprintf(":%d", a.port)}
+	go func() {
+		err := a.server.ListenAndServe()
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			fmt.Printf("HTTP server error: %v\n", err)
+		}
+	}()
+
+	return nil
+}
+
+// handleExport renders the current session, e.g. GET /coder/export?format=html
+func (a *Agent) handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Users export one of their own sessions, e.g. ?session=review
+	messages, fsys := a.Transcript(), a.fs
+	if a.users != nil {
+		user, ok := a.requestUser(w, r)
+		if !ok {
+			return
+		}
+		messages = a.sessions.Messages(userSessionID(user, sessionParam(r)))
+		fsys = tools.OSFS{Root: user.Root}
+	}
+
+	format := r.URL.Query().Get("format")
+	rendered, err := exportTranscript(messages, format, fsys)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch strings.ToLower(format) {
+	case "html":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+	default:
+		w.Header().Set("Content-Type", "text/markdown; charset=utf-8")
+	}
+	w.Write([]byte(rendered))
+}
+
+// Transcript returns a copy of the messages exchanged so far.
+func (a *Agent) Transcript() []anthropic.MessageParam {
+	a.transcriptMu.Lock()
+	defer a.transcriptMu.Unlock()
+
+	return append([]anthropic.MessageParam{}, a.transcript...)
+}
+
+func (a *Agent) saveTranscript(messages []anthropic.MessageParam) {
+	a.transcriptMu.Lock()
+	defer a.transcriptMu.Unlock()
+
+	a.transcript = append([]anthropic.MessageParam{}, messages...)
+}
+
+func (a *Agent) Run(ctx context.Context) (string, error) {
+	takeInput := true
+	usage := newTaskUsage(a.clock)
+
+	messages := []anthropic.MessageParam{}
+	var session *session
+
+	// Query of the current turn, if its answer may be cached.
+	var query string
+
+	// Request of the current turn and the file changes made for it, for the critic.
+	var request string
+	var turnChanges []tools.FileChange
+	reviewRounds := 0
+
+	// Context of the current turn, carrying its request ID.
+	turnCtx := ctx
+
+	go a.evictIdleSessions(ctx)
+	a.warmUp()
+
+	anthropicTools := a.toolParams()
+
+	for {
+		if takeInput {
+			if session != nil {
+				a.sessions.release(session, messages, a.clock.Now())
+				if a.users != nil {
+					a.users.charge(a.user, usage.cost, a.clock.Now())
+					usage = newTaskUsage(a.clock)
+				}
+			}
+
+			input, err := a.readTurnInput()
+			if err != nil {
+				return "", err
+			}
+
+			requestID := a.currentRequestID()
+			turnCtx = tools.WithRequestID(ctx, requestID)
+			fmt.Printf("%s📨 Handling request %s%s\n", BlueColor, requestID, ResetColor)
+
+			user, err := a.currentUser()
+			if err != nil {
+				session = nil
+				a.writeError(http.StatusUnauthorized, err.Error())
+				continue
+			}
+			if a.users.overQuota(user, a.clock.Now()) {
+				session = nil
+				a.writeError(http.StatusTooManyRequests, a.text("quota_used_up", "%s's daily quota of $%.2f is used up", user.ID, user.DailyQuota))
+				continue
+			}
+			if a.users != nil {
+				a.activateUser(user)
+				anthropicTools = a.userToolParams(user)
+			}
+			a.beginStaging()
+
+			session = a.sessions.acquire(userSessionID(user, a.currentSession()), a.clock.Now())
+			messages = session.messages
+			a.beginReview(session)
+			turnCtx = withUser(withSession(tools.WithShells(tools.WithSeenFiles(turnCtx, session.seen), session.shells), session), user)
+			a.saveTranscript(messages)
+
+			// fmt.Println("Received input: ", input)
+
+			if format, ok := exportFormat(input); ok {
+				rendered, err := exportTranscript(messages, format, a.fs)
+				if err != nil {
+					a.writeError(http.StatusBadRequest, err.Error())
+					continue
+				}
+				a.writeOutput(rendered)
+				continue
+			}
+			if isCheckpointCommand(input) {
+				reply, restored, err := a.runCheckpointCommand(session.id, messages, input)
+				if err != nil {
+					a.writeError(http.StatusBadRequest, err.Error())
+					continue
+				}
+				if restored != nil {
+					// What the model read before is no longer what's on disk.
+					messages, session.seen = restored, tools.NewSeenFiles()
+					a.saveTranscript(messages)
+				}
+				a.writeOutput(reply)
+				continue
+			}
+
+			// Only the operator on the CLI attaches files, from the agent's filesystem.
+			var files tools.FS
+			if _, ok := a.current.(*CLITransport); ok {
+				files = a.fs
+			}
+			content, err := buildUserContent(input, files)
+			if err != nil {
+				a.writeError(http.StatusBadRequest, a.text("invalid_input", "Invalid input: %v", err))
+				continue
+			}
+
+			messages = append(messages, anthropic.NewUserMessage(content...))
+			if len(messages) == 1 && a.summaryEnabled {
+				messages = withUserNote(messages, a.workspaceSummary())
+			}
+			if note := reviewNote(session); note != "" {
+				messages = withUserNote(messages, note)
+			}
+			usage = newTaskUsage(a.clock)
+			turnCtx = withUsage(turnCtx, usage)
+			request, turnChanges, reviewRounds = input, nil, 0
+			a.emit(Event{Type: TurnStarted, Text: input})
+
+			// Only plain text queries opening a session are cached, not ones with
+			// images or follow-ups, whose answer depends on the conversation.
+			query = ""
+			if len(messages) == 1 && len(content) == 1 && content[0].OfText != nil {
+				query = content[0].OfText.Text
+			}
+			if answer, ok := a.cache.get(query, a.clock.Now()); ok {
+				fmt.Printf("%s⚡ Answering from cache%s\n", BlueColor, ResetColor)
+				messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(answer)))
+				a.saveTranscript(messages)
+
+				a.emit(Event{Type: TurnEnded, Text: answer, Cost: usage.spent()})
+				a.writeOutput(answer)
+				continue
+			}
+		} else if reason, exceeded := a.budget.exceeded(usage, a.clock); exceeded {
+			summary := a.summarizePartialProgress(turnCtx, messages, anthropicTools, reason)
+			messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(summary)))
+			a.saveTranscript(messages)
+
+			takeInput = true
+			a.taskStatus = budgetExceededStatus
+			a.emit(Event{Type: TurnEnded, Text: summary, Cost: usage.spent()})
+			a.writeOutput(summary)
+			continue
+		}
+
+		if note := a.externalChangesNote(); note != "" {
+			messages = withUserNote(messages, note)
+		}
+		messages = compactToolResults(messages)
+
+		// The hint only applies to this step, so it isn't kept in the history.
+		prompt := messages
+		if hint := a.contextHint(messages, anthropicTools); hint != "" {
+			prompt = withUserNote(messages, hint)
+		}
+		response, err := a.inferWithRetry(turnCtx, prompt, anthropicTools)
+		if err != nil {
+			if classifyError(ctx, err) == fatalError {
+				a.writeError(http.StatusServiceUnavailable, a.text("agent_stopped", "The agent stopped: %v", err))
+				return "", err
+			}
+
+			// Tell both the user and the model the turn failed, and wait for the next message.
+			notice := a.text("request_failed", "Sorry, I couldn't complete that request: %v", err)
+			messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(notice)))
+			a.saveTranscript(messages)
+
+			takeInput = true
+			a.emit(Event{Type: TurnEnded, Text: notice, Cost: usage.spent()})
+			a.writeError(http.StatusBadGateway, notice)
+			continue
+		}
+		usage.add(response.Model, response.Usage)
+
+		// An empty assistant message would be rejected on the next request.
+		if len(response.Content) == 0 {
+			notice := a.emptyResponseNotice(response.StopReason)
+			messages = append(messages, anthropic.NewAssistantMessage(anthropic.NewTextBlock(notice)))
+			a.saveTranscript(messages)
+
+			takeInput = true
+			a.emit(Event{Type: TurnEnded, Text: notice, Cost: usage.spent()})
+			a.writeOutput(notice)
+			continue
+		}
+
+		messages = append(messages, response.ToParam())
+		a.saveTranscript(messages)
+
+		toolResults := []anthropic.ContentBlockParamUnion{}
+
+		// fmt.Println("\tReceived response... ")
+
+		ch := make(chan anthropic.ContentBlockParamUnion)
+		toolCalls := []anthropic.ToolUseBlock{}
+
+		for _, content := range response.Content {
+			switch block := content.AsAny().(type) {
+			case anthropic.TextBlock:
+				// fmt.Printf("Text: %s\n", block.Text)
+				a.emit(Event{Type: AssistantText, Text: block.Text})
+			case anthropic.ToolUseBlock:
+				// fmt.Printf("Tool: %s\n", block.Name)
+				toolCalls = append(toolCalls, block)
+				a.emit(Event{Type: ToolCalled, ToolID: block.ID, ToolName: block.Name, ToolInput: block.Input})
+			}
+		}
+
+		// Identical calls in one response run once; see dedupeToolCalls.
+		toolCalls, duplicates := a.dedupeToolCalls(toolCalls)
+
+		// Each phase finishes before the next starts, see scheduleToolCalls.
+		for _, phase := range a.scheduleToolCalls(toolCalls) {
+			calls := 0
+			for _, group := range phase {
+				calls += len(group)
+				go func() {
+					for _, block := range group {
+						toolResult := a.ExecuteTool(turnCtx, block.ID, block.Name, block.Input)
+						a.emit(toolResultEvent(block.Name, toolResult))
+						ch <- toolResult
+					}
+				}()
+			}
+
+			for i := 0; i < calls; i++ {
+				toolResults = append(toolResults, <-ch)
+				fmt.Printf("%s📥 Received tool result %d%s\n", GreenColor, len(toolResults), ResetColor)
+			}
+		}
+
+		// Parallel calls finish in any order; deterministic runs keep the calls' order.
+		if a.sampling.Deterministic {
+			order := map[string]int{}
+			for i, block := range toolCalls {
+				order[block.ID] = i
+			}
+			slices.SortStableFunc(toolResults, func(x, y anthropic.ContentBlockParamUnion) int {
+				return order[x.OfToolResult.ToolUseID] - order[y.OfToolResult.ToolUseID]
+			})
+		}
+
+		changes := collectFileChanges(toolResults)
+		turnChanges = append(turnChanges, changes...)
+
+		// Compile errors go back with the results, so the model fixes them next.
+		// Staged edits aren't on disk for the compiler to see.
+		buildErrors := ""
+		if a.verifyBuild && a.staged == nil && len(changes) > 0 {
+			buildErrors = a.checkBuild(turnCtx, changes)
+		}
+		securityFindings := ""
+		if a.securityScan && len(changes) > 0 {
+			securityFindings = a.scanSecurity(turnCtx, changes)
+		}
+
+		// Duplicates get the same result, but their changes are only counted once.
+		if len(duplicates) > 0 {
+			resultFor := map[string]anthropic.ContentBlockParamUnion{}
+			for _, result := range toolResults {
+				if result.OfToolResult != nil {
+					resultFor[result.OfToolResult.ToolUseID] = result
+				}
+			}
+			for _, content := range response.Content {
+				block, ok := content.AsAny().(anthropic.ToolUseBlock)
+				if id, duplicate := duplicates[block.ID]; ok && duplicate {
+					shared := sharedToolResult(block.ID, resultFor[id])
+					a.emit(toolResultEvent(block.Name, shared))
+					toolResults = append(toolResults, shared)
+				}
+			}
+		}
+
+		if len(toolResults) == 0 {
+			text := responseText(response)
+			cacheable := text != "" && query != ""
+			if text == "" {
+				text = a.emptyResponseNotice(response.StopReason)
+			} else if response.StopReason == anthropic.StopReasonMaxTokens {
+				var truncated bool
+				text, truncated = a.continueTruncated(turnCtx, messages[:len(messages)-1], anthropicTools, text, usage)
+				if truncated {
+					cacheable = false
+					text += "\n\n" + a.text("response_truncated", "[Response truncated: the output token limit was reached. Ask me to continue for the rest.]")
+				}
+
+				// Keep the stitched answer in the history rather than the first piece.
+				messages[len(messages)-1] = anthropic.NewAssistantMessage(anthropic.NewTextBlock(text))
+				a.saveTranscript(messages)
+			}
+			if a.critic != nil && len(turnChanges) > 0 {
+				if findings, approved := a.review(turnCtx, request, turnChanges, usage); !approved {
+					// Hand the findings back to the model instead of answering.
+					if reviewRounds < a.critic.MaxRounds {
+						reviewRounds++
+						messages = append(messages, anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf(criticFeedback, findings))))
+						a.saveTranscript(messages)
+						continue
+					}
+					a.taskStatus = reviewFlaggedStatus
+					text += "\n\n" + a.text("review_flagged", "[A reviewer still flags these problems with the changes:\n%s]", findings)
+				}
+			}
+			if a.selfCheck {
+				if checked := a.checkAnswer(turnCtx, text, messages, usage); checked != text {
+					text = checked
+					messages[len(messages)-1] = anthropic.NewAssistantMessage(anthropic.NewTextBlock(text))
+					a.saveTranscript(messages)
+				}
+			}
+			if a.citeSources {
+				text = verifyCitations(text, messages)
+			}
+			if cacheable {
+				a.cache.put(query, text, a.clock.Now())
+			}
+
+			takeInput = true
+			a.emit(Event{Type: TurnEnded, Text: text, Cost: usage.spent()})
+			a.writeOutput(text)
+		} else {
+			takeInput = false
+			messages = append(messages, anthropic.NewUserMessage(toolResults...))
+			if buildErrors != "" {
+				messages = withUserNote(messages, fmt.Sprintf(buildErrorsNote, buildErrors))
+			}
+			if securityFindings != "" {
+				messages = withUserNote(messages, fmt.Sprintf(securityFindingsNote, securityFindings))
+			}
+			a.saveTranscript(messages)
+		}
+	}
+}
+
+// toolParams describes the registered tools to the model.
+func (a *Agent) toolParams() []anthropic.ToolUnionParam {
+	anthropicTools := []anthropic.ToolUnionParam{}
+
+	for _, tool := range a.tools.Definitions() {
+		tool = a.catalog.Tool(tool)
+		anthropicTools = append(anthropicTools, anthropic.ToolUnionParam{
+			OfTool: &anthropic.ToolParam{
+				Name: tool.Name,
+				Description: anthropic.String(tool.FullDescription()),
+				InputSchema: tool.InputSchema,
+			},
+		})
+	}
+
+	return anthropicTools
+}
+
+func (a *Agent) Infer(ctx context.Context, messages []anthropic.MessageParam, tools []anthropic.ToolUnionParam) (*anthropic.Message, error) {
+	fmt.Printf("%s🧠 Calling LLM for inference...%s\n", BlueColor, ResetColor)
+	params := a.messageParams(messages, tools)
+	response, err := a.provider.NewMessage(ctx, params)
+
+	if err != nil {
+		return nil, err
+	}
+	a.contextHints.calibrate(params, response.Usage)
+
+	return response, nil
+}
+
+func (a *Agent) messageParams(messages []anthropic.MessageParam, tools []anthropic.ToolUnionParam) anthropic.MessageNewParams {
+	params := anthropic.MessageNewParams{
+		MaxTokens: 1024,
+		// Model: anthropic.ModelClaude3_5Haiku20241022,
+		Model: anthropic.ModelClaudeSonnet4_20250514,
+		Messages: messages,
+		Tools: tools,
+	}
+
+	if prompt, ok := strategyPrompts[a.strategy]; ok {
+		params.System = append(params.System, anthropic.TextBlockParam{Text: prompt})
+	}
+	a.sampling.apply(&params)
+	if a.strategy == StrategySerial && len(tools) > 0 {
+		params.ToolChoice = anthropic.ToolChoiceUnionParam{OfAuto: &anthropic.ToolChoiceAutoParam{DisableParallelToolUse: anthropic.Bool(true)}}
+	}
+
+	for _, instruction := range a.instructions {
+		params.System = append(params.System, anthropic.TextBlockParam{Text: instruction})
+	}
+	if len(tools) > 0 && a.hasUntrustedTools() {
+		params.System = append(params.System, anthropic.TextBlockParam{Text: untrustedInstructions})
+	}
+	if instruction := a.localeInstruction(); instruction != "" {
+		params.System = append(params.System, anthropic.TextBlockParam{Text: instruction})
+	}
+	for _, note := range a.delegationNotes() {
+		params.System = append(params.System, anthropic.TextBlockParam{Text: note})
+	}
+
+	return params
+}
+
+func (a *Agent) ExecuteTool(ctx context.Context, toolID string, toolName string, toolInput json.RawMessage) anthropic.ContentBlockParamUnion {
+	fmt.Printf("%s🛠️  Executing tool: %s with input: %s%s\n", GreenColor, toolName, toolInput, ResetColor)
+
+	// TODO - remove this
+	a.clock.Sleep(1 * time.Second)
+
+	toolDef, toolFound := a.tools.Lookup(toolName)
+	if !toolFound {
+		fmt.Printf("%s❌ Tool not found: %s%s\n", RedColor, toolName, ResetColor)
+		return anthropic.NewToolResultBlock(toolID, "Tool not found", true)
+	}
+
+	// Users of a shared agent may only call the tools their role permits.
+	if user := userFrom(ctx); !user.allows(toolDef) {
+		fmt.Printf("%s🚫 %s may not call %s%s\n", GreenColor, user.ID, toolName, ResetColor)
+		a.audit(ctx, toolDef, toolInput, auditDenied, nil)
+		return anthropic.NewToolResultBlock(toolID, user.denial(toolDef), true)
+	}
+
+	err := tools.ValidateInput(toolDef.InputSchema, toolInput)
+	if err != nil {
+		fmt.Printf("%s❌ Invalid input for tool %s: %v%s\n", RedColor, toolName, err, ResetColor)
+		return anthropic.NewToolResultBlock(toolID, err.Error(), true)
+	}
+
+	fault := a.chaos.pick()
+	switch fault {
+	case chaosFailure:
+		fmt.Printf("%s🐒 Chaos: failing %s%s\n", GreenColor, toolName, ResetColor)
+		a.audit(ctx, toolDef, toolInput, auditError, fmt.Errorf("injected by chaos mode"))
+		return anthropic.NewToolResultBlock(toolID, fmt.Sprintf("%s failed: connection reset by peer", toolName), true)
+	case chaosSlow:
+		fmt.Printf("%s🐒 Chaos: delaying %s by %s%s\n", GreenColor, toolName, a.chaos.Delay, ResetColor)
+		a.clock.Sleep(a.chaos.Delay)
+	}
+
+	// Commands stream their output while they run, to the console and as events.
+	ctx = tools.WithOutputStream(ctx, func(text string) {
+		fmt.Print(indentOutput(text))
+		a.emit(Event{Type: ToolOutput, ToolID: toolID, ToolName: toolName, Text: text})
+	})
+	ctx = a.withGoFixes(ctx)
+
+	// This is the reason why our function takes in a json.RawMessage.
+	result, err := toolDef.Function(ctx, toolInput)
+	if err != nil {
+		fmt.Printf("%s❌ Error executing tool %s: %v%s\n", RedColor, toolName, err, ResetColor)
+		a.audit(ctx, toolDef, toolInput, auditError, err)
+		return anthropic.NewToolResultBlock(toolID, err.Error(), true)
+	}
+	a.audit(ctx, toolDef, toolInput, auditOK, nil)
+
+	if fault == chaosMalformed {
+		fmt.Printf("%s🐒 Chaos: garbling the result of %s%s\n", GreenColor, toolName, ResetColor)
+		result = a.chaos.garble(result)
+	}
+	result = a.markUntrusted(toolDef, result)
+
+	// fmt.Printf("%s✅ Tool result for %s: %s%s\n", GreenColor, toolName, result, ResetColor)
+	return anthropic.NewToolResultBlock(toolID, result, false)
+}
@@ -0,0 +1,40 @@
+package agent
+
+import (
+	"os"
+	"testing"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// TestRecordsFor checks the file tools keep their records for the same files
+// when the agent switches filesystems.
+func TestRecordsFor(t *testing.T) {
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	memory := tools.NewMemFS(nil)
+	a := &Agent{}
+
+	same := []struct {
+		name string
+		a, b tools.FS
+	}{
+		{"relative and absolute root", tools.OSFS{}, tools.OSFS{Root: dir}},
+		{"staging overlay", tools.OSFS{Root: dir}, tools.NewOverlayFS(tools.OSFS{Root: "."})},
+		{"read-only", memory, tools.ReadOnlyFS{FS: memory}},
+	}
+	for _, test := range same {
+		if a.recordsFor(test.a) != a.recordsFor(test.b) {
+			t.Errorf("%s: got different records", test.name)
+		}
+	}
+
+	if a.recordsFor(tools.OSFS{Root: t.TempDir()}) == a.recordsFor(tools.OSFS{Root: dir}) {
+		t.Error("different roots share records")
+	}
+	if a.recordsFor(tools.NewMemFS(nil)) == a.recordsFor(memory) {
+		t.Error("different in-memory filesystems share records")
+	}
+}
@@ -0,0 +1,62 @@
+package agent
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// Status reported to HTTP clients when the agent is waiting on an answer to a question.
+const awaitingInputStatus = "awaiting_input"
+
+// AskUser tool for requesting clarification from the human mid-turn
+type AskUserInput struct {
+	Question string `json:"question" jsonschema:"minLength=1" jsonschema_description:"The question to ask the user."`
+}
+
+var AskUserInputSchema = tools.GenerateSchema[AskUserInput]()
+
+// askUserDefinition is bound to the agent, since answering needs the agent's input and output.
+func (a *Agent) askUserDefinition() tools.ToolDefinition {
+	return tools.ToolDefinition{
+		Name:        "ask_user",
+		Description: "Ask the user a clarifying question and wait for their answer. Use this when the request is ambiguous and guessing would likely waste work.",
+		InputSchema: AskUserInputSchema,
+		Function:    a.AskUser,
+		Category:    tools.CategoryRead,
+	}
+}
+
+func (a *Agent) AskUser(ctx context.Context, input json.RawMessage) (string, error) {
+	askUserInput := AskUserInput{}
+
+	err := json.Unmarshal(input, &askUserInput)
+	if err != nil {
+		return "", err
+	}
+
+	// Parallel tool calls may both ask; the user answers one question at a time.
+	a.askMu.Lock()
+	defer a.askMu.Unlock()
+
+	// Over HTTP the question is the response to the current request, and the answer must
+	// come back in a new request carrying the X-Agent-Continuation header.
+	answer, err := a.askForInput(ctx, askUserInput.Question)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("User answered: %s", answer), nil
+}
+
+func newContinuationToken() (string, error) {
+	bytes := make([]byte, 16)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
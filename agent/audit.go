@@ -0,0 +1,179 @@
+package agent
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// Outcomes of an audited tool call.
+const (
+	auditOK     = "ok"
+	auditError  = "error"
+	auditDenied = "denied"
+)
+
+// AuditEntry records one call of a tool that writes or executes something: file
+// writes, commands, outbound requests and database changes.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user,omitempty"`
+	Session   string    `json:"session,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+	Tool      string    `json:"tool"`
+	Category  string    `json:"category"`
+	// SHA-256 of the tool's JSON input; inputs can hold file contents or secrets,
+	// so they aren't logged themselves.
+	InputSHA256 string `json:"input_sha256"`
+	Status      string `json:"status"`
+	Error       string `json:"error,omitempty"`
+}
+
+// AuditLog appends entries to a JSON Lines file that is never rewritten.
+type AuditLog struct {
+	path string
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenAuditLog opens, creating if needed, the audit log at path for appending.
+func OpenAuditLog(path string) (*AuditLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{path: path, file: file}, nil
+}
+
+// Record appends an entry and syncs it to disk.
+func (l *AuditLog) Record(entry AuditEntry) error {
+	if l == nil {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return l.file.Sync()
+}
+
+// Export writes the entries recorded at or after since, and by user if set, as JSON Lines.
+func (l *AuditLog) Export(w io.Writer, user string, since time.Time) error {
+	file, err := os.Open(l.path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		if entry.Time.Before(since) || (user != "" && entry.User != user) {
+			continue
+		}
+		if _, err := fmt.Fprintf(w, "%s\n", scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func (l *AuditLog) Close() error {
+	return l.file.Close()
+}
+
+// SetAuditLog records every call of a write or execute tool to log. Call before Start.
+func (a *Agent) SetAuditLog(log *AuditLog) {
+	a.auditLog = log
+}
+
+// audit records a tool call if the tool can change something or contacts other
+// hosts. A call that can't be recorded is logged loudly but not failed: the
+// action has already happened.
+func (a *Agent) audit(ctx context.Context, tool tools.ToolDefinition, input json.RawMessage, status string, err error) {
+	if a.auditLog == nil || (tool.Category == tools.CategoryRead && !tool.Network) {
+		return
+	}
+
+	category := tool.Category
+	if category == "" {
+		category = tools.CategoryExecute
+	}
+	hash := sha256.Sum256(input)
+	entry := AuditEntry{
+		Time:        a.clock.Now().UTC(),
+		RequestID:   tools.RequestID(ctx),
+		Tool:        tool.Name,
+		Category:    string(category),
+		InputSHA256: hex.EncodeToString(hash[:]),
+		Status:      status,
+	}
+	if user := userFrom(ctx); user != nil {
+		entry.User = user.ID
+	}
+	if current, sessionErr := sessionFrom(ctx); sessionErr == nil {
+		entry.Session = current.id
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if recordErr := a.auditLog.Record(entry); recordErr != nil {
+		fmt.Printf("%s❌ Failed to write audit log entry for %s: %v%s\n", RedColor, tool.Name, recordErr, ResetColor)
+	}
+}
+
+// handleAudit exports the audit log as JSON Lines, e.g.
+// GET /coder/audit?since=2025-09-01T00:00:00Z&user=alice
+// Users of a shared agent need the admin role.
+func (a *Agent) handleAudit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := a.requestUser(w, r)
+	if !ok {
+		return
+	}
+	if user != nil && user.Role != RoleAdmin {
+		http.Error(w, "the audit log is only available to admins", http.StatusForbidden)
+		return
+	}
+
+	var since time.Time
+	if value := r.URL.Query().Get("since"); value != "" {
+		parsed, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid since: %v", err), http.StatusBadRequest)
+			return
+		}
+		since = parsed
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	if err := a.auditLog.Export(w, r.URL.Query().Get("user"), since); err != nil {
+		fmt.Printf("Failed to export audit log: %v\n", err)
+	}
+}
@@ -0,0 +1,165 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/providers"
+	"github.com/kartikx/agent/tools"
+)
+
+// Most queries accepted in one batch request.
+const maxBatchQueries = 20
+
+// Queries of a batch answered at the same time.
+const batchConcurrency = 5
+
+// Model round trips allowed while answering a single query.
+const maxAnswerSteps = 10
+
+// BatchRequest is the body of POST /<agent>/batch.
+type BatchRequest struct {
+	Queries []string `json:"queries"`
+}
+
+// BatchResponse maps each query to its answer, or to the error answering it.
+type BatchResponse struct {
+	Results map[string]string `json:"results"`
+	Errors  map[string]string `json:"errors,omitempty"`
+}
+
+// Answer handles query as a standalone turn, without the conversation history
+// or any transport, so several queries can be answered in parallel.
+func (a *Agent) Answer(ctx context.Context, query string) (string, error) {
+	if answer, ok := a.cache.get(query, a.clock.Now()); ok {
+		return answer, nil
+	}
+
+	messages := []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(query))}
+
+	// Nobody can answer a clarifying question here, and there is no session to keep notes in.
+	conversationOnly := map[string]bool{"ask_user": true, "save_note": true, "read_notes": true}
+	anthropicTools := []anthropic.ToolUnionParam{}
+	// Batch queries run alongside other users' turns, so they can't touch the active workspace.
+	user := userFrom(ctx)
+	shared := a.users != nil
+	for _, tool := range a.toolParams() {
+		name := tool.OfTool.Name
+		definition, _ := a.tools.Lookup(name)
+		if !conversationOnly[name] && user.allows(definition) && !(shared && workspaceTool(name)) {
+			anthropicTools = append(anthropicTools, tool)
+		}
+	}
+
+	for step := 0; step < maxAnswerSteps; step++ {
+		response, err := a.inferWithRetry(ctx, messages, anthropicTools)
+		if err != nil {
+			return "", err
+		}
+		if shared {
+			a.users.charge(user, providers.Cost(response.Model, response.Usage), a.clock.Now())
+		}
+		if len(response.Content) == 0 {
+			return "", fmt.Errorf("%s", a.emptyResponseNotice(response.StopReason))
+		}
+		messages = append(messages, response.ToParam())
+
+		toolResults := []anthropic.ContentBlockParamUnion{}
+		for _, content := range response.Content {
+			if block, ok := content.AsAny().(anthropic.ToolUseBlock); ok {
+				toolResults = append(toolResults, a.ExecuteTool(ctx, block.ID, block.Name, block.Input))
+			}
+		}
+
+		if len(toolResults) == 0 {
+			answer := responseText(response)
+			if a.selfCheck {
+				answer = a.checkAnswer(ctx, answer, messages, nil)
+			}
+			if a.citeSources {
+				answer = verifyCitations(answer, messages)
+			}
+			if answer != "" && response.StopReason != anthropic.StopReasonMaxTokens {
+				a.cache.put(query, answer, a.clock.Now())
+			}
+			return answer, nil
+		}
+		messages = append(messages, anthropic.NewUserMessage(toolResults...))
+	}
+
+	return "", fmt.Errorf("no answer after %d steps", maxAnswerSteps)
+}
+
+// handleBatch answers several independent queries in parallel, e.g.
+// POST /doc/batch {"queries": ["net/http timeouts", "sync.OnceValue"]}
+func (a *Agent) handleBatch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var request BatchRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		http.Error(w, fmt.Sprintf("invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	if len(request.Queries) == 0 || len(request.Queries) > maxBatchQueries {
+		http.Error(w, fmt.Sprintf("queries must contain between 1 and %d entries", maxBatchQueries), http.StatusBadRequest)
+		return
+	}
+
+	user, ok := a.requestUser(w, r)
+	if !ok {
+		return
+	}
+	if a.users.overQuota(user, a.clock.Now()) {
+		http.Error(w, fmt.Sprintf("%s's daily quota of $%.2f is used up", user.ID, user.DailyQuota), http.StatusTooManyRequests)
+		return
+	}
+
+	ctx := withUser(r.Context(), user)
+	if requestID := r.Header.Get("X-Request-ID"); requestID != "" {
+		ctx = tools.WithRequestID(ctx, requestID)
+	}
+
+	fmt.Printf("%s📦 Answering batch of %d queries%s\n", BlueColor, len(request.Queries), ResetColor)
+
+	response := BatchResponse{Results: map[string]string{}, Errors: map[string]string{}}
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, batchConcurrency)
+
+	seen := map[string]bool{}
+	for _, query := range request.Queries {
+		if seen[query] {
+			continue
+		}
+		seen[query] = true
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			answer, err := a.Answer(ctx, query)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				response.Errors[query] = err.Error()
+				return
+			}
+			response.Results[query] = answer
+		}()
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Agent-Capabilities", a.capabilitiesVersion)
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,126 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/providers"
+)
+
+// Status reported to HTTP clients when a task ran out of budget.
+const budgetExceededStatus = "budget_exceeded"
+
+// Budget is the hard limit applied to every task (one user request until the final answer).
+// Zero values mean unlimited.
+type Budget struct {
+	MaxCost     float64
+	MaxDuration time.Duration
+}
+
+// budgetFromEnv reads TASK_MAX_COST_USD (e.g. "0.50") and TASK_MAX_DURATION (e.g. "5m").
+func budgetFromEnv() Budget {
+	budget := Budget{}
+
+	if value := os.Getenv("TASK_MAX_COST_USD"); value != "" {
+		cost, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			fmt.Printf("Invalid TASK_MAX_COST_USD %q, ignoring: %v\n", value, err)
+		} else {
+			budget.MaxCost = cost
+		}
+	}
+
+	if value := os.Getenv("TASK_MAX_DURATION"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			fmt.Printf("Invalid TASK_MAX_DURATION %q, ignoring: %v\n", value, err)
+		} else {
+			budget.MaxDuration = duration
+		}
+	}
+
+	return budget
+}
+
+// SetBudget sets the limits of each task, replacing TASK_MAX_COST_USD and TASK_MAX_DURATION.
+func (a *Agent) SetBudget(budget Budget) {
+	a.budget = budget
+}
+
+// taskUsage tracks what the current task has spent so far.
+type taskUsage struct {
+	start time.Time
+
+	// Tools making model calls of their own add to cost concurrently.
+	mu   sync.Mutex
+	cost float64
+}
+
+func newTaskUsage(clock Clock) *taskUsage {
+	return &taskUsage{start: clock.Now()}
+}
+
+// add records the cost of a model response.
+func (u *taskUsage) add(model anthropic.Model, usage anthropic.Usage) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.cost += providers.Cost(model, usage)
+}
+
+// spent returns the cost of the task so far.
+func (u *taskUsage) spent() float64 {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.cost
+}
+
+type usageKey struct{}
+
+// withUsage returns a context carrying the usage of the current task, so tools
+// making model calls count towards its budget.
+func withUsage(ctx context.Context, usage *taskUsage) context.Context {
+	return context.WithValue(ctx, usageKey{}, usage)
+}
+
+func usageFrom(ctx context.Context) *taskUsage {
+	usage, _ := ctx.Value(usageKey{}).(*taskUsage)
+	return usage
+}
+
+// exceeded reports whether the task is over budget, and why.
+func (b Budget) exceeded(u *taskUsage, clock Clock) (string, bool) {
+	if b.MaxCost > 0 && u.cost >= b.MaxCost {
+		return fmt.Sprintf("spent $%.4f of $%.4f", u.cost, b.MaxCost), true
+	}
+	elapsed := clock.Now().Sub(u.start)
+	if b.MaxDuration > 0 && elapsed >= b.MaxDuration {
+		return fmt.Sprintf("ran for %s of %s", elapsed.Round(time.Second), b.MaxDuration), true
+	}
+	return "", false
+}
+
+// summarizePartialProgress asks the model, with tools disabled, to wrap up what it has done so far.
+func (a *Agent) summarizePartialProgress(ctx context.Context, messages []anthropic.MessageParam, tools []anthropic.ToolUnionParam, reason string) string {
+	// The last message is the user turn carrying tool results, so the instruction is added to it.
+	messages = withUserNote(messages, fmt.Sprintf("The task budget has been exceeded (%s). Stop working now. Summarize what you have done so far, what is left, and any changes made.", reason))
+
+	params := a.messageParams(messages, tools)
+	params.ToolChoice = anthropic.ToolChoiceUnionParam{OfNone: &anthropic.ToolChoiceNoneParam{}}
+
+	fmt.Printf("%s💸 Budget exceeded (%s), summarizing...%s\n", BlueColor, reason, ResetColor)
+	response, err := a.provider.NewMessage(ctx, params)
+	if err != nil {
+		return a.text("budget_exceeded", "Budget exceeded (%s).", reason) + " " + a.text("budget_summary_failed", "Failed to summarize progress: %v", err)
+	}
+
+	summary := responseText(response)
+	if summary == "" {
+		return a.text("budget_exceeded", "Budget exceeded (%s).", reason) + " " + a.emptyResponseNotice(response.StopReason)
+	}
+	return a.text("budget_exceeded", "Budget exceeded (%s).", reason) + "\n\n" + summary
+}
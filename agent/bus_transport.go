@@ -0,0 +1,107 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/kartikx/agent/bus"
+)
+
+// How long sending a reply on the bus may take.
+const busReplyTimeout = 10 * time.Second
+
+// Delay before reading again after the bus failed.
+const busRetryDelay = time.Second
+
+// BusTransport serves requests queued on the agent's Redis stream, agents:<name>.
+// Replicas of an agent share the stream as a work queue, and requests queued
+// while no replica is running are served once one starts.
+type BusTransport struct {
+	consumer *bus.Consumer
+	ctx      context.Context
+	cancel   context.CancelFunc
+
+	// Requests read but not answered yet, oldest first; replies are in order.
+	mu      sync.Mutex
+	pending []bus.Request
+}
+
+// NewBusTransport joins the stream of the agent called name on the Redis server
+// at url, e.g. redis://redis:6379.
+func NewBusTransport(url, name string) (*BusTransport, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Each replica is its own consumer; the hostname is the pod name in Kubernetes.
+	consumerName, _ := os.Hostname()
+	consumer, err := bus.NewConsumer(ctx, url, bus.Stream(name), name, fmt.Sprintf("%s-%d", consumerName, os.Getpid()))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &BusTransport{consumer: consumer, ctx: ctx, cancel: cancel}, nil
+}
+
+func (t *BusTransport) Read() (string, error) {
+	request, err := t.consumer.Next(t.ctx)
+	if errors.Is(err, context.Canceled) {
+		return "", io.EOF
+	}
+	if err != nil {
+		// Don't retry in a busy loop while Redis is unreachable.
+		select {
+		case <-time.After(busRetryDelay):
+		case <-t.ctx.Done():
+		}
+		return "", err
+	}
+
+	t.mu.Lock()
+	t.pending = append(t.pending, request)
+	t.mu.Unlock()
+	return request.Body, nil
+}
+
+func (t *BusTransport) Write(message string) error {
+	return t.reply(message, "")
+}
+
+// WriteError answers the current request with an error, e.g. a failed turn.
+func (t *BusTransport) WriteError(status int, message string) error {
+	return t.reply("", fmt.Sprintf("status %d: %s", status, message))
+}
+
+func (t *BusTransport) reply(message string, errMessage string) error {
+	t.mu.Lock()
+	if len(t.pending) == 0 {
+		t.mu.Unlock()
+		return fmt.Errorf("no bus request to reply to")
+	}
+	request := t.pending[0]
+	t.pending = t.pending[1:]
+	t.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), busReplyTimeout)
+	defer cancel()
+	return t.consumer.Reply(ctx, request, message, errMessage)
+}
+
+// RequestID returns the request ID of the request being answered.
+func (t *BusTransport) RequestID() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.pending) == 0 {
+		return ""
+	}
+	return t.pending[0].RequestID
+}
+
+func (t *BusTransport) Close() error {
+	t.cancel()
+	return t.consumer.Close()
+}
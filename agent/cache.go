@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ResponseCache remembers answers to queries for a while, so repeated questions
+// (e.g. the coder agent asking the doc agent the same thing across turns) skip the model.
+type ResponseCache struct {
+	TTL time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedResponse
+	hits    int
+	misses  int
+}
+
+type cachedResponse struct {
+	answer  string
+	expires time.Time
+}
+
+func NewResponseCache(ttl time.Duration) *ResponseCache {
+	return &ResponseCache{TTL: ttl, entries: map[string]cachedResponse{}}
+}
+
+// responseCacheFromEnv reads DOC_CACHE_TTL (e.g. "30m", default 10m). A TTL of 0
+// disables caching.
+func responseCacheFromEnv() *ResponseCache {
+	ttl := 10 * time.Minute
+	if value := os.Getenv("DOC_CACHE_TTL"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			fmt.Printf("Invalid DOC_CACHE_TTL %q, ignoring: %v\n", value, err)
+		} else {
+			ttl = duration
+		}
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	return NewResponseCache(ttl)
+}
+
+// SetResponseCache makes the agent answer repeated queries from cache; nil disables it.
+func (a *Agent) SetResponseCache(cache *ResponseCache) {
+	a.cache = cache
+}
+
+// cacheKey normalizes a query so that ones differing only in case, spacing or
+// trailing punctuation share an answer.
+func cacheKey(query string) string {
+	query = strings.Join(strings.Fields(strings.ToLower(query)), " ")
+	return strings.TrimRightFunc(query, func(r rune) bool { return unicode.IsPunct(r) || unicode.IsSpace(r) })
+}
+
+// get returns the unexpired answer cached for query, if any.
+func (c *ResponseCache) get(query string, now time.Time) (string, bool) {
+	if c == nil || query == "" {
+		return "", false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := cacheKey(query)
+	entry, ok := c.entries[key]
+	if ok && now.Before(entry.expires) {
+		c.hits++
+		return entry.answer, true
+	}
+	if ok {
+		delete(c.entries, key)
+	}
+	c.misses++
+	return "", false
+}
+
+// put caches the answer to query, dropping expired entries.
+func (c *ResponseCache) put(query string, answer string, now time.Time) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, entry := range c.entries {
+		if !now.Before(entry.expires) {
+			delete(c.entries, key)
+		}
+	}
+	c.entries[cacheKey(query)] = cachedResponse{answer: answer, expires: now.Add(c.TTL)}
+}
+
+// CacheMetrics counts cache lookups.
+type CacheMetrics struct {
+	Entries int
+	Hits    int
+	Misses  int
+}
+
+func (c *ResponseCache) Metrics() CacheMetrics {
+	if c == nil {
+		return CacheMetrics{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return CacheMetrics{Entries: len(c.entries), Hits: c.hits, Misses: c.misses}
+}
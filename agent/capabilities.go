@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// Capabilities describes the agent to agents delegating to it: its model, its
+// tools and the limits applied to each request.
+func (a *Agent) Capabilities() tools.Capabilities {
+	params := a.messageParams(nil, nil)
+	manifest := tools.Capabilities{
+		Agent: a.name,
+		Model: string(params.Model),
+		Tools: []tools.ToolCapability{},
+		Limits: tools.CapabilityLimits{
+			MaxOutputTokens: params.MaxTokens,
+			MaxBatchQueries: maxBatchQueries,
+			MaxTaskCostUSD:  a.budget.MaxCost,
+		},
+	}
+	if a.budget.MaxDuration > 0 {
+		manifest.Limits.MaxTaskDuration = a.budget.MaxDuration.String()
+	}
+
+	// Conversation tools only matter to the model, not to callers.
+	internal := map[string]bool{"ask_user": true, "save_note": true, "read_notes": true, "current_time": true, "ask_consensus": true}
+	for _, definition := range a.tools.Definitions() {
+		if internal[definition.Name] {
+			continue
+		}
+		category := definition.Category
+		if category == "" {
+			category = tools.CategoryExecute
+		}
+		manifest.Tools = append(manifest.Tools, tools.ToolCapability{Name: definition.Name, Description: definition.Description, Category: category})
+	}
+	return manifest
+}
+
+// handleCapabilities serves the agent's capability manifest, e.g. GET /doc/capabilities
+func (a *Agent) handleCapabilities(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a.Capabilities())
+}
+
+// delegationNotes describes the agents this one delegates to, for its system
+// prompt, once their manifests have been fetched.
+func (a *Agent) delegationNotes() []string {
+	const tool = "invoke_documentation_agent"
+	if _, ok := a.tools.Lookup(tool); !ok {
+		return nil
+	}
+	manifest, ok := tools.DocAgentCapabilities()
+	if !ok {
+		return nil
+	}
+	return []string{manifest.PromptNote(tool)}
+}
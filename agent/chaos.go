@@ -0,0 +1,117 @@
+package agent
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of fault injected into tool calls in chaos mode.
+const (
+	chaosFailure   = "failure"
+	chaosSlow      = "slow"
+	chaosMalformed = "malformed"
+)
+
+// Chaos injects faults into tool calls at random, so the agent's error recovery can
+// be exercised and demoed deliberately. A nil Chaos injects nothing.
+type Chaos struct {
+	// Fraction of tool calls hit by a fault, from 0 to 1.
+	Rate float64
+	// Faults to choose from: "failure" (the call errors without running), "slow"
+	// (the call is delayed by Delay) and "malformed" (the result is cut off and garbled).
+	Faults []string
+	Delay  time.Duration
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewChaos creates a fault injector; the same seed injects the same faults.
+func NewChaos(rate float64, faults []string, delay time.Duration, seed int64) *Chaos {
+	return &Chaos{Rate: rate, Faults: faults, Delay: delay, rand: rand.New(rand.NewSource(seed))}
+}
+
+// chaosFromEnv reads CHAOS_RATE (e.g. "0.2", default off), CHAOS_FAULTS (default
+// all), CHAOS_DELAY (default 10s) and CHAOS_SEED (default random).
+func chaosFromEnv() *Chaos {
+	value := os.Getenv("CHAOS_RATE")
+	if value == "" {
+		return nil
+	}
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate < 0 || rate > 1 {
+		fmt.Printf("Invalid CHAOS_RATE %q, chaos mode disabled: must be between 0 and 1\n", value)
+		return nil
+	}
+
+	faults := []string{chaosFailure, chaosSlow, chaosMalformed}
+	if value := os.Getenv("CHAOS_FAULTS"); value != "" {
+		faults = nil
+		for _, fault := range strings.Split(value, ",") {
+			switch fault = strings.TrimSpace(fault); fault {
+			case chaosFailure, chaosSlow, chaosMalformed:
+				faults = append(faults, fault)
+			default:
+				fmt.Printf("Unknown chaos fault %q, ignoring\n", fault)
+			}
+		}
+	}
+
+	delay := 10 * time.Second
+	if value := os.Getenv("CHAOS_DELAY"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			fmt.Printf("Invalid CHAOS_DELAY %q, ignoring: %v\n", value, err)
+		} else {
+			delay = duration
+		}
+	}
+
+	seed := time.Now().UnixNano()
+	if value := os.Getenv("CHAOS_SEED"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			fmt.Printf("Invalid CHAOS_SEED %q, ignoring: %v\n", value, err)
+		} else {
+			seed = parsed
+		}
+	}
+
+	fmt.Printf("Chaos mode: %.0f%% of tool calls get one of %s\n", rate*100, strings.Join(faults, ", "))
+	return NewChaos(rate, faults, delay, seed)
+}
+
+// SetChaos enables fault injection into tool calls; nil disables it.
+func (a *Agent) SetChaos(chaos *Chaos) {
+	a.chaos = chaos
+}
+
+// pick decides which fault, if any, to inject into the next tool call.
+func (c *Chaos) pick() string {
+	if c == nil || len(c.Faults) == 0 {
+		return ""
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rand.Float64() >= c.Rate {
+		return ""
+	}
+	return c.Faults[c.rand.Intn(len(c.Faults))]
+}
+
+// garble cuts a result off at a random point and appends bytes no tool would produce.
+func (c *Chaos) garble(result string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(result) > 0 {
+		result = strings.ToValidUTF8(result[:c.rand.Intn(len(result))], "")
+	}
+	return result + "��{\"status\": \x00"
+}
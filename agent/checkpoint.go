@@ -0,0 +1,371 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/tools"
+)
+
+// Prefixes of the commands managing checkpoints, e.g. "/checkpoint before-refactor".
+const (
+	checkpointCommand  = "/checkpoint"
+	checkpointsCommand = "/checkpoints"
+	restoreCommand     = "/restore"
+)
+
+const (
+	// Files larger than this aren't saved in checkpoints, and are left alone on restore.
+	maxCheckpointFileSize = 1 << 20
+	// Most files saved in one checkpoint.
+	maxCheckpointFiles = 20_000
+)
+
+// Directories never saved in checkpoints.
+var checkpointSkipped = map[string]bool{".git": true, "node_modules": true}
+
+var checkpointName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// Checkpoints saves named snapshots of a session's messages together with the
+// workspace's files, which can be restored together as a coarse undo.
+type Checkpoints struct {
+	// Where checkpoints are saved, by workspace and session; file contents are
+	// shared between checkpoints.
+	Dir string
+	// If set, checkpoints are encrypted with it.
+	Sealer *Sealer
+}
+
+// checkpoint is a saved checkpoint.
+type checkpoint struct {
+	Name     string                   `json:"name"`
+	Created  time.Time                `json:"created"`
+	Messages []anthropic.MessageParam `json:"messages"`
+	// SHA-256 of each file's content, by path.
+	Files map[string]string `json:"files"`
+	// Files too large to save, left alone on restore.
+	Skipped []string `json:"skipped,omitempty"`
+}
+
+// checkpointsFromEnv reads CHECKPOINT_DIR (default: the user's cache directory,
+// "off" to disable checkpoints).
+func checkpointsFromEnv() *Checkpoints {
+	checkpoints := &Checkpoints{Dir: os.Getenv("CHECKPOINT_DIR")}
+	if checkpoints.Dir == "off" {
+		return nil
+	}
+	if checkpoints.Dir == "" {
+		dir, err := os.UserCacheDir()
+		if err != nil {
+			return nil
+		}
+		checkpoints.Dir = filepath.Join(dir, "agent", "checkpoints")
+	}
+	return checkpoints
+}
+
+// SetCheckpoints sets where checkpoints are saved; nil disables them.
+func (a *Agent) SetCheckpoints(checkpoints *Checkpoints) {
+	a.checkpoints = checkpoints
+	a.shareSealer()
+}
+
+// isCheckpointCommand reports whether input is one of the checkpoint commands.
+func isCheckpointCommand(input string) bool {
+	command, _, _ := strings.Cut(strings.TrimSpace(input), " ")
+	return command == checkpointCommand || command == checkpointsCommand || command == restoreCommand
+}
+
+// runCheckpointCommand runs a checkpoint command in the current session,
+// returning the reply and, after a restore, the messages the session goes back to.
+func (a *Agent) runCheckpointCommand(sessionID string, messages []anthropic.MessageParam, input string) (string, []anthropic.MessageParam, error) {
+	if a.checkpoints == nil {
+		return "", nil, errors.New("checkpoints are disabled")
+	}
+	command, name, _ := strings.Cut(strings.TrimSpace(input), " ")
+	name = strings.TrimSpace(name)
+	dir := a.checkpoints.sessionDir(repoKey(a.fs), sessionID)
+
+	switch command {
+	case checkpointsCommand:
+		return a.checkpoints.list(dir), nil, nil
+
+	case checkpointCommand:
+		if !checkpointName.MatchString(name) {
+			return "", nil, fmt.Errorf("name the checkpoint with letters, digits, '.', '_' and '-', e.g. %s before-refactor", checkpointCommand)
+		}
+		saved, err := a.checkpoints.save(dir, name, messages, a.fs)
+		if err != nil {
+			return "", nil, err
+		}
+		reply := fmt.Sprintf("Saved checkpoint %s: %d messages and %d files.", name, len(saved.Messages), len(saved.Files))
+		if len(saved.Skipped) > 0 {
+			reply += fmt.Sprintf(" %d files over 1MB weren't saved: %s.", len(saved.Skipped), strings.Join(saved.Skipped, ", "))
+		}
+		return reply, nil, nil
+
+	default:
+		if !checkpointName.MatchString(name) {
+			return "", nil, fmt.Errorf("name the checkpoint to restore, e.g. %s before-refactor", restoreCommand)
+		}
+		restored, summary, err := a.checkpoints.restore(dir, name, messages, a.fs)
+		if err != nil {
+			return "", nil, err
+		}
+		return summary, restored, nil
+	}
+}
+
+func (c *Checkpoints) sessionDir(workspace string, sessionID string) string {
+	sum := sha256.Sum256([]byte(workspace))
+	session := sha256.Sum256([]byte(sessionID))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:8]), hex.EncodeToString(session[:8]))
+}
+
+// checkpointRecord names a checkpoint when sealing it, so it can't be moved to another session.
+func checkpointRecord(dir string, name string) string {
+	return filepath.Base(dir) + "/" + name
+}
+
+func (c *Checkpoints) blobPath(hash string) string {
+	return filepath.Join(c.Dir, "blobs", hash[:2], hash)
+}
+
+// snapshot reads the workspace's files, by path, and lists those too large to save.
+func snapshot(fsys tools.FS) (map[string][]byte, []string, error) {
+	fsys = tools.NewIgnoreFS(fsys)
+	files := map[string][]byte{}
+	var skipped []string
+	var walk func(dir string) error
+	walk = func(dir string) error {
+		entries, err := fsys.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			name := path.Join(dir, entry.Name())
+			switch {
+			case entry.IsDir():
+				if checkpointSkipped[entry.Name()] || dir == "." && entry.Name() == ".agent" {
+					continue
+				}
+				if err := walk(name); err != nil {
+					return err
+				}
+			case !entry.Type().IsRegular():
+			default:
+				if info, err := entry.Info(); err == nil && info.Size() > maxCheckpointFileSize {
+					skipped = append(skipped, name)
+					continue
+				}
+				if len(files) >= maxCheckpointFiles {
+					return fmt.Errorf("the workspace has more than %d files, too many to checkpoint", maxCheckpointFiles)
+				}
+				data, err := fsys.ReadFile(name)
+				if err != nil {
+					return err
+				}
+				files[name] = data
+			}
+		}
+		return nil
+	}
+	if err := walk("."); err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(skipped)
+	return files, skipped, nil
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// save snapshots messages and the workspace as checkpoint name, replacing one
+// of the same name.
+func (c *Checkpoints) save(dir string, name string, messages []anthropic.MessageParam, fsys tools.FS) (*checkpoint, error) {
+	files, skipped, err := snapshot(fsys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the workspace: %v", err)
+	}
+
+	saved := &checkpoint{Name: name, Created: time.Now().UTC(), Messages: messages, Files: map[string]string{}, Skipped: skipped}
+	for file, data := range files {
+		hash := contentHash(data)
+		saved.Files[file] = hash
+		// Contents are stored once, however many checkpoints have them.
+		blob := c.blobPath(hash)
+		if _, err := os.Stat(blob); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(blob), 0o700); err != nil {
+			return nil, err
+		}
+		if err := tools.WriteFileAtomic(blob, c.Sealer.Seal(data, hash), 0o600); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(saved)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	if err := tools.WriteFileAtomic(filepath.Join(dir, name+".json"), c.Sealer.Seal(data, checkpointRecord(dir, name)), 0o600); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+func (c *Checkpoints) load(dir string, name string) (*checkpoint, error) {
+	data, err := os.ReadFile(filepath.Join(dir, name+".json"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("there's no checkpoint %s; list them with %s", name, checkpointsCommand)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if data, err = c.Sealer.Open(data, checkpointRecord(dir, name)); err != nil {
+		return nil, fmt.Errorf("checkpoint %s: %v", name, err)
+	}
+	var loaded checkpoint
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("checkpoint %s is corrupted: %v", name, err)
+	}
+	return &loaded, nil
+}
+
+// list describes the session's checkpoints, oldest first.
+func (c *Checkpoints) list(dir string) string {
+	entries, _ := os.ReadDir(dir)
+	var saved []*checkpoint
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		if loaded, err := c.load(dir, name); err == nil {
+			saved = append(saved, loaded)
+		}
+	}
+	if len(saved) == 0 {
+		return fmt.Sprintf("No checkpoints yet; save one with %s <name>.", checkpointCommand)
+	}
+	sort.Slice(saved, func(i, j int) bool { return saved[i].Created.Before(saved[j].Created) })
+
+	var list strings.Builder
+	list.WriteString("Checkpoints:\n")
+	for _, checkpoint := range saved {
+		fmt.Fprintf(&list, "- %s (%s): %d messages, %d files\n", checkpoint.Name, checkpoint.Created.Format(time.RFC3339), len(checkpoint.Messages), len(checkpoint.Files))
+	}
+	return strings.TrimSuffix(list.String(), "\n")
+}
+
+// restore puts the workspace back as checkpoint name saved it and returns its
+// messages. The current state is saved first as a checkpoint named
+// "before-restore", which undoes the restore and is put back if it fails.
+func (c *Checkpoints) restore(dir string, name string, messages []anthropic.MessageParam, fsys tools.FS) ([]anthropic.MessageParam, string, error) {
+	target, err := c.load(dir, name)
+	if err != nil {
+		return nil, "", err
+	}
+	if target.Messages == nil {
+		target.Messages = []anthropic.MessageParam{}
+	}
+	// Every file is read before anything changes.
+	contents, err := c.contents(target)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if name != "before-restore" {
+		if _, err := c.save(dir, "before-restore", messages, fsys); err != nil {
+			return nil, "", fmt.Errorf("failed to save the current state before restoring: %v", err)
+		}
+	}
+	current, _, err := snapshot(fsys)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read the workspace: %v", err)
+	}
+
+	written, removed, err := applySnapshot(fsys, current, contents, target.Skipped)
+	if err != nil {
+		// Put back what changed, so the workspace isn't left half restored.
+		if _, _, rollbackErr := applySnapshot(fsys, contents, current, nil); rollbackErr != nil {
+			return nil, "", fmt.Errorf("failed to restore %s: %v; putting the workspace back also failed: %v", name, err, rollbackErr)
+		}
+		return nil, "", fmt.Errorf("failed to restore %s, the workspace is unchanged: %v", name, err)
+	}
+
+	summary := fmt.Sprintf("Restored checkpoint %s: the conversation is back to %d messages, %d files were written and %d deleted.", name, len(target.Messages), written, removed)
+	if name != "before-restore" {
+		summary += fmt.Sprintf(" Undo with %s before-restore.", restoreCommand)
+	}
+	return target.Messages, summary, nil
+}
+
+// contents reads the files of a checkpoint.
+func (c *Checkpoints) contents(saved *checkpoint) (map[string][]byte, error) {
+	contents := map[string][]byte{}
+	for file, hash := range saved.Files {
+		data, err := os.ReadFile(c.blobPath(hash))
+		if err == nil {
+			data, err = c.Sealer.Open(data, hash)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("checkpoint %s is missing the content of %s: %v", saved.Name, file, err)
+		}
+		contents[file] = data
+	}
+	return contents, nil
+}
+
+// applySnapshot changes the workspace from current to target, leaving the
+// files in keep alone, and counts the files written and deleted.
+func applySnapshot(fsys tools.FS, current map[string][]byte, target map[string][]byte, keep []string) (int, int, error) {
+	files := make([]string, 0, len(target))
+	for file := range target {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	written := 0
+	for _, file := range files {
+		data, exists := current[file]
+		if exists && string(data) == string(target[file]) {
+			continue
+		}
+		if err := fsys.WriteFile(file, target[file], 0o644); err != nil {
+			return written, 0, err
+		}
+		written++
+	}
+
+	removed := 0
+	for file := range current {
+		if _, ok := target[file]; ok || slices.Contains(keep, file) {
+			continue
+		}
+		if err := tools.Remove(fsys, file); err != nil {
+			return written, removed, err
+		}
+		removed++
+	}
+	return written, removed, nil
+}
@@ -0,0 +1,90 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Instructions given to agents that cite their sources, see CiteSources.
+const citationInstructions = `<citations>
+Support every claim in your final answer with the documentation you fetched. Mark claims with numbered references like [1], and end the answer with a citations block listing each reference once:
+
+<citations>
+[{"id": 1, "url": "https://pkg.go.dev/net/http#Client", "section": "type Client", "quote": "Timeout specifies a time limit for requests made by this Client."}]
+</citations>
+
+url is the page the claim comes from, with the anchor of the section when there is one; section names that section; quote is a short verbatim excerpt supporting the claim. Only cite pages you fetched with your tools in this conversation.
+</citations>`
+
+var citationsPattern = regexp.MustCompile(`(?s)\n*<citations>\s*(.*?)\s*</citations>\s*$`)
+
+// Citation links a numbered reference in an answer to the documentation supporting it.
+type Citation struct {
+	ID      int    `json:"id"`
+	URL     string `json:"url"`
+	Section string `json:"section,omitempty"`
+	Quote   string `json:"quote,omitempty"`
+	// Verified is set when the URL's page was fetched by a tool in the conversation,
+	// rather than recalled by the model.
+	Verified bool `json:"verified"`
+}
+
+// CiteSources makes the agent attach a structured citations block to its answers.
+func (a *Agent) CiteSources() {
+	a.citeSources = true
+	a.instructions = append(a.instructions, citationInstructions)
+}
+
+// ParseCitations splits an answer into its text and the citations block at its end.
+func ParseCitations(answer string) (string, []Citation) {
+	match := citationsPattern.FindStringSubmatchIndex(answer)
+	if match == nil {
+		return answer, nil
+	}
+
+	var citations []Citation
+	if err := json.Unmarshal([]byte(answer[match[2]:match[3]]), &citations); err != nil {
+		return answer, nil
+	}
+	return answer[:match[0]], citations
+}
+
+// verifyCitations re-renders the citations block of an answer, marking which
+// cited pages were actually fetched by tools in messages.
+func verifyCitations(answer string, messages []anthropic.MessageParam) string {
+	text, citations := ParseCitations(answer)
+	if len(citations) == 0 {
+		fmt.Printf("%s⚠️  Answer has no citations%s\n", BlueColor, ResetColor)
+		return answer
+	}
+
+	fetched := toolResultText(messages)
+	for i, citation := range citations {
+		page, _, _ := strings.Cut(citation.URL, "#")
+		citations[i].Verified = page != "" && strings.Contains(fetched, page)
+	}
+
+	data, err := json.MarshalIndent(citations, "", "  ")
+	if err != nil {
+		return answer
+	}
+	return fmt.Sprintf("%s\n\n<citations>\n%s\n</citations>", strings.TrimSpace(text), data)
+}
+
+// toolResultText concatenates the text of every tool result in messages.
+func toolResultText(messages []anthropic.MessageParam) string {
+	var text strings.Builder
+	for _, message := range messages {
+		for _, block := range message.Content {
+			if block.OfToolResult != nil {
+				text.WriteString(toolResultContent(block.OfToolResult))
+				text.WriteString("\n")
+			}
+		}
+	}
+	return text.String()
+}
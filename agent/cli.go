@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// CLITransport reads messages from stdin and prints replies to stdout.
+type CLITransport struct {
+	reader *bufio.Reader
+	writer io.Writer
+}
+
+func NewCLITransport() *CLITransport {
+	return &CLITransport{
+		reader: bufio.NewReader(os.Stdin),
+		writer: os.Stdout,
+	}
+}
+
+func (t *CLITransport) Read() (string, error) {
+	// fmt.Println("Coder Agent: Sleeping for 5 seconds")
+
+	// time.Sleep(5 * time.Second)
+
+	fmt.Fprintf(t.writer, "> ")
+	input, err := t.reader.ReadString('\n')
+	if err != nil && input == "" {
+		return "", err
+	}
+	return strings.TrimSpace(input), nil
+}
+
+func (t *CLITransport) Write(message string) error {
+	_, err := fmt.Fprintln(t.writer, message)
+	return err
+}
+
+func (t *CLITransport) Close() error {
+	return nil
+}
@@ -0,0 +1,94 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+	// current_time must know every timezone, also on hosts without tzdata, e.g. alpine.
+	_ "time/tzdata"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// Clock is the agent's source of time, so tests and replays can freeze it.
+type Clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+}
+
+// RealClock is the system clock.
+type RealClock struct{}
+
+func (RealClock) Now() time.Time        { return time.Now() }
+func (RealClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+// FixedClock is a frozen clock; Sleep advances it instantly instead of blocking.
+type FixedClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func NewFixedClock(now time.Time) *FixedClock {
+	return &FixedClock{now: now}
+}
+
+func (c *FixedClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *FixedClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// SetClock replaces the agent's clock; call before Run.
+func (a *Agent) SetClock(clock Clock) {
+	a.clock = clock
+}
+
+// CurrentTime tool for telling the model the date and time
+type CurrentTimeInput struct {
+	Timezone string `json:"timezone,omitempty" jsonschema:"default=UTC" jsonschema_description:"IANA timezone name, e.g. America/New_York. Defaults to UTC."`
+}
+
+var CurrentTimeInputSchema = tools.GenerateSchema[CurrentTimeInput]()
+
+// currentTimeDefinition is bound to the agent so it reads the agent's clock.
+func (a *Agent) currentTimeDefinition() tools.ToolDefinition {
+	return tools.ToolDefinition{
+		Name:        "current_time",
+		Description: "Get the current date and time. Use this whenever the answer depends on today's date or the time of day.",
+		InputSchema: CurrentTimeInputSchema,
+		Function:    a.CurrentTime,
+		Category:    tools.CategoryRead,
+		Examples: []tools.ToolExample{
+			{Input: `{"timezone": "Europe/Berlin"}`, Output: "2025-09-05T14:03:12+02:00 (Friday)"},
+		},
+	}
+}
+
+func (a *Agent) CurrentTime(ctx context.Context, input json.RawMessage) (string, error) {
+	currentTimeInput := CurrentTimeInput{}
+
+	err := json.Unmarshal(input, &currentTimeInput)
+	if err != nil {
+		return "", err
+	}
+
+	if currentTimeInput.Timezone == "" {
+		currentTimeInput.Timezone = "UTC"
+	}
+
+	location, err := time.LoadLocation(currentTimeInput.Timezone)
+	if err != nil {
+		return "", fmt.Errorf("unknown timezone %q: %v", currentTimeInput.Timezone, err)
+	}
+
+	now := a.clock.Now().In(location)
+	return fmt.Sprintf("%s (%s)", now.Format(time.RFC3339), now.Weekday()), nil
+}
@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/tools"
+)
+
+// Tools whose results hold a file's content or changes, superseded once the
+// file is read or written again.
+var fileTools = map[string]bool{"read_file": true, "write_file": true, "read_document": true}
+
+// compactToolResults replaces the results of file tool calls that a later call on
+// the same file has superseded with a one-line placeholder, e.g.
+// "[read_file main.go — 312 lines, superseded]", so old file contents stop
+// filling the prompt. Messages are copied before being changed.
+func compactToolResults(messages []anthropic.MessageParam) []anthropic.MessageParam {
+	// Walk the tool calls in order, remembering the last call per path that left
+	// the whole file in the history. A differential read only holds the changes
+	// since the previous read, so it doesn't supersede it.
+	type fileCall struct {
+		name  string
+		path  string
+		order int
+	}
+	calls := map[string]fileCall{} // tool use ID -> call
+	lastFull := map[string]int{}   // path -> order of the last call leaving the whole file
+	results := map[string]string{} // tool use ID -> result text
+
+	for _, message := range messages {
+		for _, block := range message.Content {
+			if block.OfToolResult != nil {
+				results[block.OfToolResult.ToolUseID] = toolResultContent(block.OfToolResult)
+			}
+		}
+	}
+
+	for _, message := range messages {
+		for _, block := range message.Content {
+			if block.OfToolUse == nil || !fileTools[block.OfToolUse.Name] {
+				continue
+			}
+			input, err := json.Marshal(block.OfToolUse.Input)
+			if err != nil {
+				continue
+			}
+			path := toolCallPath(input)
+			if path == "" {
+				continue
+			}
+			call := fileCall{name: block.OfToolUse.Name, path: path, order: len(calls) + 1}
+			calls[block.OfToolUse.ID] = call
+			if !tools.IsDifferentialRead(results[block.OfToolUse.ID]) {
+				lastFull[path] = call.order
+			}
+		}
+	}
+
+	compacted := messages
+	copied := false
+	saved := 0
+
+	for i, message := range messages {
+		var content []anthropic.ContentBlockParamUnion
+		for j, block := range message.Content {
+			result := block.OfToolResult
+			if result == nil || result.IsError.Value {
+				continue
+			}
+			call, ok := calls[result.ToolUseID]
+			if !ok || call.order >= lastFull[call.path] {
+				continue
+			}
+
+			text := toolResultContent(result)
+			placeholder := fmt.Sprintf("[%s %s — %d lines, superseded]", call.name, call.path, strings.Count(strings.TrimRight(text, "\n"), "\n")+1)
+			if len(placeholder) >= len(text) {
+				continue
+			}
+
+			if !copied {
+				compacted = append([]anthropic.MessageParam{}, messages...)
+				copied = true
+			}
+			if content == nil {
+				content = append([]anthropic.ContentBlockParamUnion{}, message.Content...)
+			}
+			content[j] = anthropic.NewToolResultBlock(result.ToolUseID, placeholder, false)
+			saved += len(text) - len(placeholder)
+		}
+		if content != nil {
+			compacted[i] = anthropic.MessageParam{Role: message.Role, Content: content}
+		}
+	}
+
+	if saved > 0 {
+		fmt.Printf("%s🗜️  Compacted superseded tool results, saving %d bytes%s\n", BlueColor, saved, ResetColor)
+	}
+	return compacted
+}
+
+// toolResultContent joins the text of a tool result.
+func toolResultContent(result *anthropic.ToolResultBlockParam) string {
+	var text strings.Builder
+	for _, content := range result.Content {
+		if content.OfText != nil {
+			text.WriteString(content.OfText.Text)
+		}
+	}
+	return text.String()
+}
@@ -0,0 +1,273 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// Ways of reconciling the voters' answers.
+const (
+	consensusMajority = "majority"
+	consensusJudge    = "judge"
+)
+
+// Longest part of a voter's reasoning shown in the tool result.
+const maxVoterReasoning = 1500
+
+const consensusVoterPrompt = `You are one of several independent reviewers asked the same question. Your answer is combined with theirs, so think it through on your own and be careful: the question was escalated because a wrong answer is costly.
+
+Explain your reasoning briefly, then end with a line of the form
+VERDICT: <answer>
+where <answer> is exactly one of: %s`
+
+const consensusJudgePrompt = `Several independent reviewers answered the question below. Weigh their reasoning rather than counting votes: an answer backed by a concrete argument beats several that are vague. When in doubt, prefer the more cautious answer.
+
+<question>
+%s
+</question>
+
+<context>
+%s
+</context>
+
+%s
+
+Explain your decision briefly, then end with a line of the form
+VERDICT: <answer>
+where <answer> is exactly one of: %s`
+
+// Consensus sends critical questions to several model calls and reconciles their
+// answers, by majority vote or by a judge model call. A nil Consensus is disabled.
+type Consensus struct {
+	// Model calls answering each question.
+	Voters int
+	// "majority" or "judge".
+	Mode string
+	// Models the voters take turns using; empty uses the agent's model.
+	Models []anthropic.Model
+}
+
+// consensusFromEnv reads CONSENSUS_VOTERS (e.g. "3", default off), CONSENSUS_MODE
+// (default majority) and CONSENSUS_MODELS (comma-separated, default the agent's model).
+func consensusFromEnv() *Consensus {
+	value := os.Getenv("CONSENSUS_VOTERS")
+	if value == "" {
+		return nil
+	}
+	voters, err := strconv.Atoi(value)
+	if err != nil || voters < 2 || voters > 9 {
+		fmt.Printf("Invalid CONSENSUS_VOTERS %q, consensus mode disabled: must be between 2 and 9\n", value)
+		return nil
+	}
+
+	consensus := &Consensus{Voters: voters, Mode: consensusMajority}
+	switch mode := os.Getenv("CONSENSUS_MODE"); mode {
+	case "", consensusMajority:
+	case consensusJudge:
+		consensus.Mode = consensusJudge
+	default:
+		fmt.Printf("Unknown CONSENSUS_MODE %q, using majority\n", mode)
+	}
+
+	for _, model := range strings.Split(os.Getenv("CONSENSUS_MODELS"), ",") {
+		if model = strings.TrimSpace(model); model != "" {
+			consensus.Models = append(consensus.Models, anthropic.Model(model))
+		}
+	}
+	return consensus
+}
+
+// SetConsensus gives the model the ask_consensus tool for high-stakes questions.
+func (a *Agent) SetConsensus(consensus *Consensus) {
+	a.consensus = consensus
+	if consensus != nil {
+		a.tools.Register(a.askConsensusDefinition())
+	}
+}
+
+// AskConsensus tool for getting several independent answers to a critical question
+type AskConsensusInput struct {
+	Question string   `json:"question" jsonschema:"minLength=1" jsonschema_description:"The question, e.g. Is this migration destructive?"`
+	Context  string   `json:"context,omitempty" jsonschema_description:"Everything needed to answer, e.g. the migration's SQL. The voters don't see this conversation."`
+	Choices  []string `json:"choices,omitempty" jsonschema:"minItems=2,maxItems=5" jsonschema_description:"The possible answers. Defaults to yes and no."`
+}
+
+var AskConsensusInputSchema = tools.GenerateSchema[AskConsensusInput]()
+
+// askConsensusDefinition is bound to the agent, since voting needs the agent's provider.
+func (a *Agent) askConsensusDefinition() tools.ToolDefinition {
+	return tools.ToolDefinition{
+		Name:        "ask_consensus",
+		Description: fmt.Sprintf("Have %d independent reviewers answer a high-stakes question and get their reconciled answer. Use this before steps where a wrong judgement is costly or hard to undo, e.g. whether a migration is destructive or a command deletes data; not for routine questions.", a.consensus.Voters),
+		InputSchema: AskConsensusInputSchema,
+		Function:    a.AskConsensus,
+		Category:    tools.CategoryRead,
+		Examples: []tools.ToolExample{
+			{Input: `{"question": "Is this migration destructive?", "context": "ALTER TABLE users DROP COLUMN legacy_id;"}`, Output: "Consensus: yes (3 of 3 voters agree)\n\n## Voter 1 (claude-sonnet-4-20250514): yes\n\nDropping a column deletes its data ..."},
+		},
+	}
+}
+
+// vote is one voter's answer.
+type vote struct {
+	model     anthropic.Model
+	reasoning string
+	verdict   string
+	err       error
+}
+
+func (a *Agent) AskConsensus(ctx context.Context, input json.RawMessage) (string, error) {
+	askConsensusInput := AskConsensusInput{}
+
+	err := json.Unmarshal(input, &askConsensusInput)
+	if err != nil {
+		return "", err
+	}
+
+	choices := askConsensusInput.Choices
+	if len(choices) == 0 {
+		choices = []string{"yes", "no"}
+	}
+	question := askConsensusInput.Question
+	if askConsensusInput.Context != "" {
+		question += "\n\n<context>\n" + askConsensusInput.Context + "\n</context>"
+	}
+
+	fmt.Printf("%s🗳️  Asking %d voters: %s%s\n", BlueColor, a.consensus.Voters, askConsensusInput.Question, ResetColor)
+	votes := make([]vote, a.consensus.Voters)
+	var wg sync.WaitGroup
+	for i := range votes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			votes[i] = a.castVote(ctx, a.voterModel(i), fmt.Sprintf(consensusVoterPrompt, strings.Join(choices, ", ")), question, choices)
+		}()
+	}
+	wg.Wait()
+
+	var ballots strings.Builder
+	counts := map[string]int{}
+	answered := 0
+	for i, v := range votes {
+		if v.err != nil {
+			fmt.Fprintf(&ballots, "## Voter %d (%s): failed\n\n%v\n\n", i+1, v.model, v.err)
+			continue
+		}
+		if v.verdict == "" {
+			fmt.Fprintf(&ballots, "## Voter %d (%s): no verdict\n\n%s\n\n", i+1, v.model, truncateReasoning(v.reasoning))
+			continue
+		}
+		answered++
+		counts[v.verdict]++
+		fmt.Fprintf(&ballots, "## Voter %d (%s): %s\n\n%s\n\n", i+1, v.model, v.verdict, truncateReasoning(v.reasoning))
+	}
+	if answered == 0 {
+		return "", fmt.Errorf("no voter gave a verdict:\n\n%s", strings.TrimSpace(ballots.String()))
+	}
+
+	var decision string
+	if a.consensus.Mode == consensusJudge {
+		decision = a.judgeVotes(ctx, askConsensusInput, choices, ballots.String(), counts, answered)
+	} else {
+		decision = majorityDecision(counts, answered, a.consensus.Voters)
+	}
+	return decision + "\n\n" + strings.TrimSpace(ballots.String()), nil
+}
+
+// voterModel is the model the i-th voter uses.
+func (a *Agent) voterModel(i int) anthropic.Model {
+	if len(a.consensus.Models) == 0 {
+		return a.messageParams(nil, nil).Model
+	}
+	return a.consensus.Models[i%len(a.consensus.Models)]
+}
+
+// castVote asks model the question on its own, without the conversation or tools.
+func (a *Agent) castVote(ctx context.Context, model anthropic.Model, system string, question string, choices []string) vote {
+	params := anthropic.MessageNewParams{
+		MaxTokens: 1024,
+		Model:     model,
+		System:    []anthropic.TextBlockParam{{Text: system}},
+		Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(question))},
+	}
+	// Votes of one model only differ by sampling, so a temperature only applies to deterministic runs.
+	if a.sampling.Deterministic {
+		a.sampling.apply(&params)
+	}
+	response, err := a.provider.NewMessage(ctx, params)
+	if err != nil {
+		return vote{model: model, err: err}
+	}
+	if usage := usageFrom(ctx); usage != nil {
+		usage.add(response.Model, response.Usage)
+	}
+
+	reasoning := responseText(response)
+	return vote{model: model, reasoning: reasoning, verdict: parseVerdict(reasoning, choices)}
+}
+
+// parseVerdict finds the last "VERDICT:" line and matches it to one of choices.
+func parseVerdict(text string, choices []string) string {
+	lines := strings.Split(text, "\n")
+	for i := len(lines) - 1; i >= 0; i-- {
+		line := strings.Trim(strings.TrimSpace(lines[i]), "*_`")
+		prefix, answer, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(prefix), "verdict") {
+			continue
+		}
+		answer = strings.Trim(strings.TrimSpace(answer), "*_`.\"'")
+		for _, choice := range choices {
+			if strings.EqualFold(answer, choice) {
+				return choice
+			}
+		}
+		return ""
+	}
+	return ""
+}
+
+// majorityDecision reports the answer more than half of the voters gave, if any.
+func majorityDecision(counts map[string]int, answered int, voters int) string {
+	for choice, count := range counts {
+		if count*2 > voters {
+			return fmt.Sprintf("Consensus: %s (%d of %d voters agree)", choice, count, voters)
+		}
+	}
+
+	tally := make([]string, 0, len(counts))
+	for choice, count := range counts {
+		tally = append(tally, fmt.Sprintf("%s %d", choice, count))
+	}
+	sort.Strings(tally)
+	return fmt.Sprintf("No consensus (%s, %d of %d voters gave a verdict). Treat the question as unresolved: take the cautious option or ask the user.", strings.Join(tally, ", "), answered, voters)
+}
+
+// judgeVotes has one more model call weigh the voters' answers. Without a
+// verdict from the judge, the majority decides.
+func (a *Agent) judgeVotes(ctx context.Context, input AskConsensusInput, choices []string, ballots string, counts map[string]int, answered int) string {
+	prompt := fmt.Sprintf(consensusJudgePrompt, input.Question, input.Context, strings.TrimSpace(ballots), strings.Join(choices, ", "))
+	judgement := a.castVote(ctx, a.messageParams(nil, nil).Model, "You are the judge reconciling independent reviewers' answers.", prompt, choices)
+	if judgement.err != nil || judgement.verdict == "" {
+		fmt.Printf("Consensus judge gave no verdict, falling back to the majority: %v\n", judgement.err)
+		return majorityDecision(counts, answered, a.consensus.Voters)
+	}
+	return fmt.Sprintf("Consensus: %s (decided by a judge)\n\n## Judge\n\n%s", judgement.verdict, truncateReasoning(judgement.reasoning))
+}
+
+func truncateReasoning(text string) string {
+	text = strings.TrimSpace(text)
+	if len(text) > maxVoterReasoning {
+		return text[:maxVoterReasoning] + " ..."
+	}
+	return text
+}
@@ -0,0 +1,123 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Context window of the Claude models, in tokens.
+const defaultContextWindow = 200_000
+
+// Bytes of a request, as JSON, per token until a response tells the actual count.
+const defaultBytesPerToken = 3.5
+
+// ContextHints tells the model how much of its context window is left once it
+// runs low, so it picks tool calls it can afford instead of reading whole files
+// that won't fit. A nil ContextHints gives no hints.
+type ContextHints struct {
+	// Window is the model's context window, in tokens.
+	Window int
+	// Below this fraction of the window left, each step gets a hint.
+	Below float64
+
+	mu sync.Mutex
+	// Measured from the last response, as the prompt's size in bytes over its tokens.
+	bytesPerToken float64
+}
+
+// contextHintsFromEnv reads CONTEXT_HINT_BELOW (default 0.25, "off" to disable)
+// and CONTEXT_WINDOW (default 200000).
+func contextHintsFromEnv() *ContextHints {
+	hints := &ContextHints{Window: defaultContextWindow, Below: 0.25}
+	if value := os.Getenv("CONTEXT_HINT_BELOW"); value == "off" {
+		return nil
+	} else if value != "" {
+		below, err := strconv.ParseFloat(value, 64)
+		if err != nil || below <= 0 || below > 1 {
+			fmt.Printf("Invalid CONTEXT_HINT_BELOW %q, ignoring: must be above 0 and at most 1\n", value)
+		} else {
+			hints.Below = below
+		}
+	}
+	if value := os.Getenv("CONTEXT_WINDOW"); value != "" {
+		window, err := strconv.Atoi(value)
+		if err != nil || window <= 0 {
+			fmt.Printf("Invalid CONTEXT_WINDOW %q, ignoring\n", value)
+		} else {
+			hints.Window = window
+		}
+	}
+	return hints
+}
+
+// SetContextHints sets when the model is told its context window runs low; nil disables the hints.
+func (a *Agent) SetContextHints(hints *ContextHints) {
+	a.contextHints = hints
+}
+
+func requestBytes(params anthropic.MessageNewParams) int {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
+
+// calibrate learns how many bytes of request make a token from the usage the
+// request was charged.
+func (h *ContextHints) calibrate(params anthropic.MessageNewParams, usage anthropic.Usage) {
+	if h == nil {
+		return
+	}
+	tokens := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+	size := requestBytes(params)
+	if tokens <= 0 || size == 0 {
+		return
+	}
+	h.mu.Lock()
+	h.bytesPerToken = float64(size) / float64(tokens)
+	h.mu.Unlock()
+}
+
+// remaining estimates the tokens left in the window after the request and the
+// longest response it allows.
+func (h *ContextHints) remaining(params anthropic.MessageNewParams) int {
+	h.mu.Lock()
+	bytesPerToken := h.bytesPerToken
+	h.mu.Unlock()
+	if bytesPerToken == 0 {
+		bytesPerToken = defaultBytesPerToken
+	}
+	return h.Window - int(float64(requestBytes(params))/bytesPerToken) - int(params.MaxTokens)
+}
+
+// contextHint returns advice for the next step if the context window is
+// running low, or "" if there's room.
+func (a *Agent) contextHint(messages []anthropic.MessageParam, tools []anthropic.ToolUnionParam) string {
+	if a.contextHints == nil {
+		return ""
+	}
+	remaining := a.contextHints.remaining(a.messageParams(messages, tools))
+	if float64(remaining) >= a.contextHints.Below*float64(a.contextHints.Window) {
+		return ""
+	}
+
+	fmt.Printf("%s📏 About %d tokens of context left%s\n", BlueColor, max(remaining, 0), ResetColor)
+	if remaining < a.contextHints.Window/20 {
+		return fmt.Sprintf("Context budget: %s tokens remain in your context window, which is nearly full. Don't read any more files or run commands with long output. Finish with what you have, or summarize your progress and what's left.", approximateTokens(remaining))
+	}
+	return fmt.Sprintf("Context budget: %s tokens remain in your context window. Prefer targeted tool calls: search for what you need and read only the relevant parts instead of whole files, don't re-read files you've already seen, and keep command output short (e.g. pipe it through head or grep).", approximateTokens(remaining))
+}
+
+// approximateTokens rounds a token count for the model, e.g. "~3k".
+func approximateTokens(tokens int) string {
+	if tokens < 1000 {
+		return fmt.Sprintf("~%d", max(tokens, 0))
+	}
+	return fmt.Sprintf("~%dk", tokens/1000)
+}
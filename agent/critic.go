@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// Status reported to HTTP clients when the critic still objected to the changes
+// after the model's last attempt to address it.
+const reviewFlaggedStatus = "review_flagged"
+
+// Most diff text sent to the critic; the start of the change set is kept.
+const maxCriticDiff = 60_000
+
+const criticPrompt = `You review code changes before they are handed back to the user. Below is the user's request, followed by the diffs of every file write made for it, in order.
+
+Flag only clear problems:
+- the changes don't do what was asked, do only part of it, or do something else as well
+- placeholders left in: TODO or FIXME comments, stub bodies, "not implemented" errors, elided code like "// ... rest unchanged"
+- code that obviously can't compile, e.g. calls to functions that don't exist in the diff or the request
+
+Don't comment on style or suggest improvements. List each problem as a "- " bullet naming the file, then end with a line of the form
+VERDICT: <approve or reject>
+
+<request>
+%s
+</request>
+
+<diffs>
+%s
+</diffs>`
+
+const criticFeedback = `A reviewer checked your changes against the request before your answer is returned, and flagged these problems:
+
+%s
+
+Fix them, or explain in your answer why they are not problems.`
+
+// Placeholder markers in added lines, flagged without asking the critic.
+var leftoverPattern = regexp.MustCompile(`\b(TODO|FIXME|XXX)\b`)
+
+// Critic reviews the changes of a turn against the request before the answer
+// is returned. While it rejects them, its findings are handed back to the model
+// to address, up to MaxRounds times. A nil Critic is disabled.
+type Critic struct {
+	// A cheap model is enough to spot mismatches and leftovers.
+	Model     anthropic.Model
+	MaxRounds int
+}
+
+// criticFromEnv reads CRITIC_REVIEW ("on", default off), CRITIC_MODEL (default
+// Haiku) and CRITIC_MAX_ROUNDS (default 2).
+func criticFromEnv() *Critic {
+	if os.Getenv("CRITIC_REVIEW") != "on" {
+		return nil
+	}
+
+	critic := &Critic{Model: anthropic.ModelClaude3_5Haiku20241022, MaxRounds: 2}
+	if model := os.Getenv("CRITIC_MODEL"); model != "" {
+		critic.Model = anthropic.Model(model)
+	}
+	if value := os.Getenv("CRITIC_MAX_ROUNDS"); value != "" {
+		rounds, err := strconv.Atoi(value)
+		if err != nil || rounds < 0 {
+			fmt.Printf("Invalid CRITIC_MAX_ROUNDS %q, ignoring: must be a non-negative number\n", value)
+		} else {
+			critic.MaxRounds = rounds
+		}
+	}
+	return critic
+}
+
+// SetCritic makes the agent have its changes reviewed before answering.
+func (a *Agent) SetCritic(critic *Critic) {
+	a.critic = critic
+}
+
+// collectFileChanges returns the file changes reported in tool results.
+func collectFileChanges(results []anthropic.ContentBlockParamUnion) []tools.FileChange {
+	var changes []tools.FileChange
+	for _, block := range results {
+		if block.OfToolResult == nil || block.OfToolResult.IsError.Value {
+			continue
+		}
+		_, reported := tools.ParseFileChanges(toolResultContent(block.OfToolResult))
+		changes = append(changes, reported...)
+	}
+	return changes
+}
+
+// review has the critic check the turn's changes against request, returning its
+// findings and whether it approved them. Changes are approved if the critic can't
+// be reached, so an outage doesn't block every answer.
+func (a *Agent) review(ctx context.Context, request string, changes []tools.FileChange, usage *taskUsage) (string, bool) {
+	var diffs strings.Builder
+	var findings []string
+	flagged := map[string]bool{}
+	for _, change := range changes {
+		diffs.WriteString(change.Diff)
+		diffs.WriteString("\n")
+		for _, line := range tools.DiffBody(change.Diff) {
+			if !strings.HasPrefix(line, "+") || !leftoverPattern.MatchString(line) {
+				continue
+			}
+			// A later write may have removed it again.
+			line = strings.TrimSpace(line[1:])
+			current, err := a.fs.ReadFile(change.Path)
+			if err != nil || !strings.Contains(string(current), line) || flagged[change.Path+line] {
+				continue
+			}
+			flagged[change.Path+line] = true
+			findings = append(findings, fmt.Sprintf("- %s: leftover placeholder %q", change.Path, line))
+		}
+	}
+	diff := diffs.String()
+	if len(diff) > maxCriticDiff {
+		diff = diff[:maxCriticDiff] + "\n[... diff truncated]"
+	}
+
+	fmt.Printf("%s🧐 Reviewing %d file changes...%s\n", BlueColor, len(changes), ResetColor)
+	params := anthropic.MessageNewParams{
+		MaxTokens: 1024,
+		Model:     a.critic.Model,
+		Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf(criticPrompt, request, diff)))},
+	}
+	a.sampling.apply(&params)
+	response, err := a.provider.NewMessage(ctx, params)
+	if err != nil {
+		fmt.Printf("Review failed, not blocking the answer: %v\n", err)
+	} else {
+		usage.add(response.Model, response.Usage)
+		text := responseText(response)
+		if parseVerdict(text, []string{"approve", "reject"}) == "reject" {
+			for _, line := range strings.Split(text, "\n") {
+				if line = strings.TrimSpace(line); strings.HasPrefix(line, "- ") {
+					findings = append(findings, line)
+				}
+			}
+			if len(findings) == 0 {
+				findings = append(findings, "- the changes don't match the request")
+			}
+		}
+	}
+
+	if len(findings) == 0 {
+		fmt.Printf("%s✅ Review passed%s\n", BlueColor, ResetColor)
+		return "", true
+	}
+	fmt.Printf("%s🚩 Review flagged %d problems%s\n", BlueColor, len(findings), ResetColor)
+	return strings.Join(findings, "\n"), false
+}
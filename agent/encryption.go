@@ -0,0 +1,132 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Marks sealed data, so data stored before encryption was turned on can still
+// be read; it's encrypted when next saved.
+const sealedPrefix = "agent-sealed:v1:"
+
+// Sealer encrypts what the agent stores at rest, sessions and caches, with
+// AES-GCM. A nil Sealer stores data as it is.
+type Sealer struct {
+	aead cipher.AEAD
+}
+
+// NewSealer returns a Sealer using a 16, 24 or 32-byte key, for AES-128, AES-192
+// or AES-256.
+func NewSealer(key []byte) (*Sealer, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("the key must be 16, 24 or 32 bytes, got %d", len(key))
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &Sealer{aead: aead}, nil
+}
+
+// SealerFromEnv reads a base64-encoded key from STORAGE_KEY, from the file
+// STORAGE_KEY_FILE (e.g. a mounted secret) or from the output of the shell
+// command STORAGE_KEY_COMMAND (e.g. a KMS decrypt call). It returns nil if none
+// is set.
+func SealerFromEnv() (*Sealer, error) {
+	var encoded, source string
+	switch {
+	case os.Getenv("STORAGE_KEY") != "":
+		encoded, source = os.Getenv("STORAGE_KEY"), "STORAGE_KEY"
+	case os.Getenv("STORAGE_KEY_FILE") != "":
+		source = "STORAGE_KEY_FILE"
+		data, err := os.ReadFile(os.Getenv("STORAGE_KEY_FILE"))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", source, err)
+		}
+		encoded = string(data)
+	case os.Getenv("STORAGE_KEY_COMMAND") != "":
+		source = "STORAGE_KEY_COMMAND"
+		cmd := exec.Command("sh", "-c", os.Getenv("STORAGE_KEY_COMMAND"))
+		cmd.Stderr = os.Stderr
+		output, err := cmd.Output()
+		if err != nil {
+			return nil, fmt.Errorf("%s failed: %v", source, err)
+		}
+		encoded = string(output)
+	default:
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("%s is not base64: %v", source, err)
+	}
+	sealer, err := NewSealer(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", source, err)
+	}
+	return sealer, nil
+}
+
+// Seal encrypts data stored under name, e.g. a session ID. Data sealed under
+// one name can't be opened under another, so stored records can't be swapped.
+func (s *Sealer) Seal(data []byte, name string) []byte {
+	if s == nil {
+		return data
+	}
+	nonce := make([]byte, s.aead.NonceSize())
+	rand.Read(nonce)
+	sealed := s.aead.Seal(nonce, nonce, data, []byte(name))
+	return []byte(sealedPrefix + base64.StdEncoding.EncodeToString(sealed))
+}
+
+// Open decrypts data sealed under name. Data that isn't sealed is returned as it is.
+func (s *Sealer) Open(data []byte, name string) ([]byte, error) {
+	encoded, sealed := bytes.CutPrefix(data, []byte(sealedPrefix))
+	if !sealed {
+		return data, nil
+	}
+	if s == nil {
+		return nil, errors.New("the data is encrypted, but no storage key is set")
+	}
+	ciphertext, err := base64.StdEncoding.DecodeString(string(encoded))
+	if err != nil || len(ciphertext) < s.aead.NonceSize() {
+		return nil, errors.New("the encrypted data is corrupted")
+	}
+	nonce, ciphertext := ciphertext[:s.aead.NonceSize()], ciphertext[s.aead.NonceSize():]
+	plaintext, err := s.aead.Open(nil, nonce, ciphertext, []byte(name))
+	if err != nil {
+		return nil, errors.New("the data can't be decrypted: wrong storage key, or corrupted data")
+	}
+	return plaintext, nil
+}
+
+// EncryptStorage makes the agent encrypt the sessions it saves, to SESSION_DIR
+// or a session database, its checkpoints and the caches it keeps on disk.
+func (a *Agent) EncryptStorage(sealer *Sealer) {
+	a.sealer = sealer
+	a.shareSealer()
+}
+
+// shareSealer hands the agent's Sealer to the stores it has.
+func (a *Agent) shareSealer() {
+	a.sessions.Sealer = a.sealer
+	if backend, ok := a.sessions.Backend.(*SQLSessionBackend); ok {
+		backend.Sealer = a.sealer
+	}
+	if a.repoSummary != nil {
+		a.repoSummary.Sealer = a.sealer
+	}
+	if a.checkpoints != nil {
+		a.checkpoints.Sealer = a.sealer
+	}
+}
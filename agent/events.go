@@ -0,0 +1,114 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/providers"
+	"github.com/kartikx/agent/tools"
+)
+
+type EventType string
+
+const (
+	TurnStarted   EventType = "turn_started"
+	ToolCalled    EventType = "tool_called"
+	ToolOutput    EventType = "tool_output"
+	ToolResult    EventType = "tool_result"
+	AssistantText EventType = "assistant_text"
+	TurnEnded     EventType = "turn_ended"
+)
+
+// Event describes something that happened while the agent handled a turn.
+// Only the fields relevant to the event's type are set.
+type Event struct {
+	Type      EventType          `json:"type"`
+	Text      string             `json:"text,omitempty"`       // TurnStarted: user input, AssistantText/TurnEnded: assistant text, ToolOutput: the next lines of output
+	ToolID    string             `json:"tool_id,omitempty"`    // ToolCalled, ToolOutput, ToolResult
+	ToolName  string             `json:"tool_name,omitempty"`  // ToolCalled, ToolOutput, ToolResult
+	ToolInput json.RawMessage    `json:"tool_input,omitempty"` // ToolCalled
+	Result    string             `json:"result,omitempty"`     // ToolResult
+	IsError   bool               `json:"is_error,omitempty"`   // ToolResult
+	Changes   []tools.FileChange `json:"changes,omitempty"`    // ToolResult: files modified by the tool
+	Cost      float64            `json:"cost_usd,omitempty"`   // TurnEnded: cost of the task so far in USD
+}
+
+// Size of the events buffer; once full, the agent blocks until events are consumed.
+const eventsBufferSize = 64
+
+// Events returns the channel the agent publishes events on. Events are only
+// published after the first call, and must then be drained by the caller.
+func (a *Agent) Events() <-chan Event {
+	a.eventsMu.Lock()
+	defer a.eventsMu.Unlock()
+
+	if a.events == nil {
+		a.events = make(chan Event, eventsBufferSize)
+	}
+	return a.events
+}
+
+// eventTransport is implemented by transports that show the progress of a turn
+// to whoever sent its message, e.g. the tools being called.
+type eventTransport interface {
+	Event(event Event)
+}
+
+func (a *Agent) emit(event Event) {
+	if transport, ok := a.current.(eventTransport); ok {
+		transport.Event(event)
+	}
+
+	a.eventsMu.Lock()
+	events := a.events
+	a.eventsMu.Unlock()
+
+	if events != nil {
+		events <- event
+	}
+}
+
+// indentOutput sets streamed command output apart from the agent's own logs on the console.
+func indentOutput(text string) string {
+	text = strings.TrimSuffix(text, "\n")
+	return "   │ " + strings.ReplaceAll(text, "\n", "\n   │ ") + "\n"
+}
+
+func toolResultEvent(toolName string, block anthropic.ContentBlockParamUnion) Event {
+	event := Event{Type: ToolResult, ToolName: toolName}
+	if block.OfToolResult == nil {
+		return event
+	}
+
+	event.ToolID = block.OfToolResult.ToolUseID
+	event.IsError = block.OfToolResult.IsError.Value
+	for _, content := range block.OfToolResult.Content {
+		if content.OfText != nil {
+			event.Result += content.OfText.Text
+		}
+	}
+	_, event.Changes = tools.ParseFileChanges(event.Result)
+	return event
+}
+
+// NewEmbeddedAgent creates an agent hosted in-process: start it with go agent.Run(ctx)
+// and talk to it with SendMessage instead of stdin or HTTP.
+func NewEmbeddedAgent(provider providers.Provider, toolDefinitions []tools.ToolDefinition, name string) *Agent {
+	agent := NewAgent(provider, toolDefinitions, name, 0)
+
+	agent.inProcess = NewInProcessTransport()
+	agent.AddTransport(agent.inProcess)
+
+	return agent
+}
+
+// SendMessage sends a user message to an embedded agent and waits for its reply.
+func (a *Agent) SendMessage(ctx context.Context, message string) (string, error) {
+	if a.inProcess == nil {
+		return "", fmt.Errorf("agent %s is not embedded", a.name)
+	}
+	return a.inProcess.SendMessage(ctx, message)
+}
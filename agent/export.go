@@ -0,0 +1,204 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/tools"
+)
+
+// Command that exports the current session, e.g. "/export html".
+const exportCommand = "/export"
+
+// exportFormat returns the format input asks for, if it's an /export command.
+func exportFormat(input string) (string, bool) {
+	command, format, _ := strings.Cut(strings.TrimSpace(input), " ")
+	return strings.TrimSpace(format), command == exportCommand
+}
+
+// transcriptEntry is one rendered item of a session: a piece of text or a tool call with its result.
+type transcriptEntry struct {
+	Role       string
+	Text       string
+	ToolName   string
+	ToolInput  string
+	ToolResult string
+	ToolError  bool
+}
+
+// buildTranscript flattens the message history, pairing each tool call with its result.
+func buildTranscript(messages []anthropic.MessageParam) []transcriptEntry {
+	entries := []transcriptEntry{}
+	toolCalls := map[string]int{} // tool use ID -> index into entries
+
+	for _, message := range messages {
+		role := string(message.Role)
+
+		for _, block := range message.Content {
+			switch {
+			case block.OfText != nil:
+				entries = append(entries, transcriptEntry{Role: role, Text: block.OfText.Text})
+			case block.OfImage != nil:
+				entries = append(entries, transcriptEntry{Role: role, Text: "[image]"})
+			case block.OfToolUse != nil:
+				input, _ := json.MarshalIndent(block.OfToolUse.Input, "", "  ")
+				toolCalls[block.OfToolUse.ID] = len(entries)
+				entries = append(entries, transcriptEntry{Role: role, ToolName: block.OfToolUse.Name, ToolInput: string(input)})
+			case block.OfToolResult != nil:
+				var result strings.Builder
+				for _, content := range block.OfToolResult.Content {
+					if content.OfText != nil {
+						result.WriteString(content.OfText.Text)
+					}
+				}
+				if i, ok := toolCalls[block.OfToolResult.ToolUseID]; ok {
+					entries[i].ToolResult = result.String()
+					entries[i].ToolError = block.OfToolResult.IsError.Value
+				}
+			}
+		}
+	}
+
+	return entries
+}
+
+// exportTranscript renders the session as "markdown" (default), "html" or "json" (a Trajectory).
+// Files changed during the session are read from fsys.
+func exportTranscript(messages []anthropic.MessageParam, format string, fsys tools.FS) (string, error) {
+	if strings.ToLower(format) == "json" {
+		return renderTrajectory(messages, fsys)
+	}
+	return renderTranscript(messages, format)
+}
+
+// ExportTranscript renders the current session like /export, as "markdown"
+// (default), "html" or "json".
+func (a *Agent) ExportTranscript(format string) (string, error) {
+	return exportTranscript(a.Transcript(), format, a.fs)
+}
+
+// renderTranscript renders the session as "markdown" (default) or "html".
+func renderTranscript(messages []anthropic.MessageParam, format string) (string, error) {
+	entries := buildTranscript(messages)
+
+	switch strings.ToLower(format) {
+	case "", "md", "markdown":
+		return renderMarkdown(entries), nil
+	case "html":
+		return renderHTML(entries), nil
+	default:
+		return "", fmt.Errorf("unknown export format: %s", format)
+	}
+}
+
+func renderMarkdown(entries []transcriptEntry) string {
+	var result strings.Builder
+	result.WriteString("# Agent Session\n\n")
+
+	for _, entry := range entries {
+		if entry.ToolName == "" {
+			result.WriteString(fmt.Sprintf("### %s\n\n%s\n\n", roleTitle(entry.Role), closeFences(entry.Text)))
+			continue
+		}
+
+		result.WriteString(fmt.Sprintf("<details>\n<summary>🛠️ %s%s</summary>\n\n", entry.ToolName, errorSuffix(entry.ToolError)))
+		result.WriteString(codeBlock("json", entry.ToolInput))
+		text, changes := tools.ParseFileChanges(entry.ToolResult)
+		result.WriteString(codeBlock(resultLanguage(text), text))
+		for _, change := range changes {
+			result.WriteString(fmt.Sprintf("%s `%s` (+%d -%d)\n\n", change.Operation, change.Path, change.Added, change.Removed))
+			result.WriteString(codeBlock("diff", strings.TrimSuffix(change.Diff, "\n")))
+		}
+		result.WriteString("</details>\n\n")
+	}
+
+	return result.String()
+}
+
+// codeBlock fences text as a Markdown code block, with more backticks than
+// any run of them in text, so a fence in it can't end the block.
+func codeBlock(language string, text string) string {
+	longest, run := 0, 0
+	for _, c := range text {
+		if c == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	fence := strings.Repeat("`", max(3, longest+1))
+	return fmt.Sprintf("%s%s\n%s\n%s\n\n", fence, language, text, fence)
+}
+
+// closeFences closes a code block a message leaves open, which would
+// otherwise swallow the rest of the transcript.
+func closeFences(text string) string {
+	open := ""
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		marker := line[:len(line)-len(strings.TrimLeft(line, "`~"))]
+		if len(marker) < 3 || strings.Trim(marker, marker[:1]) != "" {
+			continue
+		}
+		switch {
+		case open == "":
+			open = marker
+		case marker[0] == open[0] && len(marker) >= len(open) && strings.TrimSpace(line[len(marker):]) == "":
+			open = ""
+		}
+	}
+	if open == "" {
+		return text
+	}
+	return text + "\n" + open
+}
+
+func renderHTML(entries []transcriptEntry) string {
+	var result strings.Builder
+	result.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>Agent Session</title>\n")
+	result.WriteString("<style>body{font-family:sans-serif;max-width:900px;margin:auto}pre{background:#f4f4f4;padding:8px;overflow-x:auto}.user{color:#2a6}.assistant{color:#26a}.error{color:#c33}</style>\n")
+	result.WriteString("</head>\n<body>\n<h1>Agent Session</h1>\n")
+
+	for _, entry := range entries {
+		if entry.ToolName == "" {
+			result.WriteString(fmt.Sprintf("<h3 class=\"%s\">%s</h3>\n<pre>%s</pre>\n", entry.Role, roleTitle(entry.Role), html.EscapeString(entry.Text)))
+			continue
+		}
+
+		class := ""
+		if entry.ToolError {
+			class = " class=\"error\""
+		}
+		result.WriteString(fmt.Sprintf("<details>\n<summary%s>🛠️ %s%s</summary>\n", class, html.EscapeString(entry.ToolName), errorSuffix(entry.ToolError)))
+		result.WriteString(fmt.Sprintf("<pre>%s</pre>\n<pre>%s</pre>\n</details>\n", html.EscapeString(entry.ToolInput), html.EscapeString(entry.ToolResult)))
+	}
+
+	result.WriteString("</body>\n</html>\n")
+	return result.String()
+}
+
+func roleTitle(role string) string {
+	if role == "" {
+		return ""
+	}
+	return strings.ToUpper(role[:1]) + role[1:]
+}
+
+func errorSuffix(isError bool) string {
+	if isError {
+		return " (error)"
+	}
+	return ""
+}
+
+// resultLanguage picks a code fence language so diffs are highlighted.
+func resultLanguage(result string) string {
+	if strings.Contains(result, "\n@@ ") || strings.HasPrefix(result, "--- ") {
+		return "diff"
+	}
+	return ""
+}
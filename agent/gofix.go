@@ -0,0 +1,48 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// goFixesFromEnv reads GO_AUTOFIX, a comma-separated list of the fixes applied
+// to the Go files the file tools write: "imports" (goimports) and "tidy" (go
+// mod tidy). Default none.
+func goFixesFromEnv() tools.GoFixes {
+	var fixes tools.GoFixes
+	value := os.Getenv("GO_AUTOFIX")
+	if value == "" {
+		return fixes
+	}
+	for _, fix := range strings.Split(value, ",") {
+		switch fix = strings.TrimSpace(fix); fix {
+		case "imports":
+			fixes.Imports = true
+		case "tidy":
+			fixes.Tidy = true
+		default:
+			fmt.Printf("Unknown GO_AUTOFIX fix %q, ignoring\n", fix)
+		}
+	}
+	return fixes
+}
+
+// SetGoFixes changes the fixes applied to the Go files the file tools write.
+func (a *Agent) SetGoFixes(fixes tools.GoFixes) {
+	a.goFixes = fixes
+}
+
+// withGoFixes makes the file tools apply the agent's Go fixes, through its
+// runner. Tidying is left out while edits are staged, as go mod tidy would
+// write go.mod and go.sum outside the overlay.
+func (a *Agent) withGoFixes(ctx context.Context) context.Context {
+	fixes := a.goFixes
+	if a.staged != nil {
+		fixes.Tidy = false
+	}
+	return tools.WithGoFixes(ctx, fixes, a.runner)
+}
@@ -0,0 +1,167 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// Answer with which the user hands a shell back to the model.
+const handBackCommand = "/done"
+
+// HandOverShell tool for letting the human answer a command's prompts
+type HandOverShellInput struct {
+	Shell  string `json:"shell,omitempty" jsonschema_description:"ID of the shell whose command is waiting for input. Can be left out when one shell is open."`
+	Reason string `json:"reason" jsonschema:"minLength=1" jsonschema_description:"Why the user should answer, e.g. git push needs your GitHub credentials."`
+}
+
+var HandOverShellInputSchema = tools.GenerateSchema[HandOverShellInput]()
+
+// handOverShellDefinition is bound to the agent, since the user answers through its transports.
+func (a *Agent) handOverShellDefinition() tools.ToolDefinition {
+	return tools.ToolDefinition{
+		Name:        "hand_over_shell",
+		Description: "Let the user answer the prompts of a command waiting for input in a shell, e.g. for passwords, passphrases or one-time codes you must not know, or choices only they can make. Their answers aren't shown to you; you get the output once the command finishes or they hand the shell back.",
+		InputSchema: HandOverShellInputSchema,
+		Function:    a.HandOverShell,
+	}
+}
+
+func (a *Agent) HandOverShell(ctx context.Context, input json.RawMessage) (string, error) {
+	handOverInput := HandOverShellInput{}
+	if err := json.Unmarshal(input, &handOverInput); err != nil {
+		return "", err
+	}
+	command, prompt, err := tools.WaitingCommand(ctx, handOverInput.Shell)
+	if err != nil {
+		return "", err
+	}
+
+	a.askMu.Lock()
+	defer a.askMu.Unlock()
+
+	message := fmt.Sprintf("%s\n\n`%s` is waiting for input:\n\n%s\n\nType your answer (it won't be shown to the agent), or %s to hand the shell back.",
+		handOverInput.Reason, command, prompt, handBackCommand)
+	for answers := 1; ; answers++ {
+		answer, err := a.askForInput(ctx, message)
+		if err != nil {
+			return "", err
+		}
+		if strings.TrimSpace(answer) == handBackCommand {
+			return fmt.Sprintf("The user handed the shell back after %d answers; `%s` is still waiting for input:\n%s", answers-1, command, prompt), nil
+		}
+
+		result, waiting, err := tools.AnswerPrompt(ctx, handOverInput.Shell, answer)
+		if err != nil {
+			return "", fmt.Errorf("after the user's answer: %w", err)
+		}
+		if !waiting {
+			return fmt.Sprintf("The user answered %d prompts.\n%s", answers, result), nil
+		}
+		_, prompt, _ = tools.WaitingCommand(ctx, handOverInput.Shell)
+		message = fmt.Sprintf("`%s` is waiting for input again:\n\n%s\n\nType your answer, or %s to hand the shell back.", command, prompt, handBackCommand)
+	}
+}
+
+// askForInput shows message to the user and waits for their reply, until ctx is
+// done or ANSWER_TIMEOUT passes. a.askMu must be held.
+func (a *Agent) askForInput(ctx context.Context, message string) (string, error) {
+	if a.unanswered {
+		return "", fmt.Errorf("the user didn't answer the previous question")
+	}
+	token, err := newContinuationToken()
+	if err != nil {
+		return "", err
+	}
+
+	// Only the conversation that was asked may answer; replying moves the
+	// transport on to its next message, so they're noted first.
+	asking, session := a.current, a.currentSession()
+	user, _ := a.currentUser()
+
+	a.pendingContinuation = token
+	a.taskStatus = awaitingInputStatus
+	if err := a.writeOutput(message); err != nil {
+		a.pendingContinuation = ""
+		return "", err
+	}
+
+	defer func() { a.pendingContinuation = "" }()
+	timeout := answerTimeout()
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	for {
+		var answer string
+		select {
+		case input := <-a.inputs:
+			a.current, answer = input.transport, input.message
+		case <-ctx.Done():
+			// Other conversations were turned away meanwhile; free the agent for them.
+			a.current, a.unanswered = asking, true
+			if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				return "", fmt.Errorf("the user didn't answer within %s", timeout)
+			}
+			return "", fmt.Errorf("stopped waiting for an answer: %v", ctx.Err())
+		}
+
+		sender, err := a.currentUser()
+		continuation, carriesToken := a.current.(continuationTransport)
+		switch {
+		case a.current != asking || a.currentSession() != session || err != nil || sender != user:
+			a.turnAway("The agent is waiting for an answer to a question in another conversation; try again once it's done")
+		// Over HTTP, requests of the session may have queued while the question
+		// was asked; only the one carrying its continuation token answers it.
+		case carriesToken && continuation.Continuation() != token:
+			a.turnAway("The agent is waiting for an answer to its question; resend with the X-Agent-Continuation header of its reply")
+		default:
+			return answer, nil
+		}
+		a.current = asking
+	}
+}
+
+// How long a question waits for its answer unless ANSWER_TIMEOUT says otherwise.
+const defaultAnswerTimeout = 10 * time.Minute
+
+// answerTimeout reads ANSWER_TIMEOUT, e.g. "1h".
+func answerTimeout() time.Duration {
+	if value := os.Getenv("ANSWER_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err == nil && timeout > 0 {
+			return timeout
+		}
+		fmt.Printf("Invalid ANSWER_TIMEOUT %q, using %s\n", value, defaultAnswerTimeout)
+	}
+	return defaultAnswerTimeout
+}
+
+// continuationTransport is implemented by transports whose messages carry the
+// continuation token of the question they answer, e.g. HTTP's X-Agent-Continuation header.
+type continuationTransport interface {
+	Continuation() string
+}
+
+// turnAway answers the current message, which doesn't answer the pending
+// question, with an error. The question's continuation token is left out, as
+// the message may come from someone else.
+func (a *Agent) turnAway(message string) {
+	if transport, ok := a.current.(statusTransport); ok {
+		transport.SetStatus(awaitingInputStatus, "")
+	}
+	var err error
+	if transport, ok := a.current.(errorTransport); ok {
+		err = transport.WriteError(http.StatusConflict, message)
+	} else {
+		err = a.current.Write(message)
+	}
+	if err != nil {
+		fmt.Printf("Failed to turn away a message: %v\n", err)
+	}
+}
@@ -0,0 +1,56 @@
+package agent
+
+import (
+	"context"
+	"testing"
+)
+
+// recordingTransport keeps what the agent writes.
+type recordingTransport struct {
+	writes []string
+}
+
+func (r *recordingTransport) Read() (string, error) { select {} }
+
+func (r *recordingTransport) Write(message string) error {
+	r.writes = append(r.writes, message)
+	return nil
+}
+
+func (r *recordingTransport) Close() error { return nil }
+
+// TestAskForInputTimeout checks an unanswered question frees the agent, and the
+// rest of the turn doesn't reply again in place of the question.
+func TestAskForInputTimeout(t *testing.T) {
+	t.Setenv("ANSWER_TIMEOUT", "50ms")
+	asking := &recordingTransport{}
+	a := &Agent{inputs: make(chan transportInput), current: asking}
+
+	if _, err := a.askForInput(context.Background(), "Which API?"); err == nil {
+		t.Fatal("an unanswered question returned no error")
+	}
+	if _, err := a.askForInput(context.Background(), "Which API, again?"); err == nil {
+		t.Fatal("a second question was asked after the first went unanswered")
+	}
+	if err := a.writeOutput("Done, using v1."); err != nil {
+		t.Fatal(err)
+	}
+	if len(asking.writes) != 1 || asking.writes[0] != "Which API?" {
+		t.Errorf("the asking transport got %q, want only the question", asking.writes)
+	}
+
+	// The next message starts a turn that can ask again, until the turn is cancelled.
+	next := &recordingTransport{}
+	go func() { a.inputs <- transportInput{transport: next, message: "hello"} }()
+	if _, err := a.readInput(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := a.askForInput(ctx, "Which file?"); err == nil {
+		t.Fatal("a question of a cancelled turn returned no error")
+	}
+	if len(next.writes) != 1 || next.writes[0] != "Which file?" {
+		t.Errorf("the next transport got %q, want the question", next.writes)
+	}
+}
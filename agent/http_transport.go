@@ -0,0 +1,307 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// HTTPTransport receives messages as POST requests and answers each with the agent's reply.
+// Requests are answered in the order they were read, so each keeps its own
+// response and headers while the agent works on an earlier one.
+type HTTPTransport struct {
+	requestChan chan *httpRequest
+	closed      chan struct{}
+	closeOnce   sync.Once
+
+	// Requests read but not answered yet, oldest first.
+	mu           sync.Mutex
+	pending      []*httpRequest
+	status       string
+	continuation string
+	capabilities string
+}
+
+// httpRequest is a request waiting for the agent's reply.
+type httpRequest struct {
+	r    *http.Request
+	w    http.ResponseWriter
+	done chan error
+
+	session      string
+	requestID    string
+	authToken    string
+	continuation string
+	// Whether the response is a text/event-stream, which gets the turn's events
+	// as they happen and then the reply, instead of just the reply.
+	stream bool
+}
+
+func NewHTTPTransport() *HTTPTransport {
+	return &HTTPTransport{
+		requestChan: make(chan *httpRequest),
+		closed:      make(chan struct{}),
+	}
+}
+
+func (t *HTTPTransport) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fmt.Println("Handling request")
+
+	request := &httpRequest{
+		r:            r,
+		w:            w,
+		done:         make(chan error, 1),
+		session:      r.Header.Get("X-Session-ID"),
+		requestID:    r.Header.Get("X-Request-ID"),
+		authToken:    bearerToken(r),
+		continuation: r.Header.Get("X-Agent-Continuation"),
+		stream:       strings.Contains(r.Header.Get("Accept"), "text/event-stream"),
+	}
+	select {
+	case t.requestChan <- request:
+	case <-t.closed:
+		http.Error(w, "The agent is shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	// The agent writes the response; wait until it's done with it.
+	if err := <-request.done; err != nil {
+		fmt.Printf("Failed to write HTTP response: %v\n", err)
+	}
+}
+
+// Read returns the body of the next request, which is answered by the next
+// Write or WriteError after those of the requests read before it.
+func (t *HTTPTransport) Read() (string, error) {
+	fmt.Println("Reading from network")
+
+	var request *httpRequest
+	select {
+	case request = <-t.requestChan:
+	case <-t.closed:
+		return "", io.EOF
+	}
+
+	body, err := io.ReadAll(request.r.Body)
+	if err != nil {
+		http.Error(request.w, "failed to read request body", http.StatusBadRequest)
+		request.done <- nil
+		return "", fmt.Errorf("failed to read request body: %v", err)
+	}
+
+	if request.stream {
+		t.startStream(request)
+	}
+	t.mu.Lock()
+	t.pending = append(t.pending, request)
+	t.mu.Unlock()
+	return string(body), nil
+}
+
+// startStream answers a request with an event stream right away.
+func (t *HTTPTransport) startStream(request *httpRequest) {
+	w := request.w
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	if request.requestID != "" {
+		w.Header().Set("X-Request-ID", request.requestID)
+	}
+	if t.capabilities != "" {
+		w.Header().Set("X-Agent-Capabilities", t.capabilities)
+	}
+	w.WriteHeader(http.StatusOK)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// current returns the request being answered, or nil.
+func (t *HTTPTransport) current() *httpRequest {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if len(t.pending) == 0 {
+		return nil
+	}
+	return t.pending[0]
+}
+
+// answer removes the request being answered from the queue, returning it with
+// the status and continuation to send with its reply.
+func (t *HTTPTransport) answer() (*httpRequest, string, string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status, continuation := t.status, t.continuation
+	t.status, t.continuation = "", ""
+	if len(t.pending) == 0 {
+		return nil, "", "", fmt.Errorf("no HTTP request to reply to")
+	}
+	request := t.pending[0]
+	t.pending = t.pending[1:]
+	return request, status, continuation, nil
+}
+
+// Event sends an event of the turn to a client streaming it.
+func (t *HTTPTransport) Event(event Event) {
+	if request := t.current(); request != nil && request.stream {
+		request.sendEvent(string(event.Type), event)
+	}
+}
+
+// sendEvent writes one server-sent event.
+func (r *httpRequest) sendEvent(name string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(r.w, "event: %s\ndata: %s\n\n", name, payload); err != nil {
+		return err
+	}
+	if flusher, ok := r.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+	return nil
+}
+
+// endStream sends the last event of a stream and completes its request.
+func (r *httpRequest) endStream(name string, data any) error {
+	err := r.sendEvent(name, data)
+	r.done <- err
+	return err
+}
+
+// Write answers the oldest unanswered request with the agent's reply.
+func (t *HTTPTransport) Write(message string) error {
+	fmt.Println("Writing to network")
+
+	request, status, continuation, err := t.answer()
+	if err != nil {
+		return err
+	}
+
+	// A streamed reply carries in its event what would be headers.
+	if request.stream {
+		return request.endStream("reply", struct {
+			Text         string `json:"text"`
+			Status       string `json:"status,omitempty"`
+			Continuation string `json:"continuation,omitempty"`
+		}{message, status, continuation})
+	}
+
+	w := request.w
+	w.Header().Set("Content-Type", "text/plain")
+	if status != "" {
+		w.Header().Set("X-Agent-Status", status)
+	}
+	if continuation != "" {
+		w.Header().Set("X-Agent-Continuation", continuation)
+	}
+	if request.requestID != "" {
+		w.Header().Set("X-Request-ID", request.requestID)
+	}
+	if t.capabilities != "" {
+		w.Header().Set("X-Agent-Capabilities", t.capabilities)
+	}
+	w.WriteHeader(http.StatusOK)
+	_, err = w.Write([]byte(message))
+
+	// Signal completion to the HTTP handler
+	request.done <- err
+
+	return err
+}
+
+// WriteError answers the oldest unanswered request with a JSON error and the
+// given status code, and the status and continuation set for it, if any.
+func (t *HTTPTransport) WriteError(status int, message string) error {
+	request, agentStatus, continuation, err := t.answer()
+	if err != nil {
+		return err
+	}
+
+	if request.stream {
+		event := map[string]any{"error": message, "status": status}
+		if continuation != "" {
+			event["continuation"] = continuation
+		}
+		return request.endStream("error", event)
+	}
+
+	w := request.w
+	w.Header().Set("Content-Type", "application/json")
+	if agentStatus != "" {
+		w.Header().Set("X-Agent-Status", agentStatus)
+	}
+	if continuation != "" {
+		w.Header().Set("X-Agent-Continuation", continuation)
+	}
+	if t.capabilities != "" {
+		w.Header().Set("X-Agent-Capabilities", t.capabilities)
+	}
+	w.WriteHeader(status)
+	err = json.NewEncoder(w).Encode(map[string]any{"error": message, "status": status})
+
+	request.done <- err
+	return err
+}
+
+// SetStatus sets the status and continuation token sent with the next reply.
+func (t *HTTPTransport) SetStatus(status string, continuation string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.status = status
+	t.continuation = continuation
+}
+
+// SetCapabilitiesVersion sets the version of the agent's capability manifest sent
+// with every reply, so callers know when to fetch it again. Call before serving.
+func (t *HTTPTransport) SetCapabilitiesVersion(version string) {
+	t.capabilities = version
+}
+
+// RequestID returns the X-Request-ID of the request being answered.
+func (t *HTTPTransport) RequestID() string {
+	if request := t.current(); request != nil {
+		return request.requestID
+	}
+	return ""
+}
+
+// Session returns the X-Session-ID of the request being answered.
+func (t *HTTPTransport) Session() string {
+	if request := t.current(); request != nil {
+		return request.session
+	}
+	return ""
+}
+
+// AuthToken returns the bearer token of the request being answered.
+func (t *HTTPTransport) AuthToken() string {
+	if request := t.current(); request != nil {
+		return request.authToken
+	}
+	return ""
+}
+
+// Continuation returns the X-Agent-Continuation of the request being answered.
+func (t *HTTPTransport) Continuation() string {
+	if request := t.current(); request != nil {
+		return request.continuation
+	}
+	return ""
+}
+
+func (t *HTTPTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return nil
+}
@@ -0,0 +1,70 @@
+package agent
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// TestHTTPTransportConcurrentClients reads a second request while the first is
+// being answered, as the agent does, and checks each client gets its own reply
+// and the agent sees the headers of the request it is answering.
+func TestHTTPTransportConcurrentClients(t *testing.T) {
+	transport := NewHTTPTransport()
+	server := httptest.NewServer(transport)
+	defer server.Close()
+	defer transport.Close()
+
+	clients := []string{"alice", "bob"}
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			request, _ := http.NewRequest("POST", server.URL, strings.NewReader(client))
+			request.Header.Set("X-Request-ID", client+"-request")
+			request.Header.Set("X-Session-ID", client+"-session")
+			request.Header.Set("Authorization", "Bearer "+client+"-token")
+			response, err := http.DefaultClient.Do(request)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer response.Body.Close()
+			body, _ := io.ReadAll(response.Body)
+			if want := "reply to " + client; string(body) != want {
+				t.Errorf("%s got %q, want %q", client, body, want)
+			}
+			if id := response.Header.Get("X-Request-ID"); id != client+"-request" {
+				t.Errorf("%s got X-Request-ID %q", client, id)
+			}
+		}()
+	}
+
+	first, err := transport.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := transport.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, message := range []string{first, second} {
+		for _, check := range []struct{ name, got, want string }{
+			{"request ID", transport.RequestID(), message + "-request"},
+			{"session", transport.Session(), message + "-session"},
+			{"auth token", transport.AuthToken(), message + "-token"},
+		} {
+			if check.got != check.want {
+				t.Errorf("answering %s: %s is %q, want %q", message, check.name, check.got, check.want)
+			}
+		}
+		if err := transport.Write("reply to " + message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
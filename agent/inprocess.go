@@ -0,0 +1,68 @@
+package agent
+
+import (
+	"context"
+	"io"
+	"sync"
+)
+
+// InProcessTransport lets Go code talk to the agent directly, see SendMessage.
+type InProcessTransport struct {
+	inbox     chan string
+	outbox    chan string
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func NewInProcessTransport() *InProcessTransport {
+	return &InProcessTransport{
+		inbox:  make(chan string),
+		outbox: make(chan string),
+		closed: make(chan struct{}),
+	}
+}
+
+// SendMessage sends a user message and waits for the agent's reply.
+// If the agent asks a clarifying question, the question is the reply and the next
+// SendMessage call is the answer.
+func (t *InProcessTransport) SendMessage(ctx context.Context, message string) (string, error) {
+	select {
+	case t.inbox <- message:
+	case <-t.closed:
+		return "", io.EOF
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+
+	select {
+	case reply := <-t.outbox:
+		return reply, nil
+	case <-t.closed:
+		return "", io.EOF
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (t *InProcessTransport) Read() (string, error) {
+	select {
+	case message := <-t.inbox:
+		return message, nil
+	case <-t.closed:
+		return "", io.EOF
+	}
+}
+
+func (t *InProcessTransport) Write(message string) error {
+	select {
+	case t.outbox <- message:
+		return nil
+	case <-t.closed:
+		return io.EOF
+	}
+}
+
+func (t *InProcessTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+	return nil
+}
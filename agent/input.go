@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/tools"
+)
+
+// Prefix used on the CLI to attach an image, e.g. "/image trace.png why does this panic?"
+const imageCommandPrefix = "/image "
+
+// Supported image media types for the model.
+var supportedImageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// ImageInput is an image attached to a request over HTTP.
+type ImageInput struct {
+	MediaType string `json:"media_type"`
+	Data      string `json:"data"` // base64 encoded
+}
+
+// RequestInput is the JSON body accepted by the agent's HTTP endpoint.
+// Plain text bodies are still accepted and treated as the query.
+type RequestInput struct {
+	Query  string       `json:"query"`
+	Images []ImageInput `json:"images,omitempty"`
+}
+
+// buildUserContent turns raw user input into the content blocks of a user message.
+// /image attaches a file from files, which is nil for transports whose users
+// mustn't read the agent's files.
+func buildUserContent(input string, files tools.FS) ([]anthropic.ContentBlockParamUnion, error) {
+	// CLI: /image <path> [text]
+	if files != nil && strings.HasPrefix(input, imageCommandPrefix) {
+		rest := strings.TrimSpace(strings.TrimPrefix(input, imageCommandPrefix))
+		path, text, _ := strings.Cut(rest, " ")
+
+		image, err := imageBlockFromFile(files, path)
+		if err != nil {
+			return nil, err
+		}
+
+		blocks := []anthropic.ContentBlockParamUnion{image}
+		if text = strings.TrimSpace(text); text != "" {
+			blocks = append(blocks, anthropic.NewTextBlock(text))
+		}
+		return blocks, nil
+	}
+
+	// HTTP: {"query": "...", "images": [{"media_type": "...", "data": "..."}]}
+	var request RequestInput
+	// A JSON body's query is the text, with or without images.
+	if err := json.Unmarshal([]byte(input), &request); err == nil && request.Query != "" {
+		blocks := []anthropic.ContentBlockParamUnion{}
+		for _, image := range request.Images {
+			if !supportedImageTypes[image.MediaType] {
+				return nil, fmt.Errorf("unsupported image media type: %s", image.MediaType)
+			}
+			if _, err := base64.StdEncoding.DecodeString(image.Data); err != nil {
+				return nil, fmt.Errorf("invalid base64 image data: %v", err)
+			}
+			blocks = append(blocks, anthropic.NewImageBlockBase64(image.MediaType, image.Data))
+		}
+		return append(blocks, anthropic.NewTextBlock(request.Query)), nil
+	}
+
+	return []anthropic.ContentBlockParamUnion{anthropic.NewTextBlock(input)}, nil
+}
+
+// imageBlockFromFile reads an image from files and encodes it as an image block.
+func imageBlockFromFile(files tools.FS, path string) (anthropic.ContentBlockParamUnion, error) {
+	data, err := files.ReadFile(path)
+	if err != nil {
+		return anthropic.ContentBlockParamUnion{}, fmt.Errorf("failed to read image: %v", err)
+	}
+
+	mediaType := http.DetectContentType(data)
+	if !supportedImageTypes[mediaType] {
+		return anthropic.ContentBlockParamUnion{}, fmt.Errorf("unsupported image type %s for %s", mediaType, path)
+	}
+
+	return anthropic.NewImageBlockBase64(mediaType, base64.StdEncoding.EncodeToString(data)), nil
+}
@@ -0,0 +1,44 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/kartikx/agent/locale"
+)
+
+// catalogFromEnv reads AGENT_LOCALE (e.g. "es", default English) and LOCALE_DIR,
+// a directory of catalogs taking precedence over the built-in ones.
+func catalogFromEnv() *locale.Catalog {
+	catalog, err := locale.Load(os.Getenv("AGENT_LOCALE"), os.Getenv("LOCALE_DIR"))
+	if err != nil {
+		fmt.Printf("%v, using English\n", err)
+		return nil
+	}
+	return catalog
+}
+
+// SetLocale makes the agent talk to users in the catalog's language: the model
+// is told to reply in it, tool descriptions are translated and the agent's own
+// messages are. A nil catalog is English.
+func (a *Agent) SetLocale(catalog *locale.Catalog) {
+	a.catalog = catalog
+}
+
+// text returns the message key in the agent's language, formatted with args if
+// there are any; english is the message and its format.
+func (a *Agent) text(key string, english string, args ...any) string {
+	format := a.catalog.Text(key, english)
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// localeInstruction tells the model which language to reply in, if not English.
+func (a *Agent) localeInstruction() string {
+	if a.catalog == nil {
+		return ""
+	}
+	return fmt.Sprintf("Reply to the user in %s, whatever language tool results, files or documentation are in. Keep tool names, code, identifiers, file paths and command output as they are.", a.catalog.Language)
+}
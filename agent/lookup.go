@@ -0,0 +1,60 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/kartikx/agent/docsource"
+)
+
+// handleLookup serves GET /<agent>/lookup?pkg=net/http&symbol=Client: the
+// documentation search_documentation would give the model, without the model.
+// source picks the documentation source as the tool's input does; symbol only
+// works for Go packages.
+func (a *Agent) handleLookup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	pkg, symbol := query.Get("pkg"), query.Get("symbol")
+	if pkg == "" {
+		http.Error(w, "pkg is required, e.g. ?pkg=net/http&symbol=Client", http.StatusBadRequest)
+		return
+	}
+	source, err := docsource.Pick(pkg, query.Get("source"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if symbol != "" && source.Name() != "go" {
+		http.Error(w, fmt.Sprintf("symbol lookups only work for Go packages, not %s documentation", source.Name()), http.StatusBadRequest)
+		return
+	}
+
+	// Shares the response cache with queries, under a key no query looks like.
+	key := "/lookup?" + url.Values{"source": {source.Name()}, "pkg": {pkg}, "symbol": {symbol}}.Encode()
+	text, ok := a.cache.get(key, a.clock.Now())
+	if !ok {
+		if symbol != "" {
+			text, err = docsource.GoSymbol(r.Context(), pkg, symbol)
+		} else {
+			text, err = source.Fetch(r.Context(), pkg)
+		}
+		if errors.Is(err, docsource.ErrNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		a.cache.put(key, text, a.clock.Now())
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(text))
+}
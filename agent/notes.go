@@ -0,0 +1,143 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// Note is an entry in the model's scratchpad for a session.
+type Note struct {
+	Key     string    `json:"key"`
+	Text    string    `json:"text"`
+	Updated time.Time `json:"updated"`
+}
+
+type sessionKey struct{}
+
+// withSession returns a context carrying the session a turn belongs to.
+func withSession(ctx context.Context, current *session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, current)
+}
+
+func sessionFrom(ctx context.Context) (*session, error) {
+	current, ok := ctx.Value(sessionKey{}).(*session)
+	if !ok {
+		return nil, fmt.Errorf("notes are only available within a conversation")
+	}
+	return current, nil
+}
+
+// SaveNote tool for keeping intermediate findings outside the conversation
+type SaveNoteInput struct {
+	Key  string `json:"key" jsonschema:"minLength=1" jsonschema_description:"Short name for the note, e.g. failing-tests. Saving under an existing key replaces that note."`
+	Text string `json:"text" jsonschema_description:"The note. Save an empty text to delete the note."`
+}
+
+var SaveNoteInputSchema = tools.GenerateSchema[SaveNoteInput]()
+
+// saveNoteDefinition is bound to the agent, since notes belong to the session being handled.
+func (a *Agent) saveNoteDefinition() tools.ToolDefinition {
+	return tools.ToolDefinition{
+		Name:        "save_note",
+		Description: "Save a note to your scratchpad for this conversation. Notes survive even when older messages are trimmed from your context, so use them in long tasks for findings, plans and progress you will need later.",
+		InputSchema: SaveNoteInputSchema,
+		Function:    a.SaveNote,
+		Category:    tools.CategoryWrite,
+		Examples: []tools.ToolExample{
+			{Input: `{"key": "plan", "text": "1. fix parser bug (done)\n2. add tests for empty input\n3. update README"}`, Output: "Saved note plan (1 note in total)"},
+		},
+	}
+}
+
+func (a *Agent) SaveNote(ctx context.Context, input json.RawMessage) (string, error) {
+	saveNoteInput := SaveNoteInput{}
+
+	err := json.Unmarshal(input, &saveNoteInput)
+	if err != nil {
+		return "", err
+	}
+
+	current, err := sessionFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	current.notesMu.Lock()
+	defer current.notesMu.Unlock()
+
+	for i, note := range current.notes {
+		if note.Key != saveNoteInput.Key {
+			continue
+		}
+		if saveNoteInput.Text == "" {
+			current.notes = append(current.notes[:i], current.notes[i+1:]...)
+			return fmt.Sprintf("Deleted note %s (%d notes in total)", saveNoteInput.Key, len(current.notes)), nil
+		}
+		current.notes[i] = Note{Key: saveNoteInput.Key, Text: saveNoteInput.Text, Updated: a.clock.Now()}
+		return fmt.Sprintf("Updated note %s (%d notes in total)", saveNoteInput.Key, len(current.notes)), nil
+	}
+
+	if saveNoteInput.Text == "" {
+		return "", fmt.Errorf("there is no note %s to delete", saveNoteInput.Key)
+	}
+	current.notes = append(current.notes, Note{Key: saveNoteInput.Key, Text: saveNoteInput.Text, Updated: a.clock.Now()})
+	return fmt.Sprintf("Saved note %s (%d notes in total)", saveNoteInput.Key, len(current.notes)), nil
+}
+
+// ReadNotes tool for reading back the scratchpad
+type ReadNotesInput struct {
+	Key string `json:"key,omitempty" jsonschema_description:"Only read the note with this key. Reads all notes if omitted."`
+}
+
+var ReadNotesInputSchema = tools.GenerateSchema[ReadNotesInput]()
+
+func (a *Agent) readNotesDefinition() tools.ToolDefinition {
+	return tools.ToolDefinition{
+		Name:        "read_notes",
+		Description: "Read the notes saved to your scratchpad in this conversation with save_note.",
+		InputSchema: ReadNotesInputSchema,
+		Function:    a.ReadNotes,
+		Category:    tools.CategoryRead,
+		Examples: []tools.ToolExample{
+			{Input: `{}`, Output: "## plan (updated 14:02)\n1. fix parser bug (done)\n2. add tests for empty input"},
+		},
+	}
+}
+
+func (a *Agent) ReadNotes(ctx context.Context, input json.RawMessage) (string, error) {
+	readNotesInput := ReadNotesInput{}
+
+	err := json.Unmarshal(input, &readNotesInput)
+	if err != nil {
+		return "", err
+	}
+
+	current, err := sessionFrom(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	current.notesMu.Lock()
+	defer current.notesMu.Unlock()
+
+	var result strings.Builder
+	for _, note := range current.notes {
+		if readNotesInput.Key != "" && note.Key != readNotesInput.Key {
+			continue
+		}
+		result.WriteString(fmt.Sprintf("## %s (updated %s)\n%s\n\n", note.Key, note.Updated.Format("15:04"), note.Text))
+	}
+
+	if result.Len() == 0 {
+		if readNotesInput.Key != "" {
+			return "", fmt.Errorf("there is no note %s", readNotesInput.Key)
+		}
+		return "The scratchpad is empty.", nil
+	}
+	return strings.TrimSpace(result.String()), nil
+}
@@ -0,0 +1,72 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Attempts at an inference that keeps failing with transient errors.
+const maxInferAttempts = 4
+
+// Delay before the first retry; doubled for each one after.
+const inferRetryDelay = time.Second
+
+type errorClass int
+
+const (
+	// transientError is retried, e.g. rate limits, overload and network failures.
+	transientError errorClass = iota
+	// recoverableError fails the turn but not the agent, e.g. a rejected request.
+	recoverableError
+	// fatalError stops Run, e.g. invalid credentials or a cancelled context.
+	fatalError
+)
+
+func classifyError(ctx context.Context, err error) errorClass {
+	if ctx.Err() != nil {
+		return fatalError
+	}
+
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) {
+		switch {
+		case apiErr.StatusCode == http.StatusUnauthorized, apiErr.StatusCode == http.StatusForbidden:
+			return fatalError
+		case apiErr.StatusCode == http.StatusTooManyRequests, apiErr.StatusCode >= 500:
+			return transientError
+		default:
+			return recoverableError
+		}
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) {
+		return transientError
+	}
+	return recoverableError
+}
+
+// inferWithRetry calls Infer, retrying transient failures with exponential backoff.
+func (a *Agent) inferWithRetry(ctx context.Context, messages []anthropic.MessageParam, tools []anthropic.ToolUnionParam) (*anthropic.Message, error) {
+	delay := inferRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		response, err := a.Infer(ctx, messages, tools)
+		if err == nil {
+			return response, nil
+		}
+		if attempt == maxInferAttempts || classifyError(ctx, err) != transientError {
+			return nil, err
+		}
+
+		fmt.Printf("%s⚠️  Inference failed (attempt %d/%d), retrying in %s: %v%s\n", BlueColor, attempt, maxInferAttempts, delay, err, ResetColor)
+		a.clock.Sleep(delay)
+		delay *= 2
+	}
+}
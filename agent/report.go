@@ -0,0 +1,334 @@
+package agent
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// How long delivering a report to a webhook or mail server may take.
+const reportDeliveryTimeout = 30 * time.Second
+
+// Longest tool input shown for a step, and most test output kept; the end is kept.
+const maxReportStepInput = 200
+const maxReportTestOutput = 4_000
+
+// Most diff text included in a rendered report.
+const maxReportDiff = 100_000
+
+// Commands taken for test runs, e.g. "go test ./..." or "make test".
+var testCommandPattern = regexp.MustCompile(`\b(test|tests|pytest|jest|vitest|rspec)\b`)
+
+// The command line at the start of execute_command, run_in_shell and run_tests results.
+var resultCommandPattern = regexp.MustCompile(`(?m)^Command: (.*)$`)
+
+var reportClient = &http.Client{Timeout: reportDeliveryTimeout}
+
+// TaskReport makes an unattended run reviewable: what it was asked, the tools
+// it called, the files it changed, the tests it ran and what it cost.
+type TaskReport struct {
+	Task     string    `json:"task"`
+	Session  string    `json:"session"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	// "ok", "failed", or the agent's status for the reply, e.g. budget_exceeded.
+	Status  string             `json:"status"`
+	Report  string             `json:"report"`
+	Steps   []ReportStep       `json:"steps,omitempty"`
+	Changes []tools.FileChange `json:"changes,omitempty"`
+	Tests   []TestRun          `json:"tests,omitempty"`
+	Cost    float64            `json:"cost_usd"`
+}
+
+// ReportStep is one tool call of the run.
+type ReportStep struct {
+	Tool   string `json:"tool"`
+	Input  string `json:"input"`
+	Failed bool   `json:"failed,omitempty"`
+
+	id      string
+	command string
+}
+
+// TestRun is a command the run used to run tests, and how it went.
+type TestRun struct {
+	Command string `json:"command"`
+	Passed  bool   `json:"passed"`
+	Output  string `json:"output,omitempty"`
+}
+
+// record adds what happened during the run's turn to the report.
+func (r *TaskReport) record(event Event) {
+	switch event.Type {
+	case ToolCalled:
+		step := ReportStep{Tool: event.ToolName, id: event.ToolID}
+		var compact bytes.Buffer
+		if json.Compact(&compact, event.ToolInput) == nil {
+			step.Input = compact.String()
+		}
+		if len(step.Input) > maxReportStepInput {
+			step.Input = step.Input[:maxReportStepInput] + " ..."
+		}
+		switch event.ToolName {
+		case "execute_command":
+			var input tools.ExecuteCommandInput
+			if json.Unmarshal(event.ToolInput, &input) == nil && testCommandPattern.MatchString(input.Command) {
+				step.command = input.Command
+			}
+		case "run_in_shell":
+			var input tools.RunInShellInput
+			if json.Unmarshal(event.ToolInput, &input) == nil && testCommandPattern.MatchString(input.Command) {
+				step.command = input.Command
+			}
+		case "run_tests":
+			step.command = "run_tests " + step.Input
+		}
+		r.Steps = append(r.Steps, step)
+	case ToolResult:
+		for i := range r.Steps {
+			step := &r.Steps[i]
+			if step.id != event.ToolID {
+				continue
+			}
+			step.Failed = event.IsError
+			if step.command != "" {
+				command := step.command
+				if match := resultCommandPattern.FindStringSubmatch(event.Result); match != nil {
+					command = match[1]
+				}
+				output := strings.TrimSpace(event.Result)
+				if len(output) > maxReportTestOutput {
+					output = "[... output truncated]\n" + output[len(output)-maxReportTestOutput:]
+				}
+				r.Tests = append(r.Tests, TestRun{Command: command, Passed: !event.IsError, Output: output})
+			}
+		}
+		r.Changes = append(r.Changes, event.Changes...)
+	case TurnEnded:
+		r.Cost = event.Cost
+	}
+}
+
+// Markdown renders the report for people, e.g. as the body of an email.
+func (r *TaskReport) Markdown() string {
+	var content strings.Builder
+	fmt.Fprintf(&content, "# %s\n\n", r.Task)
+	fmt.Fprintf(&content, "- Status: %s\n", r.Status)
+	fmt.Fprintf(&content, "- Started: %s\n", r.Started.Format(time.RFC3339))
+	fmt.Fprintf(&content, "- Finished: %s (%s)\n", r.Finished.Format(time.RFC3339), r.Finished.Sub(r.Started).Round(time.Second))
+	fmt.Fprintf(&content, "- Session: %s\n", r.Session)
+	fmt.Fprintf(&content, "- Cost: $%.4f\n\n", r.Cost)
+	fmt.Fprintf(&content, "## Report\n\n%s\n", strings.TrimSpace(r.Report))
+
+	if len(r.Tests) > 0 {
+		content.WriteString("\n## Tests\n\n")
+		for _, test := range r.Tests {
+			result := "passed"
+			if !test.Passed {
+				result = "failed"
+			}
+			fmt.Fprintf(&content, "- `%s` %s\n", test.Command, result)
+			if !test.Passed && test.Output != "" {
+				fmt.Fprintf(&content, "\n```\n%s\n```\n\n", test.Output)
+			}
+		}
+	}
+
+	if len(r.Changes) > 0 {
+		content.WriteString("\n## Changes\n\n")
+		var diff strings.Builder
+		for _, change := range r.Changes {
+			fmt.Fprintf(&content, "- %s %s (+%d -%d)\n", change.Operation, change.Path, change.Added, change.Removed)
+			diff.WriteString(change.Diff)
+		}
+		if diff.Len() > 0 {
+			diffText := diff.String()
+			if len(diffText) > maxReportDiff {
+				diffText = diffText[:maxReportDiff] + "\n[... diff truncated]\n"
+			}
+			fmt.Fprintf(&content, "\n```diff\n%s```\n", diffText)
+		}
+	}
+
+	if len(r.Steps) > 0 {
+		content.WriteString("\n## Steps\n\n")
+		for i, step := range r.Steps {
+			fmt.Fprintf(&content, "%d. `%s` %s", i+1, step.Tool, step.Input)
+			if step.Failed {
+				content.WriteString(" (failed)")
+			}
+			content.WriteString("\n")
+		}
+	}
+	return content.String()
+}
+
+// ReportDelivery says where the reports of unattended runs are sent.
+type ReportDelivery struct {
+	// URL the report is POSTed to as JSON, see TaskReport.
+	Webhook string `json:"webhook,omitempty"`
+	// Addresses the report is emailed to, through the SMTP_* server.
+	Email []string `json:"email,omitempty"`
+	// Directory each report is written to as <task>-<time>.md.
+	ReportDir string `json:"report_dir,omitempty"`
+}
+
+func (d ReportDelivery) configured() bool {
+	return d.Webhook != "" || len(d.Email) > 0 || d.ReportDir != ""
+}
+
+func (d ReportDelivery) validate() error {
+	if d.Webhook != "" && !strings.HasPrefix(d.Webhook, "http://") && !strings.HasPrefix(d.Webhook, "https://") {
+		return fmt.Errorf("webhook must be an http or https URL")
+	}
+	if len(d.Email) > 0 {
+		if config := smtpConfigFromEnv(); config.addr == "" || config.from == "" {
+			return fmt.Errorf("set SMTP_ADDR and SMTP_FROM to email reports")
+		}
+	}
+	for _, address := range d.Email {
+		if !strings.Contains(address, "@") || strings.ContainsAny(address, "\r\n") {
+			return fmt.Errorf("invalid email address %q", address)
+		}
+	}
+	return nil
+}
+
+// deliver sends the report everywhere it should go, logging failures.
+func (d ReportDelivery) deliver(report *TaskReport) {
+	if d.ReportDir != "" {
+		if err := writeTaskReport(d.ReportDir, report); err != nil {
+			fmt.Printf("Failed to write the report of %s: %v\n", report.Task, err)
+		}
+	}
+	if d.Webhook != "" {
+		if err := postTaskReport(d.Webhook, report); err != nil {
+			fmt.Printf("Failed to send the report of %s to its webhook: %v\n", report.Task, err)
+		}
+	}
+	if len(d.Email) > 0 {
+		if err := emailTaskReport(smtpConfigFromEnv(), d.Email, report); err != nil {
+			fmt.Printf("Failed to email the report of %s: %v\n", report.Task, err)
+		}
+	}
+}
+
+func writeTaskReport(dir string, report *TaskReport) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s-%s.md", report.Task, report.Started.Format("20060102-150405")))
+	return os.WriteFile(path, []byte(report.Markdown()), 0644)
+}
+
+func postTaskReport(url string, report *TaskReport) error {
+	body, err := json.Marshal(report)
+	if err != nil {
+		return err
+	}
+	resp, err := reportClient.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %s", resp.Status)
+	}
+	return nil
+}
+
+// smtpConfig is the mail server reports are emailed through.
+type smtpConfig struct {
+	addr     string
+	username string
+	password string
+	from     string
+}
+
+// smtpConfigFromEnv reads SMTP_ADDR (host:port), SMTP_USERNAME, SMTP_PASSWORD and SMTP_FROM.
+func smtpConfigFromEnv() smtpConfig {
+	return smtpConfig{
+		addr:     os.Getenv("SMTP_ADDR"),
+		username: os.Getenv("SMTP_USERNAME"),
+		password: os.Getenv("SMTP_PASSWORD"),
+		from:     os.Getenv("SMTP_FROM"),
+	}
+}
+
+// emailTaskReport sends the report as a plain text email, using STARTTLS when
+// the server offers it and PLAIN authentication when a username is set.
+func emailTaskReport(config smtpConfig, to []string, report *TaskReport) error {
+	host, _, err := net.SplitHostPort(config.addr)
+	if err != nil {
+		return fmt.Errorf("invalid SMTP_ADDR %q: %v", config.addr, err)
+	}
+	conn, err := net.DialTimeout("tcp", config.addr, reportDeliveryTimeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(reportDeliveryTimeout))
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return err
+		}
+	}
+	if config.username != "" {
+		if err := client.Auth(smtp.PlainAuth("", config.username, config.password, host)); err != nil {
+			return err
+		}
+	}
+	if err := client.Mail(config.from); err != nil {
+		return err
+	}
+	for _, address := range to {
+		if err := client.Rcpt(address); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	var message strings.Builder
+	fmt.Fprintf(&message, "From: %s\r\n", config.from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", fmt.Sprintf("[agent] %s: %s", report.Task, report.Status)))
+	fmt.Fprintf(&message, "Date: %s\r\n", report.Finished.Format(time.RFC1123Z))
+	message.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+	if _, err := writer.Write([]byte(message.String())); err != nil {
+		return err
+	}
+	// Quoted-printable keeps long diff lines within SMTP's line length limit.
+	body := quotedprintable.NewWriter(writer)
+	if _, err := body.Write([]byte(report.Markdown())); err != nil {
+		return err
+	}
+	if err := body.Close(); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return client.Quit()
+}
@@ -0,0 +1,600 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/anthropics/anthropic-sdk-go"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// Limits of the repository overview.
+const (
+	repoOverviewDirs   = 60     // directories described up front
+	repoZoomDirs       = 30     // subdirectories described when zooming into one
+	repoMaxDirs        = 20_000 // directories walked
+	repoSamples        = 4      // files sampled per directory
+	repoSampleBytes    = 3_000  // read from each sampled file
+	repoListedFiles    = 40     // file names shown per directory
+	repoParallelCalls  = 8
+	repoEntryPointsMax = 20
+)
+
+const repoDirPrompt = `You describe one directory of a large software repository for a developer new to it, from its layout and a few of its files.
+
+Answer in one or two sentences: what the code in it does and what it's for. Name its most important files or subdirectories if that helps. Don't start with "This directory", and don't guess beyond what the files show.
+
+<directory path=%q files="%d">
+%s
+</directory>`
+
+const repoRootPrompt = `Below are descriptions of the top-level directories of a large software repository, with their file counts. Write a short overview for a developer new to it: what the repository is, how it's organized, the key packages most other code builds on, and where to start reading. At most eight sentences, no headings or lists.
+
+%s`
+
+// RepoSummarizer describes repositories too large to explore file by file: a
+// short overview, then each top-level directory and its largest subdirectories,
+// written by a cheap model from a few files sampled in each. Descriptions are
+// kept on disk and only redone for directories whose files changed. A nil
+// RepoSummarizer is disabled.
+type RepoSummarizer struct {
+	Model anthropic.Model
+	// Workspaces with fewer files only get the plain workspace summary.
+	MinFiles int
+	// Directory the descriptions are kept in, one file per workspace.
+	CacheDir string
+	// If set, the descriptions are encrypted with it.
+	Sealer *Sealer
+
+	// Serializes builds, which share the cache file.
+	buildMu sync.Mutex
+
+	mu       sync.Mutex
+	key      string // workspace the overview describes
+	overview string
+}
+
+// repoSummarizerFromEnv reads REPO_SUMMARY ("on", default off), REPO_SUMMARY_MODEL
+// (default Haiku), REPO_SUMMARY_MIN_FILES (default 2000) and REPO_SUMMARY_DIR
+// (default a directory in the user's cache directory).
+func repoSummarizerFromEnv() *RepoSummarizer {
+	if os.Getenv("REPO_SUMMARY") != "on" {
+		return nil
+	}
+
+	summarizer := &RepoSummarizer{Model: anthropic.ModelClaude3_5Haiku20241022, MinFiles: 2000, CacheDir: os.Getenv("REPO_SUMMARY_DIR")}
+	if model := os.Getenv("REPO_SUMMARY_MODEL"); model != "" {
+		summarizer.Model = anthropic.Model(model)
+	}
+	if value := os.Getenv("REPO_SUMMARY_MIN_FILES"); value != "" {
+		files, err := strconv.Atoi(value)
+		if err != nil || files < 0 {
+			fmt.Printf("Invalid REPO_SUMMARY_MIN_FILES %q, ignoring: must be a non-negative number\n", value)
+		} else {
+			summarizer.MinFiles = files
+		}
+	}
+	if summarizer.CacheDir == "" {
+		if dir, err := os.UserCacheDir(); err == nil {
+			summarizer.CacheDir = filepath.Join(dir, "agent", "repo-summaries")
+		}
+	}
+	return summarizer
+}
+
+// SetRepoSummarizer makes the agent describe large workspaces hierarchically,
+// in the workspace summary and through the repository_overview tool.
+func (a *Agent) SetRepoSummarizer(summarizer *RepoSummarizer) {
+	a.repoSummary = summarizer
+	if summarizer != nil {
+		a.tools.Register(a.repositoryOverviewDefinition())
+	}
+	a.shareSealer()
+}
+
+// ready returns the overview of the workspace, if it has been built.
+func (s *RepoSummarizer) ready() string {
+	if s == nil {
+		return ""
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.overview
+}
+
+// prepareRepoOverview builds the overview of the agent's workspace while Run
+// warms up, so it's ready for the workspace summary.
+func (a *Agent) prepareRepoOverview() {
+	if a.repoSummary == nil {
+		return
+	}
+	if _, err := a.repoOverview(context.Background(), false); err != nil {
+		fmt.Printf("Repository overview failed: %v\n", err)
+	}
+}
+
+// repoOverview returns the overview of the agent's workspace, building it if
+// needed or asked to. Workspaces below MinFiles files have none.
+func (a *Agent) repoOverview(ctx context.Context, refresh bool) (string, error) {
+	s := a.repoSummary
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+
+	key := repoKey(a.fs)
+	s.mu.Lock()
+	current := s.overview
+	if s.key != key {
+		current = ""
+	}
+	s.mu.Unlock()
+	if current != "" && !refresh {
+		return current, nil
+	}
+
+	root := walkRepo(tools.NewIgnoreFS(a.fs))
+	if root.total < s.MinFiles {
+		return "", nil
+	}
+	cache := s.loadCache(key)
+	fmt.Printf("%s🗺️  Describing the repository (%d files)...%s\n", BlueColor, root.total, ResetColor)
+
+	// The largest top-level directories, then the largest of their subdirectories.
+	selected := root.children[:min(len(root.children), repoOverviewDirs)]
+	var second []*repoDir
+	for _, dir := range selected {
+		second = append(second, dir.children...)
+	}
+	sort.SliceStable(second, func(i, j int) bool { return second[i].total > second[j].total })
+	second = second[:min(len(second), repoOverviewDirs-len(selected))]
+
+	a.describeDirs(ctx, second, cache, refresh)
+	a.describeDirs(ctx, selected, cache, refresh)
+
+	// The overview is written from the top-level descriptions.
+	var listing strings.Builder
+	for _, dir := range selected {
+		fmt.Fprintf(&listing, "- %s/ (%d files): %s\n", dir.path, dir.total, orNotDescribed(cache.Dirs[dir.path].Description))
+	}
+	overview := cache.Dirs["."]
+	if refresh || overview.Fingerprint != root.fingerprint || overview.Description == "" {
+		text, err := a.summarizerCall(ctx, fmt.Sprintf(repoRootPrompt, listing.String()))
+		if err != nil {
+			return "", err
+		}
+		overview = repoCacheEntry{Fingerprint: root.fingerprint, Description: text}
+		cache.Dirs["."] = overview
+	}
+	s.saveCache(key, cache)
+
+	rendered := renderRepoOverview(root, overview.Description, cache, 2)
+	s.mu.Lock()
+	s.key, s.overview = key, rendered
+	s.mu.Unlock()
+	return rendered, nil
+}
+
+// zoomRepo describes dir and its largest subdirectories.
+func (a *Agent) zoomRepo(ctx context.Context, dir string, refresh bool) (string, error) {
+	s := a.repoSummary
+	s.buildMu.Lock()
+	defer s.buildMu.Unlock()
+
+	root := walkRepo(tools.NewIgnoreFS(a.fs))
+	node := root.find(path.Clean(dir))
+	if node == nil {
+		return "", fmt.Errorf("no directory %s in the repository overview; it may be empty, hidden or skipped like vendor", dir)
+	}
+	key := repoKey(a.fs)
+	cache := s.loadCache(key)
+
+	children := node.children[:min(len(node.children), repoZoomDirs)]
+	a.describeDirs(ctx, children, cache, refresh)
+	a.describeDirs(ctx, []*repoDir{node}, cache, refresh)
+	s.saveCache(key, cache)
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "%s/ (%d files): %s\n", node.path, node.total, orNotDescribed(cache.Dirs[node.path].Description))
+	for _, child := range children {
+		fmt.Fprintf(&result, "- %s/ (%d files): %s\n", child.path, child.total, orNotDescribed(cache.Dirs[child.path].Description))
+	}
+	if skipped := len(node.children) - len(children); skipped > 0 {
+		fmt.Fprintf(&result, "(%d smaller subdirectories not described.)\n", skipped)
+	}
+	if files := node.fileNames(); len(files) > 0 {
+		fmt.Fprintf(&result, "Files: %s\n", strings.Join(files, " "))
+	}
+	return result.String(), nil
+}
+
+// describeDirs has the model describe the directories whose files changed since
+// they were last described, a few at a time.
+func (a *Agent) describeDirs(ctx context.Context, dirs []*repoDir, cache *repoCache, refresh bool) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, repoParallelCalls)
+	for _, dir := range dirs {
+		mu.Lock()
+		entry := cache.Dirs[dir.path]
+		mu.Unlock()
+		if !refresh && entry.Fingerprint == dir.fingerprint && entry.Description != "" {
+			continue
+		}
+
+		mu.Lock()
+		prompt := fmt.Sprintf(repoDirPrompt, dir.path, dir.total, dir.context(tools.NewIgnoreFS(a.fs), cache))
+		mu.Unlock()
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer func() { <-slots; wg.Done() }()
+			text, err := a.summarizerCall(ctx, prompt)
+			if err != nil {
+				fmt.Printf("Describing %s failed: %v\n", dir.path, err)
+				return
+			}
+			mu.Lock()
+			cache.Dirs[dir.path] = repoCacheEntry{Fingerprint: dir.fingerprint, Description: text}
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+}
+
+// summarizerCall makes one call to the summarizer's model, counted towards the
+// task's usage if there is one.
+func (a *Agent) summarizerCall(ctx context.Context, prompt string) (string, error) {
+	params := anthropic.MessageNewParams{
+		MaxTokens: 400,
+		Model:     a.repoSummary.Model,
+		Messages:  []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(prompt))},
+	}
+	a.sampling.apply(&params)
+	response, err := a.provider.NewMessage(ctx, params)
+	if err != nil {
+		return "", err
+	}
+	if usage := usageFrom(ctx); usage != nil {
+		usage.add(response.Model, response.Usage)
+	}
+	return strings.Join(strings.Fields(responseText(response)), " "), nil
+}
+
+func orNotDescribed(description string) string {
+	if description == "" {
+		return "(not described)"
+	}
+	return description
+}
+
+// renderRepoOverview lays out the overview and the descriptions of the
+// directories up to depth levels down.
+func renderRepoOverview(root *repoDir, overview string, cache *repoCache, depth int) string {
+	var result strings.Builder
+	fmt.Fprintf(&result, "<repository_overview>\nThis repository is large (%d files in %d directories). Overview written from files sampled in each directory; call repository_overview to zoom into a directory or refresh it after big changes.\n%s\n", root.total, root.dirs, overview)
+
+	var entryPoints []string
+	root.visit(func(dir *repoDir) {
+		if dir.main {
+			entryPoints = append(entryPoints, dir.path)
+		}
+	})
+	if len(entryPoints) > repoEntryPointsMax {
+		entryPoints = append(entryPoints[:repoEntryPointsMax], fmt.Sprintf("and %d more", len(entryPoints)-repoEntryPointsMax))
+	}
+	if len(entryPoints) > 0 {
+		fmt.Fprintf(&result, "Entry points (package main): %s\n", strings.Join(entryPoints, ", "))
+	}
+
+	result.WriteString("Directories (files):\n")
+	var list func(dir *repoDir, level int)
+	list = func(dir *repoDir, level int) {
+		for _, child := range dir.children {
+			entry, ok := cache.Dirs[child.path]
+			if !ok {
+				continue
+			}
+			fmt.Fprintf(&result, "%s- %s/ (%d): %s\n", strings.Repeat("  ", level), child.path, child.total, orNotDescribed(entry.Description))
+			if level+1 < depth {
+				list(child, level+1)
+			}
+		}
+	}
+	list(root, 0)
+	result.WriteString("</repository_overview>")
+	return result.String()
+}
+
+// repoDir is a directory of the walked repository.
+type repoDir struct {
+	path        string
+	files       []repoFile
+	children    []*repoDir // largest first
+	total       int        // files in the whole subtree
+	dirs        int        // directories in the whole subtree, itself included
+	fingerprint string     // changes when a file in the subtree is added, removed or modified
+	main        bool       // holds a Go package main
+}
+
+type repoFile struct {
+	name string
+	size int64
+}
+
+// walkRepo reads the directory tree, skipping what the workspace summary skips.
+func walkRepo(fsys tools.FS) *repoDir {
+	walked := 0
+	var walk func(dir string) *repoDir
+	walk = func(dir string) *repoDir {
+		node := &repoDir{path: dir, dirs: 1}
+		entries, err := fsys.ReadDir(dir)
+		if err != nil || walked >= repoMaxDirs {
+			return node
+		}
+		walked++
+
+		hash := sha256.New()
+		for _, entry := range entries {
+			name := entry.Name()
+			if summarySkipped[name] || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+				continue
+			}
+			if entry.IsDir() {
+				child := walk(path.Join(dir, name))
+				if child.total == 0 {
+					continue
+				}
+				node.children = append(node.children, child)
+				node.total += child.total
+				node.dirs += child.dirs
+				fmt.Fprintf(hash, "%s/ %s\n", name, child.fingerprint)
+				continue
+			}
+			file := repoFile{name: name}
+			if info, err := entry.Info(); err == nil {
+				file.size = info.Size()
+				fmt.Fprintf(hash, "%s %d %d\n", name, info.Size(), info.ModTime().UnixNano())
+			} else {
+				fmt.Fprintf(hash, "%s\n", name)
+			}
+			node.files = append(node.files, file)
+			node.total++
+		}
+		sort.SliceStable(node.children, func(i, j int) bool { return node.children[i].total > node.children[j].total })
+		node.fingerprint = hex.EncodeToString(hash.Sum(nil))
+
+		for _, file := range node.files {
+			if strings.HasSuffix(file.name, ".go") && !strings.HasSuffix(file.name, "_test.go") {
+				node.main = packageClause(fsys, path.Join(dir, file.name)) == "main"
+				break
+			}
+		}
+		return node
+	}
+	return walk(".")
+}
+
+func (d *repoDir) find(dir string) *repoDir {
+	if d.path == dir {
+		return d
+	}
+	for _, child := range d.children {
+		if child.path == dir || strings.HasPrefix(dir, child.path+"/") {
+			return child.find(dir)
+		}
+	}
+	return nil
+}
+
+func (d *repoDir) visit(fn func(*repoDir)) {
+	fn(d)
+	for _, child := range d.children {
+		child.visit(fn)
+	}
+}
+
+func (d *repoDir) fileNames() []string {
+	var names []string
+	for _, file := range d.files {
+		names = append(names, file.name)
+	}
+	if len(names) > repoListedFiles {
+		names = append(names[:repoListedFiles], fmt.Sprintf("and %d more", len(names)-repoListedFiles))
+	}
+	return names
+}
+
+// context lays out what the model sees of a directory: its subdirectories with
+// any descriptions they have, its files and samples of the most telling ones.
+func (d *repoDir) context(fsys tools.FS, cache *repoCache) string {
+	var result strings.Builder
+	for _, child := range d.children {
+		fmt.Fprintf(&result, "Subdirectory %s/ (%d files)", path.Base(child.path), child.total)
+		if description := cache.Dirs[child.path].Description; description != "" {
+			fmt.Fprintf(&result, ": %s", description)
+		}
+		result.WriteString("\n")
+	}
+	if files := d.fileNames(); len(files) > 0 {
+		fmt.Fprintf(&result, "Files: %s\n", strings.Join(files, " "))
+	}
+
+	// Without files of its own, the directory is sampled through its largest subdirectories.
+	candidates := d.samples()
+	for _, child := range d.children {
+		if len(candidates) >= repoSamples {
+			break
+		}
+		if samples := child.samples(); len(samples) > 0 {
+			candidates = append(candidates, samples[0])
+		}
+	}
+	for _, name := range candidates[:min(len(candidates), repoSamples)] {
+		data, err := fsys.ReadFile(name)
+		if err != nil || bytes.IndexByte(data, 0) >= 0 {
+			continue
+		}
+		if len(data) > repoSampleBytes {
+			data = append(data[:repoSampleBytes], "\n[...]"...)
+		}
+		fmt.Fprintf(&result, "<file path=%q>\n%s\n</file>\n", name, data)
+	}
+	return result.String()
+}
+
+// samples returns the paths of the directory's files most likely to say what
+// it's for: READMEs, package docs and mains, files named after the directory,
+// then the largest source files. Tests and generated files come last.
+func (d *repoDir) samples() []string {
+	base := path.Base(d.path)
+	rank := func(file repoFile) int {
+		name := strings.ToLower(file.name)
+		switch {
+		case strings.HasPrefix(name, "readme"), name == "doc.go":
+			return 0
+		case strings.TrimSuffix(name, path.Ext(name)) == strings.ToLower(base), strings.HasPrefix(name, "main."), strings.HasPrefix(name, "index."):
+			return 1
+		case strings.Contains(name, "_test.") || strings.Contains(name, ".test.") || strings.Contains(name, "generated") || strings.Contains(name, ".pb."):
+			return 3
+		default:
+			return 2
+		}
+	}
+	files := slices.Clone(d.files)
+	sort.SliceStable(files, func(i, j int) bool {
+		if rank(files[i]) != rank(files[j]) {
+			return rank(files[i]) < rank(files[j])
+		}
+		return files[i].size > files[j].size
+	})
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, path.Join(d.path, file.name))
+	}
+	return paths
+}
+
+// repoCache holds the descriptions of a workspace's directories, "." being the
+// overview.
+type repoCache struct {
+	Dirs map[string]repoCacheEntry `json:"dirs"`
+}
+
+type repoCacheEntry struct {
+	Fingerprint string `json:"fingerprint"`
+	Description string `json:"description"`
+}
+
+// repoKey identifies a workspace across runs: by its path on disk when it has
+// one, else by its top-level entries.
+func repoKey(fsys tools.FS) string {
+	for {
+		overlay, ok := fsys.(*tools.OverlayFS)
+		if !ok {
+			break
+		}
+		fsys = overlay.Base
+	}
+	if osfs, ok := fsys.(tools.OSFS); ok {
+		if root, err := filepath.Abs(osfs.Root); err == nil {
+			return root
+		}
+	}
+	var names []string
+	if entries, err := fsys.ReadDir("."); err == nil {
+		for _, entry := range entries {
+			names = append(names, entry.Name())
+		}
+	}
+	return "fs:" + strings.Join(names, "/")
+}
+
+func (s *RepoSummarizer) cachePath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.CacheDir, hex.EncodeToString(sum[:8])+".json")
+}
+
+// loadCache reads the workspace's descriptions, starting afresh if there are none.
+func (s *RepoSummarizer) loadCache(key string) *repoCache {
+	cache := &repoCache{}
+	if s.CacheDir != "" {
+		if data, err := os.ReadFile(s.cachePath(key)); err == nil {
+			if data, err = s.Sealer.Open(data, key); err == nil {
+				json.Unmarshal(data, cache)
+			}
+		}
+	}
+	if cache.Dirs == nil {
+		cache.Dirs = map[string]repoCacheEntry{}
+	}
+	return cache
+}
+
+func (s *RepoSummarizer) saveCache(key string, cache *repoCache) {
+	if s.CacheDir == "" {
+		return
+	}
+	data, err := json.MarshalIndent(cache, "", "  ")
+	if err == nil {
+		err = os.MkdirAll(s.CacheDir, 0755)
+	}
+	if err == nil {
+		err = os.WriteFile(s.cachePath(key), s.Sealer.Seal(data, key), 0600)
+	}
+	if err != nil {
+		fmt.Printf("Failed to save the repository overview: %v\n", err)
+	}
+}
+
+// RepositoryOverview tool for finding one's way around a large repository
+type RepositoryOverviewInput struct {
+	Dir     string `json:"dir,omitempty" jsonschema_description:"Directory to zoom into, e.g. services/billing. Leave out for the overview of the whole repository."`
+	Refresh bool   `json:"refresh,omitempty" jsonschema_description:"Describe the directories again even if their files haven't changed, e.g. after a large refactoring."`
+}
+
+var RepositoryOverviewInputSchema = tools.GenerateSchema[RepositoryOverviewInput]()
+
+// repositoryOverviewDefinition is bound to the agent, since descriptions are
+// written by the model.
+func (a *Agent) repositoryOverviewDefinition() tools.ToolDefinition {
+	return tools.ToolDefinition{
+		Name:        "repository_overview",
+		Description: "Describe a large repository hierarchically: an overview, the entry points, and what each top-level directory and its largest subdirectories are for. Give a directory to zoom into it and its subdirectories. Much cheaper than listing and reading files to find your way around. Descriptions are cached and redone only where files changed.",
+		InputSchema: RepositoryOverviewInputSchema,
+		Function:    a.RepositoryOverview,
+		Category:    tools.CategoryRead,
+		Examples: []tools.ToolExample{
+			{Input: `{"dir": "services/billing"}`, Output: "services/billing/ (412 files): Billing service: invoices, payment provider webhooks and the monthly charge job.\n- services/billing/invoice/ (120 files): ..."},
+		},
+	}
+}
+
+func (a *Agent) RepositoryOverview(ctx context.Context, input json.RawMessage) (string, error) {
+	overviewInput := RepositoryOverviewInput{}
+	if err := json.Unmarshal(input, &overviewInput); err != nil {
+		return "", err
+	}
+	if overviewInput.Dir != "" && path.Clean(overviewInput.Dir) != "." {
+		return a.zoomRepo(ctx, overviewInput.Dir, overviewInput.Refresh)
+	}
+	overview, err := a.repoOverview(ctx, overviewInput.Refresh)
+	if err != nil {
+		return "", err
+	}
+	if overview == "" {
+		return fmt.Sprintf("The repository has fewer than %d files; list them with the file tools instead.", a.repoSummary.MinFiles), nil
+	}
+	return overview, nil
+}
@@ -0,0 +1,57 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// responseText joins the text blocks of a response, skipping tool calls and other blocks.
+func responseText(response *anthropic.Message) string {
+	var text []string
+	for _, content := range response.Content {
+		if block, ok := content.AsAny().(anthropic.TextBlock); ok && block.Text != "" {
+			text = append(text, block.Text)
+		}
+	}
+	return strings.Join(text, "\n\n")
+}
+
+// emptyResponseNotice is written instead of a reply when the model produced no text.
+func (a *Agent) emptyResponseNotice(stopReason anthropic.StopReason) string {
+	if stopReason == anthropic.StopReasonMaxTokens {
+		return a.text("empty_response_max_tokens", "The response was cut off by the output token limit before any text was produced. Please try again or ask for a shorter answer.")
+	}
+	return a.text("empty_response", "The model returned an empty response. Please try rephrasing your request.")
+}
+
+// Continuation requests made for one answer cut off by the output token limit.
+const maxContinuations = 3
+
+// continueTruncated asks the model to carry on from an answer that hit the output
+// token limit, prefilling what it wrote so far, and returns the stitched answer and
+// whether it is still truncated.
+func (a *Agent) continueTruncated(ctx context.Context, messages []anthropic.MessageParam, tools []anthropic.ToolUnionParam, text string, usage *taskUsage) (string, bool) {
+	for i := 0; i < maxContinuations; i++ {
+		// The API rejects a prefilled assistant message ending in whitespace.
+		partial := strings.TrimRightFunc(text, unicode.IsSpace)
+		prefilled := append(append([]anthropic.MessageParam{}, messages...), anthropic.NewAssistantMessage(anthropic.NewTextBlock(partial)))
+
+		fmt.Printf("%s✂️  Response truncated, requesting continuation %d/%d...%s\n", BlueColor, i+1, maxContinuations, ResetColor)
+		response, err := a.inferWithRetry(ctx, prefilled, tools)
+		if err != nil {
+			fmt.Printf("Continuation failed: %v\n", err)
+			return text, true
+		}
+		usage.add(response.Model, response.Usage)
+
+		text = partial + responseText(response)
+		if response.StopReason != anthropic.StopReasonMaxTokens {
+			return text, false
+		}
+	}
+	return text, true
+}
@@ -0,0 +1,152 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/kartikx/agent/tools"
+)
+
+const reviewDecisionsNote = `The reviewer went through your pending changes since your last turn:
+%s
+
+Approved files are now applied. Rejected files are back as they were before your changes: address the reviewer's comments on them, or explain why you won't.`
+
+// pendingReview holds a session's edits until the reviewer approves them.
+type pendingReview struct {
+	mu      sync.Mutex
+	overlay *tools.OverlayFS
+	// Decisions made since the session's last turn, told to the model at its next.
+	decisions []string
+}
+
+// pending reports whether any edits wait for review.
+func (r *pendingReview) pending() bool {
+	return r != nil && len(r.overlay.Changes()) > 0
+}
+
+// reviewDecision is a reviewer's verdict on one file, e.g. POST /coder/review.
+type reviewDecision struct {
+	Path     string `json:"path"`
+	Decision string `json:"decision"` // "approve" or "reject"
+	Comment  string `json:"comment,omitempty"`
+}
+
+// ReviewChanges keeps the file edits of each session pending instead of
+// writing them, until they're approved one file at a time at /<name>/review.
+// Rejections, with the reviewer's comments, are given to the model at the
+// session's next turn.
+func (a *Agent) ReviewChanges() {
+	a.reviewChanges = true
+}
+
+// beginReview points the file tools at the session's pending edits.
+func (a *Agent) beginReview(current *session) {
+	if !a.reviewChanges || a.staged != nil {
+		return
+	}
+	if current.review == nil {
+		current.review = &pendingReview{overlay: tools.NewOverlayFS(a.fs)}
+	}
+	a.staged = current.review.overlay
+	a.SetFS(a.staged)
+}
+
+// reviewNote returns the reviewer's decisions since the session's last turn,
+// or "" if there are none.
+func reviewNote(current *session) string {
+	if current.review == nil {
+		return ""
+	}
+	current.review.mu.Lock()
+	decisions := current.review.decisions
+	current.review.decisions = nil
+	current.review.mu.Unlock()
+	if len(decisions) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(reviewDecisionsNote, "- "+strings.Join(decisions, "\n- "))
+}
+
+// decide applies a decision to the pending edits: approving writes the file to
+// the workspace, rejecting discards it.
+func (a *Agent) decide(review *pendingReview, decision reviewDecision) error {
+	review.mu.Lock()
+	defer review.mu.Unlock()
+
+	data, err := review.overlay.Upper.ReadFile(decision.Path)
+	if err != nil {
+		return fmt.Errorf("%s has no pending changes", decision.Path)
+	}
+	switch decision.Decision {
+	case "approve":
+		info, err := review.overlay.Upper.Stat(decision.Path)
+		if err != nil {
+			return err
+		}
+		if a.watcher != nil {
+			a.watcher.RecordWrite(data)
+		}
+		if err := review.overlay.Base.WriteFile(decision.Path, data, info.Mode().Perm()); err != nil {
+			return fmt.Errorf("failed to apply %s: %v", decision.Path, err)
+		}
+		review.decisions = append(review.decisions, fmt.Sprintf("approved %s", decision.Path))
+	case "reject":
+		if comment := strings.TrimSpace(decision.Comment); comment != "" {
+			review.decisions = append(review.decisions, fmt.Sprintf("rejected %s: %s", decision.Path, comment))
+		} else {
+			review.decisions = append(review.decisions, fmt.Sprintf("rejected %s", decision.Path))
+		}
+	default:
+		return fmt.Errorf("unknown decision %q: use approve or reject", decision.Decision)
+	}
+	return review.overlay.Upper.Remove(decision.Path)
+}
+
+// handleReview lists a session's pending changes (GET) or approves or rejects
+// one file (POST), e.g. POST /coder/review?session=feature-x
+// {"path": "main.go", "decision": "reject", "comment": "keep the old flag name"}
+func (a *Agent) handleReview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := a.requestUser(w, r)
+	if !ok {
+		return
+	}
+	id := userSessionID(user, sessionParam(r))
+
+	if r.Method == "POST" {
+		var decision reviewDecision
+		if err := json.NewDecoder(r.Body).Decode(&decision); err != nil {
+			http.Error(w, fmt.Sprintf("invalid decision: %v", err), http.StatusBadRequest)
+			return
+		}
+		err := a.sessions.idle(id, func(current *session) error {
+			if current.review == nil {
+				return fmt.Errorf("%s has no pending changes", decision.Path)
+			}
+			return a.decide(current.review, decision)
+		})
+		if err != nil {
+			status := http.StatusBadRequest
+			if err == errSessionBusy {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		fmt.Printf("%s📝 Review of session %s: %s %s%s\n", BlueColor, id, decision.Decision, decision.Path, ResetColor)
+	}
+
+	changes := []tools.FileChange{}
+	if review := a.sessions.review(id); review != nil {
+		changes = review.overlay.Changes()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"session": strings.TrimPrefix(id, userSessionID(user, "")), "changes": changes})
+}
@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/providers"
+)
+
+// Sampling controls how the model samples its responses. Unset fields keep the
+// provider's defaults.
+type Sampling struct {
+	Temperature *float64
+	TopP        *float64
+	// Seed for providers that take one (see providers.Seeded) and for the agent's
+	// own random choices, such as chaos mode's faults.
+	Seed *int64
+	// Deterministic also runs the agent the same way each time: results of tool
+	// calls run in parallel are handed back in the order they were called.
+	Deterministic bool
+}
+
+// samplingFromEnv reads TEMPERATURE, TOP_P and SEED, overridden for one agent
+// by e.g. CODER_TEMPERATURE. SAMPLING_PRESET=deterministic sets a temperature
+// of 0 and a seed of 0 unless they're set.
+func samplingFromEnv(name string) Sampling {
+	lookup := func(key string) string {
+		if value := os.Getenv(strings.ToUpper(name) + "_" + key); value != "" {
+			return value
+		}
+		return os.Getenv(key)
+	}
+
+	var sampling Sampling
+	for key, target := range map[string]**float64{"TEMPERATURE": &sampling.Temperature, "TOP_P": &sampling.TopP} {
+		value := lookup(key)
+		if value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 || parsed > 1 {
+			fmt.Printf("Invalid %s %q, ignoring: must be between 0 and 1\n", key, value)
+			continue
+		}
+		*target = &parsed
+	}
+	if value := lookup("SEED"); value != "" {
+		seed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			fmt.Printf("Invalid SEED %q, ignoring: %v\n", value, err)
+		} else {
+			sampling.Seed = &seed
+		}
+	}
+
+	switch preset := os.Getenv("SAMPLING_PRESET"); preset {
+	case "":
+	case "deterministic":
+		sampling.Deterministic = true
+		if sampling.Temperature == nil {
+			sampling.Temperature = new(float64)
+		}
+		if sampling.Seed == nil {
+			sampling.Seed = new(int64)
+		}
+	default:
+		fmt.Printf("Unknown SAMPLING_PRESET %q, ignoring: use deterministic\n", preset)
+	}
+	return sampling
+}
+
+// SetSampling sets how the model samples the agent's responses, and those of
+// the models helping it, such as the critic.
+func (a *Agent) SetSampling(sampling Sampling) {
+	a.sampling = sampling
+	if sampling.Seed == nil {
+		return
+	}
+	if seeded, ok := a.provider.(providers.Seeded); ok {
+		seeded.SetSeed(*sampling.Seed)
+	}
+	// Chaos mode picks the same faults for the same seed, unless CHAOS_SEED picks its own.
+	if a.chaos != nil && os.Getenv("CHAOS_SEED") == "" {
+		a.chaos = NewChaos(a.chaos.Rate, a.chaos.Faults, a.chaos.Delay, *sampling.Seed)
+	}
+}
+
+// apply sets the sampling parameters of a request.
+func (s Sampling) apply(params *anthropic.MessageNewParams) {
+	if s.Temperature != nil {
+		params.Temperature = anthropic.Float(*s.Temperature)
+	}
+	if s.TopP != nil {
+		params.TopP = anthropic.Float(*s.TopP)
+	}
+}
@@ -0,0 +1,393 @@
+package agent
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Reply to a clarifying question asked during a scheduled run.
+const unattendedAnswer = "Nobody is available to answer; this task runs unattended. Use your best judgement and note your assumptions in the report."
+
+// Year of the next run of a schedule that is never due.
+const neverYear = 9999
+
+var scheduledTaskName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// ScheduledTask is a task the agent runs on its own on a schedule, e.g. running
+// the test suite nightly and summarizing the failures.
+type ScheduledTask struct {
+	Name string `json:"name"`
+	// Cron expression in local time, e.g. "0 3 * * *" or "30 9 * * 1-5", or one
+	// of @hourly, @daily, @weekly, @monthly and "@every 6h".
+	Schedule string `json:"schedule"`
+	// The message the agent is sent, as if from a user.
+	Task string `json:"task"`
+	// Where each run's TaskReport is sent.
+	ReportDelivery
+
+	schedule schedule
+}
+
+// LoadSchedule reads a JSON array of scheduled tasks.
+func LoadSchedule(path string) ([]ScheduledTask, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []ScheduledTask
+	if err := json.Unmarshal(data, &tasks); err != nil {
+		return nil, fmt.Errorf("invalid schedule file %s: %v", path, err)
+	}
+
+	names := map[string]bool{}
+	for i := range tasks {
+		task := &tasks[i]
+		if !scheduledTaskName.MatchString(task.Name) {
+			return nil, fmt.Errorf("invalid task name %q: use letters, digits, - and _", task.Name)
+		}
+		if names[task.Name] {
+			return nil, fmt.Errorf("duplicate task name %q", task.Name)
+		}
+		names[task.Name] = true
+
+		if strings.TrimSpace(task.Task) == "" {
+			return nil, fmt.Errorf("task %s: task is required", task.Name)
+		}
+		if !task.configured() {
+			return nil, fmt.Errorf("task %s: set webhook, email or report_dir to deliver its reports", task.Name)
+		}
+		if err := task.validate(); err != nil {
+			return nil, fmt.Errorf("task %s: %v", task.Name, err)
+		}
+		task.schedule, err = parseSchedule(task.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("task %s: invalid schedule %q: %v", task.Name, task.Schedule, err)
+		}
+		if task.schedule.next(time.Now()).Year() == neverYear {
+			return nil, fmt.Errorf("task %s: schedule %q is never due", task.Name, task.Schedule)
+		}
+	}
+	return tasks, nil
+}
+
+// Scheduler is a transport sending the agent its scheduled tasks when they are
+// due, each in a new session, and delivering the replies as reports. Tasks run
+// one at a time, queued with other transports' messages; a task due again
+// before its last run finished runs once, not once per missed time.
+type Scheduler struct {
+	tasks []ScheduledTask
+
+	// Signalled when the running task finished or asked a question.
+	wake   chan struct{}
+	closed chan struct{}
+	once   sync.Once
+
+	mu       sync.Mutex
+	next     []time.Time
+	running  *TaskReport
+	runTask  *ScheduledTask
+	status   string
+	question bool
+}
+
+func NewScheduler(tasks []ScheduledTask) *Scheduler {
+	s := &Scheduler{
+		tasks:  tasks,
+		wake:   make(chan struct{}, 1),
+		closed: make(chan struct{}),
+		next:   make([]time.Time, len(tasks)),
+	}
+	now := time.Now()
+	for i, task := range tasks {
+		s.next[i] = task.schedule.next(now)
+		fmt.Printf("⏰ Scheduled task %s, next run at %s\n", task.Name, s.next[i].Format(time.RFC3339))
+	}
+	return s
+}
+
+// Read waits for the next task to be due, or answers the running task's question.
+func (s *Scheduler) Read() (string, error) {
+	for {
+		s.mu.Lock()
+		switch {
+		case s.question:
+			s.question = false
+			s.mu.Unlock()
+			return unattendedAnswer, nil
+		case s.running != nil, len(s.tasks) == 0:
+			s.mu.Unlock()
+			if err := s.waitFor(nil); err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		due := 0
+		for i := range s.tasks {
+			if s.next[i].Before(s.next[due]) {
+				due = i
+			}
+		}
+		wait := time.Until(s.next[due])
+		if wait > 0 {
+			s.mu.Unlock()
+			timer := time.NewTimer(wait)
+			err := s.waitFor(timer.C)
+			timer.Stop()
+			if err != nil {
+				return "", err
+			}
+			continue
+		}
+
+		task := &s.tasks[due]
+		started := time.Now()
+		s.next[due] = task.schedule.next(started)
+		s.runTask = task
+		s.running = &TaskReport{
+			Task:    task.Name,
+			Session: fmt.Sprintf("schedule-%s-%s", task.Name, started.Format("20060102-150405")),
+			Started: started,
+		}
+		s.status = ""
+		s.mu.Unlock()
+
+		fmt.Printf("⏰ Running scheduled task %s\n", task.Name)
+		return fmt.Sprintf("%s\n\nThis task runs unattended on a schedule: nobody can answer questions, so don't ask any. Your reply is the report sent to whoever set it up.", task.Task), nil
+	}
+}
+
+// waitFor blocks until the scheduler is woken, timer fires or it is closed.
+func (s *Scheduler) waitFor(timer <-chan time.Time) error {
+	select {
+	case <-s.wake:
+	case <-timer:
+	case <-s.closed:
+		return io.EOF
+	}
+	return nil
+}
+
+func (s *Scheduler) signal() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Write delivers the running task's report, unless it is a question.
+func (s *Scheduler) Write(message string) error {
+	s.mu.Lock()
+	if s.status == awaitingInputStatus {
+		s.question = true
+		s.mu.Unlock()
+		s.signal()
+		return nil
+	}
+	status := s.status
+	if status == "" {
+		status = "ok"
+	}
+	return s.finish(status, message)
+}
+
+// WriteError delivers a report of the failed run.
+func (s *Scheduler) WriteError(status int, message string) error {
+	s.mu.Lock()
+	return s.finish("failed", fmt.Sprintf("status %d: %s", status, message))
+}
+
+// finish ends the running task, which must be called with s.mu held.
+func (s *Scheduler) finish(status string, message string) error {
+	report, task := s.running, s.runTask
+	s.running, s.runTask = nil, nil
+	s.mu.Unlock()
+	s.signal()
+
+	if report == nil {
+		return fmt.Errorf("no scheduled task is running")
+	}
+	report.Finished = time.Now()
+	report.Status = status
+	report.Report = message
+	// Delivery may be slow; the agent shouldn't wait for it.
+	go s.deliver(task, report)
+	return nil
+}
+
+func (s *Scheduler) deliver(task *ScheduledTask, report *TaskReport) {
+	fmt.Printf("⏰ Scheduled task %s finished: %s\n", task.Name, report.Status)
+	task.deliver(report)
+}
+
+// Event records the running task's tool calls, changes, tests and cost for its report.
+func (s *Scheduler) Event(event Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running != nil {
+		s.running.record(event)
+	}
+}
+
+// SetStatus records the status of the reply about to be written, e.g. awaiting_input.
+func (s *Scheduler) SetStatus(status string, continuation string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status = status
+}
+
+// Session gives each run its own session, e.g. schedule-nightly-tests-20250905-030000.
+func (s *Scheduler) Session() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running == nil {
+		return ""
+	}
+	return s.running.Session
+}
+
+func (s *Scheduler) Close() error {
+	s.once.Do(func() { close(s.closed) })
+	return nil
+}
+
+// schedule computes when a task is next due.
+type schedule interface {
+	next(after time.Time) time.Time
+}
+
+// everySchedule is "@every <duration>".
+type everySchedule time.Duration
+
+func (e everySchedule) next(after time.Time) time.Time {
+	return after.Add(time.Duration(e))
+}
+
+// cronSchedule is a five-field cron expression; each field is the set of values it allows.
+type cronSchedule struct {
+	minute, hour, day, month, weekday map[int]bool
+	// Whether day or weekday is *, for cron's rule that a restricted day of the
+	// month or day of the week matches if either does.
+	anyDay, anyWeekday bool
+}
+
+var scheduleShorthands = map[string]string{
+	"@hourly":  "0 * * * *",
+	"@daily":   "0 0 * * *",
+	"@weekly":  "0 0 * * 0",
+	"@monthly": "0 0 1 * *",
+}
+
+func parseSchedule(spec string) (schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		interval, err := time.ParseDuration(strings.TrimSpace(rest))
+		if err != nil || interval < time.Minute {
+			return nil, fmt.Errorf("@every needs a duration of at least 1m")
+		}
+		return everySchedule(interval), nil
+	}
+	if expanded, ok := scheduleShorthands[spec]; ok {
+		spec = expanded
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("want 5 fields (minute hour day month weekday), got %d", len(fields))
+	}
+	var cron cronSchedule
+	var err error
+	ranges := []struct {
+		values   *map[int]bool
+		min, max int
+	}{{&cron.minute, 0, 59}, {&cron.hour, 0, 23}, {&cron.day, 1, 31}, {&cron.month, 1, 12}, {&cron.weekday, 0, 7}}
+	for i, r := range ranges {
+		if *r.values, err = parseCronField(fields[i], r.min, r.max); err != nil {
+			return nil, err
+		}
+	}
+	// Sunday is 0 or 7.
+	if cron.weekday[7] {
+		cron.weekday[0] = true
+	}
+	cron.anyDay, cron.anyWeekday = fields[2] == "*", fields[4] == "*"
+	return cron, nil
+}
+
+// parseCronField parses a comma-separated list of *, values and ranges, each
+// with an optional /step, e.g. "*/15" or "1-5,10".
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		span, stepText, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepText); err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+		}
+
+		low, high := min, max
+		if span != "*" {
+			first, last, isRange := strings.Cut(span, "-")
+			var err error
+			if low, err = strconv.Atoi(first); err != nil {
+				return nil, fmt.Errorf("invalid value in %q", part)
+			}
+			high = low
+			if isRange {
+				if high, err = strconv.Atoi(last); err != nil {
+					return nil, fmt.Errorf("invalid value in %q", part)
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+func (c cronSchedule) next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	// Every valid expression matches within a few years, e.g. 29 February.
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !c.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !c.matchesDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !c.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !c.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	// Never due, e.g. 31 February.
+	return time.Date(neverYear, 1, 1, 0, 0, 0, 0, after.Location())
+}
+
+func (c cronSchedule) matchesDay(t time.Time) bool {
+	day, weekday := c.day[t.Day()], c.weekday[int(t.Weekday())]
+	if c.anyDay || c.anyWeekday {
+		return day && weekday
+	}
+	return day || weekday
+}
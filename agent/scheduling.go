@@ -0,0 +1,181 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/tools"
+)
+
+// ExecutionStrategy decides whether the model is asked to call tools in parallel,
+// and whether the agent runs a turn's tool calls concurrently.
+type ExecutionStrategy string
+
+const (
+	// StrategyParallel asks for independent tool calls in one turn and runs them
+	// as scheduleToolCalls orders them.
+	StrategyParallel ExecutionStrategy = "parallel"
+	// StrategySerial asks for one tool call per turn and runs any extra calls one
+	// at a time, in the order the model made them.
+	StrategySerial ExecutionStrategy = "serial"
+	// StrategyAuto leaves it to the model to batch only independent calls, run
+	// concurrently like StrategyParallel.
+	StrategyAuto ExecutionStrategy = "auto"
+)
+
+// System prompt of each strategy.
+var strategyPrompts = map[ExecutionStrategy]string{
+	StrategyParallel: "<use_parallel_tool_calls> For maximum efficiency, whenever you perform multiple independent operations, invoke all relevant tools simultaneously rather than sequentially. Prioritize calling tools in parallel whenever possible. For example, when reading 3 files, run 3 tool calls in parallel to read all 3 files into context at the same time. When running multiple read-only commands like `ls` or `list_dir`, always run all of the commands in parallel. Err on the side of maximizing parallel tool calls rather than running too many tools sequentially. </use_parallel_tool_calls>",
+	StrategySerial:   "Always use tools serially. Never use tools in parallel.",
+	StrategyAuto:     "<tool_calls> You may call several tools at once when they are independent of each other, e.g. reading several files. When a call depends on the result or effect of another, e.g. running tests after editing a file, make it in a later turn. </tool_calls>",
+}
+
+// executionStrategyFromEnv reads TOOL_EXECUTION (parallel, serial or auto; default parallel).
+func executionStrategyFromEnv() ExecutionStrategy {
+	value := ExecutionStrategy(os.Getenv("TOOL_EXECUTION"))
+	if value == "" {
+		return StrategyParallel
+	}
+	if _, ok := strategyPrompts[value]; !ok {
+		fmt.Printf("Invalid TOOL_EXECUTION %q, using %s\n", value, StrategyParallel)
+		return StrategyParallel
+	}
+	return value
+}
+
+// SetExecutionStrategy changes how tool calls are requested and run; call before Run.
+func (a *Agent) SetExecutionStrategy(strategy ExecutionStrategy) {
+	a.strategy = strategy
+}
+
+// scheduleToolCalls splits a turn's tool calls into phases run one after the other.
+// Within a phase, groups run concurrently and the calls of a group in order.
+// Reads and writes come first, grouped by file; tools that execute something
+// (CategoryExecute, the default) run afterwards one at a time, so that e.g. tests
+// see the files written in the same turn however the model ordered the calls.
+func (a *Agent) scheduleToolCalls(calls []anthropic.ToolUseBlock) [][][]anthropic.ToolUseBlock {
+	if len(calls) == 0 {
+		return nil
+	}
+	if a.strategy == StrategySerial {
+		return [][][]anthropic.ToolUseBlock{{calls}}
+	}
+
+	var fileCalls, executeCalls []anthropic.ToolUseBlock
+	reordered := false
+	for _, call := range calls {
+		definition, ok := a.tools.Lookup(call.Name)
+		if ok && (definition.Category == "" || definition.Category == tools.CategoryExecute) {
+			executeCalls = append(executeCalls, call)
+			continue
+		}
+		reordered = reordered || len(executeCalls) > 0
+		fileCalls = append(fileCalls, call)
+	}
+
+	var phases [][][]anthropic.ToolUseBlock
+	if len(fileCalls) > 0 {
+		phases = append(phases, toolCallGroups(fileCalls))
+	}
+	if len(executeCalls) > 0 {
+		if reordered {
+			fmt.Printf("%s⏭️  Running %d command(s) after this turn's reads and writes%s\n", GreenColor, len(executeCalls), ResetColor)
+		}
+		phases = append(phases, [][]anthropic.ToolUseBlock{executeCalls})
+	}
+	return phases
+}
+
+// toolCallGroups splits a turn's tool calls into groups that run in parallel
+// with each other. Calls touching the same file share a group and run in the
+// order the model issued them, so e.g. a read and a write of one path can't race.
+func toolCallGroups(calls []anthropic.ToolUseBlock) [][]anthropic.ToolUseBlock {
+	var groups [][]anthropic.ToolUseBlock
+	groupForPath := map[string]int{}
+
+	for _, call := range calls {
+		path := toolCallPath(call.Input)
+		if path == "" {
+			groups = append(groups, []anthropic.ToolUseBlock{call})
+			continue
+		}
+
+		if index, ok := groupForPath[path]; ok {
+			fmt.Printf("%s🔒 Serializing %s after %d other call(s) on %s%s\n", GreenColor, call.Name, len(groups[index]), path, ResetColor)
+			groups[index] = append(groups[index], call)
+			continue
+		}
+
+		groupForPath[path] = len(groups)
+		groups = append(groups, []anthropic.ToolUseBlock{call})
+	}
+
+	return groups
+}
+
+// toolCallPath returns the file a tool call operates on, from its "path" input, or "".
+func toolCallPath(input json.RawMessage) string {
+	var fields struct {
+		Path string `json:"path"`
+	}
+	if json.Unmarshal(input, &fields) != nil || fields.Path == "" {
+		return ""
+	}
+	return filepath.Clean(fields.Path)
+}
+
+// dedupeToolCalls drops calls that repeat an earlier call of the same turn with
+// the same input, so the tool runs once. Calls that write or execute something
+// in between may change the result, so only calls with none between them in
+// the model's order are shared, e.g. not the second read in read, write, read.
+// It returns the calls to run and, for each dropped call's ID, the ID of the
+// call whose result it shares.
+func (a *Agent) dedupeToolCalls(calls []anthropic.ToolUseBlock) ([]anthropic.ToolUseBlock, map[string]string) {
+	var unique []anthropic.ToolUseBlock
+	duplicates := map[string]string{}
+	firstCall := map[string]string{}
+	for _, call := range calls {
+		key := toolCallKey(call)
+		if id, ok := firstCall[key]; ok {
+			fmt.Printf("%s♻️  Sharing the result of %s with its duplicate %s%s\n", GreenColor, id, call.ID, ResetColor)
+			duplicates[call.ID] = id
+			continue
+		}
+		if definition, ok := a.tools.Lookup(call.Name); !ok || definition.Category != tools.CategoryRead {
+			clear(firstCall)
+		}
+		firstCall[key] = call.ID
+		unique = append(unique, call)
+	}
+	return unique, duplicates
+}
+
+// toolCallKey identifies a call by its tool and a hash of its input, ignoring
+// key order and whitespace.
+func toolCallKey(call anthropic.ToolUseBlock) string {
+	input := []byte(call.Input)
+	var value any
+	if json.Unmarshal(call.Input, &value) == nil {
+		// Maps are marshalled with sorted keys.
+		if canonical, err := json.Marshal(value); err == nil {
+			input = canonical
+		}
+	}
+	sum := sha256.Sum256(input)
+	return call.Name + ":" + hex.EncodeToString(sum[:])
+}
+
+// sharedToolResult answers the call toolID with the result of the call it duplicates.
+func sharedToolResult(toolID string, result anthropic.ContentBlockParamUnion) anthropic.ContentBlockParamUnion {
+	if result.OfToolResult == nil {
+		return anthropic.NewToolResultBlock(toolID, "", false)
+	}
+	shared := *result.OfToolResult
+	shared.ToolUseID = toolID
+	return anthropic.ContentBlockParamUnion{OfToolResult: &shared}
+}
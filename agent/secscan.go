@@ -0,0 +1,196 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// Most security findings handed back to the model at once.
+const maxSecurityFindings = 20
+
+const securityFindingsNote = `The security scan of the code you just wrote flagged these lines:
+
+%s
+
+Fix them, e.g. pass user input to commands as separate arguments, read credentials from the environment and use query parameters instead of building SQL strings. If a line is safe as it is, add a "// #nosec" comment explaining why.`
+
+// securityRule flags added lines matching pattern.
+type securityRule struct {
+	id      string
+	pattern *regexp.Regexp
+	message string
+}
+
+// Rules used when gosec isn't installed. They only see one line at a time.
+var securityRules = []securityRule{
+	{"exec", regexp.MustCompile(`exec\.Command(Context)?\(\s*(ctx\s*,\s*)?[^"\s)]`), "command run from a variable: check it can't come from user input"},
+	{"exec", regexp.MustCompile(`"(ba|z)?sh"\s*,\s*"-c"\s*,\s*([^")\s]|"[^"]*"\s*\+)`), "shell command built from a variable: user input could inject commands"},
+	{"credential", regexp.MustCompile(`(?i)\w*(password|passwd|secret|api_?key|token|private_?key)\w*\s*(:?=|:)\s*"[^"\s]{8,}"`), "hardcoded credential"},
+	{"credential", regexp.MustCompile(`AKIA[0-9A-Z]{16}|sk-ant-[A-Za-z0-9_\-]{20,}|gh[pousr]_[A-Za-z0-9]{36}|xox[abprs]-[A-Za-z0-9\-]{10,}|-----BEGIN [A-Z ]*PRIVATE KEY-----`), "hardcoded key or token"},
+	{"sql", regexp.MustCompile(`(?i)"\s*(SELECT|INSERT|UPDATE|DELETE)\b[^"]*"\s*\+`), "SQL built by concatenation: use query parameters"},
+	{"sql", regexp.MustCompile(`(?i)Sprintf\(\s*"\s*(SELECT|INSERT|UPDATE|DELETE)\b[^"]*%[sv]`), "SQL built with Sprintf: use query parameters"},
+	{"tls", regexp.MustCompile(`InsecureSkipVerify:\s*true`), "TLS certificate verification turned off"},
+}
+
+// ScanSecurity makes the agent scan the Go code written by each round of tool
+// calls for dangerous constructs, with gosec if it's installed and simpler
+// rules otherwise, and hand what it finds back to the model to fix.
+func (a *Agent) ScanSecurity() {
+	a.securityScan = true
+}
+
+// addedLine is a line a change added, by its number in the new file.
+type addedLine struct {
+	number int
+	text   string
+}
+
+// addedLines returns the lines a change's diff adds.
+func addedLines(change tools.FileChange) []addedLine {
+	var lines []addedLine
+	number := 0
+	for _, line := range tools.DiffBody(change.Diff) {
+		switch {
+		case strings.HasPrefix(line, "@@"):
+			// @@ -a,b +c,d @@
+			fields := strings.Fields(line)
+			if len(fields) < 3 {
+				continue
+			}
+			start, _, _ := strings.Cut(strings.TrimPrefix(fields[2], "+"), ",")
+			number, _ = strconv.Atoi(start)
+		case strings.HasPrefix(line, "+"):
+			lines = append(lines, addedLine{number: number, text: line[1:]})
+			number++
+		case strings.HasPrefix(line, " "):
+			number++
+		}
+	}
+	return lines
+}
+
+// scanSecurity returns the security findings on the Go lines changes added, or
+// "" if there are none.
+func (a *Agent) scanSecurity(ctx context.Context, changes []tools.FileChange) string {
+	added := map[string][]addedLine{}
+	for _, change := range changes {
+		if strings.HasSuffix(change.Path, ".go") {
+			added[change.Path] = append(added[change.Path], addedLines(change)...)
+		}
+	}
+	if len(added) == 0 {
+		return ""
+	}
+
+	// Staged edits aren't on disk for gosec to see; the rules work from the diffs.
+	var findings []string
+	ok := false
+	if a.staged == nil {
+		findings, ok = a.gosec(ctx, added)
+	}
+	if !ok {
+		findings = ruleFindings(added)
+	}
+	if len(findings) == 0 {
+		return ""
+	}
+	slices.Sort(findings)
+	findings = slices.Compact(findings)
+	fmt.Printf("%s🔒 The security scan flagged %d lines%s\n", BlueColor, len(findings), ResetColor)
+	if len(findings) > maxSecurityFindings {
+		findings = append(findings[:maxSecurityFindings], fmt.Sprintf("[... %d more]", len(findings)-maxSecurityFindings))
+	}
+	return strings.Join(findings, "\n")
+}
+
+// ruleFindings checks added lines against securityRules.
+func ruleFindings(added map[string][]addedLine) []string {
+	var findings []string
+	for file, lines := range added {
+		for _, line := range lines {
+			if strings.Contains(line.text, "nosec") {
+				continue
+			}
+			for _, rule := range securityRules {
+				if rule.pattern.MatchString(line.text) {
+					findings = append(findings, fmt.Sprintf("%s:%d: [%s] %s\n    %s", file, line.number, rule.id, rule.message, strings.TrimSpace(line.text)))
+					break
+				}
+			}
+		}
+	}
+	return findings
+}
+
+// gosec runs gosec on the changed packages, keeping the issues on added lines.
+// It returns false if gosec couldn't run, e.g. because it isn't installed.
+func (a *Agent) gosec(ctx context.Context, added map[string][]addedLine) ([]string, bool) {
+	// Changed package directories, relative to their module, by module.
+	packages := map[string]map[string]bool{}
+	for file := range added {
+		module, ok := tools.ModuleDir(a.fs, file)
+		if !ok {
+			return nil, false
+		}
+		rel, err := filepath.Rel(module, path.Dir(file))
+		if err != nil {
+			return nil, false
+		}
+		if packages[module] == nil {
+			packages[module] = map[string]bool{}
+		}
+		packages[module]["./"+filepath.ToSlash(rel)] = true
+	}
+
+	var findings []string
+	for module, dirs := range packages {
+		args := []string{"-fmt=json", "-quiet"}
+		for dir := range dirs {
+			args = append(args, dir)
+		}
+		// gosec exits with an error when it finds issues, so only its output counts.
+		output, _ := a.runIn(ctx, module, "gosec", args...).Output()
+		var report struct {
+			Issues []struct {
+				RuleID  string `json:"rule_id"`
+				Details string `json:"details"`
+				File    string `json:"file"`
+				Line    string `json:"line"`
+			} `json:"Issues"`
+		}
+		if err := json.Unmarshal(output, &report); err != nil {
+			return nil, false
+		}
+
+		for _, issue := range report.Issues {
+			first, last, _ := strings.Cut(issue.Line, "-")
+			from, _ := strconv.Atoi(first)
+			to, err := strconv.Atoi(last)
+			if err != nil {
+				to = from
+			}
+			// gosec reports absolute paths.
+			for file, lines := range added {
+				if !strings.HasSuffix(filepath.ToSlash(issue.File), "/"+path.Clean(file)) && issue.File != file {
+					continue
+				}
+				for _, line := range lines {
+					if line.number >= from && line.number <= to {
+						findings = append(findings, fmt.Sprintf("%s:%d: [%s] %s\n    %s", file, line.number, issue.RuleID, issue.Details, strings.TrimSpace(line.text)))
+						break
+					}
+				}
+			}
+		}
+	}
+	return findings, true
+}
@@ -0,0 +1,66 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Most documentation text sent along with a draft to be checked.
+const maxSelfCheckDocs = 100_000
+
+const selfCheckPrompt = `Below is documentation fetched to answer a question, followed by a draft answer. Check every statement in the draft about an API (names, signatures, behavior, defaults, versions) against the documentation.
+
+- Keep statements the documentation supports, unchanged.
+- Remove statements the documentation contradicts, or correct them from the documentation.
+- Remove statements the documentation doesn't mention, unless they are needed for the answer to make sense; then keep them marked "(unverified)".
+- Keep citation markers and the <citations> block for the statements that remain, and drop citations nobody refers to any more.
+
+If anything was removed or corrected, end the answer with a short "Removed after checking the documentation:" list. Reply with the revised answer only.
+
+<documentation>
+%s
+</documentation>
+
+<draft>
+%s
+</draft>`
+
+// SelfCheck makes the agent re-read its draft answers against the documentation its
+// tools fetched, dropping or flagging statements the documentation doesn't support.
+func (a *Agent) SelfCheck() {
+	a.selfCheck = true
+}
+
+// checkAnswer runs the self-check pass over a draft answer. The draft is returned
+// unchanged when nothing was fetched to check it against, or the check fails.
+func (a *Agent) checkAnswer(ctx context.Context, draft string, messages []anthropic.MessageParam, usage *taskUsage) string {
+	docs := toolResultText(messages)
+	if strings.TrimSpace(docs) == "" {
+		fmt.Printf("%s🔎 No documentation fetched, skipping self-check%s\n", BlueColor, ResetColor)
+		return draft
+	}
+	if len(docs) > maxSelfCheckDocs {
+		docs = docs[len(docs)-maxSelfCheckDocs:]
+	}
+
+	fmt.Printf("%s🔎 Checking the answer against the documentation...%s\n", BlueColor, ResetColor)
+	check := []anthropic.MessageParam{anthropic.NewUserMessage(anthropic.NewTextBlock(fmt.Sprintf(selfCheckPrompt, docs, draft)))}
+	response, err := a.inferWithRetry(ctx, check, nil)
+	if err != nil {
+		fmt.Printf("Self-check failed, keeping the draft: %v\n", err)
+		return draft
+	}
+	if usage != nil {
+		usage.add(response.Model, response.Usage)
+	}
+
+	checked := responseText(response)
+	if checked == "" || response.StopReason == anthropic.StopReasonMaxTokens {
+		fmt.Printf("Self-check returned no complete answer, keeping the draft\n")
+		return draft
+	}
+	return checked
+}
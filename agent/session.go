@@ -0,0 +1,449 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/tools"
+)
+
+// Session used by transports that don't identify sessions.
+const defaultSessionID = "default"
+
+// How often idle sessions are looked for.
+const sessionSweepInterval = time.Minute
+
+var validSessionID = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+
+// sessionTransport is implemented by transports whose messages belong to a
+// client-chosen session, e.g. HTTP's X-Session-ID header.
+type sessionTransport interface {
+	Session() string
+}
+
+// session is one conversation's message history.
+type session struct {
+	id         string
+	messages   []anthropic.MessageParam
+	lastActive time.Time
+	size       int // approximate memory held by messages, in bytes
+	active     bool
+
+	// The model's scratchpad, kept outside the message history.
+	notesMu sync.Mutex
+	notes   []Note
+
+	// Files the model has read or written, for differential reads. Not persisted:
+	// a restored session starts with full reads again.
+	seen *tools.SeenFiles
+
+	// Shells opened with open_shell, closed when the session is evicted.
+	shells *tools.Shells
+
+	// Version of the session in the store's Backend, for optimistic locking.
+	version int64
+
+	// Edits waiting for review, see ReviewChanges. Not persisted.
+	review *pendingReview
+}
+
+// SessionState is what is saved of a session, to SESSION_DIR or a SessionBackend.
+type SessionState struct {
+	Messages []anthropic.MessageParam `json:"messages"`
+	Notes    []Note                   `json:"notes,omitempty"`
+}
+
+// SessionStore holds conversation histories, evicting those idle for longer than TTL.
+type SessionStore struct {
+	// Idle time after which a session is evicted; 0 keeps sessions forever.
+	TTL time.Duration
+	// If set, sessions are saved here before eviction and restored when resumed.
+	Dir string
+	// If set, sessions are loaded from here before every turn and saved after it,
+	// instead of using Dir, so several replicas can share them.
+	Backend SessionBackend
+	// If set, sessions saved to Dir are encrypted with it.
+	Sealer *Sealer
+
+	mu        sync.Mutex
+	sessions  map[string]*session
+	evicted   int
+	conflicts int
+}
+
+func NewSessionStore(ttl time.Duration, dir string) *SessionStore {
+	return &SessionStore{TTL: ttl, Dir: dir, sessions: map[string]*session{}}
+}
+
+// sessionStoreFromEnv reads SESSION_TTL (e.g. "30m", default 1h, "0" to disable)
+// and SESSION_DIR.
+func sessionStoreFromEnv() *SessionStore {
+	ttl := time.Hour
+	if value := os.Getenv("SESSION_TTL"); value != "" {
+		duration, err := time.ParseDuration(value)
+		if err != nil {
+			fmt.Printf("Invalid SESSION_TTL %q, ignoring: %v\n", value, err)
+		} else {
+			ttl = duration
+		}
+	}
+	return NewSessionStore(ttl, os.Getenv("SESSION_DIR"))
+}
+
+// acquire returns the session with the given ID, restoring or creating it, and
+// marks it in use so it isn't evicted mid-turn.
+func (s *SessionStore) acquire(id string, now time.Time) *session {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.sessions[id]
+	if !ok {
+		current = &session{id: id, seen: tools.NewSeenFiles(), shells: tools.NewShells()}
+		if s.Backend == nil {
+			current.messages, current.notes = s.load(id)
+		}
+		s.sessions[id] = current
+	}
+	if s.Backend != nil {
+		s.refresh(current)
+	}
+	current.active = true
+	current.lastActive = now
+	return current
+}
+
+// refresh replaces a session with the Backend's copy if another replica saved
+// a newer version of it.
+func (s *SessionStore) refresh(current *session) {
+	ctx, cancel := context.WithTimeout(context.Background(), sessionBackendTimeout)
+	defer cancel()
+
+	state, version, err := s.Backend.Load(ctx, current.id)
+	if err != nil {
+		fmt.Printf("Failed to load session %s, continuing with this replica's copy: %v\n", current.id, err)
+		return
+	}
+	if version == current.version {
+		return
+	}
+
+	current.notesMu.Lock()
+	current.messages, current.notes, current.version = state.Messages, state.Notes, version
+	current.notesMu.Unlock()
+	current.seen = tools.NewSeenFiles()
+}
+
+// release stores the session's messages once a turn is over, saving them to
+// the Backend if there is one.
+func (s *SessionStore) release(current *session, messages []anthropic.MessageParam, now time.Time) {
+	size := 0
+	if data, err := json.Marshal(messages); err == nil {
+		size = len(data)
+	}
+
+	if s.Backend != nil {
+		s.save(current, messages)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current.messages = messages
+	current.size = size
+	current.lastActive = now
+	current.active = false
+}
+
+// Evict drops sessions idle for longer than TTL, persisting them first if Dir is set.
+// It returns the number of sessions evicted.
+func (s *SessionStore) Evict(now time.Time) int {
+	if s.TTL <= 0 {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	evicted := 0
+	for id, current := range s.sessions {
+		// Evicting a session with edits waiting for review would lose them.
+		if current.active || now.Sub(current.lastActive) < s.TTL || current.review.pending() {
+			continue
+		}
+
+		if err := s.persist(current); err != nil {
+			fmt.Printf("Failed to persist session %s, keeping it: %v\n", id, err)
+			continue
+		}
+		current.shells.Close()
+		delete(s.sessions, id)
+		evicted++
+	}
+
+	s.evicted += evicted
+	return evicted
+}
+
+// save writes a session to the Backend. If another replica saved it during the
+// turn, that replica's copy wins and is loaded before the session's next turn.
+func (s *SessionStore) save(current *session, messages []anthropic.MessageParam) {
+	current.notesMu.Lock()
+	state := SessionState{Messages: messages, Notes: append([]Note{}, current.notes...)}
+	current.notesMu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), sessionBackendTimeout)
+	defer cancel()
+
+	version, err := s.Backend.Save(ctx, current.id, state, current.version)
+	switch {
+	case errors.Is(err, ErrSessionConflict):
+		fmt.Printf("⚠️  Session %s was changed by another replica during this turn; keeping its version\n", current.id)
+		s.mu.Lock()
+		s.conflicts++
+		s.mu.Unlock()
+	case err != nil:
+		fmt.Printf("Failed to save session %s, will retry after its next turn: %v\n", current.id, err)
+	default:
+		current.version = version
+	}
+}
+
+func (s *SessionStore) path(id string) string {
+	return filepath.Join(s.Dir, id+".json")
+}
+
+func (s *SessionStore) persist(current *session) error {
+	// Sessions in a Backend are saved after every turn.
+	if s.Backend != nil || s.Dir == "" || (len(current.messages) == 0 && len(current.notes) == 0) {
+		return nil
+	}
+
+	data, err := json.Marshal(SessionState{Messages: current.messages, Notes: current.notes})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	return tools.WriteFileAtomic(s.path(current.id), s.Sealer.Seal(data, current.id), 0600)
+}
+
+// Flush persists every session held in memory, e.g. before the process exits.
+// Sessions in the middle of a turn are saved as they were before it started.
+func (s *SessionStore) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var errs []error
+	for id, current := range s.sessions {
+		if err := s.persist(current); err != nil {
+			errs = append(errs, fmt.Errorf("session %s: %w", id, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// load restores a persisted session's messages and notes, if there is one.
+func (s *SessionStore) load(id string) ([]anthropic.MessageParam, []Note) {
+	if s.Backend != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sessionBackendTimeout)
+		defer cancel()
+
+		state, _, err := s.Backend.Load(ctx, id)
+		if err != nil {
+			fmt.Printf("Failed to load session %s: %v\n", id, err)
+		}
+		return state.Messages, state.Notes
+	}
+	if s.Dir == "" {
+		return nil, nil
+	}
+
+	data, err := os.ReadFile(s.path(id))
+	if err != nil {
+		return nil, nil
+	}
+	data, err = s.Sealer.Open(data, id)
+	if err != nil {
+		fmt.Printf("Failed to restore session %s: %v\n", id, err)
+		return nil, nil
+	}
+
+	var persisted SessionState
+	if err := json.Unmarshal(data, &persisted); err != nil {
+		fmt.Printf("Failed to restore session %s: %v\n", id, err)
+		return nil, nil
+	}
+	fmt.Printf("Restored session %s (%d messages, %d notes)\n", id, len(persisted.Messages), len(persisted.Notes))
+	return persisted.Messages, persisted.Notes
+}
+
+// Messages returns a copy of a session's history, restoring it from Dir if evicted.
+// Sessions in a Backend are always read from it, since another replica may have
+// continued them.
+func (s *SessionStore) Messages(id string) []anthropic.MessageParam {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.sessions[id]; ok && s.Backend == nil {
+		return append([]anthropic.MessageParam{}, current.messages...)
+	}
+	messages, _ := s.load(id)
+	return messages
+}
+
+// errSessionBusy is returned by idle for a session in the middle of a turn.
+var errSessionBusy = errors.New("the session is in the middle of a turn; try again once it's answered")
+
+// idle calls f with a live session that isn't in the middle of a turn, keeping
+// its next turn from starting until f returns.
+func (s *SessionStore) idle(id string, f func(*session) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.sessions[id]
+	if !ok {
+		return fmt.Errorf("session %s has no pending changes", id)
+	}
+	if current.active {
+		return errSessionBusy
+	}
+	return f(current)
+}
+
+// review returns a live session's pending edits, or nil if it has none.
+func (s *SessionStore) review(id string) *pendingReview {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if current, ok := s.sessions[id]; ok {
+		return current.review
+	}
+	return nil
+}
+
+// IDs lists the sessions whose ID starts with prefix, live or persisted, sorted.
+func (s *SessionStore) IDs(prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.Backend != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), sessionBackendTimeout)
+		defer cancel()
+
+		ids, err := s.Backend.List(ctx, prefix)
+		if err != nil {
+			fmt.Printf("Failed to list sessions: %v\n", err)
+		}
+		return ids
+	}
+
+	found := map[string]bool{}
+	for id := range s.sessions {
+		if strings.HasPrefix(id, prefix) {
+			found[id] = true
+		}
+	}
+	if s.Dir != "" {
+		entries, _ := os.ReadDir(s.Dir)
+		for _, entry := range entries {
+			id, ok := strings.CutSuffix(entry.Name(), ".json")
+			if ok && strings.HasPrefix(id, prefix) {
+				found[id] = true
+			}
+		}
+	}
+
+	ids := make([]string, 0, len(found))
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// SessionMetrics describes the sessions currently held in memory.
+type SessionMetrics struct {
+	Live         int
+	MessageBytes int
+	Evicted      int
+	Conflicts    int
+}
+
+func (s *SessionStore) Metrics() SessionMetrics {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	metrics := SessionMetrics{Live: len(s.sessions), Evicted: s.evicted, Conflicts: s.conflicts}
+	for _, current := range s.sessions {
+		metrics.MessageBytes += current.size
+	}
+	return metrics
+}
+
+// SetSessionStore replaces the agent's session store, e.g. to change its TTL.
+func (a *Agent) SetSessionStore(store *SessionStore) {
+	a.sessions = store
+}
+
+// currentSession returns the session ID of the message being handled.
+func (a *Agent) currentSession() string {
+	if transport, ok := a.current.(sessionTransport); ok {
+		if id := transport.Session(); validSessionID.MatchString(id) {
+			return id
+		}
+	}
+	return defaultSessionID
+}
+
+// evictIdleSessions periodically evicts idle sessions until ctx is done.
+func (a *Agent) evictIdleSessions(ctx context.Context) {
+	ticker := time.NewTicker(sessionSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if evicted := a.sessions.Evict(a.clock.Now()); evicted > 0 {
+				fmt.Printf("Evicted %d idle session(s)\n", evicted)
+			}
+		}
+	}
+}
+
+// handleMetrics reports session and memory metrics in the Prometheus text format.
+func (a *Agent) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	metrics := a.sessions.Metrics()
+
+	var memory runtime.MemStats
+	runtime.ReadMemStats(&memory)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprintf(w, "# HELP agent_sessions_live Sessions held in memory.\n# TYPE agent_sessions_live gauge\nagent_sessions_live %d\n", metrics.Live)
+	fmt.Fprintf(w, "# HELP agent_session_message_bytes Approximate size of the message histories held in memory.\n# TYPE agent_session_message_bytes gauge\nagent_session_message_bytes %d\n", metrics.MessageBytes)
+	fmt.Fprintf(w, "# HELP agent_sessions_evicted_total Sessions evicted after idling past the TTL.\n# TYPE agent_sessions_evicted_total counter\nagent_sessions_evicted_total %d\n", metrics.Evicted)
+	if a.sessions.Backend != nil {
+		fmt.Fprintf(w, "# HELP agent_session_conflicts_total Turns whose session was changed by another replica before it could be saved.\n# TYPE agent_session_conflicts_total counter\nagent_session_conflicts_total %d\n", metrics.Conflicts)
+	}
+	if a.cache != nil {
+		cache := a.cache.Metrics()
+		fmt.Fprintf(w, "# HELP agent_response_cache_entries Answers held in the response cache.\n# TYPE agent_response_cache_entries gauge\nagent_response_cache_entries %d\n", cache.Entries)
+		fmt.Fprintf(w, "# HELP agent_response_cache_hits_total Queries answered from the response cache.\n# TYPE agent_response_cache_hits_total counter\nagent_response_cache_hits_total %d\n", cache.Hits)
+		fmt.Fprintf(w, "# HELP agent_response_cache_misses_total Cacheable queries not found in the response cache.\n# TYPE agent_response_cache_misses_total counter\nagent_response_cache_misses_total %d\n", cache.Misses)
+	}
+	fmt.Fprintf(w, "# HELP go_memstats_heap_alloc_bytes Bytes of allocated heap objects.\n# TYPE go_memstats_heap_alloc_bytes gauge\ngo_memstats_heap_alloc_bytes %d\n", memory.HeapAlloc)
+}
@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// How long a single load or save of a shared session may take.
+const sessionBackendTimeout = 10 * time.Second
+
+// ErrSessionConflict is returned by SessionBackend.Save when another replica
+// saved the session since it was loaded.
+var ErrSessionConflict = errors.New("session was changed by another replica")
+
+// SessionBackend stores sessions outside the process, so that several replicas
+// of an agent behind a load balancer can continue any session.
+type SessionBackend interface {
+	// Load returns a session's state and version; a session that was never
+	// saved has version 0 and no state.
+	Load(ctx context.Context, id string) (SessionState, int64, error)
+	// Save stores a session's state if its version is still version, and returns
+	// the new version. Otherwise it returns ErrSessionConflict.
+	Save(ctx context.Context, id string, state SessionState, version int64) (int64, error)
+	// List returns the IDs of the stored sessions starting with prefix, sorted.
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// SetSessionBackend keeps the agent's sessions in backend instead of in memory
+// and SESSION_DIR. Call before Run.
+func (a *Agent) SetSessionBackend(backend SessionBackend) {
+	a.sessions.Backend = backend
+	a.shareSealer()
+}
+
+// SQLSessionBackend keeps sessions in the agent_sessions table of a Postgres
+// or SQLite database, created if needed.
+type SQLSessionBackend struct {
+	db *sql.DB
+
+	// If set, session states are encrypted with it.
+	Sealer *Sealer
+}
+
+// NewSQLSessionBackend connects to the database; driver is "postgres" or "sqlite".
+func NewSQLSessionBackend(driver, dsn string) (*SQLSessionBackend, error) {
+	if driver != "postgres" && driver != "sqlite" {
+		return nil, fmt.Errorf("unknown session database driver %q; valid values are postgres or sqlite", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open session database: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), sessionBackendTimeout)
+	defer cancel()
+	_, err = db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS agent_sessions (
+		id TEXT PRIMARY KEY,
+		version BIGINT NOT NULL,
+		state TEXT NOT NULL,
+		updated_at TIMESTAMP NOT NULL
+	)`)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create the agent_sessions table: %v", err)
+	}
+	return &SQLSessionBackend{db: db}, nil
+}
+
+func (b *SQLSessionBackend) Load(ctx context.Context, id string) (SessionState, int64, error) {
+	var state SessionState
+	var version int64
+	var data string
+	err := b.db.QueryRowContext(ctx, `SELECT version, state FROM agent_sessions WHERE id = $1`, id).Scan(&version, &data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return state, 0, nil
+	}
+	if err != nil {
+		return state, 0, err
+	}
+	plaintext, err := b.Sealer.Open([]byte(data), id)
+	if err != nil {
+		return state, 0, fmt.Errorf("session %s: %v", id, err)
+	}
+	if err := json.Unmarshal(plaintext, &state); err != nil {
+		return state, 0, fmt.Errorf("invalid state of session %s: %v", id, err)
+	}
+	return state, version, nil
+}
+
+func (b *SQLSessionBackend) Save(ctx context.Context, id string, state SessionState, version int64) (int64, error) {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return 0, err
+	}
+	data = b.Sealer.Seal(data, id)
+
+	// The version check and the write are a single statement, so of two
+	// replicas saving the same version only one succeeds.
+	var result sql.Result
+	now := time.Now().UTC()
+	if version == 0 {
+		result, err = b.db.ExecContext(ctx, `INSERT INTO agent_sessions (id, version, state, updated_at) VALUES ($1, 1, $2, $3) ON CONFLICT (id) DO NOTHING`, id, string(data), now)
+	} else {
+		result, err = b.db.ExecContext(ctx, `UPDATE agent_sessions SET version = version + 1, state = $1, updated_at = $2 WHERE id = $3 AND version = $4`, string(data), now, id, version)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if rows == 0 {
+		return 0, ErrSessionConflict
+	}
+	return version + 1, nil
+}
+
+func (b *SQLSessionBackend) List(ctx context.Context, prefix string) ([]string, error) {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+	rows, err := b.db.QueryContext(ctx, `SELECT id FROM agent_sessions WHERE id LIKE $1 ESCAPE '\' ORDER BY id`, escaped+"%")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		// SQLite's LIKE ignores case.
+		if strings.HasPrefix(id, prefix) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
+func (b *SQLSessionBackend) Close() error {
+	return b.db.Close()
+}
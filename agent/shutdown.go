@@ -0,0 +1,99 @@
+package agent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+)
+
+// How long Shutdown waits for the turn in progress unless SHUTDOWN_TIMEOUT says otherwise.
+const defaultShutdownTimeout = 25 * time.Second
+
+// ErrShuttingDown is returned by Run once Shutdown has stopped it between turns.
+var ErrShuttingDown = errors.New("agent is shutting down")
+
+// Sent to callers whose message arrives while the agent is draining.
+const shuttingDownMessage = "The agent is shutting down; retry the request"
+
+// ShutdownTimeout reads SHUTDOWN_TIMEOUT, e.g. "90s". It should be a little shorter
+// than the pod's terminationGracePeriodSeconds.
+func ShutdownTimeout() time.Duration {
+	if value := os.Getenv("SHUTDOWN_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err == nil && timeout > 0 {
+			return timeout
+		}
+		fmt.Printf("Invalid SHUTDOWN_TIMEOUT %q, using %s\n", value, defaultShutdownTimeout)
+	}
+	return defaultShutdownTimeout
+}
+
+// Shutdown drains the agent: /health starts failing so no new traffic is routed
+// here, the turn in progress is allowed to finish until ctx expires, messages
+// that arrive meanwhile are turned away, and all sessions are saved before the
+// server and transports are closed.
+func (a *Agent) Shutdown(ctx context.Context) error {
+	a.stopOnce.Do(func() { close(a.stopping) })
+	fmt.Printf("%s🛑 Shutting down, waiting for the turn in progress%s\n", BlueColor, ResetColor)
+
+	var errs []error
+	select {
+	case <-a.stopped:
+	case <-ctx.Done():
+		errs = append(errs, fmt.Errorf("the turn in progress didn't finish: %w", ctx.Err()))
+	}
+
+	if err := a.sessions.Flush(); err != nil {
+		errs = append(errs, fmt.Errorf("failed to save sessions: %w", err))
+	}
+	if a.server != nil {
+		errs = append(errs, a.server.Shutdown(ctx))
+	}
+	errs = append(errs, a.Close())
+	if a.auditLog != nil {
+		errs = append(errs, a.auditLog.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// draining reports whether Shutdown has been called.
+func (a *Agent) draining() bool {
+	select {
+	case <-a.stopping:
+		return true
+	default:
+		return false
+	}
+}
+
+// readTurnInput waits for the message starting the next turn. Once Shutdown has
+// been called it returns ErrShuttingDown instead, even if messages are waiting.
+func (a *Agent) readTurnInput() (string, error) {
+	if !a.draining() {
+		select {
+		case input := <-a.inputs:
+			a.current = input.transport
+			return input.message, nil
+		case <-a.stopping:
+		}
+	}
+
+	close(a.stopped)
+	return "", ErrShuttingDown
+}
+
+// reject turns away a message that arrived after Run stopped.
+func (a *Agent) reject(transport Transport) {
+	var err error
+	if errTransport, ok := transport.(errorTransport); ok {
+		err = errTransport.WriteError(http.StatusServiceUnavailable, a.text("shutting_down", shuttingDownMessage))
+	} else {
+		err = transport.Write(a.text("shutting_down", shuttingDownMessage))
+	}
+	if err != nil {
+		fmt.Printf("Failed to turn away a message: %v\n", err)
+	}
+}
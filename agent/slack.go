@@ -0,0 +1,422 @@
+package agent
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/net/websocket"
+)
+
+// Slack's Web API.
+const slackAPI = "https://slack.com/api/"
+
+// Longest text sent in one Slack message; longer replies are split.
+const maxSlackMessage = 3900
+
+// Delay before reconnecting after the Socket Mode connection dropped.
+const slackReconnectDelay = 5 * time.Second
+
+// Threads the Slack transport remembers answering, so follow-ups in them
+// don't need to mention the bot; the oldest are forgotten first.
+const maxSlackThreads = 1000
+
+var slackMention = regexp.MustCompile(`<@[A-Z0-9]+>\s*`)
+
+// SlackTransport connects the agent to Slack over Socket Mode, so it can serve a
+// team channel without a public URL. It answers messages mentioning the bot and
+// direct messages, in a thread; each thread is a session, so follow-ups in it
+// (which needn't mention the bot) continue the conversation. While a turn runs,
+// a status message in the thread lists the tools being called.
+type SlackTransport struct {
+	appToken string
+	botToken string
+	botID    string
+	client   *http.Client
+
+	incoming chan slackMessage
+	closed   chan struct{}
+	once     sync.Once
+
+	// Web API calls, made in order by one goroutine so thread updates stay in order.
+	calls chan func()
+
+	// Messages read but not answered yet, oldest first; replies are in order.
+	mu      sync.Mutex
+	pending []*slackMessage
+	conn    *websocket.Conn
+	// Threads the bot answered in, oldest first, and message timestamps already handled.
+	threads    []string
+	inThread   map[string]bool
+	handledTS  map[string]bool
+	handledLog []string
+}
+
+// slackMessage is a message the agent is answering, and the status message
+// showing its progress.
+type slackMessage struct {
+	channel string
+	thread  string
+	text    string
+
+	// Written by the Web API goroutine only.
+	statusTS string
+	tools    []string
+}
+
+// slackEvent is the part of an Events API event the transport uses.
+type slackEvent struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype"`
+	Text        string `json:"text"`
+	User        string `json:"user"`
+	BotID       string `json:"bot_id"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type"`
+	TS          string `json:"ts"`
+	ThreadTS    string `json:"thread_ts"`
+}
+
+// NewSlackTransport connects to Slack with a Socket Mode app-level token
+// (xapp-...) and a bot token (xoxb-...) used to post replies.
+func NewSlackTransport(appToken, botToken string) (*SlackTransport, error) {
+	if appToken == "" || botToken == "" {
+		return nil, fmt.Errorf("both an app-level token and a bot token are required")
+	}
+	t := &SlackTransport{
+		appToken:  appToken,
+		botToken:  botToken,
+		client:    &http.Client{Timeout: 30 * time.Second},
+		incoming:  make(chan slackMessage),
+		closed:    make(chan struct{}),
+		calls:     make(chan func(), 100),
+		inThread:  map[string]bool{},
+		handledTS: map[string]bool{},
+	}
+
+	var identity struct {
+		UserID string `json:"user_id"`
+	}
+	if err := t.call(botToken, "auth.test", nil, &identity); err != nil {
+		return nil, fmt.Errorf("invalid bot token: %v", err)
+	}
+	t.botID = identity.UserID
+
+	conn, err := t.connect()
+	if err != nil {
+		return nil, err
+	}
+	t.conn = conn
+
+	go t.receive(conn)
+	go t.makeCalls()
+	return t, nil
+}
+
+// connect opens a Socket Mode connection.
+func (t *SlackTransport) connect() (*websocket.Conn, error) {
+	var connection struct {
+		URL string `json:"url"`
+	}
+	if err := t.call(t.appToken, "apps.connections.open", nil, &connection); err != nil {
+		return nil, fmt.Errorf("failed to open a Socket Mode connection: %v", err)
+	}
+	conn, err := websocket.Dial(connection.URL, "", "https://slack.com")
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Slack: %v", err)
+	}
+	return conn, nil
+}
+
+// receive acknowledges and handles envelopes, reconnecting whenever Slack drops
+// the connection, which it does every few hours.
+func (t *SlackTransport) receive(conn *websocket.Conn) {
+	for {
+		var envelope struct {
+			Type       string `json:"type"`
+			EnvelopeID string `json:"envelope_id"`
+			Payload    struct {
+				Event slackEvent `json:"event"`
+			} `json:"payload"`
+		}
+		err := websocket.JSON.Receive(conn, &envelope)
+		if err == nil && envelope.Type != "disconnect" {
+			if envelope.EnvelopeID != "" {
+				websocket.JSON.Send(conn, map[string]string{"envelope_id": envelope.EnvelopeID})
+			}
+			if envelope.Type == "events_api" {
+				t.handle(envelope.Payload.Event)
+			}
+			continue
+		}
+
+		conn.Close()
+		for {
+			select {
+			case <-t.closed:
+				return
+			default:
+			}
+			if conn, err = t.connect(); err == nil {
+				break
+			}
+			fmt.Printf("Slack: %v, retrying in %s\n", err, slackReconnectDelay)
+			select {
+			case <-time.After(slackReconnectDelay):
+			case <-t.closed:
+				return
+			}
+		}
+		t.mu.Lock()
+		t.conn = conn
+		t.mu.Unlock()
+	}
+}
+
+// handle queues a message if it is for the bot: a mention, a direct message, or
+// a follow-up in a thread the bot answered in.
+func (t *SlackTransport) handle(event slackEvent) {
+	if event.BotID != "" || event.User == t.botID || (event.Subtype != "" && event.Subtype != "file_share") {
+		return
+	}
+	thread := event.ThreadTS
+	if thread == "" {
+		thread = event.TS
+	}
+
+	t.mu.Lock()
+	// A mention in a thread arrives both as app_mention and as message.
+	forBot := event.Type == "app_mention" || event.ChannelType == "im" || t.inThread[event.Channel+"/"+thread]
+	if !forBot || t.handledTS[event.Channel+"/"+event.TS] {
+		t.mu.Unlock()
+		return
+	}
+	t.remember(event.Channel + "/" + event.TS)
+	t.mu.Unlock()
+
+	text := strings.TrimSpace(slackMention.ReplaceAllString(event.Text, ""))
+	if text == "" {
+		return
+	}
+	select {
+	case t.incoming <- slackMessage{channel: event.Channel, thread: thread, text: text}:
+	case <-t.closed:
+	}
+}
+
+// remember records a handled message, forgetting the oldest. Call with t.mu held.
+func (t *SlackTransport) remember(key string) {
+	t.handledTS[key] = true
+	t.handledLog = append(t.handledLog, key)
+	if len(t.handledLog) > maxSlackThreads {
+		delete(t.handledTS, t.handledLog[0])
+		t.handledLog = t.handledLog[1:]
+	}
+}
+
+func (t *SlackTransport) Read() (string, error) {
+	select {
+	case message := <-t.incoming:
+		t.mu.Lock()
+		t.pending = append(t.pending, &message)
+		key := message.channel + "/" + message.thread
+		if !t.inThread[key] {
+			t.inThread[key] = true
+			t.threads = append(t.threads, key)
+			if len(t.threads) > maxSlackThreads {
+				delete(t.inThread, t.threads[0])
+				t.threads = t.threads[1:]
+			}
+		}
+		t.mu.Unlock()
+		return message.text, nil
+	case <-t.closed:
+		return "", io.EOF
+	}
+}
+
+// Session maps the thread being answered to a session, e.g. slack-C024BE91L-1712345678.000100.
+func (t *SlackTransport) Session() string {
+	message := t.current()
+	if message == nil {
+		return ""
+	}
+	return fmt.Sprintf("slack-%s-%s", message.channel, message.thread)
+}
+
+func (t *SlackTransport) current() *slackMessage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(t.pending) == 0 {
+		return nil
+	}
+	return t.pending[0]
+}
+
+// Event shows the turn's tool calls in its status message.
+func (t *SlackTransport) Event(event Event) {
+	message := t.current()
+	if message == nil {
+		return
+	}
+	switch event.Type {
+	case TurnStarted:
+		t.calls <- func() { t.updateStatus(message, "Working on it…") }
+	case ToolCalled:
+		line := fmt.Sprintf("• `%s` %s", event.ToolName, summarizeToolInput(event.ToolInput))
+		t.calls <- func() {
+			message.tools = append(message.tools, line)
+			t.updateStatus(message, "Working on it…\n"+strings.Join(message.tools, "\n"))
+		}
+	}
+}
+
+// summarizeToolInput shortens a tool call's input for display.
+func summarizeToolInput(input json.RawMessage) string {
+	text := strings.Join(strings.Fields(string(input)), " ")
+	if len(text) > 120 {
+		text = text[:117] + "..."
+	}
+	return text
+}
+
+// Write posts the reply in the thread of the message being answered.
+func (t *SlackTransport) Write(message string) error {
+	t.mu.Lock()
+	if len(t.pending) == 0 {
+		t.mu.Unlock()
+		return fmt.Errorf("no Slack message to reply to")
+	}
+	answered := t.pending[0]
+	t.pending = t.pending[1:]
+	t.mu.Unlock()
+
+	t.calls <- func() {
+		if answered.statusTS != "" {
+			status := "Done."
+			if len(answered.tools) > 0 {
+				status = "Done. Tools used:\n" + strings.Join(answered.tools, "\n")
+			}
+			t.updateStatus(answered, status)
+		}
+		for _, chunk := range splitSlackMessage(message) {
+			if err := t.post(answered, chunk); err != nil {
+				fmt.Printf("Slack: failed to post a reply: %v\n", err)
+				return
+			}
+		}
+	}
+	return nil
+}
+
+// updateStatus posts or edits the message's status message.
+func (t *SlackTransport) updateStatus(message *slackMessage, text string) {
+	if message.statusTS == "" {
+		var posted struct {
+			TS string `json:"ts"`
+		}
+		body := map[string]string{"channel": message.channel, "thread_ts": message.thread, "text": text}
+		if err := t.call(t.botToken, "chat.postMessage", body, &posted); err != nil {
+			fmt.Printf("Slack: failed to post status: %v\n", err)
+			return
+		}
+		message.statusTS = posted.TS
+		return
+	}
+	body := map[string]string{"channel": message.channel, "ts": message.statusTS, "text": text}
+	if err := t.call(t.botToken, "chat.update", body, nil); err != nil {
+		fmt.Printf("Slack: failed to update status: %v\n", err)
+	}
+}
+
+func (t *SlackTransport) post(message *slackMessage, text string) error {
+	return t.call(t.botToken, "chat.postMessage", map[string]string{"channel": message.channel, "thread_ts": message.thread, "text": text}, nil)
+}
+
+// makeCalls runs Web API calls in order until the transport is closed.
+func (t *SlackTransport) makeCalls() {
+	for {
+		select {
+		case call := <-t.calls:
+			call()
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+// call calls a Web API method, decoding the response into result if it isn't nil.
+func (t *SlackTransport) call(token string, method string, body any, result any) error {
+	data := []byte("{}")
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	request, err := http.NewRequest("POST", slackAPI+method, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Bearer "+token)
+	request.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	response, err := t.client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	raw, err := io.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(raw, &status); err != nil {
+		return fmt.Errorf("%s: %s", method, response.Status)
+	}
+	if !status.OK {
+		return fmt.Errorf("%s: %s", method, status.Error)
+	}
+	if result != nil {
+		return json.Unmarshal(raw, result)
+	}
+	return nil
+}
+
+// splitSlackMessage splits text into messages Slack shows in full, at line breaks where possible.
+func splitSlackMessage(text string) []string {
+	var chunks []string
+	for len(text) > maxSlackMessage {
+		cut := strings.LastIndex(text[:maxSlackMessage], "\n")
+		if cut <= 0 {
+			cut = maxSlackMessage
+			for !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		chunks = append(chunks, text[:cut])
+		text = strings.TrimLeft(text[cut:], "\n")
+	}
+	return append(chunks, text)
+}
+
+func (t *SlackTransport) Close() error {
+	t.once.Do(func() { close(t.closed) })
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.conn != nil {
+		return t.conn.Close()
+	}
+	return nil
+}
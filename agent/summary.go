@@ -0,0 +1,198 @@
+package agent
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// Limits of the workspace walk behind the summary.
+const (
+	summaryMaxDepth = 6
+	summaryMaxDirs  = 500
+)
+
+// Directories left out of the summary.
+var summarySkipped = map[string]bool{".git": true, "vendor": true, "node_modules": true, "testdata": true}
+
+// SummarizeWorkspace makes the agent start every new session with an overview of
+// its workspace (module path, packages, entry points and tests), saving the
+// model the usual exploratory first turns. The overview is computed in the
+// background when Run starts and whenever the filesystem changes.
+func (a *Agent) SummarizeWorkspace() {
+	a.summaryEnabled = true
+}
+
+// warmUp computes the workspace summary and fetches the documentation agent's
+// capabilities ahead of the first session.
+func (a *Agent) warmUp() {
+	if a.summaryEnabled {
+		go a.workspaceSummary()
+		go a.prepareRepoOverview()
+	}
+	if _, ok := a.tools.Lookup("invoke_documentation_agent"); ok {
+		go tools.PrefetchDocAgentCapabilities(context.Background())
+	}
+}
+
+// workspaceSummary returns the summary of the current filesystem, computing it once.
+func (a *Agent) workspaceSummary() string {
+	a.summaryMu.Lock()
+	defer a.summaryMu.Unlock()
+
+	if a.summary == "" {
+		a.summary = summarizeWorkspace(tools.NewIgnoreFS(a.fs))
+		fmt.Printf("%s🗺️  Workspace summary ready (%d bytes)%s\n", BlueColor, len(a.summary), ResetColor)
+	}
+	// Large repositories are described further once their overview is built.
+	if overview := a.repoSummary.ready(); overview != "" {
+		return a.summary + "\n" + overview
+	}
+	return a.summary
+}
+
+// resetWorkspaceSummary drops the cached summary after the filesystem changed.
+func (a *Agent) resetWorkspaceSummary() {
+	a.summaryMu.Lock()
+	a.summary = ""
+	a.summaryMu.Unlock()
+
+	a.warmUp()
+}
+
+// goPackage is a directory holding Go files.
+type goPackage struct {
+	dir   string
+	name  string
+	files int
+	tests int
+}
+
+// summarizeWorkspace lists the projects in the workspace and describes a Go
+// module's layout, or lists the top level of anything else.
+func summarizeWorkspace(fsys tools.FS) string {
+	var summary strings.Builder
+	summary.WriteString("<workspace_summary>\nOverview of the workspace, computed ahead of this session; it may be out of date after edits.\n")
+
+	if data, err := fsys.ReadFile("go.mod"); err == nil {
+		for _, line := range strings.Split(string(data), "\n") {
+			if fields := strings.Fields(line); len(fields) == 2 && (fields[0] == "module" || fields[0] == "go") {
+				fmt.Fprintf(&summary, "%s %s\n", fields[0], fields[1])
+			}
+		}
+	}
+
+	if projects := tools.DetectProjects(fsys); len(projects) > 0 {
+		fmt.Fprintf(&summary, "Projects (build_project, run_tests and format_code work on each): %s\n", tools.DescribeProjects(projects))
+	}
+	if names := tools.TaskFileNames(fsys, "."); len(names) > 0 {
+		fmt.Fprintf(&summary, "Workflows (list_targets shows them): %s\n", strings.Join(names, ", "))
+	}
+
+	var packages []goPackage
+	var topLevel []string
+	dirs := 0
+
+	var walk func(dir string, depth int)
+	walk = func(dir string, depth int) {
+		entries, err := fsys.ReadDir(dir)
+		if err != nil || dirs >= summaryMaxDirs {
+			return
+		}
+		dirs++
+
+		pkg := goPackage{dir: dir}
+		for _, entry := range entries {
+			name := entry.Name()
+			if dir == "." && !summarySkipped[name] {
+				if entry.IsDir() {
+					topLevel = append(topLevel, name+"/")
+				} else {
+					topLevel = append(topLevel, name)
+				}
+			}
+
+			if entry.IsDir() {
+				if depth < summaryMaxDepth && !summarySkipped[name] && !strings.HasPrefix(name, ".") && !strings.HasPrefix(name, "_") {
+					walk(path.Join(dir, name), depth+1)
+				}
+				continue
+			}
+			if !strings.HasSuffix(name, ".go") {
+				continue
+			}
+			if strings.HasSuffix(name, "_test.go") {
+				pkg.tests++
+				continue
+			}
+			pkg.files++
+			if pkg.name == "" {
+				pkg.name = packageClause(fsys, path.Join(dir, name))
+			}
+		}
+		if pkg.files > 0 || pkg.tests > 0 {
+			packages = append(packages, pkg)
+		}
+	}
+	walk(".", 0)
+
+	fmt.Fprintf(&summary, "Top level: %s\n", strings.Join(topLevel, " "))
+	if len(packages) == 0 {
+		summary.WriteString("</workspace_summary>")
+		return summary.String()
+	}
+
+	sort.Slice(packages, func(i, j int) bool { return packages[i].dir < packages[j].dir })
+
+	var entryPoints, tested, untested []string
+	summary.WriteString("Packages (directory: package, files):\n")
+	for _, pkg := range packages {
+		fmt.Fprintf(&summary, "- %s: %s, %d files", pkg.dir, pkg.name, pkg.files)
+		if pkg.tests > 0 {
+			fmt.Fprintf(&summary, " + %d test files", pkg.tests)
+			tested = append(tested, pkg.dir)
+		} else if pkg.files > 0 {
+			untested = append(untested, pkg.dir)
+		}
+		summary.WriteString("\n")
+
+		if pkg.name == "main" {
+			entryPoints = append(entryPoints, pkg.dir)
+		}
+	}
+
+	if len(entryPoints) > 0 {
+		fmt.Fprintf(&summary, "Entry points (package main): %s\n", strings.Join(entryPoints, ", "))
+	}
+	if len(tested) == 0 {
+		summary.WriteString("Tests: none\n")
+	} else {
+		fmt.Fprintf(&summary, "Tests: in %s; none in %d other packages\n", strings.Join(tested, ", "), len(untested))
+	}
+	if dirs >= summaryMaxDirs {
+		fmt.Fprintf(&summary, "(Only the first %d directories were scanned.)\n", summaryMaxDirs)
+	}
+	summary.WriteString("</workspace_summary>")
+	return summary.String()
+}
+
+// packageClause returns the package name declared by a Go file.
+func packageClause(fsys tools.FS, name string) string {
+	data, err := fsys.ReadFile(name)
+	if err != nil {
+		return "?"
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) >= 2 && fields[0] == "package" {
+			return fields[1]
+		}
+	}
+	return "?"
+}
@@ -0,0 +1,92 @@
+package agent
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/tools"
+)
+
+// Trajectory is a recorded session that can be replayed and asserted against:
+// the conversation, the tool calls made and the final content of the files changed.
+// It is the "json" export format.
+type Trajectory struct {
+	Messages  []anthropic.MessageParam `json:"messages"`
+	ToolCalls []TrajectoryCall         `json:"tool_calls"`
+	// Final content of every file the session changed, by path.
+	Files map[string]string `json:"files,omitempty"`
+	// Files the session started from, by path; filled in by hand when a replay needs them.
+	Workspace map[string]string `json:"workspace,omitempty"`
+}
+
+// TrajectoryCall is one tool call of a trajectory.
+type TrajectoryCall struct {
+	Name  string          `json:"name"`
+	Input json.RawMessage `json:"input"`
+	Error bool            `json:"error,omitempty"`
+}
+
+// Trajectory records the current session.
+func (a *Agent) Trajectory() Trajectory {
+	return a.trajectory(a.Transcript())
+}
+
+func (a *Agent) trajectory(messages []anthropic.MessageParam) Trajectory {
+	return buildTrajectory(messages, a.fs)
+}
+
+// buildTrajectory records messages, reading the files they changed from fsys.
+func buildTrajectory(messages []anthropic.MessageParam, fsys tools.FS) Trajectory {
+	trajectory := Trajectory{Messages: messages, ToolCalls: []TrajectoryCall{}}
+	changed := map[string]bool{}
+
+	for _, entry := range buildTranscript(messages) {
+		if entry.ToolName == "" {
+			continue
+		}
+		trajectory.ToolCalls = append(trajectory.ToolCalls, TrajectoryCall{Name: entry.ToolName, Input: compactJSON(entry.ToolInput), Error: entry.ToolError})
+
+		_, changes := tools.ParseFileChanges(entry.ToolResult)
+		for _, change := range changes {
+			changed[change.Path] = true
+		}
+	}
+
+	paths := []string{}
+	for path := range changed {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		data, err := fsys.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		if trajectory.Files == nil {
+			trajectory.Files = map[string]string{}
+		}
+		trajectory.Files[path] = string(data)
+	}
+	return trajectory
+}
+
+// renderTrajectory renders the session in the "json" export format.
+func renderTrajectory(messages []anthropic.MessageParam, fsys tools.FS) (string, error) {
+	data, err := json.MarshalIndent(buildTrajectory(messages, fsys), "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// compactJSON undoes the indentation the transcript applies to tool inputs.
+func compactJSON(indented string) json.RawMessage {
+	var input json.RawMessage
+	if err := json.Unmarshal([]byte(indented), &input); err != nil {
+		return json.RawMessage("null")
+	}
+	data, _ := json.Marshal(input)
+	return data
+}
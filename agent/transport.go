@@ -0,0 +1,145 @@
+package agent
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Transport carries user messages to the agent and its replies back.
+// An agent can have several transports attached at once; each reply goes
+// to the transport the message being answered came from.
+type Transport interface {
+	// Read blocks until the next user message arrives. It returns io.EOF once closed.
+	Read() (string, error)
+	Write(message string) error
+	Close() error
+}
+
+// statusTransport is implemented by transports that can report a task status
+// (e.g. budget_exceeded, awaiting_input) and continuation token alongside a reply.
+type statusTransport interface {
+	SetStatus(status string, continuation string)
+}
+
+// errorTransport is implemented by transports that report a failed turn
+// differently from a reply, e.g. HTTP with a 4xx or 5xx status code.
+type errorTransport interface {
+	WriteError(status int, message string) error
+}
+
+// requestIDTransport is implemented by transports whose messages may carry a
+// caller-chosen request ID, e.g. HTTP's X-Request-ID header.
+type requestIDTransport interface {
+	RequestID() string
+}
+
+// transportInput is a message read from one of the agent's transports.
+type transportInput struct {
+	transport Transport
+	message   string
+}
+
+// AddTransport attaches a transport; its messages are handled in arrival order
+// together with those of all other transports.
+func (a *Agent) AddTransport(transport Transport) {
+	a.transportsMu.Lock()
+	a.transports = append(a.transports, transport)
+	a.transportsMu.Unlock()
+
+	go func() {
+		for {
+			message, err := transport.Read()
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				fmt.Printf("Transport read error: %v\n", err)
+				continue
+			}
+
+			select {
+			case a.inputs <- transportInput{transport: transport, message: message}:
+			case <-a.stopped:
+				a.reject(transport)
+			}
+		}
+	}()
+}
+
+// Close closes all attached transports, tears down any workspaces and stops watching files.
+func (a *Agent) Close() error {
+	a.transportsMu.Lock()
+	defer a.transportsMu.Unlock()
+
+	var errs []error
+	for _, transport := range a.transports {
+		errs = append(errs, transport.Close())
+	}
+	if a.workspaces != nil {
+		errs = append(errs, a.workspaces.DestroyAll())
+	}
+	if a.watcher != nil {
+		errs = append(errs, a.watcher.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// readInput waits for the next message from any transport.
+func (a *Agent) readInput() (string, error) {
+	input := <-a.inputs
+	a.current = input.transport
+	a.unanswered = false
+	return input.message, nil
+}
+
+// writeOutput replies on the transport the current message came from.
+func (a *Agent) writeOutput(message string) error {
+	if a.current == nil {
+		return fmt.Errorf("no transport to reply on")
+	}
+
+	if a.taskStatus != awaitingInputStatus {
+		a.endStaging()
+	}
+	if a.unanswered {
+		a.taskStatus = ""
+		fmt.Println("Dropping the reply of a turn whose question went unanswered")
+		return nil
+	}
+	if transport, ok := a.current.(statusTransport); ok {
+		transport.SetStatus(a.taskStatus, a.pendingContinuation)
+	}
+	a.taskStatus = ""
+
+	return a.current.Write(message)
+}
+
+// writeError reports a failed turn on the current transport. status is the HTTP
+// status code describing it; transports without status codes get message as a reply.
+func (a *Agent) writeError(status int, message string) error {
+	transport, ok := a.current.(errorTransport)
+	if !ok || a.unanswered {
+		return a.writeOutput(message)
+	}
+
+	a.endStaging()
+	a.taskStatus = ""
+	return transport.WriteError(status, message)
+}
+
+// currentRequestID returns the ID of the message being handled, generating one
+// if its transport didn't supply it.
+func (a *Agent) currentRequestID() string {
+	if transport, ok := a.current.(requestIDTransport); ok {
+		if id := transport.RequestID(); id != "" {
+			return id
+		}
+	}
+
+	bytes := make([]byte, 8)
+	rand.Read(bytes)
+	return hex.EncodeToString(bytes)
+}
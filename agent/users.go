@@ -0,0 +1,397 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/tools"
+)
+
+var validUserID = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// User is a caller of a shared agent, identified by a bearer token, with their
+// own workspace root, sessions, budget and allowed tools.
+type User struct {
+	ID string `json:"id"`
+	// Hex SHA-256 of the user's bearer token, e.g. from `echo -n $TOKEN | sha256sum`.
+	TokenSHA256 string `json:"token_sha256"`
+	// Directory the user's file and Go toolchain tools operate in.
+	Root string `json:"root"`
+	// Limits per task, replacing TASK_MAX_COST_USD and TASK_MAX_DURATION when set.
+	MaxCost     float64 `json:"max_cost_usd,omitempty"`
+	MaxDuration string  `json:"max_duration,omitempty"`
+	// Spending allowed per UTC day; zero is unlimited.
+	DailyQuota float64 `json:"daily_quota_usd,omitempty"`
+	// Kinds of tools the user may call, see Role.
+	Role Role `json:"role"`
+	// Tools the user may call, further restricting their role; empty allows all.
+	Tools []string `json:"tools,omitempty"`
+
+	maxDuration time.Duration
+}
+
+// Role determines which categories of tools a user may call.
+type Role string
+
+const (
+	// RoleViewer may only call tools that read, e.g. read_file and search_documentation.
+	RoleViewer Role = "viewer"
+	// RoleDeveloper may also call tools that write, e.g. write_file.
+	RoleDeveloper Role = "developer"
+	// RoleAdmin may call any tool, including ones that run commands.
+	RoleAdmin Role = "admin"
+)
+
+var roleCategories = map[Role][]tools.ToolCategory{
+	RoleViewer:    {tools.CategoryRead},
+	RoleDeveloper: {tools.CategoryRead, tools.CategoryWrite},
+	RoleAdmin:     {tools.CategoryRead, tools.CategoryWrite, tools.CategoryExecute},
+}
+
+// permits reports whether the role may call tools of a category. Uncategorized
+// tools count as execute tools.
+func (r Role) permits(category tools.ToolCategory) bool {
+	if category == "" {
+		category = tools.CategoryExecute
+	}
+	for _, permitted := range roleCategories[r] {
+		if permitted == category {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether the user's role and tool list permit a tool. A nil user
+// is the agent's operator (e.g. on the CLI) and may call anything.
+func (u *User) allows(tool tools.ToolDefinition) bool {
+	if u == nil {
+		return true
+	}
+	if !u.Role.permits(tool.Category) {
+		return false
+	}
+	if len(u.Tools) == 0 {
+		return true
+	}
+	for _, allowed := range u.Tools {
+		if allowed == tool.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// denial explains to the model why the user may not call a tool.
+func (u *User) denial(tool tools.ToolDefinition) string {
+	if !u.Role.permits(tool.Category) {
+		return fmt.Sprintf("Permission denied: %s's role (%s) doesn't allow calling %s", u.ID, u.Role, tool.Name)
+	}
+	return fmt.Sprintf("Permission denied: %s may not call %s", u.ID, tool.Name)
+}
+
+// budget returns the user's task budget, falling back to the agent's for unset limits.
+func (u *User) budget(fallback Budget) Budget {
+	if u == nil {
+		return fallback
+	}
+	if u.MaxCost > 0 {
+		fallback.MaxCost = u.MaxCost
+	}
+	if u.maxDuration > 0 {
+		fallback.MaxDuration = u.maxDuration
+	}
+	return fallback
+}
+
+// Users authenticates the callers of an agent and tracks their daily spending.
+type Users struct {
+	byTokenHash map[string]*User
+
+	mu    sync.Mutex
+	day   string
+	spent map[string]float64
+}
+
+// LoadUsers reads a JSON array of users, e.g.
+// [{"id": "alice", "token_sha256": "...", "root": "/srv/agent/alice", "daily_quota_usd": 5}]
+func LoadUsers(path string) (*Users, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []*User
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("invalid users file %s: %v", path, err)
+	}
+
+	users := &Users{byTokenHash: map[string]*User{}, spent: map[string]float64{}}
+	ids := map[string]bool{}
+	for _, user := range list {
+		if !validUserID.MatchString(user.ID) {
+			return nil, fmt.Errorf("invalid user ID %q: use letters, digits, _ and -", user.ID)
+		}
+		if ids[user.ID] {
+			return nil, fmt.Errorf("duplicate user ID %q", user.ID)
+		}
+		ids[user.ID] = true
+
+		hash := strings.ToLower(user.TokenSHA256)
+		if decoded, err := hex.DecodeString(hash); err != nil || len(decoded) != sha256.Size {
+			return nil, fmt.Errorf("user %s: token_sha256 must be a hex SHA-256 hash", user.ID)
+		}
+		if _, ok := users.byTokenHash[hash]; ok {
+			return nil, fmt.Errorf("user %s: token shared with another user", user.ID)
+		}
+		if _, ok := roleCategories[user.Role]; !ok {
+			return nil, fmt.Errorf("user %s: role must be viewer, developer or admin, got %q", user.ID, user.Role)
+		}
+		if user.Root == "" {
+			return nil, fmt.Errorf("user %s: root is required", user.ID)
+		}
+		if info, err := os.Stat(user.Root); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("user %s: root %s is not a directory", user.ID, user.Root)
+		}
+		if user.MaxDuration != "" {
+			if user.maxDuration, err = time.ParseDuration(user.MaxDuration); err != nil {
+				return nil, fmt.Errorf("user %s: invalid max_duration: %v", user.ID, err)
+			}
+		}
+		users.byTokenHash[hash] = user
+	}
+	return users, nil
+}
+
+// Authenticate returns the user a bearer token belongs to.
+func (u *Users) Authenticate(token string) (*User, bool) {
+	if token == "" {
+		return nil, false
+	}
+	hash := sha256.Sum256([]byte(token))
+	user, ok := u.byTokenHash[hex.EncodeToString(hash[:])]
+	return user, ok
+}
+
+// charge records what a user's task cost.
+func (u *Users) charge(user *User, cost float64, now time.Time) {
+	if user == nil || cost == 0 {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.rollOver(now)
+	u.spent[user.ID] += cost
+}
+
+// overQuota reports whether a user has used up today's quota.
+func (u *Users) overQuota(user *User, now time.Time) bool {
+	if user == nil || user.DailyQuota <= 0 {
+		return false
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.rollOver(now)
+	return u.spent[user.ID] >= user.DailyQuota
+}
+
+// rollOver resets spending when a new UTC day starts. u.mu must be held.
+func (u *Users) rollOver(now time.Time) {
+	if day := now.UTC().Format(time.DateOnly); day != u.day {
+		u.day = day
+		u.spent = map[string]float64{}
+	}
+}
+
+// SetUsers turns the agent into a shared service: HTTP requests must carry a
+// bearer token of one of users, and each user gets their own workspace root,
+// sessions, budget and tools permitted by their role. Call before Start.
+func (a *Agent) SetUsers(users *Users) {
+	a.users = users
+}
+
+// authTransport is implemented by transports whose messages carry a bearer token,
+// e.g. HTTP's Authorization header.
+type authTransport interface {
+	AuthToken() string
+}
+
+// currentUser returns the user who sent the message being handled. Messages from
+// transports without authentication (the CLI, in-process) come from the operator,
+// represented as a nil user.
+func (a *Agent) currentUser() (*User, error) {
+	if a.users == nil {
+		return nil, nil
+	}
+	transport, ok := a.current.(authTransport)
+	if !ok {
+		return nil, nil
+	}
+	user, ok := a.users.Authenticate(transport.AuthToken())
+	if !ok {
+		return nil, fmt.Errorf("missing or invalid bearer token")
+	}
+	return user, nil
+}
+
+// requestUser authenticates a request to one of the agent's other endpoints.
+// It reports false, having answered the request, when authentication failed.
+func (a *Agent) requestUser(w http.ResponseWriter, r *http.Request) (*User, bool) {
+	if a.users == nil {
+		return nil, true
+	}
+	user, ok := a.users.Authenticate(bearerToken(r))
+	if !ok {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+		return nil, false
+	}
+	return user, true
+}
+
+func bearerToken(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// userSessionID scopes a session ID to its user, so users can't see each other's sessions.
+func userSessionID(user *User, id string) string {
+	if user == nil {
+		return id
+	}
+	return user.ID + "." + id
+}
+
+// activateUser points the workspace-bound tools, their runner and the budget at the user's,
+// restoring the operator's when user is nil.
+func (a *Agent) activateUser(user *User) {
+	if user == a.user {
+		return
+	}
+	if a.user == nil {
+		a.operator = operatorState{fs: a.fs, runner: a.runner, budget: a.budget}
+	}
+	a.user = user
+
+	if user == nil {
+		fmt.Printf("%s👤 Switching to the operator's workspace%s\n", BlueColor, ResetColor)
+		a.SetFS(a.operator.fs)
+		a.SetRunner(a.operator.runner)
+		a.budget = a.operator.budget
+		return
+	}
+
+	fmt.Printf("%s👤 Switching to %s's workspace %s%s\n", BlueColor, user.ID, user.Root, ResetColor)
+	a.SetFS(tools.OSFS{Root: user.Root})
+	a.SetRunner(tools.LocalRunner(user.Root))
+	a.budget = user.budget(a.operator.budget)
+}
+
+// operatorState is what activateUser restores when the operator is back.
+type operatorState struct {
+	fs tools.FS
+	// Runs the operator's commands, e.g. in its workspace's container.
+	runner tools.CommandRunner
+	budget Budget
+}
+
+// userToolParams describes the tools the user may call to the model.
+func (a *Agent) userToolParams(user *User) []anthropic.ToolUnionParam {
+	allowed := []anthropic.ToolUnionParam{}
+	for _, tool := range a.toolParams() {
+		if definition, ok := a.tools.Lookup(tool.OfTool.Name); ok && user.allows(definition) {
+			allowed = append(allowed, tool)
+		}
+	}
+	return allowed
+}
+
+// workspaceTool reports whether a tool operates on the active workspace, which
+// belongs to whoever's turn is being handled.
+func workspaceTool(name string) bool {
+	// The agent's own tools reading the workspace.
+	if name == "repository_overview" {
+		return true
+	}
+	for _, definition := range tools.NewFiles(nil, nil).Definitions() {
+		if definition.Name == name {
+			return true
+		}
+	}
+	for _, definition := range tools.NewGoTools(nil).Definitions() {
+		if definition.Name == name {
+			return true
+		}
+	}
+	for _, definition := range tools.NewProjectTools(nil, nil).Definitions() {
+		if definition.Name == name {
+			return true
+		}
+	}
+	for _, definition := range tools.NewShellTools(nil).Definitions() {
+		if definition.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sessionParam returns the session a request names, by X-Session-ID or ?session=.
+func sessionParam(r *http.Request) string {
+	id := r.Header.Get("X-Session-ID")
+	if id == "" {
+		id = r.URL.Query().Get("session")
+	}
+	if !validSessionID.MatchString(id) {
+		return defaultSessionID
+	}
+	return id
+}
+
+// handleSessions lists the caller's sessions, e.g. GET /coder/sessions
+func (a *Agent) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	user, ok := a.requestUser(w, r)
+	if !ok {
+		return
+	}
+
+	prefix := userSessionID(user, "")
+	sessions := []string{}
+	for _, id := range a.sessions.IDs(prefix) {
+		sessions = append(sessions, strings.TrimPrefix(id, prefix))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{"user": user.ID, "sessions": sessions})
+}
+
+type userKey struct{}
+
+func withUser(ctx context.Context, user *User) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// userFrom returns the user whose turn ctx belongs to, or nil for the operator.
+func userFrom(ctx context.Context) *User {
+	user, _ := ctx.Value(userKey{}).(*User)
+	return user
+}
@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// Most compiler output handed back to the model; the start is kept.
+const maxBuildErrors = 8_000
+
+const buildErrorsNote = `The build check after these tool calls failed: the changed Go packages, or packages importing them, no longer compile.
+
+%s
+
+Fix these errors before going on.`
+
+// VerifyBuilds makes the agent compile the packages affected by each round of
+// tool calls that changes Go files, handing any compile errors back to the
+// model with the tool results so it fixes them before answering.
+func (a *Agent) VerifyBuilds() {
+	a.verifyBuild = true
+}
+
+// checkBuild compiles the packages of the changed Go files, their tests and the
+// module's packages importing them, returning the compile errors if any. A
+// check that can't run, e.g. without Go installed, doesn't report anything.
+func (a *Agent) checkBuild(ctx context.Context, changes []tools.FileChange) string {
+	// Directories of the changed packages, relative to their module, by module.
+	changed := map[string]map[string]bool{}
+	for _, change := range changes {
+		if !strings.HasSuffix(change.Path, ".go") {
+			continue
+		}
+		module, ok := tools.ModuleDir(a.fs, change.Path)
+		if !ok {
+			continue
+		}
+		rel, err := filepath.Rel(module, path.Dir(change.Path))
+		if err != nil {
+			continue
+		}
+		if changed[module] == nil {
+			changed[module] = map[string]bool{}
+		}
+		changed[module][filepath.ToSlash(rel)] = true
+	}
+	modules := make([]string, 0, len(changed))
+	for module := range changed {
+		modules = append(modules, module)
+	}
+	slices.Sort(modules)
+
+	var problems []string
+	for _, module := range modules {
+		packages, err := a.affectedPackages(ctx, module, changed[module])
+		if err != nil {
+			fmt.Printf("Build check skipped in %s: %v\n", module, err)
+			continue
+		}
+		if len(packages) == 0 {
+			continue
+		}
+		fmt.Printf("%s🔨 Compiling %d packages affected by the changes...%s\n", BlueColor, len(packages), ResetColor)
+		// Running no tests still compiles them.
+		output, err := a.runIn(ctx, module, "go", append([]string{"test", "-run=^$"}, packages...)...).CombinedOutput()
+		if err == nil {
+			continue
+		}
+		var errors []string
+		for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+			if strings.HasPrefix(line, "ok ") || strings.HasPrefix(line, "?") || strings.HasPrefix(line, "FAIL") {
+				continue
+			}
+			errors = append(errors, line)
+		}
+		if len(errors) == 0 {
+			errors = append(errors, strings.TrimSpace(string(output)))
+		}
+		problems = append(problems, strings.Join(errors, "\n"))
+	}
+
+	result := strings.Join(problems, "\n")
+	if len(result) > maxBuildErrors {
+		result = result[:maxBuildErrors] + "\n[... errors truncated]"
+	}
+	return result
+}
+
+// affectedPackages lists the import paths of the module's packages in the
+// changed directories and of those importing them, from their code or tests.
+func (a *Agent) affectedPackages(ctx context.Context, module string, dirs map[string]bool) ([]string, error) {
+	format := `{{.ImportPath}}{{"\t"}}{{.Dir}}{{"\t"}}{{with .Module}}{{.Dir}}{{end}}{{"\t"}}{{join .Deps " "}} {{join .TestImports " "}} {{join .XTestImports " "}}`
+	output, err := a.runIn(ctx, module, "go", "list", "-e", "-f", format, "./...").Output()
+	if err != nil {
+		return nil, err
+	}
+
+	type pkg struct {
+		path    string
+		imports []string
+	}
+	var packages []pkg
+	changed := map[string]bool{}
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) != 4 {
+			continue
+		}
+		packages = append(packages, pkg{path: fields[0], imports: strings.Fields(fields[3])})
+		if rel, err := filepath.Rel(fields[2], fields[1]); err == nil && dirs[filepath.ToSlash(rel)] {
+			changed[fields[0]] = true
+		}
+	}
+
+	var affected []string
+	for _, p := range packages {
+		if changed[p.path] || slices.ContainsFunc(p.imports, func(imported string) bool { return changed[imported] }) {
+			affected = append(affected, p.path)
+		}
+	}
+	return affected, nil
+}
+
+// runIn runs a command with the agent's runner in dir, relative to where it
+// runs commands.
+func (a *Agent) runIn(ctx context.Context, dir string, name string, args ...string) *exec.Cmd {
+	if dir == "." {
+		return a.runner(ctx, name, args...)
+	}
+	return a.runner(ctx, "sh", append([]string{"-c", `cd "$0" && exec "$@"`, dir, name}, args...)...)
+}
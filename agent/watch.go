@@ -0,0 +1,523 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kartikx/agent/tools"
+)
+
+// How long the workspace must be quiet before changes are looked at, so a save
+// touching several files is handled once.
+const watchSettleDelay = 2 * time.Second
+
+// Longest a watch mode test run may take.
+const watchTestTimeout = 10 * time.Minute
+
+// Most test output sent to the model; the end is kept.
+const maxWatchTestOutput = 20_000
+
+// Largest file scanned for markers.
+const maxMarkerFileSize = 1 << 20
+
+// WatchConfig configures watch mode, see NewWatchMode.
+type WatchConfig struct {
+	// Shell command whose failure starts a session, e.g. "go test ./...".
+	TestCommand string
+	// Words starting a session when a line containing one is added, e.g. TODO.
+	Markers []string
+	// Directory proposals are written to.
+	ProposalDir string
+	// Where a TaskReport of each session is sent, besides the proposal directory.
+	Report ReportDelivery
+}
+
+// WatchConfigFromEnv reads WATCH_TEST_COMMAND, WATCH_MARKERS (comma-separated,
+// default TODO,FIXME; "none" disables), WATCH_PROPOSAL_DIR (default .agent/proposals),
+// WATCH_REPORT_WEBHOOK and WATCH_REPORT_EMAIL (comma-separated).
+func WatchConfigFromEnv() WatchConfig {
+	config := WatchConfig{
+		TestCommand: os.Getenv("WATCH_TEST_COMMAND"),
+		Markers:     []string{"TODO", "FIXME"},
+		ProposalDir: os.Getenv("WATCH_PROPOSAL_DIR"),
+	}
+	if value := os.Getenv("WATCH_MARKERS"); value == "none" {
+		config.Markers = nil
+	} else if value != "" {
+		config.Markers = nil
+		for _, marker := range strings.Split(value, ",") {
+			if marker = strings.TrimSpace(marker); marker != "" {
+				config.Markers = append(config.Markers, marker)
+			}
+		}
+	}
+	if config.ProposalDir == "" {
+		config.ProposalDir = filepath.Join(".agent", "proposals")
+	}
+	config.Report.Webhook = os.Getenv("WATCH_REPORT_WEBHOOK")
+	for _, address := range strings.Split(os.Getenv("WATCH_REPORT_EMAIL"), ",") {
+		if address = strings.TrimSpace(address); address != "" {
+			config.Report.Email = append(config.Report.Email, address)
+		}
+	}
+	return config
+}
+
+// WatchMode is a transport starting a session on its own when the tests start
+// failing or a new TODO marker appears in the watched directory. Its sessions
+// don't change any files: their edits are staged in memory and written to the
+// proposal directory as a patch, next to the model's explanation, for someone
+// to review and apply.
+type WatchMode struct {
+	root    string
+	config  WatchConfig
+	files   *FileWatcher
+	markers *regexp.Regexp
+
+	wake   chan struct{}
+	closed chan struct{}
+	once   sync.Once
+
+	mu sync.Mutex
+	// Marker lines of each file, to tell new ones from old ones.
+	known map[string]map[string]bool
+	// Whether the tests failed last time they ran.
+	failing bool
+	// Triggers waiting for a session; at most one test failure and one set of markers.
+	testFailure *watchTrigger
+	newMarkers  *watchTrigger
+	// The trigger whose session is running.
+	running  *watchTrigger
+	status   string
+	question bool
+}
+
+// watchTrigger is what starts a watch mode session.
+type watchTrigger struct {
+	kind    string // "tests" or "markers"
+	message string
+	// The session's tool calls, tests and cost; its changes are the staged edits.
+	report TaskReport
+}
+
+// NewWatchMode watches root, remembering the markers already there and running
+// the tests once, so only new markers and new failures start sessions.
+func NewWatchMode(root string, config WatchConfig) (*WatchMode, error) {
+	if config.TestCommand == "" && len(config.Markers) == 0 {
+		return nil, fmt.Errorf("set a test command or markers to watch for")
+	}
+	if err := config.Report.validate(); err != nil {
+		return nil, err
+	}
+	files, err := NewFileWatcher(root)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &WatchMode{
+		root:   files.root,
+		config: config,
+		files:  files,
+		wake:   make(chan struct{}, 1),
+		closed: make(chan struct{}),
+		known:  map[string]map[string]bool{},
+	}
+	if len(config.Markers) > 0 {
+		quoted := make([]string, len(config.Markers))
+		for i, marker := range config.Markers {
+			quoted[i] = regexp.QuoteMeta(marker)
+		}
+		w.markers = regexp.MustCompile(`\b(` + strings.Join(quoted, "|") + `)\b`)
+		w.scanExistingMarkers()
+	}
+
+	go w.loop()
+	return w, nil
+}
+
+// scanExistingMarkers records the markers in every file under root, skipping hidden directories.
+func (w *WatchMode) scanExistingMarkers() {
+	filepath.WalkDir(w.root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if path != w.root && strings.HasPrefix(entry.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		relative, _ := filepath.Rel(w.root, path)
+		w.known[relative] = w.markerLines(relative)
+		return nil
+	})
+}
+
+// markerLines returns the trimmed lines of a text file containing a marker.
+func (w *WatchMode) markerLines(relative string) map[string]bool {
+	lines := map[string]bool{}
+	path := filepath.Join(w.root, relative)
+	info, err := os.Stat(path)
+	if err != nil || info.Size() > maxMarkerFileSize {
+		return lines
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || bytes.IndexByte(data, 0) >= 0 {
+		return lines
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if w.markers.MatchString(line) {
+			lines[strings.TrimSpace(line)] = true
+		}
+	}
+	return lines
+}
+
+// loop looks at changes once the workspace has been quiet for watchSettleDelay.
+func (w *WatchMode) loop() {
+	if w.config.TestCommand != "" {
+		w.runTests(nil)
+	}
+
+	ticker := time.NewTicker(watchSettleDelay)
+	defer ticker.Stop()
+
+	var pending []string
+	for {
+		select {
+		case <-w.closed:
+			return
+		case <-ticker.C:
+		}
+
+		changed := w.relevant(w.files.Drain())
+		if len(changed) > 0 {
+			// Still changing; wait for it to settle.
+			pending = append(pending, changed...)
+			continue
+		}
+		if len(pending) == 0 {
+			continue
+		}
+		changed, pending = dedupe(pending), nil
+
+		if w.markers != nil {
+			w.checkMarkers(changed)
+		}
+		if w.config.TestCommand != "" {
+			w.runTests(changed)
+		}
+	}
+}
+
+// relevant drops changes to the proposal directory, so proposals don't trigger sessions.
+func (w *WatchMode) relevant(changed []string) []string {
+	proposals, err := filepath.Abs(w.config.ProposalDir)
+	if err != nil {
+		return changed
+	}
+	kept := changed[:0]
+	for _, path := range changed {
+		if absolute := filepath.Join(w.root, path); absolute != proposals && !strings.HasPrefix(absolute, proposals+string(filepath.Separator)) {
+			kept = append(kept, path)
+		}
+	}
+	return kept
+}
+
+func dedupe(paths []string) []string {
+	seen := map[string]bool{}
+	unique := []string{}
+	for _, path := range paths {
+		if !seen[path] {
+			seen[path] = true
+			unique = append(unique, path)
+		}
+	}
+	sort.Strings(unique)
+	return unique
+}
+
+// checkMarkers queues a session for markers that weren't in the changed files before.
+func (w *WatchMode) checkMarkers(changed []string) {
+	var found []string
+	w.mu.Lock()
+	for _, path := range changed {
+		lines := w.markerLines(path)
+		for line := range lines {
+			if !w.known[path][line] {
+				found = append(found, fmt.Sprintf("%s: %s", path, line))
+			}
+		}
+		w.known[path] = lines
+	}
+	w.mu.Unlock()
+	if len(found) == 0 {
+		return
+	}
+	sort.Strings(found)
+
+	message := fmt.Sprintf("These %s markers were just added:\n- %s\n\nDo what each asks, if it is clear enough to do safely. Leave the marker in place for anything you don't do, and say why.",
+		strings.Join(w.config.Markers, "/"), strings.Join(found, "\n- "))
+	w.queue(&watchTrigger{kind: "markers", message: message})
+}
+
+// runTests runs the test command, queueing a session if the tests started failing.
+func (w *WatchMode) runTests(changed []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), watchTestTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "sh", "-c", w.config.TestCommand)
+	cmd.Dir = w.root
+	cmd.WaitDelay = 5 * time.Second
+	output, err := cmd.CombinedOutput()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		fmt.Printf("👀 %s timed out after %s\n", w.config.TestCommand, watchTestTimeout)
+		return
+	}
+
+	w.mu.Lock()
+	wasFailing := w.failing
+	w.failing = err != nil
+	w.mu.Unlock()
+
+	if err == nil {
+		if wasFailing {
+			fmt.Printf("👀 %s passes again\n", w.config.TestCommand)
+		}
+		return
+	}
+	if wasFailing {
+		return
+	}
+
+	if len(output) > maxWatchTestOutput {
+		output = append([]byte("[... output truncated]\n"), output[len(output)-maxWatchTestOutput:]...)
+	}
+	cause := "when watch mode started"
+	if len(changed) > 0 {
+		cause = fmt.Sprintf("after changes to %s", strings.Join(changed, ", "))
+	}
+	message := fmt.Sprintf("`%s` started failing %s (%v). Find the cause and fix it.\n\nOutput:\n%s", w.config.TestCommand, cause, err, output)
+	w.queue(&watchTrigger{kind: "tests", message: message})
+}
+
+// queue replaces any waiting trigger of the same kind.
+func (w *WatchMode) queue(trigger *watchTrigger) {
+	fmt.Printf("👀 Starting a session: %s\n", strings.SplitN(trigger.message, "\n", 2)[0])
+
+	w.mu.Lock()
+	if trigger.kind == "tests" {
+		w.testFailure = trigger
+	} else {
+		w.newMarkers = trigger
+	}
+	w.mu.Unlock()
+	w.signal()
+}
+
+func (w *WatchMode) signal() {
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Read waits for a trigger, or answers the running session's question.
+func (w *WatchMode) Read() (string, error) {
+	for {
+		w.mu.Lock()
+		if w.question {
+			w.question = false
+			w.mu.Unlock()
+			return unattendedAnswer, nil
+		}
+		if w.running == nil {
+			trigger := w.testFailure
+			if trigger != nil {
+				w.testFailure = nil
+			} else if trigger = w.newMarkers; trigger != nil {
+				w.newMarkers = nil
+			}
+			if trigger != nil {
+				started := time.Now()
+				trigger.report = TaskReport{
+					Task:    "watch-" + trigger.kind,
+					Session: fmt.Sprintf("watch-%s-%s", trigger.kind, started.Format("20060102-150405")),
+					Started: started,
+				}
+				w.running, w.status = trigger, ""
+				w.mu.Unlock()
+				return fmt.Sprintf("%s\n\nThis session was started by watch mode and runs unattended: nobody can answer questions, so don't ask any. Your file edits are staged as a proposal for review rather than applied, so commands like tests still see the files as they were. Your reply is shown next to the proposal: explain what you changed and why.", trigger.message), nil
+			}
+		}
+		w.mu.Unlock()
+
+		select {
+		case <-w.wake:
+		case <-w.closed:
+			return "", io.EOF
+		}
+	}
+}
+
+// Staged receives the running session's staged edits, before its reply is written.
+func (w *WatchMode) Staged(changes []tools.FileChange) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running != nil {
+		w.running.report.Changes = changes
+	}
+}
+
+// Event records the running session's tool calls, tests and cost for its report.
+func (w *WatchMode) Event(event Event) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running != nil {
+		changes := w.running.report.Changes
+		w.running.report.record(event)
+		// The staged edits replace the ones seen along the way.
+		w.running.report.Changes = changes
+	}
+}
+
+// Write saves the running session's proposal, unless the reply is a question.
+func (w *WatchMode) Write(message string) error {
+	w.mu.Lock()
+	if w.status == awaitingInputStatus {
+		w.question = true
+		w.mu.Unlock()
+		w.signal()
+		return nil
+	}
+	return w.finish("ok", message)
+}
+
+// WriteError saves the failed session's error in place of an explanation.
+func (w *WatchMode) WriteError(status int, message string) error {
+	w.mu.Lock()
+	return w.finish("failed", fmt.Sprintf("The session failed with status %d: %s", status, message))
+}
+
+// finish ends the running session, which must be called with w.mu held.
+func (w *WatchMode) finish(status string, message string) error {
+	trigger := w.running
+	w.running = nil
+	w.mu.Unlock()
+	w.signal()
+
+	if trigger == nil {
+		return fmt.Errorf("no watch mode session is running")
+	}
+	path, err := w.writeProposal(trigger, message)
+	if err != nil {
+		fmt.Printf("Failed to write the proposal: %v\n", err)
+		return err
+	}
+	fmt.Printf("👀 Proposal written to %s\n", path)
+
+	if w.config.Report.configured() {
+		report := trigger.report
+		report.Finished, report.Status, report.Report = time.Now(), status, message
+		// Delivery may be slow; the agent shouldn't wait for it.
+		go w.config.Report.deliver(&report)
+	}
+	return nil
+}
+
+// writeProposal writes <time>-<kind>.md with the reply and, if the session
+// edited files, <time>-<kind>.patch, which git apply can apply.
+func (w *WatchMode) writeProposal(trigger *watchTrigger, message string) (string, error) {
+	if err := os.MkdirAll(w.config.ProposalDir, 0755); err != nil {
+		return "", err
+	}
+	name := filepath.Join(w.config.ProposalDir, fmt.Sprintf("%s-%s", trigger.report.Started.Format("20060102-150405"), trigger.kind))
+
+	var summary strings.Builder
+	fmt.Fprintf(&summary, "# Watch mode proposal (%s)\n\n", trigger.kind)
+	fmt.Fprintf(&summary, "## Trigger\n\n%s\n\n", strings.SplitN(trigger.message, "\n\nOutput:", 2)[0])
+	fmt.Fprintf(&summary, "## Explanation\n\n%s\n\n## Changes\n\n", message)
+	if len(trigger.report.Changes) == 0 {
+		summary.WriteString("None.\n")
+	}
+
+	var patch strings.Builder
+	for _, change := range trigger.report.Changes {
+		fmt.Fprintf(&summary, "- %s %s (+%d -%d)\n", change.Operation, change.Path, change.Added, change.Removed)
+		patch.WriteString(change.Diff)
+	}
+	if len(trigger.report.Changes) > 0 {
+		fmt.Fprintf(&summary, "\nApply with `git apply %s.patch`.\n", name)
+		if err := os.WriteFile(name+".patch", []byte(patch.String()), 0644); err != nil {
+			return "", err
+		}
+	}
+	if err := os.WriteFile(name+".md", []byte(summary.String()), 0644); err != nil {
+		return "", err
+	}
+	return name + ".md", nil
+}
+
+// SetStatus records the status of the reply about to be written, e.g. awaiting_input.
+func (w *WatchMode) SetStatus(status string, continuation string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.status = status
+}
+
+// Session gives each watch mode session its own, e.g. watch-tests-20250905-101500.
+func (w *WatchMode) Session() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.running == nil {
+		return ""
+	}
+	return w.running.report.Session
+}
+
+func (w *WatchMode) Close() error {
+	w.once.Do(func() { close(w.closed) })
+	return w.files.Close()
+}
+
+// stagingTransport is implemented by transports whose turns only propose changes,
+// like WatchMode: the file tools write to an overlay for the turn, and its
+// changes are handed to Staged before the reply is written.
+type stagingTransport interface {
+	Staged(changes []tools.FileChange)
+}
+
+// beginStaging keeps the turn's writes in an overlay if its transport only proposes changes.
+func (a *Agent) beginStaging() {
+	if _, ok := a.current.(stagingTransport); !ok || a.staged != nil {
+		return
+	}
+	a.staged = tools.NewOverlayFS(a.fs)
+	a.SetFS(a.staged)
+}
+
+// endStaging hands the turn's staged changes to its transport and points the
+// file tools back at the real files.
+func (a *Agent) endStaging() {
+	if a.staged == nil {
+		return
+	}
+	if transport, ok := a.current.(stagingTransport); ok {
+		transport.Staged(a.staged.Changes())
+	}
+	a.SetFS(a.staged.Base)
+	a.staged = nil
+}
@@ -0,0 +1,203 @@
+package agent
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/fsnotify/fsnotify"
+	"github.com/kartikx/agent/tools"
+)
+
+// FileWatcher records files changed under a directory by anyone other than the agent.
+type FileWatcher struct {
+	watcher *fsnotify.Watcher
+	root    string
+
+	mu      sync.Mutex
+	changed map[string]bool
+	// Hashes of content the agent itself wrote, so its own edits aren't reported.
+	written map[[sha256.Size]byte]bool
+}
+
+// NewFileWatcher watches root and all its subdirectories, except hidden ones like .git.
+func NewFileWatcher(root string) (*FileWatcher, error) {
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create file watcher: %v", err)
+	}
+
+	w := &FileWatcher{
+		watcher: watcher,
+		root:    root,
+		changed: map[string]bool{},
+		written: map[[sha256.Size]byte]bool{},
+	}
+
+	if err := w.addRecursive(root); err != nil {
+		watcher.Close()
+		return nil, err
+	}
+
+	go w.loop()
+	return w, nil
+}
+
+func (w *FileWatcher) addRecursive(dir string) error {
+	return filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || !entry.IsDir() {
+			return nil
+		}
+		if path != dir && strings.HasPrefix(entry.Name(), ".") {
+			return filepath.SkipDir
+		}
+		return w.watcher.Add(path)
+	})
+}
+
+func (w *FileWatcher) loop() {
+	for {
+		select {
+		case event, ok := <-w.watcher.Events:
+			if !ok {
+				return
+			}
+			w.handle(event)
+		case err, ok := <-w.watcher.Errors:
+			if !ok {
+				return
+			}
+			fmt.Printf("File watcher error: %v\n", err)
+		}
+	}
+}
+
+func (w *FileWatcher) handle(event fsnotify.Event) {
+	if event.Has(fsnotify.Chmod) && !event.Has(fsnotify.Write) {
+		return
+	}
+
+	info, err := os.Stat(event.Name)
+	if err == nil && info.IsDir() {
+		if event.Has(fsnotify.Create) {
+			w.addRecursive(event.Name)
+		}
+		return
+	}
+
+	if err == nil {
+		data, err := os.ReadFile(event.Name)
+		if err == nil {
+			w.mu.Lock()
+			own := w.written[sha256.Sum256(data)]
+			w.mu.Unlock()
+			if own {
+				return
+			}
+		}
+	}
+
+	relative, err := filepath.Rel(w.root, event.Name)
+	if err != nil {
+		relative = event.Name
+	}
+
+	w.mu.Lock()
+	w.changed[relative] = true
+	w.mu.Unlock()
+}
+
+// RecordWrite marks content as written by the agent.
+func (w *FileWatcher) RecordWrite(data []byte) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.written[sha256.Sum256(data)] = true
+}
+
+// Drain returns the files changed since the last call, sorted.
+func (w *FileWatcher) Drain() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	changed := make([]string, 0, len(w.changed))
+	for path := range w.changed {
+		changed = append(changed, path)
+	}
+	sort.Strings(changed)
+
+	w.changed = map[string]bool{}
+	return changed
+}
+
+func (w *FileWatcher) Close() error {
+	return w.watcher.Close()
+}
+
+// watchedFS tells the watcher about the agent's own writes.
+type watchedFS struct {
+	tools.FS
+	watcher *FileWatcher
+}
+
+func (w watchedFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	w.watcher.RecordWrite(data)
+	return w.FS.WriteFile(name, data, perm)
+}
+
+func (w watchedFS) Remove(name string) error {
+	return tools.Remove(w.FS, name)
+}
+
+// WatchFiles reports files changed under root outside the agent's own edits
+// to the model before its next inference.
+func (a *Agent) WatchFiles(root string) error {
+	watcher, err := NewFileWatcher(root)
+	if err != nil {
+		return err
+	}
+
+	if a.watcher != nil {
+		a.watcher.Close()
+	}
+	a.watcher = watcher
+
+	// Re-wrap the current filesystem so writes are recorded.
+	a.SetFS(a.fs)
+	return nil
+}
+
+// externalChangesNote describes files changed outside the agent since the last inference.
+func (a *Agent) externalChangesNote() string {
+	if a.watcher == nil {
+		return ""
+	}
+
+	// Files excluded by .agentignore aren't worth mentioning, as they can't be read.
+	ignoring := tools.NewIgnoreFS(a.fs)
+	changed := slices.DeleteFunc(a.watcher.Drain(), func(path string) bool { return ignoring.Excluded(path, false) })
+	if len(changed) == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("Note: these files changed outside your edits since your last step; re-read them before modifying them:\n- %s", strings.Join(changed, "\n- "))
+}
+
+// withUserNote appends a text block to the last message, which must be a user message.
+func withUserNote(messages []anthropic.MessageParam, note string) []anthropic.MessageParam {
+	last := messages[len(messages)-1]
+	last.Content = append(append([]anthropic.ContentBlockParamUnion{}, last.Content...), anthropic.NewTextBlock(note))
+	return append(messages[:len(messages)-1:len(messages)-1], last)
+}
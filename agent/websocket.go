@@ -0,0 +1,102 @@
+package agent
+
+import (
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/net/websocket"
+)
+
+// WebSocketTransport accepts messages over any number of WebSocket connections
+// and replies on the connection the message came from.
+type WebSocketTransport struct {
+	incoming  chan webSocketMessage
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	// Connections of the messages read but not answered yet, oldest first.
+	mu      sync.Mutex
+	pending []*websocket.Conn
+	conns   map[*websocket.Conn]bool
+}
+
+type webSocketMessage struct {
+	conn    *websocket.Conn
+	message string
+}
+
+func NewWebSocketTransport() *WebSocketTransport {
+	return &WebSocketTransport{
+		incoming: make(chan webSocketMessage),
+		closed:   make(chan struct{}),
+		conns:    map[*websocket.Conn]bool{},
+	}
+}
+
+// Handler returns the HTTP handler that upgrades connections.
+func (t *WebSocketTransport) Handler() websocket.Handler {
+	return websocket.Handler(t.serve)
+}
+
+func (t *WebSocketTransport) serve(conn *websocket.Conn) {
+	t.mu.Lock()
+	t.conns[conn] = true
+	t.mu.Unlock()
+
+	defer func() {
+		t.mu.Lock()
+		delete(t.conns, conn)
+		t.mu.Unlock()
+		conn.Close()
+	}()
+
+	for {
+		var message string
+		if err := websocket.Message.Receive(conn, &message); err != nil {
+			return
+		}
+
+		select {
+		case t.incoming <- webSocketMessage{conn: conn, message: message}:
+		case <-t.closed:
+			return
+		}
+	}
+}
+
+func (t *WebSocketTransport) Read() (string, error) {
+	select {
+	case incoming := <-t.incoming:
+		t.mu.Lock()
+		t.pending = append(t.pending, incoming.conn)
+		t.mu.Unlock()
+		return incoming.message, nil
+	case <-t.closed:
+		return "", io.EOF
+	}
+}
+
+func (t *WebSocketTransport) Write(message string) error {
+	t.mu.Lock()
+	if len(t.pending) == 0 {
+		t.mu.Unlock()
+		return fmt.Errorf("no WebSocket connection to reply on")
+	}
+	conn := t.pending[0]
+	t.pending = t.pending[1:]
+	t.mu.Unlock()
+
+	return websocket.Message.Send(conn, message)
+}
+
+func (t *WebSocketTransport) Close() error {
+	t.closeOnce.Do(func() { close(t.closed) })
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for conn := range t.conns {
+		conn.Close()
+	}
+	return nil
+}
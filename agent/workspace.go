@@ -0,0 +1,159 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kartikx/agent/tools"
+	"github.com/kartikx/agent/workspace"
+)
+
+// Longest a clone_repository call may take.
+const cloneTimeout = 5 * time.Minute
+
+// UseWorkspaces lets the agent provision disposable workspaces through manager,
+// and gives the model the clone_repository tool.
+func (a *Agent) UseWorkspaces(manager *workspace.Manager) {
+	a.workspaces = manager
+	a.tools.Register(a.cloneRepositoryDefinition())
+}
+
+// ActivateWorkspace points all file tools at the workspace's directory, and runs
+// the Go toolchain tools inside it.
+func (a *Agent) ActivateWorkspace(ws *workspace.Workspace) {
+	a.workspaceMu.Lock()
+	a.workspace = ws
+	a.workspaceMu.Unlock()
+
+	a.SetFS(tools.OSFS{Root: ws.Dir})
+	a.SetRunner(ws.Command)
+
+	if a.watcher != nil {
+		if err := a.WatchFiles(ws.Dir); err != nil {
+			fmt.Printf("Failed to watch workspace %s: %v\n", ws.ID, err)
+		}
+	}
+}
+
+// Workspace returns the active workspace, if any.
+func (a *Agent) Workspace() *workspace.Workspace {
+	a.workspaceMu.Lock()
+	defer a.workspaceMu.Unlock()
+
+	return a.workspace
+}
+
+// destroyWorkspace tears down the active workspace and points file tools back at the OS.
+func (a *Agent) destroyWorkspace() error {
+	a.workspaceMu.Lock()
+	ws := a.workspace
+	a.workspace = nil
+	a.workspaceMu.Unlock()
+
+	if ws == nil {
+		return fmt.Errorf("no active workspace")
+	}
+
+	a.SetFS(tools.OSFS{})
+	a.SetRunner(tools.LocalRunner(""))
+	return a.workspaces.Destroy(ws.ID)
+}
+
+type createWorkspaceRequest struct {
+	Repository string `json:"repository"`
+	Ref        string `json:"ref"`
+	Depth      int    `json:"depth"`
+}
+
+// handleWorkspace creates (POST) or tears down (DELETE) the agent's workspace.
+func (a *Agent) handleWorkspace(w http.ResponseWriter, r *http.Request) {
+	// Users each have a fixed workspace root, see SetUsers.
+	if a.users != nil {
+		http.Error(w, "workspaces are not available to users of a shared agent", http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case "POST":
+		request := createWorkspaceRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		if previous := a.Workspace(); previous != nil {
+			a.destroyWorkspace()
+		}
+
+		ws, err := a.workspaces.Create(r.Context(), request.Repository, request.Ref, request.Depth)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		a.ActivateWorkspace(ws)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(ws)
+	case "DELETE":
+		if err := a.destroyWorkspace(); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// CloneRepository tool for starting a task from a repository URL
+type CloneRepositoryInput struct {
+	URL   string `json:"url" jsonschema:"minLength=1" jsonschema_description:"The URL of the git repository, e.g. https://github.com/owner/repo."`
+	Ref   string `json:"ref,omitempty" jsonschema_description:"The branch, tag or commit to check out. Defaults to the default branch."`
+	Depth int    `json:"depth,omitempty" jsonschema:"minimum=0,default=1" jsonschema_description:"How many commits of history to fetch; 0 fetches everything. Defaults to 1."`
+}
+
+var CloneRepositoryInputSchema = tools.GenerateSchema[CloneRepositoryInput]()
+
+// cloneRepositoryDefinition is bound to the agent, since it switches the agent's file tools.
+func (a *Agent) cloneRepositoryDefinition() tools.ToolDefinition {
+	return tools.ToolDefinition{
+		Name:        "clone_repository",
+		Description: "Clone a git repository into a new workspace and make it the root for all file tools. Use this when the task starts from a repository URL. Any previous workspace is discarded.",
+		InputSchema: CloneRepositoryInputSchema,
+		Function:    a.CloneRepository,
+		Examples: []tools.ToolExample{
+			{Input: `{"url": "https://github.com/spf13/cobra", "ref": "v1.8.0"}`, Output: "Cloned https://github.com/spf13/cobra at v1.8.0 into workspace 3f9a1c2b7d4e. File paths are now relative to the repository root."},
+		},
+	}
+}
+
+func (a *Agent) CloneRepository(ctx context.Context, input json.RawMessage) (string, error) {
+	cloneRepositoryInput := CloneRepositoryInput{Depth: 1}
+
+	err := json.Unmarshal(input, &cloneRepositoryInput)
+	if err != nil {
+		return "", err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, cloneTimeout)
+	defer cancel()
+
+	ws, err := a.workspaces.Create(ctx, cloneRepositoryInput.URL, cloneRepositoryInput.Ref, cloneRepositoryInput.Depth)
+	if err != nil {
+		return "", err
+	}
+
+	if previous := a.Workspace(); previous != nil {
+		a.destroyWorkspace()
+	}
+	a.ActivateWorkspace(ws)
+
+	ref := cloneRepositoryInput.Ref
+	if ref == "" {
+		ref = "the default branch"
+	}
+	return fmt.Sprintf("Cloned %s at %s into workspace %s. File paths are now relative to the repository root.", cloneRepositoryInput.URL, ref, ws.ID), nil
+}
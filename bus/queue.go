@@ -0,0 +1,342 @@
+package bus
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Longest a blocking read waits on the server before checking whether to stop.
+const maxBlock = 5 * time.Second
+
+// How long a reply is kept for a caller that hasn't picked it up.
+const replyTTL = 5 * time.Minute
+
+// Entries kept per stream; older ones, long since answered, are trimmed.
+const maxStreamLength = 10_000
+
+// Stream is the stream requests to the agent called name are queued on.
+func Stream(name string) string {
+	return "agents:" + name
+}
+
+// Request is a message taken from a stream by a Consumer.
+type Request struct {
+	// ID of the stream entry.
+	ID        string
+	Body      string
+	RequestID string
+	// The caller stops waiting for a reply after Deadline.
+	Deadline time.Time
+
+	replyTo string
+}
+
+// reply is what a consumer sends back for a request.
+type reply struct {
+	Reply string `json:"reply,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Send adds a request to stream and waits until ctx is done for an agent to
+// answer it. The request waits in the stream while no agent is serving it.
+func Send(ctx context.Context, url, stream, body, requestID string) (string, error) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return "", fmt.Errorf("sending on the bus needs a deadline")
+	}
+
+	c, err := dial(ctx, url)
+	if err != nil {
+		return "", err
+	}
+	defer c.close()
+
+	token := make([]byte, 16)
+	rand.Read(token)
+	replyTo := fmt.Sprintf("%s:reply:%s", stream, hex.EncodeToString(token))
+
+	_, err = c.do(ctx, "XADD", stream, "MAXLEN", "~", strconv.Itoa(maxStreamLength), "*",
+		"body", body, "reply_to", replyTo, "request_id", requestID, "deadline", strconv.FormatInt(deadline.UnixMilli(), 10))
+	if err != nil {
+		return "", fmt.Errorf("failed to queue request: %v", err)
+	}
+
+	for {
+		block := blockFor(ctx, maxBlock)
+		if block <= 0 {
+			return "", context.DeadlineExceeded
+		}
+		popped, err := c.do(ctx, "BLPOP", replyTo, strconv.FormatFloat(block.Seconds(), 'f', 3, 64))
+		if err != nil {
+			if ctx.Err() != nil {
+				return "", ctx.Err()
+			}
+			return "", err
+		}
+		items, ok := popped.([]any)
+		if !ok || len(items) != 2 {
+			continue
+		}
+		data, _ := items[1].(string)
+
+		var answer reply
+		if err := json.Unmarshal([]byte(data), &answer); err != nil {
+			return "", fmt.Errorf("invalid reply on the bus: %v", err)
+		}
+		if answer.Error != "" {
+			return "", errors.New(answer.Error)
+		}
+		return answer.Reply, nil
+	}
+}
+
+// Consumer takes requests from a stream as a member of a consumer group; the
+// members of a group share the stream's requests between them.
+type Consumer struct {
+	// Requests taken by a consumer that didn't answer them for this long, e.g.
+	// because it crashed, are taken over by another member of the group. The
+	// consumer keeps claiming the requests it's working on while it's running.
+	ClaimAfter time.Duration
+
+	url, stream, group, name string
+	// Next uses reader and Reply uses writer, so replies aren't held up by a
+	// blocking read.
+	reader *conn
+	mu     sync.Mutex
+	writer *conn
+	// Deadlines of the requests taken but not answered yet, by ID.
+	inFlight map[string]time.Time
+	closed   chan struct{}
+}
+
+// NewConsumer joins group on stream as name, creating both if needed.
+func NewConsumer(ctx context.Context, url, stream, group, name string) (*Consumer, error) {
+	reader, err := dial(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	writer, err := dial(ctx, url)
+	if err != nil {
+		reader.close()
+		return nil, err
+	}
+
+	// Starting at 0 rather than $ serves requests queued before the group existed.
+	_, err = writer.do(ctx, "XGROUP", "CREATE", stream, group, "0", "MKSTREAM")
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		reader.close()
+		writer.close()
+		return nil, fmt.Errorf("failed to create consumer group: %v", err)
+	}
+
+	c := &Consumer{ClaimAfter: time.Minute, url: url, stream: stream, group: group, name: name, reader: reader, writer: writer,
+		inFlight: map[string]time.Time{}, closed: make(chan struct{})}
+	go c.keepClaimed()
+	return c, nil
+}
+
+// keepClaimed claims the requests in flight again well within ClaimAfter, so
+// other members don't take over requests whose turn is still running.
+func (c *Consumer) keepClaimed() {
+	for {
+		select {
+		case <-time.After(c.ClaimAfter / 3):
+		case <-c.closed:
+			return
+		}
+
+		c.mu.Lock()
+		args := []string{"XCLAIM", c.stream, c.group, c.name, "0"}
+		for id, deadline := range c.inFlight {
+			// Once nobody waits for the reply, Next acknowledges the request
+			// when it's claimed.
+			if time.Now().After(deadline) {
+				delete(c.inFlight, id)
+				continue
+			}
+			args = append(args, id)
+		}
+		if len(c.inFlight) > 0 {
+			ctx, cancel := context.WithTimeout(context.Background(), maxBlock)
+			if _, err := c.writer.do(ctx, append(args, "JUSTID")...); err != nil {
+				fmt.Printf("Failed to keep bus requests claimed: %v\n", err)
+			}
+			cancel()
+		}
+		c.mu.Unlock()
+	}
+}
+
+// Next waits for the next request whose caller is still waiting, preferring
+// requests abandoned by other members of the group.
+func (c *Consumer) Next(ctx context.Context) (Request, error) {
+	for {
+		if ctx.Err() != nil {
+			return Request{}, ctx.Err()
+		}
+
+		entries, err := c.claim(ctx)
+		if err == nil && len(entries) == 0 {
+			entries, err = c.read(ctx)
+		}
+		if ctx.Err() != nil {
+			return Request{}, ctx.Err()
+		}
+		if err != nil {
+			// Redis may have restarted; if it can't be reached, the next call fails again.
+			if reader, dialErr := dial(ctx, c.url); dialErr == nil {
+				c.reader.close()
+				c.reader = reader
+			}
+			return Request{}, err
+		}
+
+		for _, entry := range entries {
+			request, err := parseEntry(entry)
+			c.mu.Lock()
+			_, taken := c.inFlight[request.ID]
+			c.mu.Unlock()
+			if taken {
+				// Claimed back from ourselves, e.g. while Redis was unreachable;
+				// the turn answering it is still running.
+				continue
+			}
+			if err != nil || time.Now().After(request.Deadline) {
+				// Nobody is waiting for an answer.
+				c.reader.do(ctx, "XACK", c.stream, c.group, request.ID)
+				continue
+			}
+
+			c.mu.Lock()
+			c.inFlight[request.ID] = request.Deadline
+			c.mu.Unlock()
+			return request, nil
+		}
+	}
+}
+
+// claim takes over one request left unanswered for longer than ClaimAfter.
+func (c *Consumer) claim(ctx context.Context) ([]any, error) {
+	claimed, err := c.reader.do(ctx, "XAUTOCLAIM", c.stream, c.group, c.name, strconv.FormatInt(c.ClaimAfter.Milliseconds(), 10), "0-0", "COUNT", "1")
+	if err != nil {
+		return nil, err
+	}
+	items, ok := claimed.([]any)
+	if !ok || len(items) < 2 {
+		return nil, nil
+	}
+	entries, _ := items[1].([]any)
+	return entries, nil
+}
+
+// read waits briefly for a new request.
+func (c *Consumer) read(ctx context.Context) ([]any, error) {
+	block := blockFor(ctx, maxBlock)
+	if block <= 0 {
+		return nil, context.DeadlineExceeded
+	}
+	read, err := c.reader.do(ctx, "XREADGROUP", "GROUP", c.group, c.name, "COUNT", "1",
+		"BLOCK", strconv.FormatInt(block.Milliseconds(), 10), "STREAMS", c.stream, ">")
+	if err != nil {
+		return nil, err
+	}
+	streams, ok := read.([]any)
+	if !ok || len(streams) == 0 {
+		return nil, nil
+	}
+	stream, _ := streams[0].([]any)
+	if len(stream) < 2 {
+		return nil, nil
+	}
+	entries, _ := stream[1].([]any)
+	return entries, nil
+}
+
+// parseEntry reads a stream entry: [id, [field, value, ...]].
+func parseEntry(entry any) (Request, error) {
+	parts, _ := entry.([]any)
+	if len(parts) < 2 {
+		return Request{}, fmt.Errorf("invalid stream entry")
+	}
+	request := Request{}
+	request.ID, _ = parts[0].(string)
+
+	fields, _ := parts[1].([]any)
+	for i := 0; i+1 < len(fields); i += 2 {
+		value, _ := fields[i+1].(string)
+		switch fields[i] {
+		case "body":
+			request.Body = value
+		case "reply_to":
+			request.replyTo = value
+		case "request_id":
+			request.RequestID = value
+		case "deadline":
+			millis, _ := strconv.ParseInt(value, 10, 64)
+			request.Deadline = time.UnixMilli(millis)
+		}
+	}
+	if request.replyTo == "" {
+		return request, fmt.Errorf("stream entry %s has no reply_to", request.ID)
+	}
+	return request, nil
+}
+
+// Reply answers a request and removes it from the group's pending requests.
+// A non-empty errMessage is returned to the caller as an error.
+func (c *Consumer) Reply(ctx context.Context, request Request, answer string, errMessage string) error {
+	data, err := json.Marshal(reply{Reply: answer, Error: errMessage})
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	err = c.reply(ctx, request, string(data))
+	if err != nil {
+		// Try once more on a new connection, in case Redis restarted.
+		if writer, dialErr := dial(ctx, c.url); dialErr == nil {
+			c.writer.close()
+			c.writer = writer
+			err = c.reply(ctx, request, string(data))
+		}
+	}
+	return err
+}
+
+func (c *Consumer) reply(ctx context.Context, request Request, data string) error {
+	if _, err := c.writer.do(ctx, "LPUSH", request.replyTo, data); err != nil {
+		return err
+	}
+	if _, err := c.writer.do(ctx, "EXPIRE", request.replyTo, strconv.Itoa(int(replyTTL.Seconds()))); err != nil {
+		return err
+	}
+	if _, err := c.writer.do(ctx, "XACK", c.stream, c.group, request.ID); err != nil {
+		return err
+	}
+	delete(c.inFlight, request.ID)
+	return nil
+}
+
+// Close leaves the stream; requests taken but not answered are claimed by
+// another member after ClaimAfter.
+func (c *Consumer) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+	}
+	return errors.Join(c.reader.close(), c.writer.close())
+}
@@ -0,0 +1,154 @@
+// Package bus carries requests between agents over Redis streams. Requests
+// wait in a stream until an agent takes them, so they survive the serving
+// agent restarting, and replicas of an agent share a stream as a work queue.
+package bus
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisError is an error reply from Redis, e.g. "BUSYGROUP Consumer Group name already exists".
+type RedisError string
+
+func (e RedisError) Error() string {
+	return string(e)
+}
+
+// conn is a connection to Redis speaking RESP. Replies are strings, int64s,
+// []any, nil, or RedisError.
+type conn struct {
+	mu      sync.Mutex
+	netConn net.Conn
+	reader  *bufio.Reader
+}
+
+// dial connects to a redis://[:password@]host[:port][/db] URL.
+func dial(ctx context.Context, rawURL string) (*conn, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Scheme != "redis" {
+		return nil, fmt.Errorf("invalid bus URL %q, expected redis://host:port", rawURL)
+	}
+	address := parsed.Host
+	if parsed.Port() == "" {
+		address = net.JoinHostPort(parsed.Hostname(), "6379")
+	}
+
+	var dialer net.Dialer
+	netConn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	c := &conn{netConn: netConn, reader: bufio.NewReader(netConn)}
+
+	if password, ok := parsed.User.Password(); ok {
+		if _, err := c.do(ctx, "AUTH", password); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	if db := strings.TrimPrefix(parsed.Path, "/"); db != "" {
+		if _, err := c.do(ctx, "SELECT", db); err != nil {
+			c.close()
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// do sends a command and returns its reply. A RedisError reply is returned as the error.
+func (c *conn) do(ctx context.Context, args ...string) (any, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	deadline, _ := ctx.Deadline()
+	c.netConn.SetDeadline(deadline)
+
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(c.netConn, command.String()); err != nil {
+		return nil, err
+	}
+
+	reply, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if redisErr, ok := reply.(RedisError); ok {
+		return nil, redisErr
+	}
+	return reply, nil
+}
+
+func (c *conn) read() (any, error) {
+	line, err := c.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty reply from Redis")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return RedisError(line[1:]), nil
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		length, err := strconv.Atoi(line[1:])
+		if err != nil || length < 0 {
+			return nil, err
+		}
+		data := make([]byte, length+2)
+		if _, err := io.ReadFull(c.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:length]), nil
+	case '*':
+		count, err := strconv.Atoi(line[1:])
+		if err != nil || count < 0 {
+			return nil, err
+		}
+		items := make([]any, count)
+		for i := range items {
+			if items[i], err = c.read(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	default:
+		return nil, fmt.Errorf("unexpected reply from Redis: %q", line)
+	}
+}
+
+func (c *conn) close() error {
+	return c.netConn.Close()
+}
+
+// blockFor is how long a blocking command may wait on the server: at most max,
+// and a little less than what is left of ctx, so that the server answers before
+// the connection's deadline. It is 0 once there is no time left.
+func blockFor(ctx context.Context, max time.Duration) time.Duration {
+	const margin = 100 * time.Millisecond
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if remaining := time.Until(deadline) - margin; remaining < max {
+			return remaining.Truncate(time.Millisecond)
+		}
+	}
+	return max
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/agent"
+	"github.com/kartikx/agent/providers"
+	"github.com/kartikx/agent/tools"
+)
+
+// Follow-ups asking the agent about comments its report left out.
+const maxAddressFollowUps = 3
+
+// Statuses of addressed comments; the agent reports the first three.
+var resolutionStatuses = []string{"resolved", "declined", "needs_discussion", "unaddressed"}
+
+// reviewComment is one reviewer comment on the diff, with the replies in its thread.
+type reviewComment struct {
+	ID      string   `json:"id"`
+	Path    string   `json:"path,omitempty"`
+	Line    int      `json:"line,omitempty"`
+	Author  string   `json:"author,omitempty"`
+	Body    string   `json:"body"`
+	Hunk    string   `json:"diff_hunk,omitempty"`
+	Replies []string `json:"replies,omitempty"`
+}
+
+// resolution is what the agent did about a comment.
+type resolution struct {
+	ID     string `json:"id"`
+	Path   string `json:"path,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Status string `json:"status"`
+	Reply  string `json:"reply"`
+}
+
+// runAddress implements "agent address": it has the agent address each
+// reviewer comment on a diff, editing the working tree, and prints what it did
+// about each comment by ID, e.g. to post the replies back to the pull request.
+// It exits with 1 if a comment is left unaddressed or needs discussion.
+func runAddress(args []string) int {
+	flags := flag.NewFlagSet("address", flag.ExitOnError)
+	commentsFile := flags.String("comments", "", `JSON file of review comments, e.g. from "gh api repos/OWNER/REPO/pulls/N/comments" ("-" reads stdin)`)
+	diffFile := flags.String("diff", "", "file holding the diff the comments are on")
+	base := flags.String("base", "", "use the changes since this ref, e.g. origin/main, as the diff instead of -diff")
+	format := flags.String("format", "text", "text or json")
+	timeout := flags.Duration("timeout", 30*time.Minute, "timeout for addressing all comments")
+	flags.Parse(args)
+
+	if *commentsFile == "" {
+		fmt.Fprintln(os.Stderr, "Set -comments to the file of review comments.")
+		return 2
+	}
+	if *format != "text" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown -format %s. Valid values are 'text' or 'json'.\n", *format)
+		return 2
+	}
+	keys, err := providers.KeySourceFromEnv("address")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: no API key: %v\n", err)
+		return 2
+	}
+
+	var data []byte
+	if *commentsFile == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(*commentsFile)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the comments: %v\n", err)
+		return 2
+	}
+	comments, err := parseReviewComments(data)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid comments: %v\n", err)
+		return 2
+	}
+	if len(comments) == 0 {
+		fmt.Fprintln(os.Stderr, "No comments to address.")
+		return 0
+	}
+
+	var diff []byte
+	switch {
+	case *base != "":
+		diff, err = exec.Command("git", "diff", *base+"...HEAD").Output()
+	case *diffFile != "":
+		diff, err = os.ReadFile(*diffFile)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the diff: %v\n", err)
+		return 2
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	// The agent logs to stdout, which is for the report.
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	client := anthropic.NewClient()
+	resolutions, err := address(ctx, providers.NewAnthropicWithKeys(&client, keys), string(diff), comments)
+	os.Stdout = stdout
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Addressing the comments failed: %v\n", err)
+		return 2
+	}
+
+	printResolutions(resolutions, *format)
+
+	for _, r := range resolutions {
+		if r.Status == "unaddressed" || r.Status == "needs_discussion" {
+			return 1
+		}
+	}
+	return 0
+}
+
+// parseReviewComments reads comments in GitHub's format for pull request review
+// comments, or as reviewComment objects. Replies are folded into the comment
+// they answer.
+func parseReviewComments(data []byte) ([]reviewComment, error) {
+	var raw []struct {
+		ID           json.RawMessage `json:"id"`
+		Path         string          `json:"path"`
+		Line         *int            `json:"line"`
+		OriginalLine *int            `json:"original_line"`
+		Body         string          `json:"body"`
+		Hunk         string          `json:"diff_hunk"`
+		InReplyTo    json.RawMessage `json:"in_reply_to_id"`
+		Author       string          `json:"author"`
+		User         struct {
+			Login string `json:"login"`
+		} `json:"user"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+
+	comments := []reviewComment{}
+	byID := map[string]int{}
+	for _, r := range raw {
+		id := strings.Trim(string(r.ID), `"`)
+		if id == "" || id == "null" {
+			return nil, fmt.Errorf("a comment has no id")
+		}
+		author := r.Author
+		if author == "" {
+			author = r.User.Login
+		}
+		if parent := strings.Trim(string(r.InReplyTo), `"`); parent != "" && parent != "null" {
+			if i, ok := byID[parent]; ok {
+				reply := r.Body
+				if author != "" {
+					reply = author + ": " + reply
+				}
+				comments[i].Replies = append(comments[i].Replies, reply)
+				continue
+			}
+		}
+		if _, ok := byID[id]; ok {
+			return nil, fmt.Errorf("comment %s appears twice", id)
+		}
+
+		comment := reviewComment{ID: id, Path: r.Path, Author: author, Body: r.Body, Hunk: r.Hunk}
+		// Comments on lines the diff no longer has only have their original line.
+		if r.Line != nil {
+			comment.Line = *r.Line
+		} else if r.OriginalLine != nil {
+			comment.Line = *r.OriginalLine
+		}
+		byID[id] = len(comments)
+		comments = append(comments, comment)
+	}
+	return comments, nil
+}
+
+// address has a coder agent address each comment and report what it did about
+// it, asking again about comments its report leaves out.
+func address(ctx context.Context, provider providers.Provider, diff string, comments []reviewComment) ([]resolution, error) {
+	coder := agent.NewEmbeddedAgent(provider, tools.CoderTools, "address")
+	go coder.Run(ctx)
+
+	var prompt strings.Builder
+	prompt.WriteString("A reviewer left comments on a change in this repository. Address each comment by editing the code in the working tree: make the requested change, or, if you disagree or the comment doesn't apply, leave the code as it is and explain why. Read the surrounding code first, keep each fix to what the comment asks, and run the tests when you're done. This runs unattended: nobody can answer questions, so use your best judgement.\n\n")
+	if strings.TrimSpace(diff) != "" {
+		fmt.Fprintf(&prompt, "The change:\n\n```diff\n%s\n```\n\n", truncate(diff, maxReviewDiff))
+	}
+	prompt.WriteString("The comments:\n\n")
+	for _, c := range comments {
+		writeReviewComment(&prompt, c)
+	}
+	prompt.WriteString(`When you're done, reply with a report as a JSON array in a ` + "```json" + ` block, and nothing else after it, with one entry per comment: "id" (the comment's id), "status" ("resolved" if you changed the code as asked, "declined" if you deliberately didn't, "needs_discussion" if you can't tell what the reviewer wants) and "reply" (a short reply to post on the comment, saying what you changed or why not).`)
+
+	byID := map[string]resolution{}
+	message := prompt.String()
+	for round := 0; ; round++ {
+		answer, err := coder.SendMessage(ctx, message)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range parseResolutions(answer) {
+			if slices.Index(resolutionStatuses[:3], r.Status) < 0 {
+				r.Status = "needs_discussion"
+			}
+			byID[r.ID] = r
+		}
+
+		var missing []string
+		for _, c := range comments {
+			if _, ok := byID[c.ID]; !ok {
+				missing = append(missing, c.ID)
+			}
+		}
+		if len(missing) == 0 || round == maxAddressFollowUps {
+			break
+		}
+		message = fmt.Sprintf("Your report doesn't cover comments %s. Nobody can answer questions: address them as best you can, then reply with the JSON report for those comments.", strings.Join(missing, ", "))
+	}
+
+	resolutions := []resolution{}
+	for _, c := range comments {
+		r, ok := byID[c.ID]
+		if !ok {
+			r = resolution{ID: c.ID, Status: "unaddressed"}
+		}
+		r.Path, r.Line = c.Path, c.Line
+		resolutions = append(resolutions, r)
+	}
+	return resolutions, nil
+}
+
+func writeReviewComment(prompt *strings.Builder, c reviewComment) {
+	fmt.Fprintf(prompt, "<comment id=%q", c.ID)
+	if c.Path != "" {
+		fmt.Fprintf(prompt, " path=%q", c.Path)
+	}
+	if c.Line > 0 {
+		fmt.Fprintf(prompt, " line=\"%d\"", c.Line)
+	}
+	if c.Author != "" {
+		fmt.Fprintf(prompt, " author=%q", c.Author)
+	}
+	prompt.WriteString(">\n")
+	if c.Hunk != "" {
+		fmt.Fprintf(prompt, "```diff\n%s\n```\n", c.Hunk)
+	}
+	fmt.Fprintf(prompt, "%s\n", c.Body)
+	for _, reply := range c.Replies {
+		fmt.Fprintf(prompt, "Reply from %s\n", reply)
+	}
+	prompt.WriteString("</comment>\n\n")
+}
+
+// parseResolutions reads the last JSON report in an answer, ignoring an answer without one.
+func parseResolutions(answer string) []resolution {
+	matches := findingsBlock.FindAllStringSubmatch(answer, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	var reported []struct {
+		ID     json.RawMessage `json:"id"`
+		Status string          `json:"status"`
+		Reply  string          `json:"reply"`
+	}
+	if err := json.Unmarshal([]byte(matches[len(matches)-1][1]), &reported); err != nil {
+		return nil
+	}
+	resolutions := []resolution{}
+	for _, r := range reported {
+		resolutions = append(resolutions, resolution{ID: strings.Trim(string(r.ID), `"`), Status: r.Status, Reply: r.Reply})
+	}
+	return resolutions
+}
+
+func printResolutions(resolutions []resolution, format string) {
+	if format == "json" {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(resolutions)
+		return
+	}
+
+	sorted := append([]resolution{}, resolutions...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return slices.Index(resolutionStatuses, sorted[i].Status) < slices.Index(resolutionStatuses, sorted[j].Status)
+	})
+	for _, r := range sorted {
+		location := r.Path
+		if r.Line > 0 {
+			location = fmt.Sprintf("%s:%d", r.Path, r.Line)
+		}
+		if location != "" {
+			location = " (" + location + ")"
+		}
+		fmt.Printf("%s%s: %s\n", r.ID, location, r.Status)
+		if r.Reply != "" {
+			fmt.Printf("    %s\n", strings.ReplaceAll(r.Reply, "\n", "\n    "))
+		}
+	}
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/agent"
+)
+
+// runBench implements "agent bench": it fires concurrent synthetic sessions at an
+// agent's HTTP endpoint and reports throughput, per-turn latency and memory use.
+func runBench(args []string) int {
+	flags := flag.NewFlagSet("bench", flag.ExitOnError)
+	url := flags.String("url", "http://localhost:8080/coder", "agent endpoint to send messages to")
+	sessions := flags.Int("sessions", 10, "concurrent sessions")
+	turns := flags.Int("turns", 5, "messages sent per session")
+	message := flags.String("message", "Reply with a one-sentence summary of what you can do.", "message sent on every turn")
+	timeout := flags.Duration("timeout", 2*time.Minute, "timeout per turn")
+	mock := flags.Bool("mock", false, "benchmark an in-process agent backed by a mock provider instead of -url")
+	mockLatency := flags.Duration("mock-latency", 500*time.Millisecond, "how long the mock provider takes per response")
+	flags.Parse(args)
+
+	if *mock {
+		mockURL, err := startMockAgent(*mockLatency)
+		if err != nil {
+			fmt.Printf("Failed to start mock agent: %v\n", err)
+			return 1
+		}
+		*url = mockURL
+	}
+
+	fmt.Printf("Benchmarking %s with %d sessions x %d turns\n", *url, *sessions, *turns)
+
+	before, _ := scrapeMetrics(*url + "/metrics")
+	peak := before["go_memstats_heap_alloc_bytes"]
+
+	stopSampling := make(chan struct{})
+	sampled := make(chan struct{})
+	go func() {
+		defer close(sampled)
+		ticker := time.NewTicker(250 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if metrics, err := scrapeMetrics(*url + "/metrics"); err == nil {
+					peak = max(peak, metrics["go_memstats_heap_alloc_bytes"])
+				}
+			case <-stopSampling:
+				return
+			}
+		}
+	}()
+
+	client := &http.Client{Timeout: *timeout}
+	var mu sync.Mutex
+	var latencies []time.Duration
+	failures := map[string]int{}
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for s := 0; s < *sessions; s++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := 0; t < *turns; t++ {
+				turnStart := time.Now()
+				err := sendTurn(client, *url, fmt.Sprintf("bench-%d", s), fmt.Sprintf("bench-%d-%d", s, t), *message)
+				latency := time.Since(turnStart)
+
+				mu.Lock()
+				if err != nil {
+					failures[err.Error()]++
+				} else {
+					latencies = append(latencies, latency)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	close(stopSampling)
+	<-sampled
+	after, metricsErr := scrapeMetrics(*url + "/metrics")
+	if metricsErr == nil {
+		peak = max(peak, after["go_memstats_heap_alloc_bytes"])
+	}
+
+	failed := 0
+	for _, count := range failures {
+		failed += count
+	}
+
+	fmt.Printf("\nTurns:       %d succeeded, %d failed in %s\n", len(latencies), failed, elapsed.Round(time.Millisecond))
+	fmt.Printf("Throughput:  %.2f turns/s\n", float64(len(latencies))/elapsed.Seconds())
+	if len(latencies) > 0 {
+		sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+		fmt.Printf("Latency:     p50 %s, p95 %s, p99 %s, max %s\n",
+			percentile(latencies, 50), percentile(latencies, 95), percentile(latencies, 99), latencies[len(latencies)-1].Round(time.Millisecond))
+	}
+	if metricsErr != nil {
+		fmt.Printf("Memory:      unavailable (%v)\n", metricsErr)
+	} else {
+		fmt.Printf("Heap:        %s before, %s after, %s peak\n", formatBytes(before["go_memstats_heap_alloc_bytes"]), formatBytes(after["go_memstats_heap_alloc_bytes"]), formatBytes(peak))
+		fmt.Printf("Sessions:    %.0f live, %s of message history\n", after["agent_sessions_live"], formatBytes(after["agent_session_message_bytes"]))
+	}
+	for reason, count := range failures {
+		fmt.Printf("Failure:     %dx %s\n", count, reason)
+	}
+
+	if failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// sendTurn posts one message in a session and waits for the reply.
+func sendTurn(client *http.Client, url string, session string, requestID string, message string) error {
+	request, err := http.NewRequest("POST", url, strings.NewReader(message))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("X-Session-ID", session)
+	request.Header.Set("X-Request-ID", requestID)
+
+	response, err := client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("HTTP %d", response.StatusCode)
+	}
+	return nil
+}
+
+// scrapeMetrics reads the unlabeled samples of a Prometheus text endpoint.
+func scrapeMetrics(url string) (map[string]float64, error) {
+	response, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: HTTP %d", url, response.StatusCode)
+	}
+
+	metrics := map[string]float64{}
+	scanner := bufio.NewScanner(response.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if value, err := strconv.ParseFloat(fields[1], 64); err == nil {
+			metrics[fields[0]] = value
+		}
+	}
+	return metrics, scanner.Err()
+}
+
+func percentile(sorted []time.Duration, p int) time.Duration {
+	index := (len(sorted)*p + 99) / 100
+	return sorted[max(index-1, 0)].Round(time.Millisecond)
+}
+
+func formatBytes(bytes float64) string {
+	return fmt.Sprintf("%.1f MiB", bytes/(1<<20))
+}
+
+// startMockAgent serves an agent without tools on a free port, answering every
+// message after latency, and returns its endpoint.
+func startMockAgent(latency time.Duration) (string, error) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		return "", err
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	a := agent.NewAgent(mockProvider{latency: latency}, nil, "bench", port)
+	a.AddHTTPTransport()
+	a.Start()
+	go a.Run(context.Background())
+
+	// Wait for the server to come up.
+	for i := 0; i < 50; i++ {
+		if response, err := http.Get(fmt.Sprintf("http://localhost:%d/health", port)); err == nil {
+			response.Body.Close()
+			return fmt.Sprintf("http://localhost:%d/bench", port), nil
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	return "", fmt.Errorf("mock agent did not start on port %d", port)
+}
+
+// mockProvider answers every request with a short text reply after a fixed delay.
+type mockProvider struct {
+	latency time.Duration
+}
+
+func (p mockProvider) NewMessage(ctx context.Context, params anthropic.MessageNewParams) (*anthropic.Message, error) {
+	select {
+	case <-time.After(p.latency):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	response := &anthropic.Message{}
+	err := response.UnmarshalJSON([]byte(fmt.Sprintf(`{"id": "msg_bench", "type": "message", "role": "assistant", "model": %q, "content": [{"type": "text", "text": "Synthetic reply to message %d."}], "stop_reason": "end_turn", "usage": {"input_tokens": 100, "output_tokens": 10}}`, params.Model, len(params.Messages))))
+	return response, err
+}
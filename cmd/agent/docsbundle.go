@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kartikx/agent/docsource"
+)
+
+// runDocsBundle implements "agent docs-bundle": it fetches the documentation of
+// every direct dependency of a Go module, at the version its go.mod requires,
+// into a bundle the doc agent serves from first when DOC_BUNDLE points at it.
+// Rebuilding only fetches packages whose version changed. It exits with 1 if
+// some documentation couldn't be fetched.
+func runDocsBundle(args []string) int {
+	flags := flag.NewFlagSet("docs-bundle", flag.ExitOnError)
+	dir := flags.String("dir", ".", "directory of the Go module")
+	out := flags.String("out", "", "bundle file (default DIR/.agent/docs.json)")
+	refresh := flags.Bool("refresh", false, "fetch all documentation again, not only what changed")
+	timeout := flags.Duration("timeout", 10*time.Minute, "timeout for fetching the documentation")
+	flags.Parse(args)
+
+	if *out == "" {
+		*out = filepath.Join(*dir, ".agent", "docs.json")
+	}
+
+	module, modules, err := directDependencies(*dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read go.mod: %v\n", err)
+		return 2
+	}
+	if err := addImportedPackages(*dir, modules); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read the module's imports: %v\n", err)
+		return 2
+	}
+
+	var previous *docsource.Bundle
+	if !*refresh {
+		if bundle, err := docsource.LoadBundle(*out); err == nil && bundle.Module == module {
+			previous = bundle
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	bundle := docsource.BuildBundle(ctx, module, modules, previous)
+	if err := bundle.Save(*out); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save the bundle: %v\n", err)
+		return 2
+	}
+
+	fmt.Printf("Bundled the documentation of %d packages from %d modules in %s\n", len(bundle.Docs), len(modules), *out)
+	if len(bundle.Missing) == 0 {
+		return 0
+	}
+	var missing []string
+	for pkg := range bundle.Missing {
+		missing = append(missing, pkg)
+	}
+	sort.Strings(missing)
+	fmt.Fprintf(os.Stderr, "Couldn't fetch the documentation of %d packages, which lookups fetch from pkg.go.dev instead:\n", len(missing))
+	for _, pkg := range missing {
+		fmt.Fprintf(os.Stderr, "  %s: %s\n", pkg, bundle.Missing[pkg])
+	}
+	return 1
+}
+
+// directDependencies returns the module in dir and the modules its go.mod
+// requires directly, at the versions they're replaced by.
+func directDependencies(dir string) (string, []docsource.BundleModule, error) {
+	cmd := exec.Command("go", "mod", "edit", "-json")
+	cmd.Dir = dir
+	output, err := cmd.Output()
+	if err != nil {
+		if exitErr, ok := err.(*exec.ExitError); ok {
+			return "", nil, fmt.Errorf("%v: %s", err, strings.TrimSpace(string(exitErr.Stderr)))
+		}
+		return "", nil, err
+	}
+
+	type version struct{ Path, Version string }
+	var goMod struct {
+		Module  struct{ Path string }
+		Require []struct {
+			Path     string
+			Version  string
+			Indirect bool
+		}
+		Replace []struct{ Old, New version }
+	}
+	if err := json.Unmarshal(output, &goMod); err != nil {
+		return "", nil, err
+	}
+
+	var modules []docsource.BundleModule
+	for _, r := range goMod.Require {
+		if r.Indirect {
+			continue
+		}
+		m := docsource.BundleModule{Path: r.Path, Version: r.Version}
+		// Replacements by another version document that version; the docs of
+		// other modules or local directories aren't the ones imported.
+		replaced := false
+		for _, replace := range goMod.Replace {
+			if replace.Old.Path == r.Path && (replace.Old.Version == "" || replace.Old.Version == r.Version) {
+				replaced = replace.New.Path != r.Path || replace.New.Version == ""
+				m.Version = replace.New.Version
+			}
+		}
+		if !replaced {
+			modules = append(modules, m)
+		}
+	}
+	return goMod.Module.Path, modules, nil
+}
+
+// addImportedPackages adds the packages of modules the Go files in dir import.
+func addImportedPackages(dir string, modules []docsource.BundleModule) error {
+	imported := map[string]bool{}
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			name := entry.Name()
+			if path != dir && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor" || name == "testdata") {
+				return filepath.SkipDir
+			}
+			// Nested modules have dependencies of their own.
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); path != dir && err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.HasSuffix(path, ".go") {
+			return nil
+		}
+		file, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.ImportsOnly)
+		if err != nil {
+			// Files that don't parse import nothing worth bundling.
+			return nil
+		}
+		for _, spec := range file.Imports {
+			if pkg, err := strconv.Unquote(spec.Path.Value); err == nil {
+				imported[pkg] = true
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for pkg := range imported {
+		// The longest module path owns the package, e.g. a/b/v2 over a/b.
+		owner := -1
+		for i, m := range modules {
+			if (pkg == m.Path || strings.HasPrefix(pkg, m.Path+"/")) && (owner < 0 || len(m.Path) > len(modules[owner].Path)) {
+				owner = i
+			}
+		}
+		if owner >= 0 {
+			modules[owner].Packages = append(modules[owner].Packages, pkg)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/agent"
+	"github.com/kartikx/agent/providers"
+	"github.com/kartikx/agent/tools"
+	"github.com/kartikx/agent/workspace"
+)
+
+func main() {
+	// "agent bench" load-tests a running agent instead of starting one
+	if len(os.Args) > 1 && os.Args[1] == "bench" {
+		os.Exit(runBench(os.Args[2:]))
+	}
+	// "agent review" reviews the staged changes for a pre-commit hook or CI
+	if len(os.Args) > 1 && os.Args[1] == "review" {
+		os.Exit(runReview(os.Args[2:]))
+	}
+	// "agent address" addresses a pull request's review comments in the working tree
+	if len(os.Args) > 1 && os.Args[1] == "address" {
+		os.Exit(runAddress(os.Args[2:]))
+	}
+	// "agent solve" turns a GitHub issue into a draft pull request
+	if len(os.Args) > 1 && os.Args[1] == "solve" {
+		os.Exit(runSolve(os.Args[2:]))
+	}
+	// "agent docs-bundle" bundles the documentation of a Go module's dependencies
+	if len(os.Args) > 1 && os.Args[1] == "docs-bundle" {
+		os.Exit(runDocsBundle(os.Args[2:]))
+	}
+
+	// Get agent type from environment variable
+	agentType := os.Getenv("AGENT_TYPE")
+	if agentType == "" {
+		agentType = "doc" // default to doc agent
+	}
+
+	// The API key comes from CREDENTIALS_FILE, ANTHROPIC_API_KEY_FILE or ANTHROPIC_API_KEY, and is re-read when rotated
+	keys, err := providers.KeySourceFromEnv(agentType)
+	if err != nil {
+		fmt.Printf("ERROR: no API key: %v\n", err)
+		os.Exit(1)
+	}
+
+	// Get port from environment variable
+	portStr := os.Getenv("PORT")
+	if portStr == "" {
+		portStr = "8080" // default port
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		fmt.Printf("Invalid PORT environment variable: %s\n", portStr)
+		os.Exit(1)
+	}
+
+	client := anthropic.NewClient()
+	provider := providers.NewAnthropicWithKeys(&client, keys)
+
+	var a *agent.Agent
+
+	switch agentType {
+	case "doc":
+		a = agent.NewDocAgent(provider)
+		a.SetPort(port) // override the default port
+	case "coder":
+		a = agent.NewCoderAgent(provider)
+		a.SetPort(port) // override the default port
+	default:
+		fmt.Printf("Unknown AGENT_TYPE: %s. Valid values are 'doc' or 'coder'.\n", agentType)
+		os.Exit(1)
+	}
+
+	// FS_MODE=overlay keeps all writes in memory (dry run), FS_MODE=readonly rejects them
+	switch os.Getenv("FS_MODE") {
+	case "", "os":
+	case "overlay":
+		a.SetFS(tools.NewOverlayFS(tools.OSFS{}))
+	case "readonly":
+		a.SetFS(tools.ReadOnlyFS{FS: tools.OSFS{}})
+	default:
+		fmt.Printf("Unknown FS_MODE: %s. Valid values are 'os', 'overlay' or 'readonly'.\n", os.Getenv("FS_MODE"))
+		os.Exit(1)
+	}
+
+	// WORKSPACE_ROOTS="frontend=/src/web;backend=/src/api:ro" gives file tools several named roots
+	if spec := os.Getenv("WORKSPACE_ROOTS"); spec != "" {
+		roots, err := tools.ParseRoots(spec)
+		if err != nil {
+			fmt.Printf("Invalid WORKSPACE_ROOTS: %v\n", err)
+			os.Exit(1)
+		}
+		a.SetFS(roots)
+	}
+
+	// READ_AHEAD=on prefetches files like go.mod when their directory is listed
+	if os.Getenv("READ_AHEAD") == "on" {
+		a.ReadAhead()
+	}
+
+	// WATCH_FILES=on tells the model about files changed by someone else during the session
+	if os.Getenv("WATCH_FILES") == "on" {
+		if err := a.WatchFiles("."); err != nil {
+			fmt.Printf("Failed to watch files: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// REVIEW_CHANGES=on keeps each session's edits pending until approved at /<agent>/review
+	if os.Getenv("REVIEW_CHANGES") == "on" {
+		a.ReviewChanges()
+	}
+
+	// WORKSPACES=on serves POST/DELETE /<agent>/workspace for disposable checkouts
+	if os.Getenv("WORKSPACES") == "on" {
+		a.UseWorkspaces(workspace.NewManagerFromEnv())
+	}
+
+	// DB_DSN gives the agent tools to inspect and query a SQL database, read-only unless DB_READ_WRITE=on
+	if config, ok := tools.DatabaseConfigFromEnv(); ok {
+		database, err := tools.NewDatabase(config)
+		if err != nil {
+			fmt.Printf("Invalid database configuration: %v\n", err)
+			os.Exit(1)
+		}
+		for _, definition := range database.Definitions() {
+			a.Tools().Register(definition)
+		}
+	}
+
+	// TOOLS_FILE declares project-specific tools that run shell commands, e.g. make deploy
+	if path := os.Getenv("TOOLS_FILE"); path != "" {
+		declarations, err := tools.LoadCommandTools(path)
+		if err != nil {
+			fmt.Printf("Invalid TOOLS_FILE: %v\n", err)
+			os.Exit(1)
+		}
+		for _, declaration := range declarations {
+			if _, ok := a.Tools().Lookup(declaration.Name); ok {
+				fmt.Printf("Invalid TOOLS_FILE: %s is a built-in tool\n", declaration.Name)
+				os.Exit(1)
+			}
+		}
+		if err := a.AddCommandTools(declarations); err != nil {
+			fmt.Printf("Invalid TOOLS_FILE: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	// TOOL_PLUGINS starts executables providing tools over a JSON-over-stdio protocol
+	for _, path := range strings.Split(os.Getenv("TOOL_PLUGINS"), ",") {
+		if path = strings.TrimSpace(path); path == "" {
+			continue
+		}
+		plugin, err := tools.StartPlugin(path, tools.PluginTimeout())
+		if err != nil {
+			fmt.Printf("Invalid TOOL_PLUGINS: %v\n", err)
+			os.Exit(1)
+		}
+		for _, definition := range plugin.Definitions() {
+			if _, ok := a.Tools().Lookup(definition.Name); ok {
+				fmt.Printf("Invalid TOOL_PLUGINS: %s provides %s, which is already a tool\n", path, definition.Name)
+				os.Exit(1)
+			}
+			a.Tools().Register(definition)
+		}
+	}
+
+	// STORAGE_KEY (or STORAGE_KEY_FILE or STORAGE_KEY_COMMAND) encrypts the sessions and caches stored at rest
+	sealer, err := agent.SealerFromEnv()
+	if err != nil {
+		fmt.Printf("Invalid storage encryption key: %v\n", err)
+		os.Exit(1)
+	}
+	if sealer != nil {
+		a.EncryptStorage(sealer)
+	}
+
+	// SESSION_DB_DSN keeps sessions in a shared database so any replica can continue any session
+	if dsn := os.Getenv("SESSION_DB_DSN"); dsn != "" {
+		driver := os.Getenv("SESSION_DB_DRIVER")
+		if driver == "" {
+			driver = "postgres"
+		}
+		backend, err := agent.NewSQLSessionBackend(driver, dsn)
+		if err != nil {
+			fmt.Printf("Invalid session database configuration: %v\n", err)
+			os.Exit(1)
+		}
+		a.SetSessionBackend(backend)
+	}
+
+	// USERS_FILE turns the agent into a shared service with per-user workspaces, budgets and tools
+	usersFile := os.Getenv("USERS_FILE")
+	if usersFile != "" {
+		if os.Getenv("WORKSPACES") == "on" {
+			fmt.Println("WORKSPACES can't be used with USERS_FILE: each user works in their own root.")
+			os.Exit(1)
+		}
+		users, err := agent.LoadUsers(usersFile)
+		if err != nil {
+			fmt.Printf("Invalid USERS_FILE: %v\n", err)
+			os.Exit(1)
+		}
+		a.SetUsers(users)
+	}
+
+	// AUDIT_LOG records every file write, command and outbound call to an append-only JSONL file
+	if path := os.Getenv("AUDIT_LOG"); path != "" {
+		auditLog, err := agent.OpenAuditLog(path)
+		if err != nil {
+			fmt.Printf("Failed to open AUDIT_LOG: %v\n", err)
+			os.Exit(1)
+		}
+		a.SetAuditLog(auditLog)
+	}
+
+	// SCHEDULE_FILE declares recurring tasks the agent runs on its own, e.g. nightly test runs
+	if path := os.Getenv("SCHEDULE_FILE"); path != "" {
+		tasks, err := agent.LoadSchedule(path)
+		if err != nil {
+			fmt.Printf("Invalid SCHEDULE_FILE: %v\n", err)
+			os.Exit(1)
+		}
+		a.AddTransport(agent.NewScheduler(tasks))
+	}
+
+	// WATCH_MODE=on starts sessions on its own when tests start failing or TODOs appear, staging fixes as proposals
+	if os.Getenv("WATCH_MODE") == "on" {
+		watch, err := agent.NewWatchMode(".", agent.WatchConfigFromEnv())
+		if err != nil {
+			fmt.Printf("Failed to start watch mode: %v\n", err)
+			os.Exit(1)
+		}
+		a.AddTransport(watch)
+	}
+
+	// HTTP is always served; EXTRA_TRANSPORTS attaches more, e.g. "websocket,cli" or "bus"
+	for _, transport := range strings.Split(os.Getenv("EXTRA_TRANSPORTS"), ",") {
+		switch strings.TrimSpace(transport) {
+		case "":
+		case "websocket":
+			if usersFile != "" {
+				fmt.Println("The websocket transport can't authenticate users; remove it from EXTRA_TRANSPORTS or unset USERS_FILE.")
+				os.Exit(1)
+			}
+			a.AddWebSocketTransport()
+		case "cli":
+			a.AddTransport(agent.NewCLITransport())
+		case "slack":
+			if usersFile != "" {
+				fmt.Println("The slack transport can't authenticate users; remove it from EXTRA_TRANSPORTS or unset USERS_FILE.")
+				os.Exit(1)
+			}
+			slack, err := agent.NewSlackTransport(os.Getenv("SLACK_APP_TOKEN"), os.Getenv("SLACK_BOT_TOKEN"))
+			if err != nil {
+				fmt.Printf("Failed to connect to Slack: %v\n", err)
+				os.Exit(1)
+			}
+			a.AddTransport(slack)
+		case "bus":
+			if usersFile != "" {
+				fmt.Println("The bus transport can't authenticate users; remove it from EXTRA_TRANSPORTS or unset USERS_FILE.")
+				os.Exit(1)
+			}
+			busTransport, err := agent.NewBusTransport(os.Getenv("BUS_URL"), agentType)
+			if err != nil {
+				fmt.Printf("Failed to join the bus at BUS_URL: %v\n", err)
+				os.Exit(1)
+			}
+			a.AddTransport(busTransport)
+		default:
+			fmt.Printf("Unknown transport in EXTRA_TRANSPORTS: %s. Valid values are 'websocket', 'cli', 'bus' or 'slack'.\n", transport)
+			os.Exit(1)
+		}
+	}
+
+	fmt.Printf("Starting %s agent on port %d\n", agentType, port)
+
+	// Start the agent's HTTP server
+	a.Start()
+
+	// On SIGTERM or Ctrl-C, finish the turn in progress within SHUTDOWN_TIMEOUT and save sessions
+	drained := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		sig := <-signals
+		fmt.Printf("Received %s, draining\n", sig)
+
+		drainCtx, cancelDrain := context.WithTimeout(context.Background(), agent.ShutdownTimeout())
+		defer cancelDrain()
+		if err := a.Shutdown(drainCtx); err != nil {
+			// Run may still be stuck in the turn, so don't wait for it.
+			fmt.Printf("Unclean shutdown: %v\n", err)
+			os.Exit(1)
+		}
+		close(drained)
+	}()
+
+	// Run the agent (this will block and handle requests)
+	if _, err := a.Run(context.Background()); err != nil && !errors.Is(err, agent.ErrShuttingDown) {
+		fmt.Printf("Agent stopped: %v\n", err)
+		os.Exit(1)
+	}
+	<-drained
+}
\ No newline at end of file
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/agent"
+	"github.com/kartikx/agent/providers"
+	"github.com/kartikx/agent/tools"
+)
+
+// Most diff and lint output sent to the model; the start is kept.
+const maxReviewDiff = 100_000
+const maxReviewLint = 20_000
+
+// Severities of review findings, least severe first.
+var reviewSeverities = []string{"notice", "warning", "error"}
+
+// finding is one problem the reviewer reported.
+type finding struct {
+	File       string `json:"file"`
+	Line       int    `json:"line,omitempty"`
+	Severity   string `json:"severity"`
+	Title      string `json:"title"`
+	Message    string `json:"message"`
+	Suggestion string `json:"suggestion,omitempty"`
+}
+
+var findingsBlock = regexp.MustCompile("(?s)```json\\s*(\\[.*?\\])\\s*```")
+
+// runReview implements "agent review": it has the agent review a diff, explain
+// any lint findings and suggest fixes, and prints the findings for a pre-commit
+// hook or as GitHub Actions annotations. It exits with 1 if a finding is at
+// least as severe as -fail-on.
+func runReview(args []string) int {
+	flags := flag.NewFlagSet("review", flag.ExitOnError)
+	base := flags.String("base", "", "review the changes since this ref, e.g. origin/main, instead of the staged changes")
+	format := flags.String("format", "", "text, github or json (default github on GitHub Actions, otherwise text)")
+	lint := flags.String("lint", "", `lint command whose output is explained, e.g. "golangci-lint run" (default "go vet ./..." in Go modules, "none" disables)`)
+	failOn := flags.String("fail-on", "error", "fail on findings of this severity or worse: notice, warning, error or none")
+	timeout := flags.Duration("timeout", 5*time.Minute, "timeout for the review")
+	flags.Parse(args)
+
+	if *format == "" {
+		*format = "text"
+		if os.Getenv("GITHUB_ACTIONS") == "true" {
+			*format = "github"
+		}
+	}
+	if *format != "text" && *format != "github" && *format != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown -format %s. Valid values are 'text', 'github' or 'json'.\n", *format)
+		return 2
+	}
+	if *failOn != "none" && severityRank(*failOn) < 0 {
+		fmt.Fprintf(os.Stderr, "Unknown -fail-on %s. Valid values are 'notice', 'warning', 'error' or 'none'.\n", *failOn)
+		return 2
+	}
+	keys, err := providers.KeySourceFromEnv("review")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "ERROR: no API key: %v\n", err)
+		return 2
+	}
+
+	diffArgs := []string{"diff", "--cached"}
+	if *base != "" {
+		diffArgs = []string{"diff", *base + "...HEAD"}
+	}
+	diff, err := exec.Command("git", diffArgs...).Output()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "git %s failed: %v\n", strings.Join(diffArgs, " "), err)
+		return 2
+	}
+	if len(strings.TrimSpace(string(diff))) == 0 {
+		fmt.Fprintln(os.Stderr, "Nothing to review.")
+		return 0
+	}
+
+	if *lint == "" {
+		*lint = "none"
+		if _, err := os.Stat("go.mod"); err == nil {
+			*lint = "go vet ./..."
+		}
+	}
+	var lintOutput []byte
+	if *lint != "none" {
+		// Lint tools exit non-zero when they find something; the output is what matters.
+		lintOutput, _ = exec.Command("sh", "-c", *lint).CombinedOutput()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	// The agent logs to stdout, which is for the findings.
+	stdout := os.Stdout
+	os.Stdout = os.Stderr
+	client := anthropic.NewClient()
+	findings, err := review(ctx, providers.NewAnthropicWithKeys(&client, keys), string(diff), *lint, string(lintOutput))
+	os.Stdout = stdout
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Review failed: %v\n", err)
+		return 2
+	}
+
+	printFindings(findings, *format)
+
+	if *failOn != "none" {
+		for _, f := range findings {
+			if severityRank(f.Severity) >= severityRank(*failOn) {
+				return 1
+			}
+		}
+	}
+	return 0
+}
+
+// review asks an agent with read-only file tools for findings about diff.
+func review(ctx context.Context, provider providers.Provider, diff string, lint string, lintOutput string) ([]finding, error) {
+	readOnly := []tools.ToolDefinition{}
+	for _, definition := range tools.NewCoderTools(tools.ReadOnlyFS{FS: tools.OSFS{}}) {
+		if definition.Category == tools.CategoryRead {
+			readOnly = append(readOnly, definition)
+		}
+	}
+	reviewer := agent.NewAgent(provider, readOnly, "review", 0)
+
+	var prompt strings.Builder
+	prompt.WriteString("Review this change before it is committed. Look for bugs, missing error handling, security problems and unclear code; read the surrounding files when the diff alone isn't enough. Don't report style nits a formatter would fix. For changed Go files, run check_doc_comments and report exported identifiers the change adds or changes without a proper doc comment as notices.\n\n")
+	fmt.Fprintf(&prompt, "```diff\n%s\n```\n\n", truncate(diff, maxReviewDiff))
+	if strings.TrimSpace(lintOutput) != "" {
+		fmt.Fprintf(&prompt, "`%s` reported the following. For each finding in the changed code, explain in plain words what is wrong and how to fix it:\n\n```\n%s\n```\n\n", lint, truncate(lintOutput, maxReviewLint))
+	}
+	prompt.WriteString(`Reply with your findings as a JSON array in a ` + "```json" + ` block, and nothing else after it. Each finding has "file" (path as in the diff), "line" (line number in the new file), "severity" ("error" for bugs that must be fixed, "warning" for likely problems, "notice" for suggestions), "title" (a few words), "message" (what is wrong and why) and "suggestion" (the fixed code, or how to fix it). Reply with [] if there is nothing worth reporting.`)
+
+	answer, err := reviewer.Answer(ctx, prompt.String())
+	if err != nil {
+		return nil, err
+	}
+	return parseFindings(answer)
+}
+
+func parseFindings(answer string) ([]finding, error) {
+	matches := findingsBlock.FindAllStringSubmatch(answer, -1)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("the reviewer didn't reply with findings:\n%s", answer)
+	}
+
+	var findings []finding
+	if err := json.Unmarshal([]byte(matches[len(matches)-1][1]), &findings); err != nil {
+		return nil, fmt.Errorf("invalid findings: %v", err)
+	}
+	for i := range findings {
+		if severityRank(findings[i].Severity) < 0 {
+			findings[i].Severity = "warning"
+		}
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings, nil
+}
+
+func severityRank(severity string) int {
+	for i, known := range reviewSeverities {
+		if severity == known {
+			return i
+		}
+	}
+	return -1
+}
+
+func printFindings(findings []finding, format string) {
+	switch format {
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(findings)
+	case "github":
+		// https://docs.github.com/actions/reference/workflow-commands-for-github-actions
+		for _, f := range findings {
+			properties := "file=" + escapeAnnotationProperty(f.File)
+			if f.Line > 0 {
+				properties += fmt.Sprintf(",line=%d", f.Line)
+			}
+			if f.Title != "" {
+				properties += ",title=" + escapeAnnotationProperty(f.Title)
+			}
+			message := f.Message
+			if f.Suggestion != "" {
+				message += "\n\nSuggestion:\n" + f.Suggestion
+			}
+			fmt.Printf("::%s %s::%s\n", f.Severity, properties, escapeAnnotationData(message))
+		}
+	default:
+		for _, f := range findings {
+			location := f.File
+			if f.Line > 0 {
+				location = fmt.Sprintf("%s:%d", f.File, f.Line)
+			}
+			fmt.Printf("%s: %s: %s\n", location, f.Severity, f.Title)
+			fmt.Printf("    %s\n", strings.ReplaceAll(f.Message, "\n", "\n    "))
+			if f.Suggestion != "" {
+				fmt.Printf("    Suggestion:\n        %s\n", strings.ReplaceAll(f.Suggestion, "\n", "\n        "))
+			}
+		}
+		if len(findings) == 0 {
+			fmt.Println("No findings.")
+		}
+	}
+}
+
+func escapeAnnotationData(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A").Replace(s)
+}
+
+func escapeAnnotationProperty(s string) string {
+	return strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C").Replace(s)
+}
+
+func truncate(s string, limit int) string {
+	if len(s) <= limit {
+		return s
+	}
+	return s[:limit] + "\n[... truncated]"
+}
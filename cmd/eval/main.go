@@ -0,0 +1,84 @@
+// Command eval runs the agent evaluation fixtures and prints a score report.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/eval"
+	"github.com/kartikx/agent/providers"
+)
+
+func main() {
+	dir := flag.String("dir", "evals", "directory of task fixtures")
+	only := flag.String("task", "", "run only the task with this name")
+	providerName := flag.String("provider", "mock", "anthropic (live API) or mock (each task's responses.json)")
+	out := flag.String("out", "", "save the report as JSON to this path")
+	baselinePath := flag.String("baseline", "", "compare against a report saved with -out")
+	flag.Parse()
+
+	tasks, err := eval.LoadTasks(*dir)
+	if err != nil {
+		fmt.Printf("Failed to load tasks: %v\n", err)
+		os.Exit(1)
+	}
+
+	var baseline *eval.Report
+	if *baselinePath != "" {
+		loaded, err := eval.LoadReport(*baselinePath)
+		if err != nil {
+			fmt.Printf("Failed to load baseline: %v\n", err)
+			os.Exit(1)
+		}
+		baseline = &loaded
+	}
+
+	var live providers.Provider
+	switch *providerName {
+	case "mock":
+	case "anthropic":
+		keys, err := providers.KeySourceFromEnv("eval")
+		if err != nil {
+			fmt.Printf("ERROR: no API key: %v\n", err)
+			os.Exit(1)
+		}
+		client := anthropic.NewClient()
+		live = providers.NewAnthropicWithKeys(&client, keys)
+	default:
+		fmt.Printf("Unknown provider: %s. Valid values are 'anthropic' or 'mock'.\n", *providerName)
+		os.Exit(1)
+	}
+
+	report := eval.Report{}
+	for _, task := range tasks {
+		if *only != "" && task.Name != *only {
+			continue
+		}
+
+		provider := live
+		if provider == nil {
+			scripted, err := task.ScriptedProvider()
+			if err != nil {
+				fmt.Printf("Skipping %s: %v\n", task.Name, err)
+				continue
+			}
+			provider = scripted
+		}
+
+		fmt.Printf("Running %s...\n", task.Name)
+		report.Results = append(report.Results, eval.Run(context.Background(), task, provider))
+	}
+
+	fmt.Println()
+	report.Write(os.Stdout, baseline)
+
+	if *out != "" {
+		if err := report.Save(*out); err != nil {
+			fmt.Printf("Failed to save report: %v\n", err)
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package docsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Packages fetched at once while building a bundle.
+const bundleConcurrency = 4
+
+// Bundle is a snapshot of the documentation of a project's dependencies, at the
+// versions the project requires, served before pkg.go.dev so lookups of them
+// are instant and work offline.
+type Bundle struct {
+	// Module the bundle was built for, e.g. github.com/kartikx/agent.
+	Module    string    `json:"module"`
+	Generated time.Time `json:"generated"`
+	// Documentation by package import path.
+	Docs map[string]BundleDoc `json:"docs"`
+	// Packages whose documentation couldn't be fetched, with why.
+	Missing map[string]string `json:"missing,omitempty"`
+}
+
+// BundleDoc is the documentation of one package at one version.
+type BundleDoc struct {
+	Module  string    `json:"module"`
+	Version string    `json:"version"`
+	Text    string    `json:"text"`
+	Fetched time.Time `json:"fetched"`
+}
+
+// BundleModule is a dependency to bundle: the module and the packages of it
+// the project imports. Its root package is bundled too, if it has one.
+type BundleModule struct {
+	Path     string
+	Version  string
+	Packages []string
+}
+
+// BuildBundle fetches the documentation of modules' packages from pkg.go.dev,
+// reusing the documentation in previous, if not nil, of packages whose version
+// hasn't changed.
+func BuildBundle(ctx context.Context, module string, modules []BundleModule, previous *Bundle) *Bundle {
+	bundle := &Bundle{Module: module, Generated: time.Now(), Docs: map[string]BundleDoc{}, Missing: map[string]string{}}
+
+	type job struct {
+		pkg    string
+		module BundleModule
+		// Whether the project imports the package, rather than it being the module's root.
+		imported bool
+	}
+	var jobs []job
+	for _, m := range modules {
+		packages := append([]string{m.Path}, m.Packages...)
+		sort.Strings(packages)
+		for i, pkg := range packages {
+			if i > 0 && pkg == packages[i-1] {
+				continue
+			}
+			if previous != nil {
+				if doc, ok := previous.Docs[pkg]; ok && doc.Module == m.Path && doc.Version == m.Version {
+					bundle.Docs[pkg] = doc
+					continue
+				}
+			}
+			jobs = append(jobs, job{pkg: pkg, module: m, imported: slices.Contains(m.Packages, pkg)})
+		}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	slots := make(chan struct{}, bundleConcurrency)
+	for _, j := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			// Versioned pages document the version the project builds with, not the latest.
+			text, err := GoSource{}.Fetch(ctx, j.pkg+"@"+j.module.Version)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				// Many modules have no package at their root.
+				if j.imported {
+					bundle.Missing[j.pkg] = err.Error()
+				}
+				return
+			}
+			bundle.Docs[j.pkg] = BundleDoc{Module: j.module.Path, Version: j.module.Version, Text: text, Fetched: time.Now()}
+		}()
+	}
+	wg.Wait()
+	return bundle
+}
+
+// Save writes the bundle to path, replacing it in one step.
+func (b *Bundle) Save(path string) error {
+	data, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	temp := path + ".tmp"
+	if err := os.WriteFile(temp, data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(temp, path)
+}
+
+// LoadBundle reads a bundle written by Save.
+func LoadBundle(path string) (*Bundle, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var bundle Bundle
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, fmt.Errorf("invalid documentation bundle %s: %v", path, err)
+	}
+	return &bundle, nil
+}
+
+// Lookup returns the bundled documentation of a package. A topic naming a
+// version, e.g. "github.com/go-chi/chi/v5@v5.0.0", only matches that version.
+func (b *Bundle) Lookup(topic string) (string, bool) {
+	pkg, version, versioned := strings.Cut(strings.TrimSpace(topic), "@")
+	doc, ok := b.Docs[pkg]
+	if !ok || (versioned && version != doc.Version) {
+		return "", false
+	}
+	return doc.Text, true
+}
+
+// BundledSource serves documentation from a Bundle, and from Source for
+// packages the bundle doesn't have.
+type BundledSource struct {
+	Source
+	Bundle *Bundle
+}
+
+func (s BundledSource) Fetch(ctx context.Context, topic string) (string, error) {
+	if text, ok := s.Bundle.Lookup(topic); ok {
+		return text, nil
+	}
+	return s.Source.Fetch(ctx, topic)
+}
+
+// Loaded bundles, re-read when their file changes.
+var bundles struct {
+	mu      sync.Mutex
+	path    string
+	modTime time.Time
+	bundle  *Bundle
+}
+
+// Bundled wraps the Go source in the bundle at DOC_BUNDLE, if it's set, and
+// returns other sources as they are.
+func Bundled(source Source) Source {
+	path := os.Getenv("DOC_BUNDLE")
+	if path == "" || source.Name() != "go" {
+		return source
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		fmt.Printf("Failed to read the documentation bundle, fetching documentation instead: %v\n", err)
+		return source
+	}
+
+	bundles.mu.Lock()
+	defer bundles.mu.Unlock()
+	if bundles.path != path || !bundles.modTime.Equal(info.ModTime()) {
+		bundle, err := LoadBundle(path)
+		if err != nil {
+			fmt.Printf("%v, fetching documentation instead\n", err)
+			return source
+		}
+		bundles.path, bundles.modTime, bundles.bundle = path, info.ModTime(), bundle
+	}
+	return BundledSource{Source: source, Bundle: bundles.bundle}
+}
@@ -1,46 +1,22 @@
-package main
+// Package docsource fetches documentation for the documentation agent.
+package docsource
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"net/http"
 	"io"
-	"time"
+	"net/http"
 	"strings"
-	"golang.org/x/net/html"
+	"time"
+
 	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
 )
 
-// Documentation-specific tools
-var DocTools = []ToolDefinition{
-	SearchGoDocumentationDefinition,
-}
-
-// SearchGoDocumentation tool for searching Go documentation
-type SearchGoDocumentationInput struct {
-	PackageName string `json:"package_name" jsonschema_description:"The name of the package to search for"`
-}
-
-var SearchGoDocumentationInputSchema = GenerateSchema[SearchGoDocumentationInput]()
-
-var SearchGoDocumentationDefinition = ToolDefinition{
-	Name:        "search_go_documentation",
-	Description: "Search Go documentation for information. Use this when you need to find Go language features, standard library functions, or Go-specific information. Call this function with the name of the package you want to search for.",
-	InputSchema: SearchGoDocumentationInputSchema,
-	Function:    SearchGoDocumentation,
-}
-
-// SearchGoDocumentation fetches documentation text from pkg.go.dev for a given package
-func SearchGoDocumentation(input json.RawMessage) (string, error) {
-	searchInput := SearchGoDocumentationInput{}
-
-	err := json.Unmarshal(input, &searchInput)
-	if err != nil {
-		return "", err
-	}
-
-    url := fmt.Sprintf("https://pkg.go.dev/%s?tab=doc", searchInput.PackageName)
-    resp, err := http.Get(url)
+// FetchOverview fetches the overview section of a package's documentation from pkg.go.dev
+func FetchOverview(packageName string) (string, error) {
+    url := fmt.Sprintf("https://pkg.go.dev/%s?tab=doc", packageName)
+    resp, err := client(0).Get(url)
     if err != nil {
         return "", fmt.Errorf("failed to fetch package docs: %v", err)
     }
@@ -75,12 +51,10 @@ func GetPackageContents(packageName string) string {
 	url := fmt.Sprintf("https://pkg.go.dev/%s", packageName)
 	
 	// Create HTTP client with timeout
-	client := &http.Client{
-		Timeout: 30 * time.Second,
-	}
+	httpClient := client(30 * time.Second)
 	
 	// Make HTTP request
-	resp, err := client.Get(url)
+	resp, err := httpClient.Get(url)
 	if err != nil {
 		return fmt.Sprintf("Error fetching package: %v", err)
 	}
@@ -359,3 +333,92 @@ func extractFunctionName(n *html.Node) string {
 	traverse(n)
 	return strings.TrimSpace(result.String())
 }
+
+// GoSource reads package overviews from pkg.go.dev. Topics are import paths like "net/http".
+type GoSource struct{}
+
+func (GoSource) Name() string { return "go" }
+
+func (GoSource) Fetch(ctx context.Context, topic string) (string, error) {
+	docURL := fmt.Sprintf("https://pkg.go.dev/%s?tab=doc", topic)
+	doc, err := fetchDocument(ctx, docURL)
+	if err != nil {
+		return "", err
+	}
+
+	docSelection := doc.Find(".Documentation-overview")
+	if docSelection.Length() == 0 {
+		return "", fmt.Errorf("documentation section not found")
+	}
+
+	// The version and license come first, for vetting a dependency before using it.
+	info := goMetadata(ctx, topic, doc)
+	return truncate(info.String()+"\n\n"+strings.TrimSpace(docSelection.Text()), fmt.Sprintf("https://pkg.go.dev/%s#pkg-overview", topic)), nil
+}
+
+// Classes of the pkg.go.dev elements documenting one symbol.
+const goSymbolBlocks = ".Documentation-function, .Documentation-type, .Documentation-typeFunc, .Documentation-typeMethod"
+
+// GoSymbol reads the documentation of one symbol of a package from pkg.go.dev:
+// a function, a type with its constructors and methods listed, a method like
+// "Client.Do", or a constant or variable.
+func GoSymbol(ctx context.Context, pkg string, symbol string) (string, error) {
+	docURL := fmt.Sprintf("https://pkg.go.dev/%s?tab=doc", pkg)
+	doc, err := fetchDocument(ctx, docURL)
+	if err != nil {
+		return "", err
+	}
+
+	anchor := doc.Find(fmt.Sprintf(`.Documentation [id=%q]`, symbol)).First()
+	if anchor.Length() == 0 {
+		return "", fmt.Errorf("%s has no exported symbol %s: %w", pkg, symbol, ErrNotFound)
+	}
+	symbolURL := fmt.Sprintf("https://pkg.go.dev/%s#%s", pkg, symbol)
+
+	// Constants and variables are anchored inside their declaration, which the
+	// paragraphs after it describe.
+	if block := anchor.Closest(goSymbolBlocks); block.Length() > 0 && anchor.Is("h4, h3") {
+		return truncate(goSymbolText(block), symbolURL), nil
+	}
+	declaration := anchor.Closest(".Documentation-declaration")
+	if declaration.Length() == 0 {
+		return "", fmt.Errorf("documentation of %s.%s not found", pkg, symbol)
+	}
+	text := strings.TrimSpace(declaration.Text())
+	declaration.NextUntil(".Documentation-declaration").Filter("p").Each(func(i int, s *goquery.Selection) {
+		text += "\n\n" + strings.TrimSpace(s.Text())
+	})
+	return truncate(text, symbolURL), nil
+}
+
+// goSymbolText is the header, declaration and description of a symbol's block,
+// with the constructors and methods nested in a type's block only named.
+func goSymbolText(block *goquery.Selection) string {
+	block = block.Clone()
+	nested := block.Find(".Documentation-typeFunc, .Documentation-typeMethod")
+	var members []string
+	nested.Each(func(i int, s *goquery.Selection) {
+		members = append(members, goHeaderText(s.Find("h4").First()))
+	})
+	nested.Remove()
+	block.Find(".Documentation-exampleDetails").Remove()
+
+	var parts []string
+	block.Children().Each(func(i int, s *goquery.Selection) {
+		if s.Is("h4, h3") {
+			parts = append(parts, goHeaderText(s))
+		} else if text := strings.TrimSpace(s.Text()); text != "" {
+			parts = append(parts, text)
+		}
+	})
+	if len(members) > 0 {
+		parts = append(parts, "Functions and methods:\n- "+strings.Join(members, "\n- "))
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// goHeaderText is a symbol's header on one line, e.g. "func (*Client) Do added
+// in go1.1", without its ¶ link.
+func goHeaderText(header *goquery.Selection) string {
+	return strings.Join(strings.Fields(strings.ReplaceAll(header.Text(), "¶", " ")), " ")
+}
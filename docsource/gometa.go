@@ -0,0 +1,142 @@
+package docsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// GoPackageInfo describes the latest version of a Go package, as shown in the
+// header of its pkg.go.dev page.
+type GoPackageInfo struct {
+	Path       string `json:"path"`
+	Version    string `json:"version,omitempty"`
+	Published  string `json:"published,omitempty"` // e.g. 2023-06-04
+	License    string `json:"license,omitempty"`   // e.g. "MIT" or "Apache-2.0, MIT"; empty if none was detected
+	Repository string `json:"repository,omitempty"`
+}
+
+func (info GoPackageInfo) String() string {
+	var lines []string
+	add := func(label, value string) {
+		if value != "" {
+			lines = append(lines, label+": "+value)
+		}
+	}
+	add("Version", info.Version)
+	add("Published", info.Published)
+	if info.License == "" {
+		lines = append(lines, "License: none detected")
+	}
+	add("License", info.License)
+	add("Repository", info.Repository)
+	return strings.Join(lines, "\n")
+}
+
+// GoMetadata looks up the latest version of a package with its publication
+// date, license and repository, so a dependency can be vetted before it's used.
+func GoMetadata(ctx context.Context, pkg string) (GoPackageInfo, error) {
+	doc, err := fetchDocument(ctx, fmt.Sprintf("https://pkg.go.dev/%s", pkg))
+	if err != nil {
+		return GoPackageInfo{}, err
+	}
+	return goMetadata(ctx, pkg, doc), nil
+}
+
+// goMetadata reads a package's details from its page, asking the module proxy
+// for what the page doesn't show.
+func goMetadata(ctx context.Context, pkg string, doc *goquery.Document) GoPackageInfo {
+	info := GoPackageInfo{Path: pkg}
+	detail := func(id string) string { return headerDetail(doc, id) }
+
+	// The version is followed by badges such as "Latest".
+	if fields := strings.Fields(detail("UnitHeader-version")); len(fields) > 0 {
+		info.Version = fields[0]
+	}
+	info.Published = detail("UnitHeader-commitTime")
+	if published, err := time.Parse("Jan _2, 2006", info.Published); err == nil {
+		info.Published = published.Format(time.DateOnly)
+	}
+	if license := detail("UnitHeader-licenses"); !strings.EqualFold(license, "None detected") {
+		info.License = license
+	}
+	info.Repository, _ = doc.Find(".UnitMeta-repo a").First().Attr("href")
+
+	if !standardLibrary(pkg) && (info.Version == "" || info.Published == "" || info.Repository == "") {
+		if latest, err := proxyLatest(ctx, pkg); err == nil {
+			info.Version = orElse(info.Version, latest.Version)
+			info.Published = orElse(info.Published, latest.Time.Format(time.DateOnly))
+			info.Repository = orElse(info.Repository, latest.Origin.URL)
+		}
+	}
+	return info
+}
+
+// headerDetail returns the value of a detail in a page's header, e.g. "MIT"
+// for "License: MIT", or "" if the page doesn't show it.
+func headerDetail(doc *goquery.Document, id string) string {
+	text := strings.Join(strings.Fields(doc.Find(fmt.Sprintf(`[data-test-id=%q]`, id)).First().Text()), " ")
+	_, value, found := strings.Cut(text, ":")
+	if !found {
+		return ""
+	}
+	return strings.TrimSpace(value)
+}
+
+// orElse returns a if it's set, else b.
+func orElse(a, b string) string {
+	if a != "" {
+		return a
+	}
+	return b
+}
+
+// standardLibrary reports whether pkg is in the standard library, whose paths
+// have no dot in their first element.
+func standardLibrary(pkg string) bool {
+	first, _, _ := strings.Cut(pkg, "/")
+	return !strings.Contains(first, ".")
+}
+
+type proxyVersion struct {
+	Version string
+	Time    time.Time
+	Origin  struct {
+		URL string
+	}
+}
+
+// proxyLatest asks proxy.golang.org for the latest version of the module
+// providing pkg, trying pkg and then its parent paths as the module path.
+func proxyLatest(ctx context.Context, pkg string) (proxyVersion, error) {
+	var latest proxyVersion
+	for module := pkg; strings.Contains(module, "/"); module = module[:strings.LastIndex(module, "/")] {
+		body, err := fetch(ctx, fmt.Sprintf("https://proxy.golang.org/%s/@latest", EscapeModulePath(module)))
+		if err != nil {
+			continue
+		}
+		err = json.NewDecoder(body).Decode(&latest)
+		body.Close()
+		return latest, err
+	}
+	return latest, fmt.Errorf("no module found for %s: %w", pkg, ErrNotFound)
+}
+
+// EscapeModulePath encodes upper-case letters as the module proxy and cache expect,
+// e.g. github.com/BurntSushi/toml as github.com/!burnt!sushi/toml.
+func EscapeModulePath(path string) string {
+	var escaped strings.Builder
+	for _, r := range path {
+		if unicode.IsUpper(r) {
+			escaped.WriteByte('!')
+			r = unicode.ToLower(r)
+		}
+		escaped.WriteRune(r)
+	}
+	return escaped.String()
+}
@@ -0,0 +1,55 @@
+package docsource
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// GoPackageProfile is what comparing candidate packages looks at: a package's
+// metadata, how widely it's used and how big its API is.
+type GoPackageProfile struct {
+	GoPackageInfo
+	// First sentence of the package's documentation.
+	Synopsis string `json:"synopsis,omitempty"`
+	// Packages importing it known to pkg.go.dev, and packages it imports; -1 if the page doesn't show them.
+	ImportedBy int `json:"imported_by"`
+	Imports    int `json:"imports"`
+	// Exported functions, constructors included, types and methods.
+	Functions int `json:"functions"`
+	Types     int `json:"types"`
+	Methods   int `json:"methods"`
+}
+
+// GoProfile reads a package's profile from its pkg.go.dev page.
+func GoProfile(ctx context.Context, pkg string) (GoPackageProfile, error) {
+	doc, err := fetchDocument(ctx, fmt.Sprintf("https://pkg.go.dev/%s?tab=doc", pkg))
+	if err != nil {
+		return GoPackageProfile{}, err
+	}
+
+	profile := GoPackageProfile{
+		GoPackageInfo: goMetadata(ctx, pkg, doc),
+		ImportedBy:    headerCount(headerDetail(doc, "UnitHeader-importedby")),
+		Imports:       headerCount(headerDetail(doc, "UnitHeader-imports")),
+		Functions:     doc.Find(".Documentation-function, .Documentation-typeFunc").Length(),
+		Types:         doc.Find(".Documentation-type").Length(),
+		Methods:       doc.Find(".Documentation-typeMethod").Length(),
+	}
+	overview := strings.Join(strings.Fields(doc.Find(".Documentation-overview p").First().Text()), " ")
+	if end := strings.Index(overview, ". "); end >= 0 {
+		overview = overview[:end+1]
+	}
+	profile.Synopsis = overview
+	return profile, nil
+}
+
+// headerCount parses a count such as "1,234", or returns -1.
+func headerCount(value string) int {
+	count, err := strconv.Atoi(strings.ReplaceAll(value, ",", ""))
+	if err != nil {
+		return -1
+	}
+	return count
+}
@@ -0,0 +1,49 @@
+package docsource
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Search results from MDN included for one topic.
+const mdnResults = 5
+
+// MDNSource searches the MDN Web Docs for HTML, CSS, JavaScript and Web APIs.
+type MDNSource struct{}
+
+func (MDNSource) Name() string { return "mdn" }
+
+func (MDNSource) Fetch(ctx context.Context, topic string) (string, error) {
+	searchURL := "https://developer.mozilla.org/api/v1/search?locale=en-US&q=" + url.QueryEscape(topic)
+	body, err := fetch(ctx, searchURL)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	var results struct {
+		Documents []struct {
+			Title   string `json:"title"`
+			Summary string `json:"summary"`
+			URL     string `json:"mdn_url"`
+		} `json:"documents"`
+	}
+	if err := json.NewDecoder(body).Decode(&results); err != nil {
+		return "", fmt.Errorf("failed to parse MDN search results: %v", err)
+	}
+	if len(results.Documents) == 0 {
+		return "", fmt.Errorf("no MDN documentation found for %s", topic)
+	}
+
+	var text strings.Builder
+	for i, document := range results.Documents {
+		if i == mdnResults {
+			break
+		}
+		text.WriteString(fmt.Sprintf("## %s\nhttps://developer.mozilla.org%s\n\n%s\n\n", document.Title, document.URL, document.Summary))
+	}
+	return truncate(text.String(), searchURL), nil
+}
@@ -0,0 +1,37 @@
+package docsource
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// PythonSource reads standard library module documentation from docs.python.org.
+// Topics are module names like "asyncio" or "os.path", optionally prefixed with "python:".
+type PythonSource struct{}
+
+func (PythonSource) Name() string { return "python" }
+
+func (PythonSource) Fetch(ctx context.Context, topic string) (string, error) {
+	module := strings.TrimSpace(pythonTopic.ReplaceAllString(strings.TrimSpace(topic), ""))
+	module = strings.TrimSpace(strings.TrimPrefix(module, ":"))
+	if module == "" {
+		return "", fmt.Errorf("no Python module given")
+	}
+
+	docURL := fmt.Sprintf("https://docs.python.org/3/library/%s.html", module)
+	doc, err := fetchDocument(ctx, docURL)
+	if err != nil {
+		return "", err
+	}
+
+	body := doc.Find("div[role=main] section").First()
+	if body.Length() == 0 {
+		return "", fmt.Errorf("documentation section not found")
+	}
+
+	if id, ok := body.Attr("id"); ok {
+		docURL += "#" + id
+	}
+	return truncate(body.Text(), docURL), nil
+}
@@ -0,0 +1,46 @@
+package docsource
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// RustSource reads crate and module documentation from docs.rs, or from
+// doc.rust-lang.org for std, core and alloc. Topics are paths like "tokio::sync".
+type RustSource struct{}
+
+func (RustSource) Name() string { return "rust" }
+
+func (RustSource) Fetch(ctx context.Context, topic string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(topic), "::")
+	crate := parts[0]
+
+	var docURL string
+	switch crate {
+	case "std", "core", "alloc":
+		docURL = fmt.Sprintf("https://doc.rust-lang.org/%s/index.html", strings.Join(parts, "/"))
+	default:
+		docURL = fmt.Sprintf("https://docs.rs/%s/latest/%s/index.html", crate, strings.Join(parts, "/"))
+	}
+
+	doc, err := fetchDocument(ctx, docURL)
+	if err != nil {
+		return "", err
+	}
+
+	main := doc.Find("#main-content")
+	if main.Length() == 0 {
+		return "", fmt.Errorf("documentation section not found")
+	}
+
+	// The top-level docs, then the names of the items the module contains.
+	text := main.Find(".docblock").First().Text()
+	main.Find(".item-table .item-name").Each(func(i int, s *goquery.Selection) {
+		text += "\n- " + strings.TrimSpace(s.Text())
+	})
+
+	return truncate(text, docURL), nil
+}
@@ -0,0 +1,161 @@
+package docsource
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/kartikx/agent/netpolicy"
+)
+
+// Most characters of documentation returned for one topic.
+const maxDocLength = 20_000
+
+// ErrNotFound is returned for topics and symbols that have no documentation.
+var ErrNotFound = errors.New("not found")
+
+// Source fetches documentation for topics in one ecosystem.
+type Source interface {
+	// Name identifies the source, e.g. "go".
+	Name() string
+	// Fetch returns the documentation for topic, e.g. a package or module name.
+	Fetch(ctx context.Context, topic string) (string, error)
+}
+
+// Sources are all available sources, by name.
+var Sources = map[string]Source{
+	"go":     GoSource{},
+	"mdn":    MDNSource{},
+	"rust":   RustSource{},
+	"python": PythonSource{},
+}
+
+// Enabled returns the sources listed in DOC_SOURCES (e.g. "go,python"), or all of
+// them if it's unset. The first listed is the default for topics that don't
+// identify their ecosystem. Go documentation comes from the bundle at
+// DOC_BUNDLE first, if it's set.
+func Enabled() ([]Source, error) {
+	names := []string{"go", "mdn", "rust", "python"}
+	if value := os.Getenv("DOC_SOURCES"); value != "" {
+		names = strings.Split(value, ",")
+	}
+
+	var enabled []Source
+	for _, name := range names {
+		source, ok := Sources[strings.TrimSpace(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown documentation source in DOC_SOURCES: %s", name)
+		}
+		enabled = append(enabled, Bundled(source))
+	}
+	return enabled, nil
+}
+
+var (
+	rustPath    = regexp.MustCompile(`^[a-z_][a-z0-9_]*(::[A-Za-z_][A-Za-z0-9_]*)+$`)
+	webTopic    = regexp.MustCompile(`(?i)^(html|css|javascript|js|dom|web api|http header)\b|^<[a-z]+>$|^[A-Z][A-Za-z]+\.prototype\.`)
+	goPackage   = regexp.MustCompile(`^[a-z0-9.\-]+(/[A-Za-z0-9._\-]+)+$`)
+	pythonTopic = regexp.MustCompile(`(?i)^(python\b|py:)`)
+)
+
+// Detect picks the source for topic among enabled by its shape: "tokio::sync" is
+// Rust, "net/http" is Go, "CSS grid" is MDN and "python: asyncio" is Python.
+// Anything else goes to the first enabled source.
+func Detect(topic string, enabled []Source) Source {
+	guess := ""
+	switch {
+	case rustPath.MatchString(topic):
+		guess = "rust"
+	case goPackage.MatchString(topic):
+		guess = "go"
+	case webTopic.MatchString(topic):
+		guess = "mdn"
+	case pythonTopic.MatchString(topic):
+		guess = "python"
+	}
+
+	for _, source := range enabled {
+		if source.Name() == guess {
+			return source
+		}
+	}
+	return enabled[0]
+}
+
+// Pick returns the enabled source named name, or the one Detect picks for topic
+// if name is empty.
+func Pick(topic string, name string) (Source, error) {
+	enabled, err := Enabled()
+	if err != nil {
+		return nil, err
+	}
+	if name == "" {
+		return Detect(topic, enabled), nil
+	}
+	for _, source := range enabled {
+		if source.Name() == name {
+			return source, nil
+		}
+	}
+	return nil, fmt.Errorf("documentation source %s is not enabled", name)
+}
+
+// fetchDocument downloads and parses an HTML page.
+func fetchDocument(ctx context.Context, url string) (*goquery.Document, error) {
+	body, err := fetch(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	doc, err := goquery.NewDocumentFromReader(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse HTML: %v", err)
+	}
+	return doc, nil
+}
+
+// docHosts are the hosts the sources fetch documentation from.
+var docHosts = []string{"pkg.go.dev", "proxy.golang.org", "developer.mozilla.org", "docs.python.org", "doc.rust-lang.org", "docs.rs"}
+
+// client only connects to docHosts and the hosts in NETWORK_ALLOWED_HOSTS.
+func client(timeout time.Duration) *http.Client {
+	return netpolicy.FromEnv(docHosts...).Client(timeout)
+}
+
+func fetch(ctx context.Context, url string) (io.ReadCloser, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client(0).Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %v", url, err)
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, ErrNotFound)
+	}
+	if resp.StatusCode != 200 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s: status %d", url, resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
+// truncate cuts documentation to maxDocLength, noting where it came from.
+func truncate(text string, url string) string {
+	text = strings.TrimSpace(text)
+	if len(text) > maxDocLength {
+		text = text[:maxDocLength] + "\n\n[truncated]"
+	}
+	return fmt.Sprintf("Source: %s\n\n%s", url, text)
+}
@@ -0,0 +1,152 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/kartikx/agent/agent"
+	"github.com/kartikx/agent/providers"
+	"github.com/kartikx/agent/tools"
+)
+
+// LoadTrajectory reads a trajectory exported with the "json" format.
+func LoadTrajectory(path string) (agent.Trajectory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return agent.Trajectory{}, err
+	}
+	var trajectory agent.Trajectory
+	if err := json.Unmarshal(data, &trajectory); err != nil {
+		return agent.Trajectory{}, fmt.Errorf("invalid trajectory %s: %v", path, err)
+	}
+	return trajectory, nil
+}
+
+// Replay re-runs a recorded coder session: the user's messages are sent again to a
+// fresh agent working on an in-memory copy of the trajectory's workspace, with the
+// recorded assistant messages as the model's responses. It returns the trajectory
+// of the replay, to compare with CompareTrajectories.
+func Replay(ctx context.Context, recorded agent.Trajectory) (agent.Trajectory, error) {
+	responses, prompts, err := splitTrajectory(recorded)
+	if err != nil {
+		return agent.Trajectory{}, err
+	}
+
+	fsys := tools.NewMemFS(recorded.Workspace)
+	a := agent.NewEmbeddedAgent(providers.NewScripted(responses...), tools.NewCoderTools(fsys), "coder")
+	a.SetFS(fsys)
+	a.SetSessionStore(agent.NewSessionStore(0, ""))
+	a.SetChaos(nil)
+	a.SetClock(agent.NewFixedClock(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)))
+	defer a.Close()
+
+	go a.Run(ctx)
+	for _, prompt := range prompts {
+		if _, err := a.SendMessage(ctx, prompt); err != nil {
+			return agent.Trajectory{}, err
+		}
+	}
+	return a.Trajectory(), nil
+}
+
+// splitTrajectory returns the model responses and the user prompts of a trajectory.
+func splitTrajectory(trajectory agent.Trajectory) ([]*anthropic.Message, []string, error) {
+	var responses []*anthropic.Message
+	var prompts []string
+
+	for _, message := range trajectory.Messages {
+		if message.Role == anthropic.MessageParamRoleUser {
+			// Messages carrying tool results come from the agent, not the user.
+			if len(message.Content) > 0 && message.Content[0].OfText != nil {
+				prompts = append(prompts, message.Content[0].OfText.Text)
+			}
+			continue
+		}
+
+		data, err := json.Marshal(message)
+		if err != nil {
+			return nil, nil, err
+		}
+		response := &anthropic.Message{}
+		if err := json.Unmarshal(data, response); err != nil {
+			return nil, nil, err
+		}
+		response.StopReason = anthropic.StopReasonEndTurn
+		for _, block := range message.Content {
+			if block.OfToolUse != nil {
+				response.StopReason = anthropic.StopReasonToolUse
+			}
+		}
+		responses = append(responses, response)
+	}
+
+	if len(prompts) == 0 {
+		return nil, nil, fmt.Errorf("trajectory has no user messages")
+	}
+	return responses, prompts, nil
+}
+
+// CompareTrajectories describes how a replay differs from the recording in its tool
+// calls and final files; no differences means the agent behaved the same.
+func CompareTrajectories(recorded agent.Trajectory, replayed agent.Trajectory) []string {
+	var differences []string
+
+	for i := 0; i < max(len(recorded.ToolCalls), len(replayed.ToolCalls)); i++ {
+		switch {
+		case i >= len(replayed.ToolCalls):
+			differences = append(differences, fmt.Sprintf("tool call %d: expected %s, but the replay made no more calls", i+1, recorded.ToolCalls[i].Name))
+		case i >= len(recorded.ToolCalls):
+			differences = append(differences, fmt.Sprintf("tool call %d: unexpected %s %s", i+1, replayed.ToolCalls[i].Name, replayed.ToolCalls[i].Input))
+		default:
+			want, got := recorded.ToolCalls[i], replayed.ToolCalls[i]
+			if want.Name != got.Name || !equalJSON(want.Input, got.Input) {
+				differences = append(differences, fmt.Sprintf("tool call %d: expected %s %s, got %s %s", i+1, want.Name, want.Input, got.Name, got.Input))
+			} else if want.Error != got.Error {
+				differences = append(differences, fmt.Sprintf("tool call %d (%s): expected error=%t, got error=%t", i+1, want.Name, want.Error, got.Error))
+			}
+		}
+	}
+
+	paths := map[string]bool{}
+	for path := range recorded.Files {
+		paths[path] = true
+	}
+	for path := range replayed.Files {
+		paths[path] = true
+	}
+	sorted := []string{}
+	for path := range paths {
+		sorted = append(sorted, path)
+	}
+	sort.Strings(sorted)
+
+	for _, path := range sorted {
+		want, recordedOK := recorded.Files[path]
+		got, replayedOK := replayed.Files[path]
+		switch {
+		case !replayedOK:
+			differences = append(differences, fmt.Sprintf("%s: not changed by the replay", path))
+		case !recordedOK:
+			differences = append(differences, fmt.Sprintf("%s: unexpectedly changed by the replay", path))
+		case want != got:
+			differences = append(differences, fmt.Sprintf("%s: content differs:\n--- recorded\n%s\n--- replayed\n%s", path, want, got))
+		}
+	}
+	return differences
+}
+
+// equalJSON compares JSON values, ignoring formatting and key order.
+func equalJSON(a json.RawMessage, b json.RawMessage) bool {
+	var valueA, valueB any
+	if json.Unmarshal(a, &valueA) != nil || json.Unmarshal(b, &valueB) != nil {
+		return bytes.Equal(a, b)
+	}
+	return reflect.DeepEqual(valueA, valueB)
+}
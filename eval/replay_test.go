@@ -0,0 +1,34 @@
+package eval
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestTrajectories replays the sessions recorded in testdata/trajectories (exported
+// with "/export json") and fails when the agent's tool calls or final files change.
+func TestTrajectories(t *testing.T) {
+	paths, err := filepath.Glob("testdata/trajectories/*.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range paths {
+		t.Run(strings.TrimSuffix(filepath.Base(path), ".json"), func(t *testing.T) {
+			recorded, err := LoadTrajectory(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			replayed, err := Replay(context.Background(), recorded)
+			if err != nil {
+				t.Fatalf("replay failed: %v", err)
+			}
+			for _, difference := range CompareTrajectories(recorded, replayed) {
+				t.Error(difference)
+			}
+		})
+	}
+}
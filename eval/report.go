@@ -0,0 +1,92 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// Report is the outcome of an evaluation run, saved as JSON to compare later runs against.
+type Report struct {
+	Results []Result `json:"results"`
+}
+
+// Score is the mean score of the tasks.
+func (r Report) Score() float64 {
+	if len(r.Results) == 0 {
+		return 0
+	}
+	var total float64
+	for _, result := range r.Results {
+		total += result.Score()
+	}
+	return total / float64(len(r.Results))
+}
+
+func LoadReport(path string) (Report, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Report{}, err
+	}
+	var report Report
+	if err := json.Unmarshal(data, &report); err != nil {
+		return Report{}, fmt.Errorf("invalid report %s: %v", path, err)
+	}
+	return report, nil
+}
+
+func (r Report) Save(path string) error {
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// Write prints a score table, with the change per task when a baseline report is given,
+// followed by the failed assertions.
+func (r Report) Write(w io.Writer, baseline *Report) {
+	previous := map[string]Result{}
+	if baseline != nil {
+		for _, result := range baseline.Results {
+			previous[result.Task] = result
+		}
+	}
+
+	table := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(table, "TASK\tSCORE\tCHECKS\tTOOL CALLS\tDURATION\tCHANGE")
+	for _, result := range r.Results {
+		change := ""
+		if before, ok := previous[result.Task]; ok {
+			change = fmt.Sprintf("%+.0f%%", (result.Score()-before.Score())*100)
+		} else if baseline != nil {
+			change = "new"
+		}
+		fmt.Fprintf(table, "%s\t%.0f%%\t%d/%d\t%d\t%s\t%s\n", result.Task, result.Score()*100, result.Passed, result.Total, len(result.ToolCalls), result.Duration.Round(time.Millisecond), change)
+	}
+	table.Flush()
+
+	fmt.Fprintf(w, "\nOverall: %.1f%%", r.Score()*100)
+	if baseline != nil {
+		fmt.Fprintf(w, " (baseline %.1f%%, %+.1f%%)", baseline.Score()*100, (r.Score()-baseline.Score())*100)
+	}
+	fmt.Fprintln(w)
+
+	for _, result := range r.Results {
+		if result.Error != "" {
+			fmt.Fprintf(w, "\n%s: error: %s\n", result.Task, result.Error)
+		}
+		for _, check := range result.Checks {
+			if check.Passed {
+				continue
+			}
+			fmt.Fprintf(w, "\n%s: FAIL %s\n", result.Task, check.Assertion)
+			if check.Detail != "" {
+				fmt.Fprintf(w, "  %s\n", check.Detail)
+			}
+		}
+	}
+}
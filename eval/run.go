@@ -0,0 +1,199 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kartikx/agent/agent"
+	"github.com/kartikx/agent/providers"
+	"github.com/kartikx/agent/tools"
+)
+
+// Result is the outcome of one task.
+type Result struct {
+	Task      string        `json:"task"`
+	Passed    int           `json:"passed"`
+	Total     int           `json:"total"`
+	Checks    []Check       `json:"checks"`
+	ToolCalls []string      `json:"tool_calls"`
+	Reply     string        `json:"reply"`
+	Duration  time.Duration `json:"duration"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// Check is the outcome of one assertion.
+type Check struct {
+	Assertion string `json:"assertion"`
+	Passed    bool   `json:"passed"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// Score is the fraction of assertions that passed.
+func (r Result) Score() float64 {
+	if r.Total == 0 {
+		return 0
+	}
+	return float64(r.Passed) / float64(r.Total)
+}
+
+// Run gives the task's prompt to a fresh agent backed by provider, working in a
+// temporary copy of the task's workspace, and checks the assertions.
+func Run(ctx context.Context, task Task, provider providers.Provider) Result {
+	result := Result{Task: task.Name, Total: len(task.Assertions)}
+	start := time.Now()
+
+	dir, err := os.MkdirTemp("", "agent-eval-"+task.Name+"-")
+	if err != nil {
+		result.Error = err.Error()
+		return result
+	}
+	defer os.RemoveAll(dir)
+
+	if err := copyDir(filepath.Join(task.Dir, workspaceDir), dir); err != nil {
+		result.Error = fmt.Sprintf("copying workspace: %v", err)
+		return result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, task.timeout())
+	defer cancel()
+
+	a := newAgent(task, provider, dir)
+	defer a.Close()
+
+	// Events are published before the reply is written, so once SendMessage
+	// returns, whatever the collector hasn't seen is already buffered.
+	events := a.Events()
+	stop := make(chan struct{})
+	var collected sync.WaitGroup
+	collected.Add(1)
+	record := func(event agent.Event) {
+		if event.Type == agent.ToolCalled {
+			result.ToolCalls = append(result.ToolCalls, event.ToolName)
+		}
+	}
+	go func() {
+		defer collected.Done()
+		for {
+			select {
+			case event := <-events:
+				record(event)
+			case <-stop:
+				for {
+					select {
+					case event := <-events:
+						record(event)
+					default:
+						return
+					}
+				}
+			}
+		}
+	}()
+
+	go a.Run(ctx)
+	result.Reply, err = a.SendMessage(ctx, task.Prompt)
+	close(stop)
+	collected.Wait()
+	result.Duration = time.Since(start)
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	for _, assertion := range task.Assertions {
+		check := checkAssertion(ctx, assertion, dir, result)
+		if check.Passed {
+			result.Passed++
+		}
+		result.Checks = append(result.Checks, check)
+	}
+	return result
+}
+
+// newAgent creates the task's agent with its tools confined to dir.
+func newAgent(task Task, provider providers.Provider, dir string) *agent.Agent {
+	var a *agent.Agent
+	if task.Agent == "doc" {
+		a = agent.NewEmbeddedAgent(provider, tools.DocTools, "doc")
+		a.CiteSources()
+	} else {
+		a = agent.NewEmbeddedAgent(provider, tools.NewCoderTools(tools.OSFS{Root: dir}), "coder")
+		a.SetRunner(tools.LocalRunner(dir))
+	}
+
+	// Keep sessions from earlier runs out of the evaluation.
+	a.SetSessionStore(agent.NewSessionStore(0, ""))
+	return a
+}
+
+func checkAssertion(ctx context.Context, assertion Assertion, dir string, result Result) Check {
+	check := Check{Assertion: assertion.String()}
+
+	switch assertion.Type {
+	case "file_exists", "file_contains", "file_not_contains":
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(assertion.Path)))
+		if err != nil {
+			check.Passed = false
+			check.Detail = err.Error()
+			break
+		}
+		contains := strings.Contains(string(data), assertion.Text)
+		check.Passed = assertion.Type == "file_exists" ||
+			(assertion.Type == "file_contains" && contains) ||
+			(assertion.Type == "file_not_contains" && !contains)
+	case "reply_contains":
+		check.Passed = strings.Contains(result.Reply, assertion.Text)
+	case "tool_called":
+		for _, tool := range result.ToolCalls {
+			check.Passed = check.Passed || tool == assertion.Tool
+		}
+	case "command_succeeds":
+		cmd := exec.CommandContext(ctx, "sh", "-c", assertion.Command)
+		cmd.Dir = dir
+		output, err := cmd.CombinedOutput()
+		check.Passed = err == nil
+		if err != nil {
+			check.Detail = strings.TrimSpace(fmt.Sprintf("%v\n%s", err, output))
+		}
+	default:
+		check.Detail = fmt.Sprintf("unknown assertion type %q", assertion.Type)
+	}
+	return check
+}
+
+// copyDir copies the files under src into dst. A missing src leaves dst empty.
+func copyDir(src string, dst string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+
+	return filepath.WalkDir(src, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		relative, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, relative)
+
+		if entry.IsDir() {
+			return os.MkdirAll(target, 0755)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(target, data, info.Mode().Perm())
+	})
+}
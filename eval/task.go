@@ -0,0 +1,126 @@
+// Package eval runs agents against task fixtures and scores the outcome, so prompt
+// and tool changes can be compared objectively.
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kartikx/agent/providers"
+)
+
+// Files of a task fixture directory.
+const (
+	taskFile      = "task.json"
+	workspaceDir  = "workspace"
+	responsesFile = "responses.json"
+)
+
+// Task is one evaluation fixture: a prompt given to an agent in a fresh copy of a
+// workspace snapshot, and assertions about the outcome.
+type Task struct {
+	Name       string      `json:"-"`
+	Dir        string      `json:"-"`
+	Agent      string      `json:"agent,omitempty"` // coder (default) or doc
+	Prompt     string      `json:"prompt"`
+	Timeout    string      `json:"timeout,omitempty"` // e.g. "5m" (default 5m)
+	Assertions []Assertion `json:"assertions"`
+}
+
+// Assertion is one check made after the agent replied.
+type Assertion struct {
+	// file_exists, file_contains, file_not_contains, reply_contains, tool_called or command_succeeds
+	Type    string `json:"type"`
+	Path    string `json:"path,omitempty"`    // file_*: path relative to the workspace
+	Text    string `json:"text,omitempty"`    // *_contains: expected substring
+	Tool    string `json:"tool,omitempty"`    // tool_called: tool name
+	Command string `json:"command,omitempty"` // command_succeeds: shell command run in the workspace, e.g. "go test ./..."
+}
+
+func (a Assertion) String() string {
+	switch a.Type {
+	case "file_exists":
+		return fmt.Sprintf("%s exists", a.Path)
+	case "file_contains":
+		return fmt.Sprintf("%s contains %q", a.Path, a.Text)
+	case "file_not_contains":
+		return fmt.Sprintf("%s doesn't contain %q", a.Path, a.Text)
+	case "reply_contains":
+		return fmt.Sprintf("reply contains %q", a.Text)
+	case "tool_called":
+		return fmt.Sprintf("%s was called", a.Tool)
+	case "command_succeeds":
+		return fmt.Sprintf("`%s` succeeds", a.Command)
+	}
+	return a.Type
+}
+
+func (t Task) timeout() time.Duration {
+	if duration, err := time.ParseDuration(t.Timeout); err == nil && duration > 0 {
+		return duration
+	}
+	return 5 * time.Minute
+}
+
+// LoadTask reads the fixture in dir.
+func LoadTask(dir string) (Task, error) {
+	data, err := os.ReadFile(filepath.Join(dir, taskFile))
+	if err != nil {
+		return Task{}, err
+	}
+
+	task := Task{Name: filepath.Base(dir), Dir: dir}
+	if err := json.Unmarshal(data, &task); err != nil {
+		return Task{}, fmt.Errorf("invalid task %s: %v", dir, err)
+	}
+	if strings.TrimSpace(task.Prompt) == "" {
+		return Task{}, fmt.Errorf("task %s has no prompt", task.Name)
+	}
+	if task.Agent == "" {
+		task.Agent = "coder"
+	}
+	if task.Agent != "coder" && task.Agent != "doc" {
+		return Task{}, fmt.Errorf("task %s: unknown agent %q", task.Name, task.Agent)
+	}
+	if len(task.Assertions) == 0 {
+		return Task{}, fmt.Errorf("task %s has no assertions", task.Name)
+	}
+	return task, nil
+}
+
+// LoadTasks reads every fixture directory (one holding a task.json) directly under dir, by name.
+func LoadTasks(dir string) ([]Task, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var tasks []Task
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, entry.Name(), taskFile)); err != nil {
+			continue
+		}
+		task, err := LoadTask(filepath.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, task)
+	}
+
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Name < tasks[j].Name })
+	return tasks, nil
+}
+
+// ScriptedProvider replays the model responses recorded in the task's responses.json,
+// to run the task without calling the API.
+func (t Task) ScriptedProvider() (*providers.Scripted, error) {
+	return providers.LoadScripted(filepath.Join(t.Dir, responsesFile))
+}
@@ -0,0 +1,6 @@
+package greeting
+
+// Greet returns a greeting for name, e.g. "Hello, Gopher!".
+func Greet(name string) string {
+	return "Hello " + name
+}
@@ -0,0 +1,125 @@
+// Package locale holds the translations of the agent's user-facing messages and
+// tool descriptions. English is built into the code; a catalog replaces the
+// strings it has translations for, and the rest stay in English. Tool names and
+// input field names are never translated, so calls look the same in every locale.
+package locale
+
+import (
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+
+	"github.com/kartikx/agent/tools"
+)
+
+//go:embed catalogs/*.json
+var catalogs embed.FS
+
+// Locale names are language tags like es or pt-BR.
+var namePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// Catalog is the translation of the agent into one language, loaded from
+// catalogs/<locale>.json.
+type Catalog struct {
+	Locale string `json:"locale"`
+	// The language's English name, used to tell the model which language to reply in.
+	Language string `json:"language"`
+	// Messages by key, e.g. "request_failed". Messages taking arguments are
+	// fmt format strings, and must keep the English message's verbs in order.
+	Messages map[string]string `json:"messages"`
+	// Tool texts by tool name.
+	Tools map[string]ToolText `json:"tools"`
+}
+
+// ToolText is the translation of a tool's description and of its input fields'
+// descriptions, by field name.
+type ToolText struct {
+	Description string            `json:"description"`
+	Properties  map[string]string `json:"properties,omitempty"`
+}
+
+// Load returns the catalog for name, looking in dir first if it is set and then
+// in the catalogs built in. English needs no catalog, so "" and "en" return nil.
+func Load(name string, dir string) (*Catalog, error) {
+	if name == "" || name == "en" {
+		return nil, nil
+	}
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid locale %q, expected a language tag like es or pt-BR", name)
+	}
+
+	var data []byte
+	var err error = fs.ErrNotExist
+	if dir != "" {
+		data, err = os.ReadFile(filepath.Join(dir, name+".json"))
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		data, err = catalogs.ReadFile("catalogs/" + name + ".json")
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("no catalog for locale %q", name)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	catalog := &Catalog{}
+	if err := json.Unmarshal(data, catalog); err != nil {
+		return nil, fmt.Errorf("invalid catalog for locale %q: %v", name, err)
+	}
+	if catalog.Language == "" {
+		return nil, fmt.Errorf("catalog for locale %q doesn't name its language", name)
+	}
+	return catalog, nil
+}
+
+// Text returns the translation of the message key, or english if there is none.
+// A nil Catalog is English.
+func (c *Catalog) Text(key string, english string) string {
+	if c == nil {
+		return english
+	}
+	if text, ok := c.Messages[key]; ok && text != "" {
+		return text
+	}
+	return english
+}
+
+// Tool returns definition with its descriptions translated. The name, schema
+// constraints and examples are kept.
+func (c *Catalog) Tool(definition tools.ToolDefinition) tools.ToolDefinition {
+	if c == nil {
+		return definition
+	}
+	text, ok := c.Tools[definition.Name]
+	if !ok {
+		return definition
+	}
+
+	if text.Description != "" {
+		definition.Description = text.Description
+	}
+	if len(text.Properties) > 0 && definition.InputSchema.Properties != nil {
+		// Copied, since the schema is shared with the English definition.
+		data, err := json.Marshal(definition.InputSchema.Properties)
+		if err != nil {
+			return definition
+		}
+		var properties map[string]map[string]any
+		if err := json.Unmarshal(data, &properties); err != nil {
+			return definition
+		}
+		for name, description := range text.Properties {
+			if property, ok := properties[name]; ok {
+				property["description"] = description
+			}
+		}
+		definition.InputSchema.Properties = properties
+	}
+	return definition
+}
@@ -0,0 +1,156 @@
+// Package netpolicy decides which hosts tools may contact, so the model can't
+// send workspace contents to arbitrary endpoints.
+package netpolicy
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Policy allows requests to a list of hosts. Entries are host names
+// ("api.example.com"), wildcards matching subdomains ("*.example.com"), IP
+// addresses or CIDR ranges ("10.0.0.0/8").
+//
+// Names are checked again when connecting: a listed name may resolve to any
+// address except unspecified, multicast and link-local ones (e.g. the cloud
+// metadata endpoint 169.254.169.254), and only localhost may resolve to a
+// loopback address. Connections go to the address that was checked, so the
+// answer can't change between the check and the request.
+type Policy struct {
+	hosts []string
+}
+
+// New returns a Policy allowing hosts.
+func New(hosts ...string) *Policy {
+	p := &Policy{}
+	for _, host := range hosts {
+		if host = normalize(host); host != "" {
+			p.hosts = append(p.hosts, host)
+		}
+	}
+	return p
+}
+
+// FromEnv returns a Policy allowing hosts and the comma-separated hosts in
+// NETWORK_ALLOWED_HOSTS and, for compatibility, HTTP_TOOL_ALLOWED_HOSTS.
+func FromEnv(hosts ...string) *Policy {
+	hosts = append(hosts, strings.Split(os.Getenv("NETWORK_ALLOWED_HOSTS"), ",")...)
+	hosts = append(hosts, strings.Split(os.Getenv("HTTP_TOOL_ALLOWED_HOSTS"), ",")...)
+	return New(hosts...)
+}
+
+// Loopback are the hosts of the local machine.
+var Loopback = []string{"localhost", "127.0.0.0/8", "::1"}
+
+func normalize(host string) string {
+	return strings.TrimSuffix(strings.ToLower(strings.TrimSpace(host)), ".")
+}
+
+// Allows reports whether requests may be sent to host.
+func (p *Policy) Allows(host string) bool {
+	host = normalize(host)
+	ip := net.ParseIP(host)
+	for _, allowed := range p.hosts {
+		switch {
+		case allowed == host:
+			return true
+		case ip != nil:
+			if _, network, err := net.ParseCIDR(allowed); err == nil && network.Contains(ip) {
+				return true
+			}
+		case strings.HasPrefix(allowed, "*."):
+			if strings.HasSuffix(host, allowed[1:]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// CheckURL returns an error unless target is an HTTP(S) URL on an allowed host.
+func (p *Policy) CheckURL(target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", target.Scheme)
+	}
+	if !p.Allows(target.Hostname()) {
+		return fmt.Errorf("host %s is not allowed; allow it in NETWORK_ALLOWED_HOSTS", target.Hostname())
+	}
+	return nil
+}
+
+// checkAddress returns an error unless host may be reached at ip.
+func (p *Policy) checkAddress(host string, ip net.IP) error {
+	// Addresses listed themselves are always fine.
+	if p.Allows(ip.String()) {
+		return nil
+	}
+	switch {
+	case ip.IsUnspecified(), ip.IsMulticast(), ip.IsLinkLocalUnicast(), ip.IsLinkLocalMulticast():
+		return fmt.Errorf("host %s resolves to %s, which is not allowed", host, ip)
+	case ip.IsLoopback() && normalize(host) != "localhost":
+		return fmt.Errorf("host %s resolves to the loopback address %s, which is not allowed", host, ip)
+	}
+	return nil
+}
+
+// dial connects to an allowed host, at the first of its addresses that passes
+// checkAddress.
+func (p *Policy) dial(ctx context.Context, network string, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	if !p.Allows(host) {
+		return nil, fmt.Errorf("host %s is not allowed; allow it in NETWORK_ALLOWED_HOSTS", host)
+	}
+	ips, err := net.DefaultResolver.LookupIP(ctx, "ip", host)
+	if err != nil {
+		return nil, err
+	}
+
+	dialer := &net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second}
+	var firstErr error
+	for _, ip := range ips {
+		if err := p.checkAddress(host, ip); err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = fmt.Errorf("host %s has no addresses", host)
+	}
+	return nil, firstErr
+}
+
+// Client returns an HTTP client that only connects to allowed hosts, following
+// redirects only to them. A proxy from HTTPS_PROXY or HTTP_PROXY must be
+// allowed itself; the hosts requested through it are checked by name only.
+func (p *Policy) Client(timeout time.Duration) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = p.dial
+	return &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return fmt.Errorf("stopped after 10 redirects")
+			}
+			return p.CheckURL(req.URL)
+		},
+	}
+}
@@ -0,0 +1,142 @@
+package netpolicy
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestAllows(t *testing.T) {
+	policy := New("api.example.com", "*.example.org", "192.0.2.7", "10.0.0.0/8", "2001:db8::/32", " Mixed.Example.NET. ", "")
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"api.example.com", true},
+		{"API.Example.com.", true},
+		{"example.com", false},
+		{"other.example.com", false},
+		{"api.example.com.evil.test", false},
+		{"evilapi.example.com", false},
+
+		{"www.example.org", true},
+		{"a.b.example.org", true},
+		{"example.org", false},
+		{"evilexample.org", false},
+		{"example.org.evil.test", false},
+
+		{"mixed.example.net", true},
+		{"", false},
+
+		{"192.0.2.7", true},
+		{"192.0.2.70", false},
+		{"192.0.2.8", false},
+		{"10.1.2.3", true},
+		{"11.1.2.3", false},
+		{"10.evil.test", false},
+		{"2001:db8::1", true},
+		{"2001:db9::1", false},
+	}
+	for _, test := range tests {
+		if got := policy.Allows(test.host); got != test.want {
+			t.Errorf("Allows(%q) = %v, want %v", test.host, got, test.want)
+		}
+	}
+}
+
+func TestCheckURL(t *testing.T) {
+	policy := New("example.com", "::1")
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://example.com/path", true},
+		{"http://example.com:8080", true},
+		{"http://[::1]:8080", true},
+		{"https://user@evil.test/?example.com", false},
+		{"https://example.com.evil.test", false},
+		{"ftp://example.com", false},
+		{"file:///etc/passwd", false},
+	}
+	for _, test := range tests {
+		target, err := url.Parse(test.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := policy.CheckURL(target); (err == nil) != test.allowed {
+			t.Errorf("CheckURL(%q) = %v, want allowed %v", test.url, err, test.allowed)
+		}
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		hosts   []string
+		host    string
+		ip      string
+		allowed bool
+	}{
+		{[]string{"example.com"}, "example.com", "93.184.216.34", true},
+		{[]string{"example.com"}, "example.com", "127.0.0.1", false},
+		{[]string{"example.com"}, "example.com", "::1", false},
+		{[]string{"example.com"}, "example.com", "169.254.169.254", false},
+		{[]string{"example.com"}, "example.com", "0.0.0.0", false},
+		{[]string{"example.com"}, "example.com", "224.0.0.1", false},
+		{[]string{"example.com"}, "example.com", "fe80::1", false},
+		{[]string{"localhost"}, "localhost", "127.0.0.1", true},
+		{[]string{"localhost"}, "LocalHost.", "::1", true},
+		{[]string{"localhost"}, "localhost", "169.254.169.254", false},
+		{[]string{"metadata.internal", "169.254.169.254"}, "metadata.internal", "169.254.169.254", true},
+		{[]string{"example.com", "127.0.0.0/8"}, "example.com", "127.0.0.1", true},
+	}
+	for _, test := range tests {
+		err := New(test.hosts...).checkAddress(test.host, net.ParseIP(test.ip))
+		if (err == nil) != test.allowed {
+			t.Errorf("%v: checkAddress(%q, %s) = %v, want allowed %v", test.hosts, test.host, test.ip, err, test.allowed)
+		}
+	}
+}
+
+// TestClientRedirects checks redirects are followed only to allowed hosts.
+func TestClientRedirects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/done" {
+			w.Write([]byte("done"))
+			return
+		}
+		http.Redirect(w, r, r.URL.Query().Get("to"), http.StatusFound)
+	}))
+	defer server.Close()
+	client := New("127.0.0.1").Client(0)
+
+	tests := []struct {
+		name    string
+		to      string
+		allowed bool
+	}{
+		{"same host", server.URL + "/done", true},
+		{"relative", "/done", true},
+		{"other host", "http://evil.test/done", false},
+		{"metadata", "http://169.254.169.254/latest/meta-data/", false},
+		{"loopback name", "http://localhost/done", false},
+		{"scheme", "file:///etc/passwd", false},
+		{"chain", server.URL + "/?to=http://evil.test/", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			response, err := client.Get(server.URL + "/?to=" + url.QueryEscape(test.to))
+			if err == nil {
+				response.Body.Close()
+			}
+			if (err == nil) != test.allowed {
+				t.Errorf("following a redirect to %s: %v, want allowed %v", test.to, err, test.allowed)
+			}
+		})
+	}
+
+	if _, err := client.Get(server.URL + "/?to=" + url.QueryEscape("/?to=/")); err == nil {
+		t.Error("a redirect loop was followed forever")
+	}
+}
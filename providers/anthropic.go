@@ -0,0 +1,87 @@
+// Package providers connects agents to the LLMs that drive them.
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/anthropics/anthropic-sdk-go/option"
+)
+
+// Provider sends a conversation to an LLM and returns its reply.
+type Provider interface {
+	NewMessage(ctx context.Context, params anthropic.MessageNewParams) (*anthropic.Message, error)
+}
+
+// Seeded is implemented by providers that can sample reproducibly from a seed.
+// The Anthropic API takes no seed, so Anthropic doesn't implement it.
+type Seeded interface {
+	SetSeed(seed int64)
+}
+
+// Anthropic is the Provider backed by the Anthropic Messages API.
+type Anthropic struct {
+	client *anthropic.Client
+	// Key sent with each request, if set; otherwise the client's.
+	keys KeySource
+}
+
+func NewAnthropic(client *anthropic.Client) *Anthropic {
+	return &Anthropic{client: client}
+}
+
+// NewAnthropicWithKeys returns a Provider asking keys for the API key of every
+// request, so a rotated key is used without restarting.
+func NewAnthropicWithKeys(client *anthropic.Client, keys KeySource) *Anthropic {
+	return &Anthropic{client: client, keys: keys}
+}
+
+func (p *Anthropic) NewMessage(ctx context.Context, params anthropic.MessageNewParams) (*anthropic.Message, error) {
+	if p.keys == nil {
+		return p.client.Messages.New(ctx, params)
+	}
+	key, err := p.keys(false)
+	if err != nil {
+		return nil, fmt.Errorf("no API key: %w", err)
+	}
+	response, err := p.client.Messages.New(ctx, params, option.WithAPIKey(key))
+
+	// A rejected key may have been rotated since it was read.
+	var apiErr *anthropic.Error
+	if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusUnauthorized {
+		if fresh, refreshErr := p.keys(true); refreshErr == nil && fresh != key {
+			fmt.Println("🔑 The API key was rotated, retrying with the new one")
+			return p.client.Messages.New(ctx, params, option.WithAPIKey(fresh))
+		}
+	}
+	return response, err
+}
+
+// USD per million tokens.
+type modelPricing struct {
+	Input  float64
+	Output float64
+}
+
+var pricing = map[anthropic.Model]modelPricing{
+	anthropic.ModelClaudeSonnet4_20250514:  {Input: 3, Output: 15},
+	anthropic.ModelClaude3_5Haiku20241022:  {Input: 0.8, Output: 4},
+	anthropic.ModelClaudeOpus4_20250514:    {Input: 15, Output: 75},
+	anthropic.ModelClaude3_7Sonnet20250219: {Input: 3, Output: 15},
+	anthropic.ModelClaude3_5Sonnet20241022: {Input: 3, Output: 15},
+	anthropic.ModelClaude_3_Haiku_20240307: {Input: 0.25, Output: 1.25},
+}
+
+// Cost returns the price in USD of a response, falling back to Sonnet pricing for unknown models.
+func Cost(model anthropic.Model, usage anthropic.Usage) float64 {
+	price, ok := pricing[model]
+	if !ok {
+		price = pricing[anthropic.ModelClaudeSonnet4_20250514]
+	}
+
+	inputTokens := usage.InputTokens + usage.CacheCreationInputTokens + usage.CacheReadInputTokens
+	return (float64(inputTokens)*price.Input + float64(usage.OutputTokens)*price.Output) / 1_000_000
+}
@@ -0,0 +1,322 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long a key from a keychain or command is used before it's read again.
+const credentialRefreshInterval = 5 * time.Minute
+
+// How long a keychain or command may take to print a key, e.g. while a keychain
+// prompt nobody answers blocks it; every model request waits meanwhile.
+const credentialFetchTimeout = 30 * time.Second
+
+// KeySource returns the current API key. refresh makes it read the key again
+// even if it doesn't look rotated, e.g. after the API rejected it.
+type KeySource func(refresh bool) (string, error)
+
+// CredentialConfig says where a credential's API key comes from; exactly one
+// of File, Keychain, Command and Env is set.
+type CredentialConfig struct {
+	// File holding the key, e.g. a mounted secret. It's read again when it changes.
+	File string `json:"file,omitempty"`
+	// Item of the OS keychain: the macOS keychain, or the Secret Service on
+	// Linux through secret-tool.
+	Keychain KeychainItem `json:"keychain,omitempty"`
+	// Shell command printing the key, e.g. a secrets manager's CLI.
+	Command string `json:"command,omitempty"`
+	// Environment variable holding the key.
+	Env string `json:"env,omitempty"`
+}
+
+type KeychainItem struct {
+	Service string `json:"service"`
+	Account string `json:"account,omitempty"`
+}
+
+// credentialsFile is the format of CREDENTIALS_FILE.
+type credentialsFile struct {
+	Credentials map[string]CredentialConfig `json:"credentials"`
+	// Credential used by agents not listed in Agents.
+	Default string `json:"default,omitempty"`
+	// Credential by agent, e.g. {"doc": "docs-team"}.
+	Agents map[string]string `json:"agents,omitempty"`
+}
+
+// Credentials are named API keys read from a file like
+//
+//	{"credentials": {"prod": {"file": "/run/secrets/anthropic"}, "dev": {"keychain": {"service": "anthropic"}}},
+//	 "default": "prod", "agents": {"doc": "dev"}}
+//
+// The file is read again when it changes, so a credential can be switched or
+// added without restarting.
+type Credentials struct {
+	path string
+
+	mu      sync.Mutex
+	version string
+	file    credentialsFile
+	// Keys read so far, by credential name; replaced when the config changes.
+	keys map[string]*credential
+}
+
+// LoadCredentials reads a credentials file.
+func LoadCredentials(path string) (*Credentials, error) {
+	c := &Credentials{path: path}
+	if err := c.reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// reload reads the file again if it changed. c.mu must be held, or c unshared.
+func (c *Credentials) reload() error {
+	info, err := os.Stat(c.path)
+	if err != nil {
+		return err
+	}
+	version := fmt.Sprintf("%d %d", info.Size(), info.ModTime().UnixNano())
+	if version == c.version {
+		return nil
+	}
+	// A broken file is reported once, not on every request.
+	c.version = version
+
+	data, err := os.ReadFile(c.path)
+	if err != nil {
+		return err
+	}
+	var file credentialsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return fmt.Errorf("invalid credentials file %s: %v", c.path, err)
+	}
+	if len(file.Credentials) == 0 {
+		return fmt.Errorf("credentials file %s has no credentials", c.path)
+	}
+	for name, config := range file.Credentials {
+		if err := config.validate(); err != nil {
+			return fmt.Errorf("credential %s: %v", name, err)
+		}
+	}
+	for agent, name := range file.Agents {
+		if _, ok := file.Credentials[name]; !ok {
+			return fmt.Errorf("agent %s uses credential %s, which isn't defined", agent, name)
+		}
+	}
+	if _, ok := file.Credentials[file.Default]; file.Default != "" && !ok {
+		return fmt.Errorf("default credential %s isn't defined", file.Default)
+	}
+
+	keys := map[string]*credential{}
+	for name, config := range file.Credentials {
+		// Unchanged credentials keep the key they read.
+		if current, ok := c.keys[name]; ok && current.config == config {
+			keys[name] = current
+			continue
+		}
+		keys[name] = &credential{config: config}
+	}
+	c.version, c.file, c.keys = version, file, keys
+	return nil
+}
+
+func (config CredentialConfig) validate() error {
+	sources := 0
+	for _, set := range []bool{config.File != "", config.Keychain != (KeychainItem{}), config.Command != "", config.Env != ""} {
+		if set {
+			sources++
+		}
+	}
+	if sources != 1 {
+		return errors.New("set exactly one of file, keychain, command and env")
+	}
+	if config.Keychain != (KeychainItem{}) && config.Keychain.Service == "" {
+		return errors.New("keychain needs a service")
+	}
+	return nil
+}
+
+// Name returns the credential agent uses: the one named by ANTHROPIC_CREDENTIAL,
+// the agent's own, the default, or the only one there is.
+func (c *Credentials) Name(agent string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.name(agent)
+}
+
+func (c *Credentials) name(agent string) (string, error) {
+	if name := os.Getenv("ANTHROPIC_CREDENTIAL"); name != "" {
+		if _, ok := c.file.Credentials[name]; !ok {
+			return "", fmt.Errorf("ANTHROPIC_CREDENTIAL names %s, which isn't in %s", name, c.path)
+		}
+		return name, nil
+	}
+	if name, ok := c.file.Agents[agent]; ok {
+		return name, nil
+	}
+	if c.file.Default != "" {
+		return c.file.Default, nil
+	}
+	if len(c.file.Credentials) == 1 {
+		for name := range c.file.Credentials {
+			return name, nil
+		}
+	}
+	names := make([]string, 0, len(c.file.Credentials))
+	for name := range c.file.Credentials {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return "", fmt.Errorf("no credential for agent %s: set a default or ANTHROPIC_CREDENTIAL to one of %s", agent, strings.Join(names, ", "))
+}
+
+// Source returns the keys of the credential agent uses, following changes to
+// the file and rotations of the key.
+func (c *Credentials) Source(agent string) KeySource {
+	return func(refresh bool) (string, error) {
+		c.mu.Lock()
+		if err := c.reload(); err != nil {
+			// A broken edit shouldn't take the agent down; the last good config stays.
+			fmt.Printf("Failed to reload credentials, keeping the current ones: %v\n", err)
+		}
+		name, err := c.name(agent)
+		current := c.keys[name]
+		c.mu.Unlock()
+		if err != nil {
+			return "", err
+		}
+		key, err := current.key(refresh)
+		if err != nil {
+			return "", fmt.Errorf("credential %s: %v", name, err)
+		}
+		return key, nil
+	}
+}
+
+// credential caches the key of one credential.
+type credential struct {
+	config CredentialConfig
+
+	mu      sync.Mutex
+	value   string
+	version string // of the key file it was read from
+	fetched time.Time
+}
+
+func (c *credential) key(refresh bool) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	switch {
+	case c.config.Env != "":
+		value := os.Getenv(c.config.Env)
+		if value == "" {
+			return "", fmt.Errorf("%s is not set", c.config.Env)
+		}
+		return value, nil
+
+	case c.config.File != "":
+		info, err := os.Stat(c.config.File)
+		if err != nil {
+			return "", err
+		}
+		version := fmt.Sprintf("%d %d", info.Size(), info.ModTime().UnixNano())
+		if refresh || version != c.version || c.value == "" {
+			data, err := os.ReadFile(c.config.File)
+			if err != nil {
+				return "", err
+			}
+			c.value, c.version = strings.TrimSpace(string(data)), version
+		}
+
+	default:
+		if refresh || c.value == "" || time.Since(c.fetched) > credentialRefreshInterval {
+			value, err := c.config.fetch()
+			if err != nil {
+				// Keep using the last key if there is one; the API says if it stopped working.
+				if c.value != "" && !refresh {
+					fmt.Printf("Failed to refresh an API key, keeping the current one: %v\n", err)
+					return c.value, nil
+				}
+				return "", err
+			}
+			c.value, c.fetched = value, time.Now()
+		}
+	}
+	if c.value == "" {
+		return "", errors.New("the key is empty")
+	}
+	return c.value, nil
+}
+
+// fetch reads a key from the keychain or a command, within credentialFetchTimeout.
+func (config CredentialConfig) fetch() (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), credentialFetchTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	switch {
+	case config.Command != "":
+		cmd = exec.CommandContext(ctx, "sh", "-c", config.Command)
+	case runtime.GOOS == "darwin":
+		args := []string{"find-generic-password", "-s", config.Keychain.Service, "-w"}
+		if config.Keychain.Account != "" {
+			args = append(args, "-a", config.Keychain.Account)
+		}
+		cmd = exec.CommandContext(ctx, "security", args...)
+	case runtime.GOOS == "linux":
+		args := []string{"lookup", "service", config.Keychain.Service}
+		if config.Keychain.Account != "" {
+			args = append(args, "account", config.Keychain.Account)
+		}
+		cmd = exec.CommandContext(ctx, "secret-tool", args...)
+	default:
+		return "", fmt.Errorf("keychains aren't supported on %s", runtime.GOOS)
+	}
+
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	// Don't wait forever for processes the command left running.
+	cmd.WaitDelay = 5 * time.Second
+	output, err := cmd.Output()
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("%s timed out after %s", cmd.Args[0], credentialFetchTimeout)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%s failed: %v %s", cmd.Args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// KeySourceFromEnv returns where agent's API key comes from: the credential
+// CREDENTIALS_FILE assigns it, the file ANTHROPIC_API_KEY_FILE, or else
+// ANTHROPIC_API_KEY. The key is read once to check it's there.
+func KeySourceFromEnv(agent string) (KeySource, error) {
+	var keys KeySource
+	switch {
+	case os.Getenv("CREDENTIALS_FILE") != "":
+		credentials, err := LoadCredentials(os.Getenv("CREDENTIALS_FILE"))
+		if err != nil {
+			return nil, err
+		}
+		keys = credentials.Source(agent)
+	case os.Getenv("ANTHROPIC_API_KEY_FILE") != "":
+		keys = (&credential{config: CredentialConfig{File: os.Getenv("ANTHROPIC_API_KEY_FILE")}}).key
+	default:
+		keys = (&credential{config: CredentialConfig{Env: "ANTHROPIC_API_KEY"}}).key
+	}
+	if _, err := keys(false); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
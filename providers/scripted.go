@@ -0,0 +1,57 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// Scripted is a Provider replaying canned responses in order, for evals and
+// replays that must not call the API.
+type Scripted struct {
+	mu        sync.Mutex
+	responses []*anthropic.Message
+	requests  []anthropic.MessageNewParams
+}
+
+func NewScripted(responses ...*anthropic.Message) *Scripted {
+	return &Scripted{responses: responses}
+}
+
+// LoadScripted reads responses from a JSON array of Messages API responses, e.g.
+// [{"role": "assistant", "content": [{"type": "text", "text": "Done."}], "stop_reason": "end_turn"}]
+func LoadScripted(path string) (*Scripted, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var responses []*anthropic.Message
+	if err := json.Unmarshal(data, &responses); err != nil {
+		return nil, fmt.Errorf("invalid scripted responses in %s: %v", path, err)
+	}
+	return NewScripted(responses...), nil
+}
+
+func (p *Scripted) NewMessage(ctx context.Context, params anthropic.MessageNewParams) (*anthropic.Message, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.requests = append(p.requests, params)
+	if len(p.requests) > len(p.responses) {
+		return nil, fmt.Errorf("scripted provider has no response for request %d", len(p.requests))
+	}
+	return p.responses[len(p.requests)-1], nil
+}
+
+// Requests returns the requests made so far.
+func (p *Scripted) Requests() []anthropic.MessageNewParams {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return append([]anthropic.MessageNewParams{}, p.requests...)
+}
@@ -1,33 +0,0 @@
-package main
-
-import (
-	"encoding/json"
-
-	"github.com/anthropics/anthropic-sdk-go"
-	"github.com/invopop/jsonschema"
-)
-
-// Anthropic Tool Definition.
-type ToolDefinition struct {
-	Name        string                         `json:"name"`
-	Description string                         `json:"description"`
-	InputSchema anthropic.ToolInputSchemaParam `json:"input_schema"`
-	Function    func(input json.RawMessage) (string, error) `json:"-"`
-}
-
-// Generates InputSchema for a given tool handler function.
-func GenerateSchema[T any]() anthropic.ToolInputSchemaParam {
-	var reflector = jsonschema.Reflector{
-		AllowAdditionalProperties: false,
-		DoNotReference:            true,
-	}
-
-	var v T
-
-	schema := reflector.Reflect(v)
-
-	return anthropic.ToolInputSchemaParam{
-		Properties: schema.Properties,
-	}
-}
-
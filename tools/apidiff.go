@@ -0,0 +1,550 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/build/constraint"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/kartikx/agent/docsource"
+	"github.com/kartikx/agent/netpolicy"
+)
+
+// Largest module zip read, as the module proxy allows.
+const maxModuleZip = 500 << 20
+
+// Most changed symbols listed per kind of change; the rest are counted.
+const maxAPIChanges = 100
+
+// Platform whose files are compared when a package has per-platform files.
+var apiDiffTags = map[string]bool{"linux": true, "amd64": true, "unix": true, "gc": true, "cgo": true}
+
+// APIDiff tool for checking what a dependency upgrade changes
+type APIDiffInput struct {
+	Module   string   `json:"module" jsonschema:"minLength=1" jsonschema_description:"Module path, e.g. github.com/go-chi/chi/v5"`
+	From     string   `json:"from" jsonschema:"minLength=1" jsonschema_description:"The version upgraded from, e.g. v5.0.0"`
+	To       string   `json:"to,omitempty" jsonschema_description:"The version upgraded to. Defaults to the latest."`
+	ToModule string   `json:"to_module,omitempty" jsonschema_description:"Module path of the new version when it's a new major version with its own path, e.g. github.com/go-chi/chi/v6. Defaults to module."`
+	Packages []string `json:"packages,omitempty" jsonschema_description:"Only compare these packages, e.g. the ones the project imports. Defaults to all of the module's packages."`
+}
+
+var APIDiffInputSchema = GenerateSchema[APIDiffInput]()
+
+var APIDiffDefinition = ToolDefinition{
+	Name:        "api_diff",
+	Description: "Compare the exported API of two versions of a Go module: the functions, methods, types, struct fields, interface methods, constants and variables removed, changed and added in each package. Use this before upgrading a dependency, to find the code the upgrade breaks; removed and changed symbols the project uses need updating.",
+	InputSchema: APIDiffInputSchema,
+	Function:    APIDiff,
+	Category:    CategoryRead,
+	Untrusted:   true,
+	Network:     true,
+	Examples: []ToolExample{
+		{Input: `{"module": "github.com/gin-gonic/gin", "from": "v1.9.1", "to": "v1.10.0"}`, Output: "github.com/gin-gonic/gin v1.9.1 to v1.10.0: 0 removed, 3 changed, 17 added (incompatible)\n\ngithub.com/gin-gonic/gin\n  Changed:\n    ~ func New(opts ...OptionFunc) *Engine\n      was: func New() *Engine\n...\n  Added:\n    + func (*Engine) With(opts ...OptionFunc) *Engine\n..."},
+	},
+}
+
+func APIDiff(ctx context.Context, input json.RawMessage) (string, error) {
+	diffInput := APIDiffInput{}
+	if err := json.Unmarshal(input, &diffInput); err != nil {
+		return "", err
+	}
+	if diffInput.ToModule == "" {
+		diffInput.ToModule = diffInput.Module
+	}
+	if diffInput.To == "" || diffInput.To == "latest" {
+		latest, err := latestModuleVersion(ctx, diffInput.ToModule)
+		if err != nil {
+			return "", err
+		}
+		diffInput.To = latest
+	}
+
+	before, err := moduleAPI(ctx, diffInput.Module, diffInput.From)
+	if err != nil {
+		return "", err
+	}
+	after, err := moduleAPI(ctx, diffInput.ToModule, diffInput.To)
+	if err != nil {
+		return "", err
+	}
+
+	// Packages of a new major version are compared with the same packages of the old.
+	oldPath := func(pkg string) string {
+		if rest, ok := strings.CutPrefix(pkg, diffInput.ToModule); ok && (rest == "" || strings.HasPrefix(rest, "/")) {
+			return diffInput.Module + rest
+		}
+		return pkg
+	}
+	renamed := map[string]map[string]apiSymbol{}
+	for pkg, api := range after {
+		renamed[oldPath(pkg)] = api
+	}
+	after = renamed
+
+	if len(diffInput.Packages) > 0 {
+		wanted := map[string]bool{}
+		for _, pkg := range diffInput.Packages {
+			wanted[oldPath(pkg)] = true
+		}
+		for pkg := range before {
+			if !wanted[pkg] {
+				delete(before, pkg)
+			}
+		}
+		for pkg := range after {
+			if !wanted[pkg] {
+				delete(after, pkg)
+			}
+		}
+		if len(before) == 0 && len(after) == 0 {
+			return "", fmt.Errorf("neither version has the packages %s", strings.Join(diffInput.Packages, ", "))
+		}
+	}
+
+	return formatAPIDiff(diffInput, before, after), nil
+}
+
+// formatAPIDiff summarizes the changes, then lists them per package.
+func formatAPIDiff(diffInput APIDiffInput, before, after map[string]map[string]apiSymbol) string {
+	packages := map[string]bool{}
+	for pkg := range before {
+		packages[pkg] = true
+	}
+	for pkg := range after {
+		packages[pkg] = true
+	}
+	sorted := make([]string, 0, len(packages))
+	for pkg := range packages {
+		sorted = append(sorted, pkg)
+	}
+	sort.Strings(sorted)
+
+	var body strings.Builder
+	var removedPackages, addedPackages []string
+	removed, changed, added := 0, 0, 0
+	for _, pkg := range sorted {
+		old, hadOld := before[pkg]
+		current, hasNew := after[pkg]
+		switch {
+		case !hasNew:
+			removedPackages = append(removedPackages, pkg)
+			removed += len(old)
+			continue
+		case !hadOld:
+			addedPackages = append(addedPackages, pkg)
+			added += len(current)
+			continue
+		}
+
+		var removals, changes, additions []string
+		for _, key := range sortedKeys(old) {
+			if symbol, ok := current[key]; !ok {
+				removals = append(removals, "    - "+old[key].declaration)
+			} else if symbol.compared != old[key].compared && !symbol.untyped && !old[key].untyped {
+				changes = append(changes, fmt.Sprintf("    ~ %s\n      was: %s", symbol.declaration, old[key].declaration))
+			}
+		}
+		for _, key := range sortedKeys(current) {
+			if _, ok := old[key]; !ok {
+				additions = append(additions, "    + "+current[key].declaration)
+			}
+		}
+		removed += len(removals)
+		changed += len(changes)
+		added += len(additions)
+		if len(removals)+len(changes)+len(additions) == 0 {
+			continue
+		}
+
+		fmt.Fprintf(&body, "\n%s\n", pkg)
+		for _, section := range []struct {
+			title string
+			lines []string
+		}{{"Removed", removals}, {"Changed", changes}, {"Added", additions}} {
+			if len(section.lines) == 0 {
+				continue
+			}
+			fmt.Fprintf(&body, "  %s:\n", section.title)
+			shown := section.lines
+			if len(shown) > maxAPIChanges {
+				shown = shown[:maxAPIChanges]
+			}
+			body.WriteString(strings.Join(shown, "\n") + "\n")
+			if len(section.lines) > len(shown) {
+				fmt.Fprintf(&body, "    ... and %d more\n", len(section.lines)-len(shown))
+			}
+		}
+	}
+	if len(removedPackages) > 0 {
+		fmt.Fprintf(&body, "\nPackages removed:\n- %s\n", strings.Join(removedPackages, "\n- "))
+	}
+	if len(addedPackages) > 0 {
+		fmt.Fprintf(&body, "\nPackages added:\n- %s\n", strings.Join(addedPackages, "\n- "))
+	}
+
+	to := diffInput.To
+	if diffInput.ToModule != diffInput.Module {
+		to = diffInput.ToModule + "@" + diffInput.To
+	}
+	summary := fmt.Sprintf("%s %s to %s: %d removed, %d changed, %d added", diffInput.Module, diffInput.From, to, removed, changed, added)
+	switch {
+	case removed+changed > 0:
+		summary += " (incompatible)"
+	case added == 0:
+		return summary + ". The exported API is the same."
+	default:
+		summary += " (compatible)"
+	}
+	return summary + "\n" + strings.TrimSuffix(body.String(), "\n")
+}
+
+func sortedKeys(api map[string]apiSymbol) []string {
+	keys := make([]string, 0, len(api))
+	for key := range api {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// apiSymbol is one exported declaration of a package.
+type apiSymbol struct {
+	declaration string
+	// The declaration as compared: without parameter names, which callers don't depend on.
+	compared string
+	// Variables declared without a type have one that's unknown without type-checking.
+	untyped bool
+}
+
+// moduleAPI returns the exported declarations of each importable package of a
+// module version, by package path and then by symbol.
+func moduleAPI(ctx context.Context, module string, version string) (map[string]map[string]apiSymbol, error) {
+	data, err := moduleZip(ctx, module, version)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid zip of %s@%s: %v", module, version, err)
+	}
+
+	prefix := module + "@" + version + "/"
+	// Directories of nested modules, whose packages aren't part of this one.
+	var nested []string
+	for _, file := range archive.File {
+		if dir := path.Dir(strings.TrimPrefix(file.Name, prefix)); path.Base(file.Name) == "go.mod" && dir != "." {
+			nested = append(nested, dir+"/")
+		}
+	}
+
+	fset := token.NewFileSet()
+	packages := map[string]map[string]apiSymbol{}
+	for _, file := range archive.File {
+		name := strings.TrimPrefix(file.Name, prefix)
+		if !apiFile(name, nested) {
+			continue
+		}
+		reader, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		source, err := io.ReadAll(reader)
+		reader.Close()
+		if err != nil {
+			return nil, err
+		}
+		parsed, err := parser.ParseFile(fset, name, source, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil || parsed.Name.Name == "main" || !matchesBuildTags(parsed) {
+			continue
+		}
+
+		pkg := module
+		if dir := path.Dir(name); dir != "." {
+			pkg = module + "/" + dir
+		}
+		if packages[pkg] == nil {
+			packages[pkg] = map[string]apiSymbol{}
+		}
+		symbols := exportedAPI(fset, parsed)
+		stripParamNames(parsed)
+		for key, unnamed := range exportedAPI(fset, parsed) {
+			symbol := symbols[key]
+			// any is interface{} by another name.
+			symbol.compared = strings.ReplaceAll(unnamed.declaration, "interface{}", "any")
+			packages[pkg][key] = symbol
+		}
+	}
+	return packages, nil
+}
+
+// apiFile reports whether a file in a module zip is a Go file of an importable
+// package, for the platform in apiDiffTags.
+func apiFile(name string, nested []string) bool {
+	if !strings.HasSuffix(name, ".go") || strings.HasSuffix(name, "_test.go") {
+		return false
+	}
+	for _, dir := range nested {
+		if strings.HasPrefix(name, dir) {
+			return false
+		}
+	}
+	for _, element := range strings.Split(path.Dir(name), "/") {
+		if element == "." {
+			continue
+		}
+		if element == "internal" || element == "testdata" || element == "vendor" || strings.HasPrefix(element, ".") || strings.HasPrefix(element, "_") {
+			return false
+		}
+	}
+	// Files named like name_windows.go or name_linux_arm64.go only build there.
+	parts := strings.Split(strings.TrimSuffix(path.Base(name), ".go"), "_")
+	for _, part := range parts[1:] {
+		if knownPlatform[part] && !apiDiffTags[part] {
+			return false
+		}
+	}
+	return true
+}
+
+// Operating systems and architectures that file name suffixes restrict files to.
+var knownPlatform = map[string]bool{
+	"aix": true, "android": true, "darwin": true, "dragonfly": true, "freebsd": true, "illumos": true, "ios": true,
+	"js": true, "linux": true, "netbsd": true, "openbsd": true, "plan9": true, "solaris": true, "wasip1": true, "windows": true,
+	"386": true, "amd64": true, "arm": true, "arm64": true, "loong64": true, "mips": true, "mips64": true, "mips64le": true,
+	"mipsle": true, "ppc64": true, "ppc64le": true, "riscv64": true, "s390x": true, "wasm": true,
+}
+
+// matchesBuildTags reports whether a file's //go:build line, if it has one, is
+// satisfied on the platform in apiDiffTags with any Go version.
+func matchesBuildTags(file *ast.File) bool {
+	for _, group := range file.Comments {
+		if group.Pos() > file.Package {
+			break
+		}
+		for _, comment := range group.List {
+			if !constraint.IsGoBuild(comment.Text) {
+				continue
+			}
+			expr, err := constraint.Parse(comment.Text)
+			if err != nil {
+				return true
+			}
+			return expr.Eval(func(tag string) bool {
+				return apiDiffTags[tag] || strings.HasPrefix(tag, "go1.")
+			})
+		}
+	}
+	return true
+}
+
+// exportedAPI renders a file's exported declarations by symbol, e.g.
+// "Client.Do" for a method or "Options.Timeout" for a struct field.
+func exportedAPI(fset *token.FileSet, file *ast.File) map[string]apiSymbol {
+	api := map[string]apiSymbol{}
+	render := func(node any) string {
+		var text bytes.Buffer
+		printer.Fprint(&text, fset, node)
+		return strings.Join(strings.Fields(text.String()), " ")
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if !decl.Name.IsExported() {
+				continue
+			}
+			signature := &ast.FuncDecl{Name: decl.Name, Type: decl.Type}
+			key := decl.Name.Name
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				receiver := receiverType(decl.Recv.List[0].Type)
+				if !ast.IsExported(receiver) {
+					continue
+				}
+				// Receiver names don't matter to callers.
+				signature.Recv = &ast.FieldList{List: []*ast.Field{{Type: decl.Recv.List[0].Type}}}
+				key = receiver + "." + decl.Name.Name
+			}
+			api[key] = apiSymbol{declaration: render(signature)}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					if spec.Name.IsExported() {
+						typeAPI(api, spec, render)
+					}
+				case *ast.ValueSpec:
+					for i, name := range spec.Names {
+						if !name.IsExported() {
+							continue
+						}
+						declaration := decl.Tok.String() + " " + name.Name
+						if spec.Type != nil {
+							declaration += " " + render(spec.Type)
+						}
+						// A constant's value is part of its API; a variable's isn't.
+						if decl.Tok == token.CONST && i < len(spec.Values) {
+							declaration += " = " + render(spec.Values[i])
+						}
+						api[name.Name] = apiSymbol{declaration: declaration, untyped: decl.Tok == token.VAR && spec.Type == nil}
+					}
+				}
+			}
+		}
+	}
+	return api
+}
+
+// typeAPI adds an exported type to api, with the exported fields of a struct
+// and the methods of an interface as symbols of their own.
+func typeAPI(api map[string]apiSymbol, spec *ast.TypeSpec, render func(any) string) {
+	name := spec.Name.Name
+	header := "type " + name
+	if spec.TypeParams != nil {
+		header += render(spec.TypeParams)
+	}
+	if spec.Assign.IsValid() {
+		header += " ="
+	}
+
+	switch t := spec.Type.(type) {
+	case *ast.StructType:
+		api[name] = apiSymbol{declaration: header + " struct"}
+		for _, field := range t.Fields.List {
+			if len(field.Names) == 0 {
+				embedded := receiverType(field.Type)
+				if ast.IsExported(embedded) {
+					api[name+"."+embedded] = apiSymbol{declaration: fmt.Sprintf("field %s.%s (embedded %s)", name, embedded, render(field.Type))}
+				}
+				continue
+			}
+			for _, fieldName := range field.Names {
+				if fieldName.IsExported() {
+					api[name+"."+fieldName.Name] = apiSymbol{declaration: fmt.Sprintf("field %s.%s %s", name, fieldName.Name, render(field.Type))}
+				}
+			}
+		}
+	case *ast.InterfaceType:
+		api[name] = apiSymbol{declaration: header + " interface"}
+		for _, method := range t.Methods.List {
+			if len(method.Names) == 0 {
+				// Embedded interfaces and type constraints.
+				embedded := render(method.Type)
+				api[name+"."+embedded] = apiSymbol{declaration: fmt.Sprintf("interface %s embeds %s", name, embedded)}
+				continue
+			}
+			for _, methodName := range method.Names {
+				api[name+"."+methodName.Name] = apiSymbol{declaration: fmt.Sprintf("interface method %s.%s%s", name, methodName.Name, strings.TrimPrefix(render(method.Type), "func"))}
+			}
+		}
+	default:
+		api[name] = apiSymbol{declaration: header + " " + render(spec.Type)}
+	}
+}
+
+// stripParamNames removes the names of the parameters and results of the
+// function types in file, e.g. turning func(a, b int) into func(int, int).
+func stripParamNames(file *ast.File) {
+	strip := func(fields *ast.FieldList) {
+		if fields == nil {
+			return
+		}
+		var unnamed []*ast.Field
+		for _, field := range fields.List {
+			for range max(len(field.Names), 1) {
+				unnamed = append(unnamed, &ast.Field{Type: field.Type})
+			}
+		}
+		fields.List = unnamed
+	}
+	ast.Inspect(file, func(node ast.Node) bool {
+		if function, ok := node.(*ast.FuncType); ok {
+			strip(function.Params)
+			strip(function.Results)
+		}
+		return true
+	})
+}
+
+// moduleZip returns the zip of a module version from the module cache, or
+// downloads it from the module proxy.
+func moduleZip(ctx context.Context, module string, version string) ([]byte, error) {
+	escaped := docsource.EscapeModulePath(module) + "/@v/" + docsource.EscapeModulePath(version) + ".zip"
+	if data, err := os.ReadFile(filepath.Join(moduleCache(), "cache", "download", filepath.FromSlash(escaped))); err == nil {
+		return data, nil
+	}
+	body, err := moduleProxyGet(ctx, escaped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s@%s: %v", module, version, err)
+	}
+	return body, nil
+}
+
+// latestModuleVersion asks the module proxy for a module's latest version.
+func latestModuleVersion(ctx context.Context, module string) (string, error) {
+	body, err := moduleProxyGet(ctx, docsource.EscapeModulePath(module)+"/@latest")
+	if err != nil {
+		return "", fmt.Errorf("failed to look up the latest version of %s: %v", module, err)
+	}
+	var latest struct{ Version string }
+	if err := json.Unmarshal(body, &latest); err != nil {
+		return "", fmt.Errorf("failed to look up the latest version of %s: %v", module, err)
+	}
+	return latest.Version, nil
+}
+
+func moduleProxyGet(ctx context.Context, escaped string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "https://proxy.golang.org/"+escaped, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := netpolicy.FromEnv("proxy.golang.org").Client(0).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if text := strings.TrimSpace(string(message)); text != "" {
+			return nil, fmt.Errorf("not found: %s", text)
+		}
+		return nil, fmt.Errorf("not found")
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("module proxy returned status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxModuleZip+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxModuleZip {
+		return nil, fmt.Errorf("larger than %d MB", maxModuleZip>>20)
+	}
+	return data, nil
+}
+
+// moduleCache returns the directory of the local module cache.
+func moduleCache() string {
+	if dir := os.Getenv("GOMODCACHE"); dir != "" {
+		return dir
+	}
+	gopath := os.Getenv("GOPATH")
+	if gopath == "" {
+		home, _ := os.UserHomeDir()
+		gopath = filepath.Join(home, "go")
+	}
+	return filepath.Join(filepath.SplitList(gopath)[0], "pkg", "mod")
+}
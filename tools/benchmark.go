@@ -0,0 +1,244 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// benchmarkResults maps benchmark name to unit (e.g. "ns/op") to the value of each run.
+type benchmarkResults map[string]map[string][]float64
+
+// Baselines saved by run_benchmarks, shared by all GoTools so they survive
+// switching workspaces.
+var baselines = struct {
+	sync.Mutex
+	results map[string]benchmarkResults
+}{results: map[string]benchmarkResults{}}
+
+// RunBenchmarks tool for measuring and comparing performance
+type RunBenchmarksInput struct {
+	Package      string `json:"package,omitempty" jsonschema:"default=." jsonschema_description:"Package containing the benchmarks. Defaults to the current package."`
+	Bench        string `json:"bench,omitempty" jsonschema:"default=." jsonschema_description:"Regular expression selecting benchmarks, as for go test -bench. Defaults to all."`
+	Count        int    `json:"count,omitempty" jsonschema:"default=5,minimum=1,maximum=20" jsonschema_description:"Times to run each benchmark. More runs give more reliable comparisons."`
+	SaveBaseline string `json:"save_baseline,omitempty" jsonschema_description:"Save these results under this name, to compare against later."`
+	Baseline     string `json:"baseline,omitempty" jsonschema_description:"Compare these results against the baseline saved under this name."`
+}
+
+var RunBenchmarksInputSchema = GenerateSchema[RunBenchmarksInput]()
+
+func (g *GoTools) RunBenchmarksDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "run_benchmarks",
+		Description: "Run Go benchmarks with go test -bench and report time and allocations per operation. To prove an optimization, run once with save_baseline before changing the code and again with baseline afterwards; the result then shows the change for each benchmark, marked ~ when it is within run-to-run noise.",
+		InputSchema: RunBenchmarksInputSchema,
+		Function:    g.RunBenchmarks,
+		Examples: []ToolExample{
+			{Input: `{"package": "./parser", "bench": "Parse", "save_baseline": "before"}`, Output: "name        ns/op        B/op       allocs/op\nParse-8     1234 ±2%     512 ±0%    8 ±0%\n\nSaved as baseline \"before\"."},
+			{Input: `{"package": "./parser", "bench": "Parse", "baseline": "before"}`, Output: "name      old ns/op   new ns/op   delta\nParse-8   1234 ±2%    1010 ±1%    -18.15%\n..."},
+		},
+	}
+}
+
+func (g *GoTools) RunBenchmarks(ctx context.Context, input json.RawMessage) (string, error) {
+	benchInput := RunBenchmarksInput{}
+
+	err := json.Unmarshal(input, &benchInput)
+	if err != nil {
+		return "", err
+	}
+	if benchInput.Package == "" {
+		benchInput.Package = "."
+	}
+	if benchInput.Bench == "" {
+		benchInput.Bench = "."
+	}
+	if benchInput.Count == 0 {
+		benchInput.Count = 5
+	}
+
+	var baseline benchmarkResults
+	if benchInput.Baseline != "" {
+		baselines.Lock()
+		baseline = baselines.results[benchInput.Baseline]
+		baselines.Unlock()
+		if baseline == nil {
+			return "", fmt.Errorf("no baseline named %q; run with save_baseline first", benchInput.Baseline)
+		}
+	}
+
+	output, err := g.run(ctx, "go", "test", "-run=^$", "-bench="+benchInput.Bench, "-benchmem",
+		"-count="+strconv.Itoa(benchInput.Count), benchInput.Package).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("benchmarks failed: %v\n%s", err, output)
+	}
+
+	results := parseBenchmarks(string(output))
+	if len(results) == 0 {
+		return fmt.Sprintf("No benchmarks matched %q in %s.", benchInput.Bench, benchInput.Package), nil
+	}
+
+	report := formatBenchmarks(results)
+	if baseline != nil {
+		report = compareBenchmarks(baseline, results)
+	}
+
+	if benchInput.SaveBaseline != "" {
+		baselines.Lock()
+		baselines.results[benchInput.SaveBaseline] = results
+		baselines.Unlock()
+		report += fmt.Sprintf("\nSaved as baseline %q.", benchInput.SaveBaseline)
+	}
+	return report, nil
+}
+
+// parseBenchmarks reads go test -bench output lines like
+// "BenchmarkParse-8  1000000  1234 ns/op  512 B/op  8 allocs/op".
+func parseBenchmarks(output string) benchmarkResults {
+	results := benchmarkResults{}
+
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+		if _, err := strconv.Atoi(fields[1]); err != nil {
+			continue
+		}
+
+		name := strings.TrimPrefix(fields[0], "Benchmark")
+		if results[name] == nil {
+			results[name] = map[string][]float64{}
+		}
+		for i := 2; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				continue
+			}
+			results[name][fields[i+1]] = append(results[name][fields[i+1]], value)
+		}
+	}
+	return results
+}
+
+// benchmarkUnits lists the units reported, most important first.
+func benchmarkUnits(results ...benchmarkResults) []string {
+	seen := map[string]bool{}
+	for _, r := range results {
+		for _, units := range r {
+			for unit := range units {
+				seen[unit] = true
+			}
+		}
+	}
+
+	order := map[string]int{"ns/op": 0, "B/op": 1, "allocs/op": 2}
+	units := make([]string, 0, len(seen))
+	for unit := range seen {
+		units = append(units, unit)
+	}
+	sort.Slice(units, func(i, j int) bool {
+		oi, iok := order[units[i]]
+		oj, jok := order[units[j]]
+		if iok != jok {
+			return iok
+		}
+		if iok {
+			return oi < oj
+		}
+		return units[i] < units[j]
+	})
+	return units
+}
+
+func sortedNames(results benchmarkResults) []string {
+	names := make([]string, 0, len(results))
+	for name := range results {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// summary is the mean of a benchmark's runs and their spread around it, in percent.
+type summary struct {
+	mean, spread, min, max float64
+}
+
+func summarize(values []float64) summary {
+	s := summary{min: math.Inf(1), max: math.Inf(-1)}
+	for _, v := range values {
+		s.mean += v
+		s.min = math.Min(s.min, v)
+		s.max = math.Max(s.max, v)
+	}
+	s.mean /= float64(len(values))
+	if s.mean != 0 {
+		s.spread = math.Max(s.max-s.mean, s.mean-s.min) / s.mean * 100
+	}
+	return s
+}
+
+func (s summary) String() string {
+	return fmt.Sprintf("%s ±%.0f%%", strconv.FormatFloat(s.mean, 'g', 4, 64), s.spread)
+}
+
+func formatBenchmarks(results benchmarkResults) string {
+	units := benchmarkUnits(results)
+
+	var out strings.Builder
+	w := tabwriter.NewWriter(&out, 0, 4, 3, ' ', 0)
+	fmt.Fprintf(w, "name\t%s\n", strings.Join(units, "\t"))
+	for _, name := range sortedNames(results) {
+		row := []string{name}
+		for _, unit := range units {
+			if values := results[name][unit]; len(values) > 0 {
+				row = append(row, summarize(values).String())
+			} else {
+				row = append(row, "-")
+			}
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	w.Flush()
+	return out.String()
+}
+
+// compareBenchmarks shows the change from old to new per benchmark and unit.
+// Changes whose ranges of runs overlap are reported as ~, like benchstat does
+// for results that aren't statistically significant.
+func compareBenchmarks(old benchmarkResults, new benchmarkResults) string {
+	var out strings.Builder
+	for _, unit := range benchmarkUnits(old, new) {
+		w := tabwriter.NewWriter(&out, 0, 4, 3, ' ', 0)
+		fmt.Fprintf(w, "name\told %s\tnew %s\tdelta\n", unit, unit)
+
+		for _, name := range sortedNames(new) {
+			newValues := new[name][unit]
+			if len(newValues) == 0 {
+				continue
+			}
+			oldValues := old[name][unit]
+			if len(oldValues) == 0 {
+				fmt.Fprintf(w, "%s\t-\t%s\tnew\n", name, summarize(newValues))
+				continue
+			}
+
+			before, after := summarize(oldValues), summarize(newValues)
+			delta := "~"
+			if after.max < before.min || after.min > before.max {
+				delta = fmt.Sprintf("%+.2f%%", (after.mean-before.mean)/before.mean*100)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", name, before, after, delta)
+		}
+		w.Flush()
+		out.WriteString("\n")
+	}
+	return out.String()
+}
@@ -0,0 +1,145 @@
+package tools
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long fetching another agent's capabilities may take.
+const capabilitiesTimeout = 5 * time.Second
+
+// Capabilities is the manifest an agent serves at GET /<agent>/capabilities, so
+// that agents delegating to it know what it can do instead of assuming.
+type Capabilities struct {
+	Agent  string           `json:"agent"`
+	Model  string           `json:"model"`
+	Tools  []ToolCapability `json:"tools"`
+	Limits CapabilityLimits `json:"limits"`
+}
+
+// ToolCapability describes one of an agent's tools.
+type ToolCapability struct {
+	Name        string       `json:"name"`
+	Description string       `json:"description"`
+	Category    ToolCategory `json:"category"`
+}
+
+// CapabilityLimits are the limits an agent applies to each request. Zero values mean unlimited.
+type CapabilityLimits struct {
+	MaxOutputTokens int64   `json:"max_output_tokens"`
+	MaxBatchQueries int     `json:"max_batch_queries"`
+	MaxTaskCostUSD  float64 `json:"max_task_cost_usd,omitempty"`
+	MaxTaskDuration string  `json:"max_task_duration,omitempty"`
+}
+
+// Version identifies the manifest's content. Agents send it with every reply in
+// the X-Agent-Capabilities header, so callers know when their copy is stale.
+func (c Capabilities) Version() string {
+	data, _ := json.Marshal(c)
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:6])
+}
+
+// PromptNote summarizes the capabilities for the prompt of an agent that reaches
+// this one through tool.
+func (c Capabilities) PromptNote(tool string) string {
+	var note strings.Builder
+	fmt.Fprintf(&note, "The %s agent you reach with %s runs %s and can use these tools:\n", c.Agent, tool, c.Model)
+	for _, capability := range c.Tools {
+		description, _, _ := strings.Cut(capability.Description, ". ")
+		fmt.Fprintf(&note, "- %s: %s\n", capability.Name, strings.TrimSuffix(description, "."))
+	}
+	fmt.Fprintf(&note, "It answers up to %d queries per call", c.Limits.MaxBatchQueries)
+	if c.Limits.MaxTaskDuration != "" {
+		fmt.Fprintf(&note, " and spends at most %s on each", c.Limits.MaxTaskDuration)
+	}
+	note.WriteString(". Only delegate questions these tools can answer.")
+	return note.String()
+}
+
+// peerCapabilities caches the manifests of agents this one delegates to, by base URL.
+var peerCapabilities = struct {
+	mu        sync.Mutex
+	manifests map[string]Capabilities
+}{manifests: map[string]Capabilities{}}
+
+// refreshCapabilities fetches the manifest of the agent at baseURL unless the
+// cached one has the version it just reported.
+func refreshCapabilities(ctx context.Context, baseURL string, version string) {
+	if version == "" {
+		return
+	}
+
+	peerCapabilities.mu.Lock()
+	cached, ok := peerCapabilities.manifests[baseURL]
+	peerCapabilities.mu.Unlock()
+	if ok && cached.Version() == version {
+		return
+	}
+
+	manifest, err := fetchCapabilities(ctx, baseURL)
+	if err != nil {
+		fmt.Printf("Failed to fetch the capabilities of %s: %v\n", baseURL, err)
+		return
+	}
+
+	peerCapabilities.mu.Lock()
+	peerCapabilities.manifests[baseURL] = manifest
+	peerCapabilities.mu.Unlock()
+}
+
+func fetchCapabilities(ctx context.Context, baseURL string) (Capabilities, error) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), capabilitiesTimeout)
+	defer cancel()
+
+	var manifest Capabilities
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimSuffix(baseURL, "/")+"/capabilities", nil)
+	if err != nil {
+		return manifest, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return manifest, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return manifest, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	err = json.NewDecoder(resp.Body).Decode(&manifest)
+	return manifest, err
+}
+
+// PrefetchDocAgentCapabilities fetches the documentation agent's manifest before
+// it is first invoked, if it is reachable.
+func PrefetchDocAgentCapabilities(ctx context.Context) {
+	if _, ok := DocAgentCapabilities(); ok {
+		return
+	}
+
+	manifest, err := fetchCapabilities(ctx, docAgentURL())
+	if err != nil {
+		return
+	}
+
+	peerCapabilities.mu.Lock()
+	peerCapabilities.manifests[docAgentURL()] = manifest
+	peerCapabilities.mu.Unlock()
+}
+
+// DocAgentCapabilities returns the manifest of the documentation agent, once
+// it has been invoked over HTTP.
+func DocAgentCapabilities() (Capabilities, bool) {
+	peerCapabilities.mu.Lock()
+	defer peerCapabilities.mu.Unlock()
+
+	manifest, ok := peerCapabilities.manifests[docAgentURL()]
+	return manifest, ok
+}
@@ -0,0 +1,59 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FileChange is the machine-readable summary of a mutating tool call,
+// appended to its result so viewers don't have to parse the human text.
+type FileChange struct {
+	Path      string `json:"path"`
+	Operation string `json:"operation"` // "create" or "modify"
+	Added     int    `json:"added"`
+	Removed   int    `json:"removed"`
+	Diff      string `json:"diff,omitempty"`
+}
+
+var fileChangePattern = regexp.MustCompile(`(?s)\n*<file_change>\n(.*?)\n</file_change>`)
+
+func newFileChange(path string, before string, after string, existed bool) FileChange {
+	change := FileChange{Path: path, Operation: "modify", Diff: UnifiedDiff(recordKey(path), before, after)}
+	if !existed {
+		change.Operation = "create"
+	}
+
+	for _, line := range DiffBody(change.Diff) {
+		switch {
+		case strings.HasPrefix(line, "+"):
+			change.Added++
+		case strings.HasPrefix(line, "-"):
+			change.Removed++
+		}
+	}
+	return change
+}
+
+// withFileChange appends change to a tool's human-readable result.
+func withFileChange(result string, change FileChange) string {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return result
+	}
+	return fmt.Sprintf("%s\n\n<file_change>\n%s\n</file_change>", result, data)
+}
+
+// ParseFileChanges splits a tool result into its human-readable text and the
+// file changes it reports.
+func ParseFileChanges(result string) (string, []FileChange) {
+	var changes []FileChange
+	for _, match := range fileChangePattern.FindAllStringSubmatch(result, -1) {
+		var change FileChange
+		if json.Unmarshal([]byte(match[1]), &change) == nil {
+			changes = append(changes, change)
+		}
+	}
+	return fileChangePattern.ReplaceAllString(result, ""), changes
+}
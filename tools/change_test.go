@@ -0,0 +1,27 @@
+package tools
+
+import "testing"
+
+func TestNewFileChangeCounts(t *testing.T) {
+	tests := []struct {
+		name           string
+		before, after  string
+		existed        bool
+		added, removed int
+	}{
+		{"create", "", "a\nb\n", false, 2, 0},
+		{"modify", "a\nb\nc\n", "a\nB\nc\n", true, 1, 1},
+		{"delete all", "a\nb\n", "", true, 0, 2},
+		{"removed SQL comment", "-- x\nselect 1;\n", "select 1;\n", true, 0, 1},
+		{"added SQL comment", "select 1;\n", "-- x\nselect 1;\n", true, 1, 0},
+		{"YAML separator", "a: 1\n", "a: 1\n---\nb: 2\n", true, 2, 0},
+		{"Markdown rule", "# Title\n---\ntext\n", "# Title\ntext\n", true, 0, 1},
+		{"increment", "i\n", "++i\n", true, 1, 1},
+	}
+	for _, test := range tests {
+		change := newFileChange("file", test.before, test.after, test.existed)
+		if change.Added != test.added || change.Removed != test.removed {
+			t.Errorf("%s: +%d -%d, want +%d -%d\n%s", test.name, change.Added, change.Removed, test.added, test.removed, change.Diff)
+		}
+	}
+}
@@ -0,0 +1,622 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kartikx/agent/bus"
+)
+
+// Coder-specific tools, operating on the real filesystem
+var CoderTools = NewCoderTools(OSFS{})
+
+// NewCoderTools returns the coder tools with file tools operating on fsys, and
+// Go toolchain, project and shell tools running in the current directory.
+func NewCoderTools(fsys FS) []ToolDefinition {
+	definitions := append(NewFiles(fsys, nil).Definitions(), NewGoTools(LocalRunner("")).Definitions()...)
+	definitions = append(definitions, NewProjectTools(fsys, LocalRunner("")).Definitions()...)
+	definitions = append(definitions, NewShellTools(LocalRunner("")).Definitions()...)
+	return append(definitions, HTTPRequestDefinition, PackageInfoDefinition, ComparePackagesDefinition, APIDiffDefinition, InvokeDocumentationAgentDefinition, DelegateSubtasksDefinition)
+}
+
+// Files holds the tools that read and write files, bound to one filesystem.
+type Files struct {
+	fs FS
+	*FileRecords
+}
+
+// FileRecords is what the file tools remember about the files of a filesystem.
+// Passing the same FileRecords to every NewFiles for those files keeps conflict
+// detection working when the tools are recreated, e.g. after switching users.
+type FileRecords struct {
+	// Last content the model read or wrote per path, for conflict detection.
+	readsMu sync.Mutex
+	reads   map[string]readRecord
+
+	// Per-path locks held while a tool touches a file.
+	locksMu sync.Mutex
+	locks   map[string]*sync.Mutex
+}
+
+func NewFileRecords() *FileRecords {
+	return &FileRecords{reads: map[string]readRecord{}, locks: map[string]*sync.Mutex{}}
+}
+
+// NewFiles returns the file tools operating on fsys, minus what .agentignore
+// excludes. A nil records starts with none.
+func NewFiles(fsys FS, records *FileRecords) *Files {
+	if records == nil {
+		records = NewFileRecords()
+	}
+	return &Files{fs: NewIgnoreFS(fsys), FileRecords: records}
+}
+
+func (f *Files) Definitions() []ToolDefinition {
+	return []ToolDefinition{
+		f.ReadFileDefinition(),
+		f.WriteFileDefinition(),
+		f.ListFilesDefinition(),
+		f.FileTreeDefinition(),
+		f.ReadDocumentDefinition(),
+		f.InspectDockerfileDefinition(),
+		f.EditDockerfileDefinition(),
+		f.InspectComposeDefinition(),
+		f.EditComposeDefinition(),
+		f.CheckDocCommentsDefinition(),
+		f.AddDocCommentsDefinition(),
+		f.ScaffoldDefinition(),
+	}
+}
+
+// ReadFile tool for reading file contents
+type ReadFileInput struct {
+	Path string `json:"path" jsonschema:"minLength=1" jsonschema_description:"The path of the file."`
+	Full bool   `json:"full,omitempty" jsonschema:"default=false" jsonschema_description:"Return the whole file even if you read it before in this session, instead of only what changed."`
+}
+
+var ReadFileInputSchema = GenerateSchema[ReadFileInput]()
+
+func (f *Files) ReadFileDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "read_file",
+		Description: "Read the contents of a file. Use this when you want to see what is inside a file. Content is returned as UTF-8 with LF line endings; files using another encoding or CRLF line endings start with a note saying so. Re-reading a file you already read or wrote in this session returns only a diff against that version, unless full is set.",
+		InputSchema: ReadFileInputSchema,
+		Function:    f.ReadFile,
+		Category:    CategoryRead,
+		Examples: []ToolExample{
+			{Input: `{"path": "main.go"}`, Output: "package main\n\nfunc main() {\n..."},
+		},
+	}
+}
+
+func (f *Files) ReadFile(ctx context.Context, input json.RawMessage) (string, error) {
+	readFileInput := ReadFileInput{}
+
+	err := json.Unmarshal(input, &readFileInput)
+	if err != nil {
+		return "", err
+	}
+
+	unlock := f.lockPath(readFileInput.Path)
+	content, err := f.fs.ReadFile(readFileInput.Path)
+	if err == nil {
+		f.recordRead(readFileInput.Path, content)
+	}
+	unlock()
+	if err != nil {
+		return "", err
+	}
+
+	// The model always sees UTF-8 with LF line endings; write_file restores the original style.
+	text, style := decodeText(content)
+	differential, ok := differentialRead(ctx, readFileInput.Path, text)
+	seenFiles(ctx).record(readFileInput.Path, text)
+	if ok && !readFileInput.Full {
+		return differential, nil
+	}
+	if !style.isDefault() {
+		return fmt.Sprintf("[File encoding: %s. Write it back with LF line endings; the original encoding is restored automatically.]\n%s", style, text), nil
+	}
+
+	return text, nil
+}
+
+// WriteFile tool for writing content to files
+type WriteFileInput struct {
+	Path    string `json:"path" jsonschema:"minLength=1" jsonschema_description:"The path of the file to write to"`
+	Content string `json:"content" jsonschema_description:"The content to write to the file"`
+	Force   bool   `json:"force,omitempty" jsonschema:"default=false" jsonschema_description:"Overwrite even if the file changed on disk since you last read it."`
+}
+
+var WriteFileInputSchema = GenerateSchema[WriteFileInput]()
+
+func (f *Files) WriteFileDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "write_file",
+		Description: "Write content to a file. Use this when you need to create or modify files. The file will be created if it doesn't exist, or overwritten if it does. If the file changed on disk since you last read it, the write is rejected with the changes so you can merge them.",
+		InputSchema: WriteFileInputSchema,
+		Function:    f.WriteFile,
+		Category:    CategoryWrite,
+		Examples: []ToolExample{
+			{Input: `{"path": "hello/hello.go", "content": "package hello\n\nfunc Hello() string {\n\treturn \"hello\"\n}\n"}`, Output: "Successfully wrote 55 bytes to hello/hello.go"},
+		},
+	}
+}
+
+func (f *Files) WriteFile(ctx context.Context, input json.RawMessage) (string, error) {
+	writeFileInput := WriteFileInput{}
+
+	err := json.Unmarshal(input, &writeFileInput)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.lockPath(writeFileInput.Path)()
+
+	if !writeFileInput.Force {
+		err = f.checkConflict(writeFileInput.Path)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	content, fixed := fixGoSource(ctx, writeFileInput.Path, writeFileInput.Content)
+
+	// Keep the line endings and encoding of an existing file.
+	data := []byte(content)
+	existing, readErr := f.fs.ReadFile(writeFileInput.Path)
+	before := ""
+	if readErr == nil {
+		var style TextStyle
+		before, style = decodeText(existing)
+		data = encodeText(content, style)
+	}
+
+	err = f.fs.WriteFile(writeFileInput.Path, data, 0644)
+	if err != nil {
+		return "", err
+	}
+	f.recordRead(writeFileInput.Path, data)
+	seenFiles(ctx).record(writeFileInput.Path, content)
+
+	change := newFileChange(writeFileInput.Path, before, content, readErr == nil)
+	result := withFileChange(fmt.Sprintf("Successfully wrote %d bytes to %s%s", len(content), writeFileInput.Path, fixed), change)
+	return tidyGoModule(ctx, f.fs, result, writeFileInput.Path, before, content), nil
+}
+
+// edit rewrites an existing file with apply, keeping its line endings and
+// encoding, and returns the change for the tool's result.
+func (f *Files) edit(ctx context.Context, path string, apply func(content string) (string, error)) (FileChange, error) {
+	defer f.lockPath(path)()
+
+	existing, err := f.fs.ReadFile(path)
+	if err != nil {
+		return FileChange{}, err
+	}
+	before, style := decodeText(existing)
+	after, err := apply(before)
+	if err != nil {
+		return FileChange{}, err
+	}
+
+	data := encodeText(after, style)
+	if err := f.fs.WriteFile(path, data, 0644); err != nil {
+		return FileChange{}, err
+	}
+	f.recordRead(path, data)
+	seenFiles(ctx).record(path, after)
+	return newFileChange(path, before, after, true), nil
+}
+
+// ListFiles tool for listing directory contents (equivalent to ls -la)
+type ListFilesInput struct {
+	Path string `json:"path,omitempty" jsonschema_description:"The directory path to list files from. Defaults to current directory if not specified." jsonschema:"default=."`
+}
+
+var ListFilesInputSchema = GenerateSchema[ListFilesInput]()
+
+func (f *Files) ListFilesDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "list_files",
+		Description: "List all files and directories in a specified path (equivalent to ls -la). Use this to explore the file system structure.",
+		InputSchema: ListFilesInputSchema,
+		Function:    f.ListFiles,
+		Category:    CategoryRead,
+		Examples: []ToolExample{
+			{Input: `{"path": "cmd"}`, Output: "Directory listing for: cmd\nPermissions | Size | Modified | Name\n-----------|------|----------|-----\ndrwxr-xr-x | 4.0K | Sep 05 10:12 | agent/"},
+		},
+	}
+}
+
+func (f *Files) ListFiles(ctx context.Context, input json.RawMessage) (string, error) {
+	listFilesInput := ListFilesInput{}
+
+	err := json.Unmarshal(input, &listFilesInput)
+	if err != nil {
+		return "", err
+	}
+
+	// If no path specified, use current directory
+	if listFilesInput.Path == "" {
+		listFilesInput.Path = "."
+	}
+
+	// Read directory contents
+	entries, err := f.fs.ReadDir(listFilesInput.Path)
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Directory listing for: %s\n", listFilesInput.Path))
+	result.WriteString("Permissions | Size | Modified | Name\n")
+	result.WriteString("-----------|------|----------|-----\n")
+
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			continue // Skip entries we can't get info for
+		}
+
+		// Format permissions (similar to ls -la)
+		mode := info.Mode()
+		perms := formatPermissions(mode)
+		
+		// Format size
+		size := formatSize(info.Size())
+		
+		// Format modification time
+		modTime := info.ModTime().Format("Jan 02 15:04")
+		
+		// Format name (with @ for symlinks, / for directories)
+		name := entry.Name()
+		if entry.IsDir() {
+			name += "/"
+		} else if mode&os.ModeSymlink != 0 {
+			name += "@"
+		}
+
+		result.WriteString(fmt.Sprintf("%s | %s | %s | %s\n", perms, size, modTime, name))
+	}
+
+	return result.String(), nil
+}
+
+// Helper function to format file permissions like ls -la
+func formatPermissions(mode os.FileMode) string {
+	var perms strings.Builder
+	
+	// File type
+	switch {
+	case mode.IsDir():
+		perms.WriteRune('d')
+	case mode&os.ModeSymlink != 0:
+		perms.WriteRune('l')
+	default:
+		perms.WriteRune('-')
+	}
+	
+	// Owner permissions
+	if mode&0400 != 0 {
+		perms.WriteRune('r')
+	} else {
+		perms.WriteRune('-')
+	}
+	if mode&0200 != 0 {
+		perms.WriteRune('w')
+	} else {
+		perms.WriteRune('-')
+	}
+	if mode&0100 != 0 {
+		perms.WriteRune('x')
+	} else {
+		perms.WriteRune('-')
+	}
+	
+	// Group permissions
+	if mode&0040 != 0 {
+		perms.WriteRune('r')
+	} else {
+		perms.WriteRune('-')
+	}
+	if mode&0020 != 0 {
+		perms.WriteRune('w')
+	} else {
+		perms.WriteRune('-')
+	}
+	if mode&0010 != 0 {
+		perms.WriteRune('x')
+	} else {
+		perms.WriteRune('-')
+	}
+	
+	// Other permissions
+	if mode&0004 != 0 {
+		perms.WriteRune('r')
+	} else {
+		perms.WriteRune('-')
+	}
+	if mode&0002 != 0 {
+		perms.WriteRune('w')
+	} else {
+		perms.WriteRune('-')
+	}
+	if mode&0001 != 0 {
+		perms.WriteRune('x')
+	} else {
+		perms.WriteRune('-')
+	}
+	
+	return perms.String()
+}
+
+// Helper function to format file size
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%c", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// Most output of execute_command returned to the model; longer output is compacted.
+const maxCommandOutput = 20_000
+
+// ExecuteCommand tool for running shell commands
+type ExecuteCommandInput struct {
+	Command string `json:"command" jsonschema:"minLength=1" jsonschema_description:"The command to execute"`
+}
+
+var ExecuteCommandInputSchema = GenerateSchema[ExecuteCommandInput]()
+
+func (t *ShellTools) ExecuteCommandDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "execute_command",
+		Description: "Execute a shell command and return the output. Use this when you need to run terminal commands.",
+		InputSchema: ExecuteCommandInputSchema,
+		Function:    t.ExecuteCommand,
+	}
+}
+
+func (t *ShellTools) ExecuteCommand(ctx context.Context, input json.RawMessage) (string, error) {
+	readFileInput := ExecuteCommandInput{}
+
+	err := json.Unmarshal(input, &readFileInput)
+	if err != nil {
+		return "", err
+	}
+	
+	// Split the command into command and arguments
+	parts := strings.Fields(readFileInput.Command)
+	if len(parts) == 0 {
+		return "", nil
+	}
+	
+	cmd := t.run(ctx, parts[0], parts[1:]...)
+	
+	// Capture both stdout and stderr, streaming them while the command runs
+	var output strings.Builder
+	stream := outputStream(ctx)
+	cmd.Stdout = io.MultiWriter(&output, stream)
+	cmd.Stderr = cmd.Stdout
+	err = cmd.Run()
+	stream.Close()
+	result := fmt.Sprintf("Command: %s\nOutput:\n%s", readFileInput.Command, CompactOutput(output.String(), maxCommandOutput))
+	if err != nil {
+		return result, err
+	}
+	
+	return result, nil
+}
+
+
+// How long a documentation agent call may take unless DOC_AGENT_TIMEOUT says otherwise.
+const defaultDocAgentTimeout = 2 * time.Minute
+
+// docAgentTimeout reads DOC_AGENT_TIMEOUT, e.g. "30s".
+func docAgentTimeout() time.Duration {
+	if value := os.Getenv("DOC_AGENT_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err == nil && timeout > 0 {
+			return timeout
+		}
+		fmt.Printf("Invalid DOC_AGENT_TIMEOUT %q, using %s\n", value, defaultDocAgentTimeout)
+	}
+	return defaultDocAgentTimeout
+}
+
+// Invoke documentation agent.
+type InvokeDocumentationAgentInput struct {
+	Query   string   `json:"query,omitempty" jsonschema_description:"The query to search for in the documentation"`
+	Queries []string `json:"queries,omitempty" jsonschema:"maxItems=20" jsonschema_description:"Several independent queries, answered in parallel. Use instead of query when you need documentation for more than one package or function."`
+}
+
+var InvokeDocumentationAgentInputSchema = GenerateSchema[InvokeDocumentationAgentInput]()
+
+var InvokeDocumentationAgentDefinition = ToolDefinition{
+	Name:        "invoke_documentation_agent",
+	Description: "Invoke the documentation agent to search for information. Use this when you need to find documentation for a specific package or function. Set either query, or queries to look several things up in one call.",
+	InputSchema: InvokeDocumentationAgentInputSchema,
+	Function:    InvokeDocumentationAgent,
+	Category:    CategoryRead,
+	Untrusted:   true,
+	Network:     true,
+	Examples: []ToolExample{
+		{Input: `{"query": "How do I set a timeout on an http.Client?"}`, Output: "Set the Timeout field: client := &http.Client{Timeout: 10 * time.Second} ..."},
+		{Input: `{"queries": ["What does errgroup.WithContext return?", "How do I use sync.OnceValue?"]}`, Output: "## What does errgroup.WithContext return?\n\nA new Group and a derived Context ...\n\n## How do I use sync.OnceValue?\n\n..."},
+	},
+}
+
+func InvokeDocumentationAgent(ctx context.Context, input json.RawMessage) (string, error) {
+	invokeDocumentationAgentInput := InvokeDocumentationAgentInput{}
+
+	err := json.Unmarshal(input, &invokeDocumentationAgentInput)
+	if err != nil {
+		return "", err
+	}
+
+	query, queries := invokeDocumentationAgentInput.Query, invokeDocumentationAgentInput.Queries
+	if (query == "") == (len(queries) == 0) {
+		return "", fmt.Errorf("set exactly one of query or queries")
+	}
+
+	// With BUS_URL set the documentation agent is reached through its stream, so
+	// requests wait while it restarts.
+	if busURL := os.Getenv("BUS_URL"); busURL != "" {
+		if query != "" {
+			queries = []string{query}
+		}
+		fmt.Println("Sending queries to the documentation agent over the bus: ", queries)
+		return sendToDocAgent(ctx, busURL, queries), nil
+	}
+
+	if query != "" {
+		fmt.Println("Invoking documentation agent with query: ", query)
+		respBytes, err := postToDocAgent(ctx, "", map[string]any{"query": query})
+		if err != nil {
+			return "", err
+		}
+		return string(respBytes), nil
+	}
+
+	fmt.Println("Invoking documentation agent with queries: ", queries)
+	respBytes, err := postToDocAgent(ctx, "/batch", map[string]any{"queries": queries})
+	if err != nil {
+		return "", err
+	}
+
+	var batch struct {
+		Results map[string]string `json:"results"`
+		Errors  map[string]string `json:"errors"`
+	}
+	if err := json.Unmarshal(respBytes, &batch); err != nil {
+		return "", fmt.Errorf("invalid batch response from documentation agent: %v", err)
+	}
+
+	var result strings.Builder
+	for _, query := range queries {
+		if answer, ok := batch.Results[query]; ok {
+			result.WriteString(fmt.Sprintf("## %s\n\n%s\n\n", query, answer))
+		} else {
+			result.WriteString(fmt.Sprintf("## %s\n\nError: %s\n\n", query, batch.Errors[query]))
+		}
+	}
+	return strings.TrimSpace(result.String()), nil
+}
+
+// sendToDocAgent queues each query on the documentation agent's stream at once,
+// so replicas answer them in parallel, and collects the answers.
+func sendToDocAgent(ctx context.Context, busURL string, queries []string) string {
+	ctx, cancel := context.WithTimeout(ctx, docAgentTimeout())
+	defer cancel()
+
+	answers := make([]string, len(queries))
+	var wg sync.WaitGroup
+	for i, query := range queries {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			body, _ := json.Marshal(map[string]any{"query": query})
+			answer, err := bus.Send(ctx, busURL, bus.Stream("doc"), string(body), RequestID(ctx))
+			switch {
+			case errors.Is(err, context.DeadlineExceeded):
+				answers[i] = fmt.Sprintf("Error: documentation agent did not answer within %s", docAgentTimeout())
+			case err != nil:
+				answers[i] = fmt.Sprintf("Error: %v", err)
+			default:
+				answers[i] = answer
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(queries) == 1 {
+		return answers[0]
+	}
+	var result strings.Builder
+	for i, query := range queries {
+		result.WriteString(fmt.Sprintf("## %s\n\n%s\n\n", query, answers[i]))
+	}
+	return strings.TrimSpace(result.String())
+}
+
+// docAgentURL reads DOC_AGENT_URL.
+func docAgentURL() string {
+	if url := os.Getenv("DOC_AGENT_URL"); url != "" {
+		return url
+	}
+	return "http://localhost:8081" // default fallback
+}
+
+// postToDocAgent sends body as JSON to path below the documentation agent's URL
+// and returns its response.
+func postToDocAgent(ctx context.Context, path string, body any) ([]byte, error) {
+	return postToAgent(ctx, "documentation agent", docAgentURL(), path, body, docAgentTimeout(), "")
+}
+
+// postToAgent sends body as JSON to path below another agent's baseURL, in the
+// given session if set, and returns its response. agent names it in errors.
+func postToAgent(ctx context.Context, agent string, baseURL string, path string, body any, timeout time.Duration, sessionID string) ([]byte, error) {
+	url := strings.TrimSuffix(baseURL, "/") + path
+
+	reqBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, strings.NewReader(string(reqBody)))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if requestID := RequestID(ctx); requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+	if sessionID != "" {
+		req.Header.Set("X-Session-ID", sessionID)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%s did not answer within %s", agent, timeout)
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	respBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	refreshCapabilities(ctx, baseURL, resp.Header.Get("X-Agent-Capabilities"))
+
+	if resp.StatusCode != 200 {
+		var agentErr struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(respBytes, &agentErr) == nil && agentErr.Error != "" {
+			return nil, fmt.Errorf("%s returned status %d: %s", agent, resp.StatusCode, agentErr.Error)
+		}
+		return nil, fmt.Errorf("%s returned status %d", agent, resp.StatusCode)
+	}
+
+	return respBytes, nil
+}
\ No newline at end of file
@@ -0,0 +1,301 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// How long a command tool may run unless its declaration says otherwise.
+const defaultCommandToolTimeout = 2 * time.Minute
+
+// Most output of a command tool returned to the model; the end is kept.
+const maxCommandToolOutput = 50_000
+
+var commandToolName = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// CommandTool declares a tool that runs a shell command or a sandboxed WASM
+// module, so project-specific tools like make deploy can be added without
+// recompiling.
+type CommandTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// JSON schema of the arguments, e.g. {"type": "object", "properties": {...}, "required": [...]}.
+	Parameters json.RawMessage `json:"parameters,omitempty"`
+	// text/template rendered with the arguments and run with sh -c, e.g.
+	// "make deploy ENV={{.env}}". Values printed by the template are shell-quoted.
+	Command string `json:"command"`
+	// e.g. "10m"; defaults to 2m.
+	Timeout string `json:"timeout,omitempty"`
+	// Directory the command runs in on the host, instead of where the agent's
+	// other commands run (the current directory, a workspace or a user's root).
+	Dir string `json:"dir,omitempty"`
+	// "read", "write" or "execute" (the default).
+	Category ToolCategory `json:"category,omitempty"`
+
+	// Path of a WASI module to run instead of a command, for untrusted tools;
+	// see wasmTool. It can only reach Mounts and AllowedHosts.
+	Wasm         string            `json:"wasm,omitempty"`
+	Mounts       []WasmMount       `json:"mounts,omitempty"`
+	AllowedHosts []string          `json:"allowed_hosts,omitempty"`
+	Env          map[string]string `json:"env,omitempty"`
+	// Memory limit; defaults to 64.
+	MemoryMB int `json:"memory_mb,omitempty"`
+}
+
+// LoadCommandTools reads and validates a JSON array of command tools, e.g.
+// [{"name": "deploy", "description": "...", "command": "make deploy ENV={{.env}}", "timeout": "10m"}]
+func LoadCommandTools(path string) ([]CommandTool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var declarations []CommandTool
+	if err := json.Unmarshal(data, &declarations); err != nil {
+		return nil, fmt.Errorf("invalid tools file %s: %v", path, err)
+	}
+
+	names := map[string]bool{}
+	for _, declaration := range declarations {
+		if names[declaration.Name] {
+			return nil, fmt.Errorf("duplicate tool name %q", declaration.Name)
+		}
+		names[declaration.Name] = true
+
+		if _, _, err := declaration.validate(); err != nil {
+			return nil, err
+		}
+	}
+	return declarations, nil
+}
+
+// UsesRunner reports whether the tool's command runs through the runner passed
+// to Definition, rather than on the host in Dir or as a WASM module.
+func (c CommandTool) UsesRunner() bool {
+	return c.Wasm == "" && c.Dir == ""
+}
+
+// Definition validates the declaration and turns it into a tool whose command
+// is run by run, e.g. in a workspace's container, or on the host in Dir if set.
+// A WASM module is compiled into a runtime of its own, which stays open.
+func (c CommandTool) Definition(run CommandRunner) (ToolDefinition, error) {
+	definition, timeout, err := c.validate()
+	if err != nil {
+		return ToolDefinition{}, err
+	}
+	if c.Wasm != "" {
+		tool, err := newWasmTool(c, timeout)
+		if err != nil {
+			return ToolDefinition{}, fmt.Errorf("tool %s: %v", c.Name, err)
+		}
+		definition.Function = tool.run
+		definition.Untrusted = len(c.AllowedHosts) > 0
+		definition.Network = len(c.AllowedHosts) > 0
+		return definition, nil
+	}
+
+	command, err := parseCommandTemplate(c.Name, c.Command)
+	if err != nil {
+		return ToolDefinition{}, fmt.Errorf("tool %s: invalid command: %v", c.Name, err)
+	}
+	if c.Dir != "" {
+		run = LocalRunner(c.Dir)
+	}
+	definition.Function = func(ctx context.Context, input json.RawMessage) (string, error) {
+		return runCommandTool(ctx, command, run, timeout, input)
+	}
+	return definition, nil
+}
+
+// validate checks the declaration and returns the tool's definition, without
+// its function, and timeout. WASM modules are only compiled by Definition.
+func (c CommandTool) validate() (ToolDefinition, time.Duration, error) {
+	if !commandToolName.MatchString(c.Name) {
+		return ToolDefinition{}, 0, fmt.Errorf("invalid tool name %q: use lowercase letters, digits and _", c.Name)
+	}
+	if strings.TrimSpace(c.Description) == "" {
+		return ToolDefinition{}, 0, fmt.Errorf("tool %s: description is required", c.Name)
+	}
+	if (strings.TrimSpace(c.Command) == "") == (c.Wasm == "") {
+		return ToolDefinition{}, 0, fmt.Errorf("tool %s: set exactly one of command or wasm", c.Name)
+	}
+	if c.Wasm == "" && (len(c.Mounts) > 0 || len(c.AllowedHosts) > 0 || len(c.Env) > 0 || c.MemoryMB != 0) {
+		return ToolDefinition{}, 0, fmt.Errorf("tool %s: mounts, allowed_hosts, env and memory_mb only apply to wasm tools", c.Name)
+	}
+	if c.Wasm != "" && c.Dir != "" {
+		return ToolDefinition{}, 0, fmt.Errorf("tool %s: wasm tools see only their mounts; use mounts instead of dir", c.Name)
+	}
+	if c.MemoryMB < 0 || c.MemoryMB > 4096 {
+		return ToolDefinition{}, 0, fmt.Errorf("tool %s: memory_mb must be between 1 and 4096", c.Name)
+	}
+
+	schema := anthropic.ToolInputSchemaParam{Properties: map[string]any{}}
+	if len(c.Parameters) > 0 {
+		var parameters struct {
+			Type       string         `json:"type"`
+			Properties map[string]any `json:"properties"`
+			Required   []string       `json:"required"`
+		}
+		if err := json.Unmarshal(c.Parameters, &parameters); err != nil {
+			return ToolDefinition{}, 0, fmt.Errorf("tool %s: invalid parameters: %v", c.Name, err)
+		}
+		if parameters.Type != "" && parameters.Type != "object" {
+			return ToolDefinition{}, 0, fmt.Errorf("tool %s: parameters must be an object schema", c.Name)
+		}
+		for _, name := range parameters.Required {
+			if _, ok := parameters.Properties[name]; !ok {
+				return ToolDefinition{}, 0, fmt.Errorf("tool %s: required parameter %q has no schema", c.Name, name)
+			}
+		}
+		if parameters.Properties != nil {
+			schema.Properties = parameters.Properties
+		}
+		schema.Required = parameters.Required
+	}
+
+	timeout := defaultCommandToolTimeout
+	if c.Timeout != "" {
+		var err error
+		timeout, err = time.ParseDuration(c.Timeout)
+		if err != nil || timeout <= 0 {
+			return ToolDefinition{}, 0, fmt.Errorf("tool %s: invalid timeout %q", c.Name, c.Timeout)
+		}
+	}
+
+	category := c.Category
+	switch category {
+	case "":
+		category = CategoryExecute
+	case CategoryRead, CategoryWrite, CategoryExecute:
+	default:
+		return ToolDefinition{}, 0, fmt.Errorf("tool %s: category must be read, write or execute, got %q", c.Name, category)
+	}
+
+	if c.Wasm == "" {
+		if _, err := parseCommandTemplate(c.Name, c.Command); err != nil {
+			return ToolDefinition{}, 0, fmt.Errorf("tool %s: invalid command: %v", c.Name, err)
+		}
+	}
+	definition := ToolDefinition{
+		Name:        c.Name,
+		Description: c.Description,
+		InputSchema: schema,
+		Category:    category,
+	}
+	return definition, timeout, nil
+}
+
+// parseCommandTemplate parses a command template, shell-quoting everything its
+// actions print so arguments can't inject commands. Conditions still see the
+// raw values, e.g. {{if .verbose}}-v{{end}}.
+func parseCommandTemplate(name string, text string) (*template.Template, error) {
+	command, err := template.New(name).Option("missingkey=zero").Funcs(template.FuncMap{"shellquote": shellQuote}).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	for _, tmpl := range command.Templates() {
+		if tmpl.Tree != nil {
+			quoteActions(tmpl.Tree, tmpl.Tree.Root)
+		}
+	}
+	return command, nil
+}
+
+// quoteActions appends shellquote to the pipeline of every action printing a value.
+func quoteActions(tree *parse.Tree, node parse.Node) {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		if node == nil {
+			return
+		}
+		for _, child := range node.Nodes {
+			quoteActions(tree, child)
+		}
+	case *parse.ActionNode:
+		if len(node.Pipe.Decl) > 0 {
+			return
+		}
+		quote := parse.NewIdentifier("shellquote").SetTree(tree).SetPos(node.Pos)
+		node.Pipe.Cmds = append(node.Pipe.Cmds, &parse.CommandNode{NodeType: parse.NodeCommand, Pos: node.Pos, Args: []parse.Node{quote}})
+	case *parse.IfNode:
+		quoteActions(tree, node.List)
+		quoteActions(tree, node.ElseList)
+	case *parse.RangeNode:
+		quoteActions(tree, node.List)
+		quoteActions(tree, node.ElseList)
+	case *parse.WithNode:
+		quoteActions(tree, node.List)
+		quoteActions(tree, node.ElseList)
+	}
+}
+
+// shellQuote renders a JSON value for sh: strings single-quoted, arrays as
+// separately quoted words, numbers and booleans as they are.
+func shellQuote(value any) string {
+	switch value := value.(type) {
+	case nil:
+		return "''"
+	case string:
+		return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+	case json.Number, bool:
+		return fmt.Sprint(value)
+	case []any:
+		words := make([]string, len(value))
+		for i, item := range value {
+			words[i] = shellQuote(item)
+		}
+		return strings.Join(words, " ")
+	default:
+		data, _ := json.Marshal(value)
+		return shellQuote(string(data))
+	}
+}
+
+func runCommandTool(ctx context.Context, command *template.Template, run CommandRunner, timeout time.Duration, input json.RawMessage) (string, error) {
+	args := map[string]any{}
+	if len(bytes.TrimSpace(input)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(input))
+		decoder.UseNumber()
+		if err := decoder.Decode(&args); err != nil {
+			return "", err
+		}
+	}
+
+	var rendered strings.Builder
+	if err := command.Execute(&rendered, args); err != nil {
+		return "", fmt.Errorf("failed to build the command: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := run(ctx, "sh", "-c", rendered.String())
+	// Don't wait forever for processes the command left running.
+	cmd.WaitDelay = 5 * time.Second
+
+	output, err := cmd.CombinedOutput()
+	if len(output) > maxCommandToolOutput {
+		output = append([]byte("[... output truncated]\n"), output[len(output)-maxCommandToolOutput:]...)
+	}
+	result := fmt.Sprintf("Command: %s\nOutput:\n%s", rendered.String(), output)
+
+	// The output goes with the error, since it usually says what went wrong.
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return "", fmt.Errorf("command timed out after %s\n\n%s", timeout, result)
+	}
+	if err != nil {
+		return "", fmt.Errorf("%v\n\n%s", err, result)
+	}
+	return result, nil
+}
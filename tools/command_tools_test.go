@@ -0,0 +1,68 @@
+package tools
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCommandToolQuoting runs command tools with arguments trying to inject
+// commands and checks sh sees each value as the words the template meant.
+func TestCommandToolQuoting(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		input   string
+		want    string
+	}{
+		{"plain", `printf '[%s]' {{.arg}}`, `{"arg": "hello world"}`, "[hello world]"},
+		{"single quote", `printf '[%s]' {{.arg}}`, `{"arg": "it's"}`, "[it's]"},
+		{"closing quote", `printf '[%s]' {{.arg}}`, `{"arg": "'; touch pwned; '"}`, "['; touch pwned; ']"},
+		{"command substitution", `printf '[%s]' {{.arg}}`, `{"arg": "$(touch pwned)"}`, "[$(touch pwned)]"},
+		{"backticks", `printf '[%s]' {{.arg}}`, "{\"arg\": \"`touch pwned`\"}", "[`touch pwned`]"},
+		{"variable", `printf '[%s]' {{.arg}}`, `{"arg": "$HOME"}`, "[$HOME]"},
+		{"separators", `printf '[%s]' {{.arg}}`, `{"arg": "a; touch pwned && b | c > pwned"}`, "[a; touch pwned && b | c > pwned]"},
+		{"newline", `printf '[%s]' {{.arg}}`, `{"arg": "a\ntouch pwned"}`, "[a\ntouch pwned]"},
+		{"glob", `printf '[%s]' {{.arg}}`, `{"arg": "*"}`, "[*]"},
+		{"missing", `printf '[%s]' {{.arg}}`, `{}`, "[]"},
+		{"null", `printf '[%s]' {{.arg}}`, `{"arg": null}`, "[]"},
+		{"number", `printf '[%s]' {{.arg}}`, `{"arg": 42.5}`, "[42.5]"},
+		{"bool", `printf '[%s]' {{.arg}}`, `{"arg": true}`, "[true]"},
+		{"object", `printf '[%s]' {{.arg}}`, `{"arg": {"a": "$(touch pwned)"}}`, `[{"a":"$(touch pwned)"}]`},
+		{"array", `printf '[%s]' {{.args}}`, `{"args": ["a b", "$(touch pwned)", "'"]}`, "[a b][$(touch pwned)][']"},
+		{"adjacent", `printf '[%s]' {{.a}}{{.b}}`, `{"a": "x y", "b": "'; touch pwned"}`, "[x y'; touch pwned]"},
+		{"printf", `printf '[%s]' {{printf "%s-%s" .a .b}}`, `{"a": "$(touch", "b": "pwned)"}`, "[$(touch-pwned)]"},
+		{"pipeline", `printf '[%s]' {{.arg | printf "%s"}}`, `{"arg": "'; touch pwned"}`, "['; touch pwned]"},
+		{"if", `printf '[%s]' {{if .verbose}}-v {{.arg}}{{end}}`, `{"verbose": true, "arg": "$(touch pwned)"}`, "[-v][$(touch pwned)]"},
+		{"else", `printf '[%s]' {{if .verbose}}-v{{else}}{{.arg}}{{end}}`, `{"verbose": false, "arg": "; touch pwned"}`, "[; touch pwned]"},
+		{"nested if in range", `printf '[%s]' {{range .args}}{{if .}}{{.}} {{end}}{{end}}`, `{"args": ["a", "", "$(touch pwned)"]}`, "[a][$(touch pwned)]"},
+		{"range else", `printf '[%s]' {{range .args}}{{.}} {{else}}{{.fallback}}{{end}}`, `{"args": [], "fallback": "'"}`, "[']"},
+		{"range variables", `printf '[%s]' {{range $i, $arg := .args}}{{$i}}={{$arg}} {{end}}`, `{"args": ["$(touch pwned)"]}`, "[0=$(touch pwned)]"},
+		{"with", `printf '[%s]' {{with .arg}}{{.}}{{end}}`, `{"arg": "` + "`touch pwned`" + `"}`, "[`touch pwned`]"},
+		{"declaration", `printf '[%s]' {{$arg := .arg}}{{$arg}}`, `{"arg": "$(touch pwned)"}`, "[$(touch pwned)]"},
+		{"defined template", `{{define "arg"}}{{.}}{{end}}printf '[%s]' {{template "arg" .arg}}`, `{"arg": "$(touch pwned)"}`, "[$(touch pwned)]"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			definition, err := CommandTool{Name: "tool", Description: "test", Command: test.command}.Definition(LocalRunner(dir))
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := definition.Function(context.Background(), []byte(test.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, output, _ := strings.Cut(result, "\nOutput:\n")
+			if output != test.want {
+				t.Errorf("got %q, want %q\n%s", output, test.want, result)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "pwned")); err == nil {
+				t.Errorf("the arguments ran a command\n%s", result)
+			}
+		})
+	}
+}
@@ -0,0 +1,344 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Names Docker Compose looks for, in its order of preference.
+var composeFileNames = []string{"compose.yaml", "compose.yml", "docker-compose.yaml", "docker-compose.yml"}
+
+// findComposeFile returns path, or the compose file in the workspace root if it is empty.
+func (f *Files) findComposeFile(path string) (string, error) {
+	if path != "" {
+		return path, nil
+	}
+	for _, name := range composeFileNames {
+		if _, err := f.fs.Stat(name); err == nil {
+			return name, nil
+		}
+	}
+	return "", fmt.Errorf("no compose file found; looked for %s", strings.Join(composeFileNames, ", "))
+}
+
+// parseCompose returns the document node of a compose file and its services mapping, if any.
+func parseCompose(content string) (*yaml.Node, *yaml.Node, error) {
+	var document yaml.Node
+	if err := yaml.Unmarshal([]byte(content), &document); err != nil {
+		return nil, nil, err
+	}
+	if len(document.Content) == 0 {
+		document = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode}}}
+	}
+	root := document.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("the top level isn't a mapping")
+	}
+	return &document, mappingValue(root, "services"), nil
+}
+
+// mappingValue returns the value of key in a mapping node, or nil.
+func mappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// InspectCompose tool for reading a compose file's services
+type InspectComposeInput struct {
+	Path string `json:"path,omitempty" jsonschema_description:"Path of the compose file. Defaults to compose.yaml or docker-compose.yml in the workspace root."`
+}
+
+var InspectComposeInputSchema = GenerateSchema[InspectComposeInput]()
+
+func (f *Files) InspectComposeDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "inspect_compose",
+		Description: "Summarize a Docker Compose file: each service's image or build, ports, dependencies, environment variable names, volumes and healthcheck, and the named volumes and networks.",
+		InputSchema: InspectComposeInputSchema,
+		Function:    f.InspectCompose,
+		Category:    CategoryRead,
+		Examples: []ToolExample{
+			{Input: `{}`, Output: "compose.yaml: 2 services\n\napi:\n  build: . (Dockerfile)\n  ports: 8080:8080\n  depends_on: db\n  environment: DATABASE_URL, LOG_LEVEL\n\ndb:\n  image: postgres:16\n  volumes: pgdata:/var/lib/postgresql/data\n  healthcheck: yes\n\nVolumes: pgdata"},
+		},
+	}
+}
+
+func (f *Files) InspectCompose(ctx context.Context, input json.RawMessage) (string, error) {
+	inspectInput := InspectComposeInput{}
+	if err := json.Unmarshal(input, &inspectInput); err != nil {
+		return "", err
+	}
+	path, err := f.findComposeFile(inspectInput.Path)
+	if err != nil {
+		return "", err
+	}
+	data, err := f.fs.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	content, _ := decodeText(data)
+	document, services, err := parseCompose(content)
+	if err != nil {
+		return "", fmt.Errorf("invalid compose file %s: %v", path, err)
+	}
+
+	var result strings.Builder
+	count := 0
+	if services != nil {
+		count = len(services.Content) / 2
+	}
+	fmt.Fprintf(&result, "%s: %d services\n", path, count)
+	for i := 0; services != nil && i+1 < len(services.Content); i += 2 {
+		service := services.Content[i+1]
+		fmt.Fprintf(&result, "\n%s:\n", services.Content[i].Value)
+		if image := mappingValue(service, "image"); image != nil {
+			fmt.Fprintf(&result, "  image: %s\n", image.Value)
+		}
+		if build := mappingValue(service, "build"); build != nil {
+			if build.Kind == yaml.ScalarNode {
+				fmt.Fprintf(&result, "  build: %s\n", build.Value)
+			} else {
+				dockerfile := "Dockerfile"
+				if value := mappingValue(build, "dockerfile"); value != nil {
+					dockerfile = value.Value
+				}
+				buildContext := "."
+				if value := mappingValue(build, "context"); value != nil {
+					buildContext = value.Value
+				}
+				fmt.Fprintf(&result, "  build: %s (%s)\n", buildContext, dockerfile)
+			}
+		}
+		for _, key := range []string{"command", "ports", "depends_on", "environment", "env_file", "volumes", "networks", "profiles"} {
+			if value := mappingValue(service, key); value != nil {
+				fmt.Fprintf(&result, "  %s: %s\n", key, strings.Join(composeList(value, key == "environment"), ", "))
+			}
+		}
+		if mappingValue(service, "healthcheck") != nil {
+			result.WriteString("  healthcheck: yes\n")
+		}
+	}
+
+	for _, key := range []string{"volumes", "networks", "secrets"} {
+		if value := mappingValue(document.Content[0], key); value != nil {
+			fmt.Fprintf(&result, "\n%s%s: %s\n", strings.ToUpper(key[:1]), key[1:], strings.Join(composeList(value, false), ", "))
+		}
+	}
+	return result.String(), nil
+}
+
+// composeList renders a scalar, list or mapping's keys as a list. Only the names
+// of environment variables are shown, since values may be secrets.
+func composeList(node *yaml.Node, namesOnly bool) []string {
+	var items []string
+	switch node.Kind {
+	case yaml.ScalarNode:
+		items = append(items, node.Value)
+	case yaml.SequenceNode:
+		for _, item := range node.Content {
+			value := item.Value
+			if item.Kind == yaml.MappingNode {
+				// Long syntax, e.g. {target: 80, published: 8080}: show it inline.
+				var long map[string]any
+				item.Decode(&long)
+				data, _ := json.Marshal(long)
+				value = string(data)
+			}
+			if namesOnly {
+				value, _, _ = strings.Cut(value, "=")
+			}
+			items = append(items, value)
+		}
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			items = append(items, node.Content[i].Value)
+		}
+	}
+	return items
+}
+
+// EditCompose tool for changing a compose file's services
+type EditComposeInput struct {
+	Path          string                     `json:"path,omitempty" jsonschema_description:"Path of the compose file. Defaults to compose.yaml or docker-compose.yml in the workspace root."`
+	Service       string                     `json:"service" jsonschema:"minLength=1" jsonschema_description:"The service to change or create."`
+	Set           map[string]json.RawMessage `json:"set,omitempty" jsonschema_description:"Keys to set on the service, as dotted paths, to JSON values, e.g. {\"image\": \"redis:7\", \"ports\": [\"6379:6379\"], \"deploy.resources.limits.memory\": \"512m\"}."`
+	Remove        []string                   `json:"remove,omitempty" jsonschema_description:"Dotted paths of keys to remove from the service, e.g. [\"environment.DEBUG\"]."`
+	DeleteService bool                       `json:"delete_service,omitempty" jsonschema_description:"Remove the whole service."`
+}
+
+var EditComposeInputSchema = GenerateSchema[EditComposeInput]()
+
+func (f *Files) EditComposeDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "edit_compose",
+		Description: "Change a service in a Docker Compose file structurally: set or remove keys by dotted path, add a service, or delete one. Comments and the order of existing keys are kept.",
+		InputSchema: EditComposeInputSchema,
+		Function:    f.EditCompose,
+		Category:    CategoryWrite,
+		Examples: []ToolExample{
+			{Input: `{"service": "cache", "set": {"image": "redis:7-alpine", "ports": ["6379:6379"]}}`, Output: "Updated service cache in compose.yaml: set image, ports"},
+		},
+	}
+}
+
+func (f *Files) EditCompose(ctx context.Context, input json.RawMessage) (string, error) {
+	editInput := EditComposeInput{}
+	if err := json.Unmarshal(input, &editInput); err != nil {
+		return "", err
+	}
+	if len(editInput.Set) == 0 && len(editInput.Remove) == 0 && !editInput.DeleteService {
+		return "", fmt.Errorf("nothing to do: give set, remove or delete_service")
+	}
+	path, err := f.findComposeFile(editInput.Path)
+	if err != nil {
+		return "", err
+	}
+
+	var summary string
+	change, err := f.edit(ctx, path, func(content string) (string, error) {
+		document, services, err := parseCompose(content)
+		if err != nil {
+			return "", fmt.Errorf("invalid compose file %s: %v", path, err)
+		}
+		if services == nil {
+			services = &yaml.Node{Kind: yaml.MappingNode}
+			root := document.Content[0]
+			root.Content = append(root.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: "services"}, services)
+		}
+
+		if editInput.DeleteService {
+			if !removeKey(services, []string{editInput.Service}) {
+				return "", fmt.Errorf("no service %s", editInput.Service)
+			}
+			summary = fmt.Sprintf("Deleted service %s from %s", editInput.Service, path)
+		} else {
+			service := mappingValue(services, editInput.Service)
+			created := service == nil
+			if created {
+				service = &yaml.Node{Kind: yaml.MappingNode}
+				services.Content = append(services.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: editInput.Service}, service)
+			}
+
+			keys := make([]string, 0, len(editInput.Set))
+			for key := range editInput.Set {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				var value any
+				if err := json.Unmarshal(editInput.Set[key], &value); err != nil {
+					return "", fmt.Errorf("invalid value for %s: %v", key, err)
+				}
+				var node yaml.Node
+				if err := node.Encode(value); err != nil {
+					return "", err
+				}
+				if err := setKey(service, strings.Split(key, "."), &node); err != nil {
+					return "", fmt.Errorf("can't set %s: %v", key, err)
+				}
+			}
+			for _, key := range editInput.Remove {
+				if !removeKey(service, strings.Split(key, ".")) {
+					return "", fmt.Errorf("service %s has no %s", editInput.Service, key)
+				}
+			}
+
+			verb := "Updated"
+			if created {
+				verb = "Added"
+			}
+			var done []string
+			if len(keys) > 0 {
+				done = append(done, "set "+strings.Join(keys, ", "))
+			}
+			if len(editInput.Remove) > 0 {
+				done = append(done, "removed "+strings.Join(editInput.Remove, ", "))
+			}
+			summary = fmt.Sprintf("%s service %s in %s: %s", verb, editInput.Service, path, strings.Join(done, "; "))
+		}
+
+		var out bytes.Buffer
+		encoder := yaml.NewEncoder(&out)
+		encoder.SetIndent(yamlIndent(content))
+		if err := encoder.Encode(document); err != nil {
+			return "", err
+		}
+		encoder.Close()
+		return out.String(), nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return withFileChange(summary, change), nil
+}
+
+// setKey sets the value at a dotted path, creating mappings along the way.
+func setKey(mapping *yaml.Node, path []string, value *yaml.Node) error {
+	for _, key := range path[:len(path)-1] {
+		next := mappingValue(mapping, key)
+		if next == nil {
+			next = &yaml.Node{Kind: yaml.MappingNode}
+			mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, next)
+		}
+		if next.Kind != yaml.MappingNode {
+			return fmt.Errorf("%s isn't a mapping; set it whole instead", key)
+		}
+		mapping = next
+	}
+
+	last := path[len(path)-1]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == last {
+			// Keep comments attached to the old value.
+			value.HeadComment, value.LineComment = mapping.Content[i+1].HeadComment, mapping.Content[i+1].LineComment
+			mapping.Content[i+1] = value
+			return nil
+		}
+	}
+	mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: last}, value)
+	return nil
+}
+
+// removeKey removes the key at a dotted path, reporting whether it was there.
+func removeKey(mapping *yaml.Node, path []string) bool {
+	for _, key := range path[:len(path)-1] {
+		if mapping = mappingValue(mapping, key); mapping == nil {
+			return false
+		}
+	}
+	if mapping.Kind != yaml.MappingNode {
+		return false
+	}
+	last := path[len(path)-1]
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == last {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// yamlIndent guesses the indentation a YAML file uses, so rewriting it keeps its style.
+func yamlIndent(content string) int {
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if indent := len(line) - len(trimmed); indent > 0 && trimmed != "" && !strings.HasPrefix(trimmed, "#") {
+			return indent
+		}
+	}
+	return 2
+}
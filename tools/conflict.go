@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+)
+
+// readRecord is what a file looked like when the model last read or wrote it.
+type readRecord struct {
+	hash    [sha256.Size]byte
+	content string
+}
+
+func recordKey(path string) string {
+	return filepath.Clean(path)
+}
+
+// recordRead remembers the content the model has seen for path.
+func (f *Files) recordRead(path string, content []byte) {
+	f.readsMu.Lock()
+	defer f.readsMu.Unlock()
+
+	f.reads[recordKey(path)] = readRecord{hash: sha256.Sum256(content), content: string(content)}
+}
+
+// checkConflict fails if path changed on disk since the model last read it,
+// returning the changes it hasn't seen so it can re-read and merge.
+func (f *Files) checkConflict(path string) error {
+	f.readsMu.Lock()
+	record, ok := f.reads[recordKey(path)]
+	f.readsMu.Unlock()
+
+	if !ok {
+		return nil
+	}
+
+	current, err := f.fs.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("conflict: %s was deleted since you last read it. Set force to true to recreate it", path)
+	}
+	if err != nil {
+		return err
+	}
+
+	if sha256.Sum256(current) == record.hash {
+		return nil
+	}
+
+	return fmt.Errorf("conflict: %s changed on disk since you last read it. Re-read it and merge your changes, or set force to true to overwrite. Changes since your read:\n%s",
+		path, UnifiedDiff(recordKey(path), record.content, string(current)))
+}
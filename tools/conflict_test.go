@@ -0,0 +1,26 @@
+package tools
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+// TestConflictAcrossFiles checks file tools recreated with the same records
+// still notice a file changed since the model read it.
+func TestConflictAcrossFiles(t *testing.T) {
+	fsys := NewMemFS(map[string]string{"main.go": "package main\n"})
+	records := NewFileRecords()
+
+	if _, err := NewFiles(fsys, records).ReadFile(context.Background(), []byte(`{"path": "main.go"}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := fsys.WriteFile("main.go", []byte("package main // changed\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := NewFiles(fsys, records).WriteFile(context.Background(), []byte(`{"path": "main.go", "content": "package main\n\nfunc main() {}\n"}`))
+	if err == nil || !strings.HasPrefix(err.Error(), "conflict:") {
+		t.Errorf("writing a file changed since it was read = %v, want a conflict", err)
+	}
+}
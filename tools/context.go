@@ -0,0 +1,17 @@
+package tools
+
+import "context"
+
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying the ID of the request a turn answers,
+// forwarded to other agents as X-Request-ID so their logs can be correlated.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by ctx, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
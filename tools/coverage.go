@@ -0,0 +1,189 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Profile written by analyze_coverage in the module directory, removed afterwards.
+const coverageProfile = ".agent-coverage.out"
+
+// Most functions and files listed in a coverage report.
+const maxCoverageEntries = 30
+
+// AnalyzeCoverage tool for finding untested code
+type AnalyzeCoverageInput struct {
+	Package string `json:"package,omitempty" jsonschema:"default=./..." jsonschema_description:"Package pattern to test, e.g. ./internal/parser. Defaults to ./..."`
+}
+
+var AnalyzeCoverageInputSchema = GenerateSchema[AnalyzeCoverageInput]()
+
+func (g *GoTools) AnalyzeCoverageDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "analyze_coverage",
+		Description: "Run the package's tests with coverage and report the functions and line ranges the tests don't cover. Use this to decide which tests to write.",
+		InputSchema: AnalyzeCoverageInputSchema,
+		Function:    g.AnalyzeCoverage,
+		Examples: []ToolExample{
+			{Input: `{"package": "./parser"}`, Output: "Total coverage: 71.4%\n\nLeast covered functions:\n  0.0%  parser/errors.go:12 Wrap\n  50.0% parser/parse.go:40 Parse\n\nUncovered lines:\n  parser/errors.go: 12-18\n  parser/parse.go: 52-55, 61"},
+		},
+	}
+}
+
+func (g *GoTools) AnalyzeCoverage(ctx context.Context, input json.RawMessage) (string, error) {
+	coverageInput := AnalyzeCoverageInput{}
+
+	err := json.Unmarshal(input, &coverageInput)
+	if err != nil {
+		return "", err
+	}
+	if coverageInput.Package == "" {
+		coverageInput.Package = "./..."
+	}
+
+	defer g.run(context.Background(), "rm", "-f", coverageProfile).Run()
+
+	testOutput, err := g.run(ctx, "go", "test", "-coverprofile="+coverageProfile, coverageInput.Package).CombinedOutput()
+	testsFailed := err != nil
+
+	// Profiles are read through the runner so this works inside containers too.
+	profile, err := g.output(ctx, "cat", coverageProfile)
+	if err != nil {
+		return "", fmt.Errorf("tests produced no coverage profile:\n%s", testOutput)
+	}
+
+	functions, err := g.output(ctx, "go", "tool", "cover", "-func="+coverageProfile)
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	if testsFailed {
+		result.WriteString(fmt.Sprintf("Warning: some tests failed, so coverage may be incomplete:\n%s\n", testOutput))
+	}
+	result.WriteString(formatFunctionCoverage(string(functions)))
+	result.WriteString(formatUncoveredLines(string(profile)))
+	return result.String(), nil
+}
+
+// formatFunctionCoverage summarizes `go tool cover -func` output: the total and
+// the least covered functions.
+func formatFunctionCoverage(output string) string {
+	type function struct {
+		location string
+		name     string
+		percent  float64
+	}
+
+	total := ""
+	var functions []function
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		if fields[0] == "total:" {
+			total = fields[2]
+			continue
+		}
+
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(fields[2], "%"), 64)
+		if err != nil || percent == 100 {
+			continue
+		}
+		functions = append(functions, function{location: strings.TrimSuffix(fields[0], ":"), name: fields[1], percent: percent})
+	}
+
+	sort.SliceStable(functions, func(i, j int) bool { return functions[i].percent < functions[j].percent })
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("Total coverage: %s\n", total))
+	if len(functions) == 0 {
+		result.WriteString("\nAll functions are fully covered.\n")
+		return result.String()
+	}
+
+	result.WriteString("\nLeast covered functions:\n")
+	for i, f := range functions {
+		if i == maxCoverageEntries {
+			result.WriteString(fmt.Sprintf("  ... and %d more\n", len(functions)-i))
+			break
+		}
+		result.WriteString(fmt.Sprintf("  %-5s %s %s\n", strconv.FormatFloat(f.percent, 'f', 1, 64)+"%", f.location, f.name))
+	}
+	return result.String()
+}
+
+// formatUncoveredLines lists, per file, the line ranges of blocks no test executed.
+func formatUncoveredLines(profile string) string {
+	uncovered := map[string][][2]int{}
+
+	for _, line := range strings.Split(profile, "\n") {
+		// file.go:startLine.startCol,endLine.endCol statements count
+		fields := strings.Fields(line)
+		if len(fields) != 3 || fields[2] != "0" {
+			continue
+		}
+
+		colon := strings.LastIndex(fields[0], ":")
+		if colon < 0 {
+			continue
+		}
+		file := fields[0][:colon]
+
+		var startLine, startCol, endLine, endCol int
+		if _, err := fmt.Sscanf(fields[0][colon+1:], "%d.%d,%d.%d", &startLine, &startCol, &endLine, &endCol); err != nil {
+			continue
+		}
+		uncovered[file] = append(uncovered[file], [2]int{startLine, endLine})
+	}
+
+	if len(uncovered) == 0 {
+		return ""
+	}
+
+	files := make([]string, 0, len(uncovered))
+	for file := range uncovered {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	var result strings.Builder
+	result.WriteString("\nUncovered lines:\n")
+	for i, file := range files {
+		if i == maxCoverageEntries {
+			result.WriteString(fmt.Sprintf("  ... and %d more files\n", len(files)-i))
+			break
+		}
+		result.WriteString(fmt.Sprintf("  %s: %s\n", file, formatLineRanges(uncovered[file])))
+	}
+	return result.String()
+}
+
+// formatLineRanges merges overlapping or adjacent ranges, e.g. "12-18, 25".
+func formatLineRanges(ranges [][2]int) string {
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i][0] < ranges[j][0] })
+
+	var merged [][2]int
+	for _, r := range ranges {
+		if len(merged) > 0 && r[0] <= merged[len(merged)-1][1]+1 {
+			merged[len(merged)-1][1] = max(merged[len(merged)-1][1], r[1])
+			continue
+		}
+		merged = append(merged, r)
+	}
+
+	parts := make([]string, len(merged))
+	for i, r := range merged {
+		if r[0] == r[1] {
+			parts[i] = strconv.Itoa(r[0])
+		} else {
+			parts[i] = fmt.Sprintf("%d-%d", r[0], r[1])
+		}
+	}
+	return strings.Join(parts, ", ")
+}
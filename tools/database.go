@@ -0,0 +1,375 @@
+package tools
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	_ "github.com/go-sql-driver/mysql"
+	_ "github.com/lib/pq"
+	_ "modernc.org/sqlite"
+)
+
+// Longest value shown in a query result cell.
+const maxCellLength = 200
+
+// Statements allowed in read-only mode.
+var readOnlyStatement = regexp.MustCompile(`(?is)^\s*(select|with|show|explain|describe|desc|pragma|values)\b`)
+
+// DatabaseConfig says which database the database tools connect to.
+type DatabaseConfig struct {
+	// Driver is "postgres", "mysql" or "sqlite".
+	Driver string
+	DSN    string
+	// ReadWrite allows statements that modify data or schema.
+	ReadWrite bool
+	// MaxRows caps the rows returned per query.
+	MaxRows int
+}
+
+// DatabaseConfigFromEnv reads DB_DRIVER, DB_DSN, DB_READ_WRITE=on and DB_MAX_ROWS
+// (default 100). It returns false if DB_DSN isn't set.
+func DatabaseConfigFromEnv() (DatabaseConfig, bool) {
+	config := DatabaseConfig{
+		Driver:    os.Getenv("DB_DRIVER"),
+		DSN:       os.Getenv("DB_DSN"),
+		ReadWrite: os.Getenv("DB_READ_WRITE") == "on",
+		MaxRows:   100,
+	}
+	if value := os.Getenv("DB_MAX_ROWS"); value != "" {
+		maxRows, err := strconv.Atoi(value)
+		if err != nil || maxRows < 1 {
+			fmt.Printf("Invalid DB_MAX_ROWS %q, using %d\n", value, config.MaxRows)
+		} else {
+			config.MaxRows = maxRows
+		}
+	}
+	return config, config.DSN != ""
+}
+
+// Database holds the tools that inspect and query a SQL database.
+type Database struct {
+	db     *sql.DB
+	config DatabaseConfig
+}
+
+// NewDatabase connects to the configured database. In read-only mode SQLite
+// files are opened read-only, PostgreSQL sessions default to read-only
+// transactions, and each query runs in a read-only transaction that is rolled
+// back. Connecting as a role that can only read is safer still.
+func NewDatabase(config DatabaseConfig) (*Database, error) {
+	driver, dsn := config.Driver, config.DSN
+	switch driver {
+	case "postgres":
+		if !config.ReadWrite {
+			dsn = postgresReadOnly(dsn)
+		}
+	case "mysql":
+	case "sqlite":
+		if !config.ReadWrite {
+			dsn = sqliteReadOnly(dsn)
+		}
+	default:
+		return nil, fmt.Errorf("unknown database driver %q; valid values are postgres, mysql or sqlite", driver)
+	}
+
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %v", err)
+	}
+	return &Database{db: db, config: config}, nil
+}
+
+func sqliteReadOnly(dsn string) string {
+	if !strings.HasPrefix(dsn, "file:") {
+		dsn = "file:" + dsn
+	}
+	if strings.Contains(dsn, "?") {
+		return dsn + "&mode=ro"
+	}
+	return dsn + "?mode=ro"
+}
+
+// postgresReadOnly makes the session's transactions read-only by default, so a
+// statement ending the tool's read-only transaction can't write either.
+func postgresReadOnly(dsn string) string {
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		if strings.Contains(dsn, "?") {
+			return dsn + "&default_transaction_read_only=on"
+		}
+		return dsn + "?default_transaction_read_only=on"
+	}
+	return dsn + " default_transaction_read_only=on"
+}
+
+// multipleStatements reports whether query holds more than one statement,
+// ignoring semicolons in comments, quoted strings and identifiers, and
+// PostgreSQL's dollar-quoted strings.
+func multipleStatements(query string) bool {
+	ended := false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '-' && strings.HasPrefix(query[i:], "--"):
+			end := strings.IndexByte(query[i:], '\n')
+			if end < 0 {
+				return false
+			}
+			i += end
+			continue
+		case c == '/' && strings.HasPrefix(query[i:], "/*"):
+			end := strings.Index(query[i+2:], "*/")
+			if end < 0 {
+				return false
+			}
+			i += end + 3
+			continue
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			continue
+		}
+		if ended {
+			return true
+		}
+
+		switch c {
+		case ';':
+			ended = true
+		case '\'', '"', '`':
+			// Quotes are escaped by doubling them, which this skips as two strings.
+			end := strings.IndexByte(query[i+1:], c)
+			if end < 0 {
+				return false
+			}
+			i += end + 1
+		case '$':
+			tag := dollarQuote.FindString(query[i:])
+			if tag == "" {
+				continue
+			}
+			end := strings.Index(query[i+len(tag):], tag)
+			if end < 0 {
+				return false
+			}
+			i += len(tag) + end + len(tag) - 1
+		}
+	}
+	return false
+}
+
+// Opening tag of a PostgreSQL dollar-quoted string, e.g. $$ or $body$.
+var dollarQuote = regexp.MustCompile(`^\$([A-Za-z_][A-Za-z0-9_]*)?\$`)
+
+func (d *Database) Definitions() []ToolDefinition {
+	return []ToolDefinition{
+		d.QueryDatabaseDefinition(),
+		d.DescribeDatabaseDefinition(),
+	}
+}
+
+func (d *Database) Close() error {
+	return d.db.Close()
+}
+
+// QueryDatabase tool for running SQL
+type QueryDatabaseInput struct {
+	Query string `json:"query" jsonschema:"minLength=1" jsonschema_description:"The SQL statement to run."`
+}
+
+var QueryDatabaseInputSchema = GenerateSchema[QueryDatabaseInput]()
+
+func (d *Database) QueryDatabaseDefinition() ToolDefinition {
+	mode := "The connection is read-only: only single SELECT, WITH, SHOW, EXPLAIN, DESCRIBE and PRAGMA statements are allowed."
+	category := CategoryRead
+	if d.config.ReadWrite {
+		mode = "The connection can modify data, so be careful with statements other than SELECT."
+		category = CategoryWrite
+	}
+
+	return ToolDefinition{
+		Name:        "query_database",
+		Description: fmt.Sprintf("Run a SQL statement against the project's %s database and return up to %d rows. Use this to look at sample data while writing data-access code. %s", d.config.Driver, d.config.MaxRows, mode),
+		InputSchema: QueryDatabaseInputSchema,
+		Function:    d.QueryDatabase,
+		Category:    category,
+		Examples: []ToolExample{
+			{Input: `{"query": "SELECT id, email FROM users ORDER BY id LIMIT 2"}`, Output: "id | email\n---|------\n1 | ada@example.com\n2 | alan@example.com\n(2 rows)"},
+		},
+	}
+}
+
+func (d *Database) QueryDatabase(ctx context.Context, input json.RawMessage) (string, error) {
+	queryInput := QueryDatabaseInput{}
+
+	err := json.Unmarshal(input, &queryInput)
+	if err != nil {
+		return "", err
+	}
+
+	if !d.config.ReadWrite && !readOnlyStatement.MatchString(queryInput.Query) {
+		return "", fmt.Errorf("the database is read-only; only SELECT, WITH, SHOW, EXPLAIN, DESCRIBE and PRAGMA statements are allowed")
+	}
+	if !d.config.ReadWrite && multipleStatements(queryInput.Query) {
+		return "", fmt.Errorf("the database is read-only; run one statement at a time")
+	}
+
+	return d.query(ctx, queryInput.Query)
+}
+
+// DescribeDatabase tool for inspecting the schema
+type DescribeDatabaseInput struct {
+	Table string `json:"table,omitempty" jsonschema_description:"Table to show the columns of. Lists all tables if omitted."`
+}
+
+var DescribeDatabaseInputSchema = GenerateSchema[DescribeDatabaseInput]()
+
+func (d *Database) DescribeDatabaseDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "describe_database",
+		Description: "List the tables in the project's database, or the columns of one table with their types and nullability. Use this before writing queries or data-access code.",
+		InputSchema: DescribeDatabaseInputSchema,
+		Function:    d.DescribeDatabase,
+		Category:    CategoryRead,
+		Examples: []ToolExample{
+			{Input: `{"table": "users"}`, Output: "column | type | nullable\n-------|------|---------\nid | integer | NO\nemail | text | NO\n(2 rows)"},
+		},
+	}
+}
+
+func (d *Database) DescribeDatabase(ctx context.Context, input json.RawMessage) (string, error) {
+	describeInput := DescribeDatabaseInput{}
+
+	err := json.Unmarshal(input, &describeInput)
+	if err != nil {
+		return "", err
+	}
+
+	table := describeInput.Table
+	switch {
+	case d.config.Driver == "sqlite" && table == "":
+		return d.query(ctx, "SELECT name AS table_name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	case d.config.Driver == "sqlite":
+		return d.query(ctx, `SELECT name AS "column", type, CASE "notnull" WHEN 1 THEN 'NO' ELSE 'YES' END AS nullable FROM pragma_table_info(?) ORDER BY cid`, table)
+	case d.config.Driver == "postgres" && table == "":
+		return d.query(ctx, "SELECT table_schema, table_name FROM information_schema.tables WHERE table_schema NOT IN ('pg_catalog', 'information_schema') ORDER BY 1, 2")
+	case d.config.Driver == "postgres":
+		return d.query(ctx, `SELECT column_name AS "column", data_type AS type, is_nullable AS nullable FROM information_schema.columns WHERE table_name = $1 ORDER BY ordinal_position`, table)
+	case table == "":
+		return d.query(ctx, "SELECT table_name FROM information_schema.tables WHERE table_schema = DATABASE() ORDER BY table_name")
+	default:
+		return d.query(ctx, "SELECT column_name AS `column`, column_type AS type, is_nullable AS nullable FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ordinal_position", table)
+	}
+}
+
+// query runs a statement and formats up to MaxRows rows as a table.
+func (d *Database) query(ctx context.Context, query string, args ...any) (string, error) {
+	// SQLite is opened read-only instead; its driver doesn't support read-only transactions.
+	tx, err := d.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: !d.config.ReadWrite && d.config.Driver != "sqlite"})
+	if err != nil {
+		return "", err
+	}
+	committed := false
+	defer func() {
+		if !committed {
+			tx.Rollback()
+		}
+	}()
+
+	// A prepared statement is sent with the extended protocol, which runs one
+	// statement only, where a query without arguments could run several.
+	var rows *sql.Rows
+	if d.config.ReadWrite {
+		rows, err = tx.QueryContext(ctx, query, args...)
+	} else {
+		var stmt *sql.Stmt
+		stmt, err = tx.PrepareContext(ctx, query)
+		if err != nil {
+			return "", err
+		}
+		defer stmt.Close()
+		rows, err = stmt.QueryContext(ctx, args...)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+
+	var result strings.Builder
+	if len(columns) > 0 {
+		result.WriteString(strings.Join(columns, " | ") + "\n")
+		separators := make([]string, len(columns))
+		for i, column := range columns {
+			separators[i] = strings.Repeat("-", max(len(column), 3))
+		}
+		result.WriteString(strings.Join(separators, "|") + "\n")
+	}
+
+	values := make([]any, len(columns))
+	pointers := make([]any, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+
+	count, truncated := 0, false
+	for rows.Next() {
+		if count == d.config.MaxRows {
+			truncated = true
+			break
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return "", err
+		}
+
+		cells := make([]string, len(values))
+		for i, value := range values {
+			cells[i] = formatCell(value)
+		}
+		result.WriteString(strings.Join(cells, " | ") + "\n")
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	rows.Close()
+
+	if d.config.ReadWrite {
+		if err := tx.Commit(); err != nil {
+			return "", err
+		}
+		committed = true
+	}
+
+	if truncated {
+		result.WriteString(fmt.Sprintf("(showing the first %d rows; add a LIMIT or a WHERE clause to narrow the results)", count))
+	} else {
+		result.WriteString(fmt.Sprintf("(%d rows)", count))
+	}
+	return result.String(), nil
+}
+
+func formatCell(value any) string {
+	var text string
+	switch v := value.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		text = string(v)
+	default:
+		text = fmt.Sprint(v)
+	}
+
+	text = strings.ReplaceAll(text, "\n", "\\n")
+	if len(text) > maxCellLength {
+		text = text[:maxCellLength] + "..."
+	}
+	return text
+}
@@ -0,0 +1,168 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kartikx/agent/bus"
+)
+
+// Subtasks of one delegate_subtasks call running at the same time.
+const delegateConcurrency = 5
+
+// DelegateAgents returns the agents subtasks can be delegated to, by name: the
+// documentation agent as "doc", plus those in DELEGATE_AGENTS, e.g.
+// "tester=http://tester-agent-service:8080/coder,reviewer=http://reviewer:8080/coder".
+func DelegateAgents() map[string]string {
+	agents := map[string]string{"doc": docAgentURL()}
+	for _, entry := range strings.Split(os.Getenv("DELEGATE_AGENTS"), ",") {
+		name, url, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if ok && name != "" && url != "" {
+			agents[strings.TrimSpace(name)] = strings.TrimSpace(url)
+		}
+	}
+	return agents
+}
+
+// DelegateSubtasks tool for fanning independent subtasks out to other agents
+type DelegateSubtasksInput struct {
+	Subtasks []Subtask `json:"subtasks" jsonschema:"minItems=1,maxItems=10" jsonschema_description:"Independent subtasks, run at the same time. Each must make sense on its own: the agents don't see this conversation or each other's results."`
+}
+
+type Subtask struct {
+	Agent          string `json:"agent" jsonschema:"minLength=1" jsonschema_description:"The agent to give the subtask to, e.g. doc for documentation lookups."`
+	Task           string `json:"task" jsonschema:"minLength=1" jsonschema_description:"What the agent should do, with all the context it needs."`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty" jsonschema:"minimum=5,maximum=600" jsonschema_description:"How long to wait for this subtask. Defaults to the documentation agent timeout."`
+}
+
+var DelegateSubtasksInputSchema = GenerateSchema[DelegateSubtasksInput]()
+
+var DelegateSubtasksDefinition = ToolDefinition{
+	Name:        "delegate_subtasks",
+	Description: "Give several independent subtasks to other agents at once, e.g. looking up two packages with doc while another agent writes tests, and get all their results in one reply. A subtask that fails or times out is reported without failing the others. Use invoke_documentation_agent instead for documentation lookups alone.",
+	InputSchema: DelegateSubtasksInputSchema,
+	Function:    DelegateSubtasks,
+	Examples: []ToolExample{
+		{Input: `{"subtasks": [{"agent": "doc", "task": "How do I stream a response with net/http?"}, {"agent": "tester", "task": "Write table-driven tests for ParseDuration in timeutil/parse.go", "timeout_seconds": 300}]}`, Output: "2 of 2 subtasks succeeded.\n\n## 1. doc (ok, 4.1s)\n\nUse http.Flusher ...\n\n## 2. tester (ok, 41.7s)\n\nAdded timeutil/parse_test.go ..."},
+	},
+}
+
+// subtaskResult is the outcome of one subtask.
+type subtaskResult struct {
+	answer   string
+	err      error
+	duration time.Duration
+}
+
+func DelegateSubtasks(ctx context.Context, input json.RawMessage) (string, error) {
+	delegateInput := DelegateSubtasksInput{}
+
+	err := json.Unmarshal(input, &delegateInput)
+	if err != nil {
+		return "", err
+	}
+
+	// Catch unknown agents before starting anything.
+	agents := DelegateAgents()
+	for _, subtask := range delegateInput.Subtasks {
+		if _, ok := agents[subtask.Agent]; !ok {
+			names := make([]string, 0, len(agents))
+			for name := range agents {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			return "", fmt.Errorf("unknown agent %q; available agents are %s", subtask.Agent, strings.Join(names, ", "))
+		}
+	}
+
+	fmt.Printf("Delegating %d subtasks\n", len(delegateInput.Subtasks))
+
+	results := make([]subtaskResult, len(delegateInput.Subtasks))
+	slots := make(chan struct{}, delegateConcurrency)
+	var wg sync.WaitGroup
+	for i, subtask := range delegateInput.Subtasks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			start := time.Now()
+			answer, err := runSubtask(ctx, subtask, agents[subtask.Agent])
+			results[i] = subtaskResult{answer: answer, err: err, duration: time.Since(start)}
+		}()
+	}
+	wg.Wait()
+
+	return aggregateSubtasks(delegateInput.Subtasks, results)
+}
+
+// runSubtask sends a subtask to an agent in a session of its own, so that
+// subtasks given to the same agent don't see each other.
+func runSubtask(ctx context.Context, subtask Subtask, url string) (string, error) {
+	timeout := docAgentTimeout()
+	if subtask.TimeoutSeconds > 0 {
+		timeout = time.Duration(subtask.TimeoutSeconds) * time.Second
+	}
+
+	body := map[string]any{"query": subtask.Task}
+
+	// The documentation agent is reached over the bus when there is one.
+	if busURL := os.Getenv("BUS_URL"); busURL != "" && subtask.Agent == "doc" {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		data, _ := json.Marshal(body)
+		answer, err := bus.Send(ctx, busURL, bus.Stream("doc"), string(data), RequestID(ctx))
+		if errors.Is(err, context.DeadlineExceeded) {
+			return "", fmt.Errorf("doc agent did not answer within %s", timeout)
+		}
+		return answer, err
+	}
+
+	session := make([]byte, 8)
+	rand.Read(session)
+	respBytes, err := postToAgent(ctx, subtask.Agent+" agent", url, "", body, timeout, "subtask-"+hex.EncodeToString(session))
+	if err != nil {
+		return "", err
+	}
+	return string(respBytes), nil
+}
+
+// aggregateSubtasks combines the results into one reply, failing only if every subtask failed.
+func aggregateSubtasks(subtasks []Subtask, results []subtaskResult) (string, error) {
+	succeeded := 0
+	var body strings.Builder
+	for i, subtask := range subtasks {
+		result := results[i]
+		status := "ok"
+		text := result.answer
+		if result.err != nil {
+			status = "failed"
+			text = fmt.Sprintf("Error: %v", result.err)
+		} else {
+			succeeded++
+		}
+		fmt.Fprintf(&body, "## %d. %s (%s, %.1fs)\n\n%s\n\n", i+1, subtask.Agent, status, result.duration.Seconds(), strings.TrimSpace(text))
+	}
+
+	summary := fmt.Sprintf("%d of %d subtasks succeeded.", succeeded, len(subtasks))
+	if succeeded < len(subtasks) {
+		summary += " Retry or work around the failed ones; the results of the others are below."
+	}
+	reply := summary + "\n\n" + strings.TrimSpace(body.String())
+
+	if succeeded == 0 {
+		return reply, fmt.Errorf("%s", reply)
+	}
+	return reply, nil
+}
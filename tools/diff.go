@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Above this many line pairs the diff is skipped rather than computed.
+const maxDiffCells = 4_000_000
+
+// Lines of unchanged context around each hunk.
+const diffContext = 3
+
+type diffOp struct {
+	kind byte // ' ', '-', '+'
+	line string
+}
+
+// UnifiedDiff returns a unified diff between two versions of a file, or "" if they are equal.
+func UnifiedDiff(path string, before string, after string) string {
+	if before == after {
+		return ""
+	}
+
+	a := splitLines(before)
+	b := splitLines(after)
+	if len(a)*len(b) > maxDiffCells {
+		return fmt.Sprintf("--- a/%s\n+++ b/%s\n(file too large to diff: %d -> %d lines)\n", path, path, len(a), len(b))
+	}
+
+	ops := diffLines(a, b)
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("--- a/%s\n+++ b/%s\n", path, path))
+
+	for start := 0; start < len(ops); {
+		// Find the next change.
+		for start < len(ops) && ops[start].kind == ' ' {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+
+		// Extend the hunk while changes are within 2*context lines of each other.
+		end := start
+		for i := start; i < len(ops); i++ {
+			if ops[i].kind != ' ' {
+				end = i + 1
+			} else if i-end >= 2*diffContext {
+				break
+			}
+		}
+
+		from := max(start-diffContext, 0)
+		to := min(end+diffContext, len(ops))
+
+		oldStart, newStart := 1, 1
+		for _, op := range ops[:from] {
+			if op.kind != '+' {
+				oldStart++
+			}
+			if op.kind != '-' {
+				newStart++
+			}
+		}
+		oldCount, newCount := 0, 0
+		for _, op := range ops[from:to] {
+			if op.kind != '+' {
+				oldCount++
+			}
+			if op.kind != '-' {
+				newCount++
+			}
+		}
+
+		result.WriteString(fmt.Sprintf("@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount))
+		for _, op := range ops[from:to] {
+			result.WriteByte(op.kind)
+			result.WriteString(op.line)
+			result.WriteByte('\n')
+		}
+
+		start = to
+	}
+
+	return result.String()
+}
+
+// DiffBody returns the lines of a unified diff from its first hunk on, without
+// the "--- a/" and "+++ b/" headers, whose prefixes changed lines can share.
+func DiffBody(diff string) []string {
+	if strings.HasPrefix(diff, "@@") {
+		return strings.Split(diff, "\n")
+	}
+	start := strings.Index(diff, "\n@@")
+	if start < 0 {
+		return nil
+	}
+	return strings.Split(diff[start+1:], "\n")
+}
+
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+}
+
+// diffLines computes a line diff from the longest common subsequence.
+func diffLines(a []string, b []string) []diffOp {
+	// lcs[i][j] is the LCS length of a[i:] and b[j:].
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, diffOp{' ', a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, diffOp{'-', a[i]})
+			i++
+		default:
+			ops = append(ops, diffOp{'+', b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, diffOp{'-', a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, diffOp{'+', b[j]})
+	}
+	return ops
+}
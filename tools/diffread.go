@@ -0,0 +1,79 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Start of a read_file result that only holds what changed since the model last saw the file.
+const differentialReadPrefix = "[Since your last read of "
+
+// IsDifferentialRead reports whether a read_file result is relative to an earlier
+// read instead of holding the whole file.
+func IsDifferentialRead(result string) bool {
+	return strings.HasPrefix(result, differentialReadPrefix)
+}
+
+// SeenFiles remembers the content of each file the model last read or wrote in
+// one session, so re-reads can return only what changed.
+type SeenFiles struct {
+	mu      sync.Mutex
+	content map[string]string
+}
+
+func NewSeenFiles() *SeenFiles {
+	return &SeenFiles{content: map[string]string{}}
+}
+
+type seenFilesKey struct{}
+
+// WithSeenFiles returns a context carrying the files seen in the current session.
+func WithSeenFiles(ctx context.Context, seen *SeenFiles) context.Context {
+	return context.WithValue(ctx, seenFilesKey{}, seen)
+}
+
+func seenFiles(ctx context.Context) *SeenFiles {
+	seen, _ := ctx.Value(seenFilesKey{}).(*SeenFiles)
+	return seen
+}
+
+func (s *SeenFiles) get(path string) (string, bool) {
+	if s == nil {
+		return "", false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	content, ok := s.content[recordKey(path)]
+	return content, ok
+}
+
+func (s *SeenFiles) record(path string, content string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.content[recordKey(path)] = content
+}
+
+// differentialRead returns what changed in path since the model last saw it in
+// the session of ctx, if that is shorter than the file itself.
+func differentialRead(ctx context.Context, path string, text string) (string, bool) {
+	previous, ok := seenFiles(ctx).get(path)
+	if !ok {
+		return "", false
+	}
+	if previous == text {
+		return fmt.Sprintf("%s%s: unchanged.]", differentialReadPrefix, path), true
+	}
+
+	diff := UnifiedDiff(recordKey(path), previous, text)
+	if len(diff) >= len(text) {
+		return "", false
+	}
+	return fmt.Sprintf("%s%s: changed. Unified diff against that version (read with full set to true for the whole file):]\n%s", differentialReadPrefix, path, diff), true
+}
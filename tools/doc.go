@@ -0,0 +1,86 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/kartikx/agent/docsource"
+)
+
+// Documentation-specific tools
+var DocTools = []ToolDefinition{
+	SearchDocumentationDefinition,
+	ComparePackagesDefinition,
+}
+
+// SearchDocumentation tool for reading documentation from any enabled source
+type SearchDocumentationInput struct {
+	Topic  string `json:"topic" jsonschema:"minLength=1" jsonschema_description:"What to look up: a Go import path (net/http), a Rust path (tokio::sync), a Python module (asyncio) or a web platform feature (CSS grid)"`
+	Source string `json:"source,omitempty" jsonschema:"enum=go,enum=mdn,enum=rust,enum=python" jsonschema_description:"Where to look. Detected from the topic if omitted."`
+}
+
+var SearchDocumentationInputSchema = GenerateSchema[SearchDocumentationInput]()
+
+var SearchDocumentationDefinition = ToolDefinition{
+	Name:        "search_documentation",
+	Description: "Read documentation for a package, module or feature. Sources are pkg.go.dev (go), MDN Web Docs (mdn), docs.rs and the Rust standard library (rust), and the Python standard library (python). Set source when the topic alone doesn't make the language clear.",
+	InputSchema: SearchDocumentationInputSchema,
+	Function:    SearchDocumentation,
+	Category:    CategoryRead,
+	Untrusted:   true,
+	Network:     true,
+	Examples: []ToolExample{
+		{Input: `{"topic": "net/http"}`, Output: "Source: https://pkg.go.dev/net/http?tab=doc\n\nPackage http provides HTTP client and server implementations. ..."},
+		{Input: `{"topic": "asyncio", "source": "python"}`, Output: "Source: https://docs.python.org/3/library/asyncio.html\n\nasyncio — Asynchronous I/O ..."},
+	},
+}
+
+func SearchDocumentation(ctx context.Context, input json.RawMessage) (string, error) {
+	searchInput := SearchDocumentationInput{}
+
+	err := json.Unmarshal(input, &searchInput)
+	if err != nil {
+		return "", err
+	}
+
+	source, err := docsource.Pick(searchInput.Topic, searchInput.Source)
+	if err != nil {
+		return "", err
+	}
+
+	fmt.Printf("Searching %s documentation for %s\n", source.Name(), searchInput.Topic)
+	return source.Fetch(ctx, searchInput.Topic)
+}
+
+// SearchGoDocumentation tool for searching Go documentation
+type SearchGoDocumentationInput struct {
+	PackageName string `json:"package_name" jsonschema:"minLength=1" jsonschema_description:"The name of the package to search for"`
+}
+
+var SearchGoDocumentationInputSchema = GenerateSchema[SearchGoDocumentationInput]()
+
+var SearchGoDocumentationDefinition = ToolDefinition{
+	Name:        "search_go_documentation",
+	Description: "Search Go documentation for information. Use this when you need to find Go language features, standard library functions, or Go-specific information. Call this function with the name of the package you want to search for.",
+	InputSchema: SearchGoDocumentationInputSchema,
+	Function:    SearchGoDocumentation,
+	Category:    CategoryRead,
+	Untrusted:   true,
+	Network:     true,
+	Examples: []ToolExample{
+		{Input: `{"package_name": "net/http"}`, Output: "Package http provides HTTP client and server implementations. ..."},
+	},
+}
+
+// SearchGoDocumentation fetches documentation text from pkg.go.dev for a given package
+func SearchGoDocumentation(ctx context.Context, input json.RawMessage) (string, error) {
+	searchInput := SearchGoDocumentationInput{}
+
+	err := json.Unmarshal(input, &searchInput)
+	if err != nil {
+		return "", err
+	}
+
+	return docsource.Bundled(docsource.GoSource{}).Fetch(ctx, searchInput.PackageName)
+}
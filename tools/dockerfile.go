@@ -0,0 +1,372 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Instructions a Dockerfile may contain.
+var dockerfileKeywords = map[string]bool{
+	"FROM": true, "RUN": true, "CMD": true, "LABEL": true, "EXPOSE": true, "ENV": true, "ADD": true,
+	"COPY": true, "ENTRYPOINT": true, "VOLUME": true, "USER": true, "WORKDIR": true, "ARG": true,
+	"ONBUILD": true, "STOPSIGNAL": true, "HEALTHCHECK": true, "SHELL": true, "MAINTAINER": true,
+}
+
+var heredocStart = regexp.MustCompile(`<<-?["']?([A-Za-z_][A-Za-z0-9_]*)["']?`)
+
+// dockerInstruction is one instruction, which may span several lines.
+type dockerInstruction struct {
+	start, end int // 1-based lines
+	keyword    string
+	args       string
+}
+
+// dockerStage starts at a FROM instruction.
+type dockerStage struct {
+	index int
+	name  string
+	image string
+	from  dockerInstruction
+	body  []dockerInstruction
+}
+
+// parseDockerfile splits a Dockerfile into stages of instructions, joining
+// continuation lines and heredocs, and skipping comments.
+func parseDockerfile(content string) ([]dockerStage, error) {
+	lines := strings.Split(content, "\n")
+	var stages []dockerStage
+	for i := 0; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		instruction := dockerInstruction{start: i + 1}
+		text := trimmed
+		for strings.HasSuffix(text, "\\") && i+1 < len(lines) {
+			text = strings.TrimSuffix(text, "\\")
+			i++
+			next := strings.TrimSpace(lines[i])
+			if !strings.HasPrefix(next, "#") {
+				text += " " + next
+			}
+		}
+		if match := heredocStart.FindStringSubmatch(text); match != nil {
+			for i+1 < len(lines) {
+				i++
+				text += "\n" + lines[i]
+				if strings.TrimSpace(lines[i]) == match[1] {
+					break
+				}
+			}
+		}
+		instruction.end = i + 1
+
+		keyword, args, _ := strings.Cut(text, " ")
+		instruction.keyword = strings.ToUpper(keyword)
+		instruction.args = strings.Join(strings.Fields(strings.SplitN(args, "\n", 2)[0]), " ")
+		if strings.Contains(args, "\n") {
+			instruction.args += " <<heredoc>>"
+		}
+		if !dockerfileKeywords[instruction.keyword] {
+			return nil, fmt.Errorf("line %d: unknown instruction %s", instruction.start, keyword)
+		}
+
+		if instruction.keyword == "FROM" {
+			stage := dockerStage{index: len(stages), from: instruction}
+			var fields []string
+			for _, field := range strings.Fields(instruction.args) {
+				if !strings.HasPrefix(field, "--") {
+					fields = append(fields, field)
+				}
+			}
+			if len(fields) > 0 {
+				stage.image = fields[0]
+			}
+			if len(fields) == 3 && strings.EqualFold(fields[1], "AS") {
+				stage.name = fields[2]
+			}
+			stages = append(stages, stage)
+			continue
+		}
+		if len(stages) == 0 {
+			// ARG may come before the first FROM; it belongs to no stage.
+			if instruction.keyword == "ARG" {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %s before the first FROM", instruction.start, instruction.keyword)
+		}
+		stages[len(stages)-1].body = append(stages[len(stages)-1].body, instruction)
+	}
+	if len(stages) == 0 {
+		return nil, fmt.Errorf("no FROM instruction")
+	}
+	return stages, nil
+}
+
+// InspectDockerfile tool for reading a Dockerfile's structure
+type InspectDockerfileInput struct {
+	Path string `json:"path,omitempty" jsonschema:"default=Dockerfile" jsonschema_description:"Path of the Dockerfile. Defaults to Dockerfile."`
+}
+
+var InspectDockerfileInputSchema = GenerateSchema[InspectDockerfileInput]()
+
+func (f *Files) InspectDockerfileDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "inspect_dockerfile",
+		Description: "Parse a Dockerfile into its build stages and instructions, with the line each starts on, and point out common problems like unpinned base images or a final stage running as root. Use the line numbers with edit_dockerfile.",
+		InputSchema: InspectDockerfileInputSchema,
+		Function:    f.InspectDockerfile,
+		Category:    CategoryRead,
+		Examples: []ToolExample{
+			{Input: `{}`, Output: "Dockerfile: 2 stages\n\nStage 0 \"build\": golang:1.23 (line 1)\n  2: WORKDIR /src\n  3: COPY go.mod go.sum ./\n  4-5: RUN go mod download && go build -o /app ./cmd/agent\n\nStage 1 (final): gcr.io/distroless/static (line 7)\n  8: COPY --from=build /app /app\n  9: ENTRYPOINT [\"/app\"]\n\nNotes:\n- The final stage has no USER, so the container runs as root."},
+		},
+	}
+}
+
+func (f *Files) InspectDockerfile(ctx context.Context, input json.RawMessage) (string, error) {
+	inspectInput := InspectDockerfileInput{}
+	if err := json.Unmarshal(input, &inspectInput); err != nil {
+		return "", err
+	}
+	if inspectInput.Path == "" {
+		inspectInput.Path = "Dockerfile"
+	}
+
+	data, err := f.fs.ReadFile(inspectInput.Path)
+	if err != nil {
+		return "", err
+	}
+	content, _ := decodeText(data)
+	stages, err := parseDockerfile(content)
+	if err != nil {
+		return "", fmt.Errorf("invalid Dockerfile %s: %v", inspectInput.Path, err)
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "%s: %d stages\n", inspectInput.Path, len(stages))
+	names := map[string]bool{}
+	var notes, ports []string
+	for _, stage := range stages {
+		label := ""
+		if stage.name != "" {
+			label = fmt.Sprintf(" %q", stage.name)
+		}
+		if stage.index == len(stages)-1 {
+			label += " (final)"
+		}
+		fmt.Fprintf(&result, "\nStage %d%s: %s (line %d)\n", stage.index, label, stage.image, stage.from.start)
+		for _, instruction := range stage.body {
+			lines := strconv.Itoa(instruction.start)
+			if instruction.end > instruction.start {
+				lines = fmt.Sprintf("%d-%d", instruction.start, instruction.end)
+			}
+			fmt.Fprintf(&result, "  %s: %s %s\n", lines, instruction.keyword, instruction.args)
+			if instruction.keyword == "EXPOSE" && stage.index == len(stages)-1 {
+				ports = append(ports, strings.Fields(instruction.args)...)
+			}
+		}
+
+		// Stages built on earlier stages, scratch and variables aren't images to pin.
+		if !names[stage.image] && stage.image != "scratch" && !strings.Contains(stage.image, "$") && !pinnedImage(stage.image) {
+			notes = append(notes, fmt.Sprintf("%s (line %d) has no tag or digest, or uses latest, so builds aren't reproducible.", stage.image, stage.from.start))
+		}
+		names[stage.name] = true
+	}
+
+	final := stages[len(stages)-1]
+	hasUser := false
+	for _, instruction := range final.body {
+		if instruction.keyword == "USER" && !strings.HasPrefix(instruction.args, "root") && instruction.args != "0" {
+			hasUser = true
+		}
+	}
+	if !hasUser {
+		notes = append(notes, "The final stage has no USER, so the container runs as root.")
+	}
+
+	if len(ports) > 0 {
+		fmt.Fprintf(&result, "\nExposed ports: %s\n", strings.Join(ports, ", "))
+	}
+	if len(notes) > 0 {
+		result.WriteString("\nNotes:\n- " + strings.Join(notes, "\n- ") + "\n")
+	}
+	return result.String(), nil
+}
+
+// pinnedImage reports whether an image reference has a digest or a tag other than latest.
+func pinnedImage(image string) bool {
+	if strings.Contains(image, "@") {
+		return true
+	}
+	// The tag follows the last colon, unless that colon is a registry's port.
+	colon := strings.LastIndex(image, ":")
+	if colon < 0 || strings.Contains(image[colon:], "/") {
+		return false
+	}
+	return image[colon+1:] != "latest"
+}
+
+// EditDockerfile tool for changing a Dockerfile instruction by instruction
+type EditDockerfileInput struct {
+	Path        string `json:"path,omitempty" jsonschema:"default=Dockerfile" jsonschema_description:"Path of the Dockerfile. Defaults to Dockerfile."`
+	Action      string `json:"action" jsonschema:"enum=set_base,enum=insert,enum=replace,enum=delete" jsonschema_description:"set_base changes a stage's base image; insert adds an instruction after line, or at the end of the stage; replace and delete change the instruction starting at line."`
+	Stage       string `json:"stage,omitempty" jsonschema_description:"Stage name or index for set_base and insert. Defaults to the final stage."`
+	Line        int    `json:"line,omitempty" jsonschema_description:"Line an instruction starts on, as shown by inspect_dockerfile."`
+	Instruction string `json:"instruction,omitempty" jsonschema_description:"The new instruction for insert and replace, e.g. USER nonroot, or the image for set_base."`
+}
+
+var EditDockerfileInputSchema = GenerateSchema[EditDockerfileInput]()
+
+func (f *Files) EditDockerfileDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "edit_dockerfile",
+		Description: "Change a Dockerfile one instruction at a time: set a stage's base image, or insert, replace or delete an instruction by the line it starts on (see inspect_dockerfile). Multi-line instructions are replaced or deleted whole, and the result must still parse.",
+		InputSchema: EditDockerfileInputSchema,
+		Function:    f.EditDockerfile,
+		Category:    CategoryWrite,
+		Examples: []ToolExample{
+			{Input: `{"action": "insert", "instruction": "USER nonroot:nonroot"}`, Output: "Inserted USER nonroot:nonroot at line 10 of Dockerfile"},
+			{Input: `{"action": "set_base", "stage": "build", "instruction": "golang:1.23-alpine"}`, Output: "Set the base image of stage build to golang:1.23-alpine in Dockerfile"},
+		},
+	}
+}
+
+func (f *Files) EditDockerfile(ctx context.Context, input json.RawMessage) (string, error) {
+	editInput := EditDockerfileInput{}
+	if err := json.Unmarshal(input, &editInput); err != nil {
+		return "", err
+	}
+	if editInput.Path == "" {
+		editInput.Path = "Dockerfile"
+	}
+	instruction := strings.TrimSpace(editInput.Instruction)
+	if editInput.Action == "insert" || editInput.Action == "replace" {
+		keyword, _, _ := strings.Cut(instruction, " ")
+		if !dockerfileKeywords[strings.ToUpper(keyword)] {
+			return "", fmt.Errorf("instruction must start with a Dockerfile instruction like RUN or COPY, not %q", keyword)
+		}
+	}
+
+	var summary string
+	change, err := f.edit(ctx, editInput.Path, func(content string) (string, error) {
+		stages, err := parseDockerfile(content)
+		if err != nil {
+			return "", fmt.Errorf("invalid Dockerfile %s: %v", editInput.Path, err)
+		}
+		lines := strings.Split(content, "\n")
+
+		var edited []string
+		switch editInput.Action {
+		case "set_base":
+			stage, err := findStage(stages, editInput.Stage)
+			if err != nil {
+				return "", err
+			}
+			if instruction == "" || strings.ContainsAny(instruction, " \t") {
+				return "", fmt.Errorf("instruction must be the image, e.g. golang:1.23-alpine")
+			}
+			from := lines[stage.from.start-1]
+			index := strings.Index(from, stage.image)
+			if stage.from.end > stage.from.start || index < 0 {
+				return "", fmt.Errorf("the FROM on line %d spans several lines; use replace instead", stage.from.start)
+			}
+			edited = append(append(append([]string{}, lines[:stage.from.start-1]...), from[:index]+instruction+from[index+len(stage.image):]), lines[stage.from.start:]...)
+			summary = fmt.Sprintf("Set the base image of stage %s to %s in %s", stageLabel(stage), instruction, editInput.Path)
+		case "insert":
+			at := 0
+			if editInput.Line > 0 {
+				found, err := findInstruction(stages, editInput.Line)
+				if err != nil {
+					return "", err
+				}
+				at = found.end
+			} else {
+				stage, err := findStage(stages, editInput.Stage)
+				if err != nil {
+					return "", err
+				}
+				at = stage.from.end
+				if len(stage.body) > 0 {
+					at = stage.body[len(stage.body)-1].end
+				}
+			}
+			edited = append(append(append([]string{}, lines[:at]...), strings.Split(instruction, "\n")...), lines[at:]...)
+			summary = fmt.Sprintf("Inserted %s at line %d of %s", firstLine(instruction), at+1, editInput.Path)
+		case "replace", "delete":
+			found, err := findInstruction(stages, editInput.Line)
+			if err != nil {
+				return "", err
+			}
+			var replacement []string
+			if editInput.Action == "replace" {
+				replacement = strings.Split(instruction, "\n")
+				summary = fmt.Sprintf("Replaced the %s on line %d of %s with %s", found.keyword, found.start, editInput.Path, firstLine(instruction))
+			} else {
+				if found.keyword == "FROM" {
+					return "", fmt.Errorf("line %d starts a stage; replace its FROM instead of deleting it", found.start)
+				}
+				summary = fmt.Sprintf("Deleted the %s on line %d of %s", found.keyword, found.start, editInput.Path)
+			}
+			edited = append(append(append([]string{}, lines[:found.start-1]...), replacement...), lines[found.end:]...)
+		default:
+			return "", fmt.Errorf("unknown action %q: use set_base, insert, replace or delete", editInput.Action)
+		}
+
+		result := strings.Join(edited, "\n")
+		if _, err := parseDockerfile(result); err != nil {
+			return "", fmt.Errorf("the edit would break the Dockerfile: %v", err)
+		}
+		return result, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return withFileChange(summary, change), nil
+}
+
+// findStage finds a stage by name or index, or the final stage if ref is empty.
+func findStage(stages []dockerStage, ref string) (dockerStage, error) {
+	if ref == "" {
+		return stages[len(stages)-1], nil
+	}
+	for _, stage := range stages {
+		if stage.name == ref || strconv.Itoa(stage.index) == ref {
+			return stage, nil
+		}
+	}
+	return dockerStage{}, fmt.Errorf("no stage %q", ref)
+}
+
+// findInstruction finds the instruction, including FROM, starting on line.
+func findInstruction(stages []dockerStage, line int) (dockerInstruction, error) {
+	for _, stage := range stages {
+		if stage.from.start == line {
+			return stage.from, nil
+		}
+		for _, instruction := range stage.body {
+			if instruction.start == line {
+				return instruction, nil
+			}
+			if line > instruction.start && line <= instruction.end {
+				return dockerInstruction{}, fmt.Errorf("line %d is inside the %s starting on line %d", line, instruction.keyword, instruction.start)
+			}
+		}
+	}
+	return dockerInstruction{}, fmt.Errorf("no instruction starts on line %d", line)
+}
+
+func stageLabel(stage dockerStage) string {
+	if stage.name != "" {
+		return stage.name
+	}
+	return strconv.Itoa(stage.index)
+}
+
+func firstLine(text string) string {
+	return strings.SplitN(text, "\n", 2)[0]
+}
@@ -0,0 +1,213 @@
+package tools
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// Documents larger than this are rejected outright.
+	maxDocumentSize = 20 * 1024 * 1024
+	// Number of characters returned per page for formats without real pages.
+	documentPageSize = 8000
+)
+
+// ReadDocument tool for extracting text from PDF and DOCX files
+type ReadDocumentInput struct {
+	Path string `json:"path" jsonschema:"minLength=1" jsonschema_description:"The path of the PDF or DOCX file."`
+	Page int    `json:"page,omitempty" jsonschema:"minimum=1,default=1" jsonschema_description:"The 1-based page to return. Defaults to the first page."`
+}
+
+var ReadDocumentInputSchema = GenerateSchema[ReadDocumentInput]()
+
+func (f *Files) ReadDocumentDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "read_document",
+		Description: "Extract the text of a PDF or DOCX file, one page at a time. Use this to read design docs and specs. The result says how many pages there are; call again with a higher page number to keep reading.",
+		InputSchema: ReadDocumentInputSchema,
+		Function:    f.ReadDocument,
+		Category:    CategoryRead,
+		Examples: []ToolExample{
+			{Input: `{"path": "docs/design.pdf", "page": 2}`, Output: "Document: docs/design.pdf (page 2 of 7)\n\n2. Architecture ..."},
+		},
+	}
+}
+
+func (f *Files) ReadDocument(ctx context.Context, input json.RawMessage) (string, error) {
+	readDocumentInput := ReadDocumentInput{}
+
+	err := json.Unmarshal(input, &readDocumentInput)
+	if err != nil {
+		return "", err
+	}
+
+	if readDocumentInput.Page < 1 {
+		readDocumentInput.Page = 1
+	}
+
+	info, err := f.fs.Stat(readDocumentInput.Path)
+	if err != nil {
+		return "", err
+	}
+	if info.Size() > maxDocumentSize {
+		return "", fmt.Errorf("document is %s, larger than the %s limit", formatSize(info.Size()), formatSize(maxDocumentSize))
+	}
+
+	data, err := f.fs.ReadFile(readDocumentInput.Path)
+	if err != nil {
+		return "", err
+	}
+
+	var pages []string
+	switch strings.ToLower(filepath.Ext(readDocumentInput.Path)) {
+	case ".pdf":
+		pages, err = extractPdfPages(ctx, data)
+	case ".docx":
+		var text string
+		text, err = extractDocxText(data)
+		pages = paginateText(text, documentPageSize)
+	default:
+		return "", fmt.Errorf("unsupported document type: %s", filepath.Ext(readDocumentInput.Path))
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if len(pages) == 0 {
+		return fmt.Sprintf("Document %s contains no text", readDocumentInput.Path), nil
+	}
+	if readDocumentInput.Page > len(pages) {
+		return "", fmt.Errorf("page %d out of range, document has %d pages", readDocumentInput.Page, len(pages))
+	}
+
+	return fmt.Sprintf("Document: %s (page %d of %d)\n\n%s", readDocumentInput.Path, readDocumentInput.Page, len(pages), pages[readDocumentInput.Page-1]), nil
+}
+
+// extractPdfPages shells out to pdftotext (poppler-utils), which ends each page
+// with a form feed. Blank pages are kept, so page N is the PDF's page N; a PDF
+// with no text at all has no pages.
+func extractPdfPages(ctx context.Context, data []byte) ([]string, error) {
+	cmd := exec.CommandContext(ctx, "pdftotext", "-layout", "-", "-")
+	cmd.Stdin = bytes.NewReader(data)
+	// Don't wait forever for pdftotext once ctx is done.
+	cmd.WaitDelay = 5 * time.Second
+	output, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("failed to extract PDF text (is pdftotext installed?): %v", err)
+	}
+
+	pages := strings.Split(strings.TrimSuffix(string(output), "\f"), "\f")
+	hasText := false
+	for i, page := range pages {
+		if strings.TrimSpace(page) == "" {
+			pages[i] = "[blank page]"
+		} else {
+			hasText = true
+		}
+	}
+	if !hasText {
+		return nil, nil
+	}
+	return pages, nil
+}
+
+// extractDocxText reads word/document.xml from the DOCX archive and joins its paragraphs.
+func extractDocxText(data []byte) (string, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return "", fmt.Errorf("failed to open DOCX: %v", err)
+	}
+
+	for _, file := range archive.File {
+		if file.Name != "word/document.xml" {
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return "", err
+		}
+		defer reader.Close()
+
+		return docxXmlToText(io.LimitReader(reader, maxDocumentSize))
+	}
+
+	return "", fmt.Errorf("word/document.xml not found in DOCX")
+}
+
+// docxXmlToText collects the text runs (<w:t>) of a document, one line per paragraph (<w:p>).
+func docxXmlToText(reader io.Reader) (string, error) {
+	var result strings.Builder
+	decoder := xml.NewDecoder(reader)
+	inText := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse DOCX: %v", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				result.WriteString("\t")
+			case "br":
+				result.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case "p":
+				result.WriteString("\n")
+			}
+		case xml.CharData:
+			if inText {
+				result.Write(t)
+			}
+		}
+	}
+
+	return result.String(), nil
+}
+
+// paginateText splits text into pages of roughly pageSize characters, breaking on newlines where possible.
+func paginateText(text string, pageSize int) []string {
+	pages := []string{}
+	for len(strings.TrimSpace(text)) > 0 {
+		if len(text) <= pageSize {
+			pages = append(pages, text)
+			break
+		}
+
+		cut := strings.LastIndex(text[:pageSize], "\n")
+		if cut <= 0 {
+			cut = pageSize
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		pages = append(pages, text[:cut])
+		text = text[cut:]
+	}
+	return pages
+}
@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+	"unicode/utf16"
+)
+
+var (
+	utf8BOM    = []byte{0xEF, 0xBB, 0xBF}
+	utf16LEBOM = []byte{0xFF, 0xFE}
+	utf16BEBOM = []byte{0xFE, 0xFF}
+)
+
+// TextStyle is how a file encodes its text, preserved when the model rewrites it.
+type TextStyle struct {
+	Encoding string // "utf-8", "utf-16le" or "utf-16be"
+	BOM      bool
+	CRLF     bool
+}
+
+func (s TextStyle) isDefault() bool {
+	return s.Encoding == "utf-8" && !s.BOM && !s.CRLF
+}
+
+func (s TextStyle) String() string {
+	description := s.Encoding
+	if s.BOM {
+		description += " with BOM"
+	}
+	if s.CRLF {
+		return description + ", CRLF line endings"
+	}
+	return description + ", LF line endings"
+}
+
+// decodeText converts file content to UTF-8 with LF line endings, returning the original style.
+func decodeText(data []byte) (string, TextStyle) {
+	style := TextStyle{Encoding: "utf-8"}
+	var text string
+
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		style.BOM = true
+		text = string(data[len(utf8BOM):])
+	case bytes.HasPrefix(data, utf16LEBOM) && len(data)%2 == 0:
+		style.Encoding, style.BOM = "utf-16le", true
+		text = decodeUTF16(data[2:], binary.LittleEndian)
+	case bytes.HasPrefix(data, utf16BEBOM) && len(data)%2 == 0:
+		style.Encoding, style.BOM = "utf-16be", true
+		text = decodeUTF16(data[2:], binary.BigEndian)
+	default:
+		text = string(data)
+	}
+
+	crlf := strings.Count(text, "\r\n")
+	if crlf > 0 && crlf >= strings.Count(text, "\n")-crlf {
+		style.CRLF = true
+		text = strings.ReplaceAll(text, "\r\n", "\n")
+	}
+
+	return text, style
+}
+
+// encodeText converts UTF-8 text from the model back to the given style.
+func encodeText(text string, style TextStyle) []byte {
+	if style.CRLF {
+		text = strings.ReplaceAll(strings.ReplaceAll(text, "\r\n", "\n"), "\n", "\r\n")
+	}
+
+	switch style.Encoding {
+	case "utf-16le":
+		return append(append([]byte{}, utf16LEBOM...), encodeUTF16(text, binary.LittleEndian)...)
+	case "utf-16be":
+		return append(append([]byte{}, utf16BEBOM...), encodeUTF16(text, binary.BigEndian)...)
+	}
+
+	if style.BOM {
+		return append(append([]byte{}, utf8BOM...), text...)
+	}
+	return []byte(text)
+}
+
+func decodeUTF16(data []byte, order binary.ByteOrder) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
+
+func encodeUTF16(text string, order binary.ByteOrder) []byte {
+	units := utf16.Encode([]rune(text))
+	data := make([]byte, 2*len(units))
+	for i, unit := range units {
+		order.PutUint16(data[2*i:], unit)
+	}
+	return data
+}
@@ -0,0 +1,327 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing/fstest"
+	"time"
+)
+
+// FS is the filesystem the file tools operate on. Paths are as given by the model.
+type FS interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm fs.FileMode) error
+	ReadDir(name string) ([]fs.DirEntry, error)
+	Stat(name string) (fs.FileInfo, error)
+}
+
+// Remover is implemented by filesystems that can delete files.
+type Remover interface {
+	Remove(name string) error
+}
+
+// Remove deletes the file name from fsys, if fsys can delete files.
+func Remove(fsys FS, name string) error {
+	remover, ok := fsys.(Remover)
+	if !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fmt.Errorf("the filesystem can't delete files")}
+	}
+	return remover.Remove(name)
+}
+
+// OSFS is the real filesystem. If Root is set, paths are resolved inside it
+// and may not escape it.
+type OSFS struct {
+	Root string
+}
+
+func (o OSFS) resolve(name string) (string, error) {
+	if o.Root == "" {
+		return name, nil
+	}
+
+	resolved := filepath.Join(o.Root, filepath.FromSlash(strings.TrimPrefix(filepath.ToSlash(name), "/")))
+	if !within(o.Root, resolved) {
+		return "", fmt.Errorf("path %s is outside the workspace", name)
+	}
+
+	// A symlink inside the root may point out of it, so where the path really
+	// leads must be inside too.
+	root, err := filepath.EvalSymlinks(o.Root)
+	if err != nil {
+		return "", err
+	}
+	target, err := evalExisting(resolved)
+	if err != nil {
+		return "", err
+	}
+	if !within(root, target) {
+		return "", fmt.Errorf("path %s is outside the workspace", name)
+	}
+	return resolved, nil
+}
+
+// within reports whether path is root or inside it.
+func within(root string, path string) bool {
+	relative, err := filepath.Rel(root, path)
+	return err == nil && relative != ".." && !strings.HasPrefix(relative, ".."+string(filepath.Separator))
+}
+
+// evalExisting resolves the symlinks in path, which may not exist yet: the
+// part of it that doesn't is kept as it is.
+func evalExisting(path string) (string, error) {
+	target, err := filepath.EvalSymlinks(path)
+	if !errors.Is(err, fs.ErrNotExist) {
+		return target, err
+	}
+	parent := filepath.Dir(path)
+	if parent == path {
+		return path, nil
+	}
+	target, err = evalExisting(parent)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(target, filepath.Base(path)), nil
+}
+
+func (o OSFS) ReadFile(name string) ([]byte, error) {
+	resolved, err := o.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadFile(resolved)
+}
+
+func (o OSFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	resolved, err := o.resolve(name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(resolved), 0755); err != nil {
+		return err
+	}
+	return WriteFileAtomic(resolved, data, perm)
+}
+
+// WriteFileAtomic writes data to a temporary file next to name and renames it into
+// place, so a process killed mid-write leaves either the old file or the new one.
+// An existing file keeps its permissions, and a symlink is written through like os.WriteFile.
+func WriteFileAtomic(name string, data []byte, perm fs.FileMode) error {
+	if target, err := filepath.EvalSymlinks(name); err == nil {
+		name = target
+	}
+	if info, err := os.Stat(name); err == nil {
+		perm = info.Mode().Perm()
+	}
+
+	temp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Sync(); err != nil {
+		temp.Close()
+		return err
+	}
+	if err := temp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(temp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(temp.Name(), name)
+}
+
+func (o OSFS) Remove(name string) error {
+	resolved, err := o.resolve(name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(resolved)
+}
+
+func (o OSFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	resolved, err := o.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.ReadDir(resolved)
+}
+
+func (o OSFS) Stat(name string) (fs.FileInfo, error) {
+	resolved, err := o.resolve(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(resolved)
+}
+
+// MemFS is an in-memory filesystem, for sandboxed demos and tests.
+type MemFS struct {
+	mu    sync.RWMutex
+	files fstest.MapFS
+}
+
+// NewMemFS creates an in-memory filesystem holding the given files (path -> content).
+func NewMemFS(files map[string]string) *MemFS {
+	m := &MemFS{files: fstest.MapFS{}}
+	for name, content := range files {
+		m.files[memPath(name)] = &fstest.MapFile{Data: []byte(content), Mode: 0644, ModTime: time.Now()}
+	}
+	return m
+}
+
+// memPath converts a model-supplied path to the unrooted form io/fs expects.
+func memPath(name string) string {
+	cleaned := strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	if cleaned == "" {
+		return "."
+	}
+	return cleaned
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.ReadFile(memPath(name))
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if info, err := m.files.Stat(memPath(name)); err == nil && info.IsDir() {
+		return &fs.PathError{Op: "write", Path: name, Err: fmt.Errorf("is a directory")}
+	}
+	m.files[memPath(name)] = &fstest.MapFile{Data: append([]byte{}, data...), Mode: perm, ModTime: time.Now()}
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.files[memPath(name)]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, memPath(name))
+	return nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.ReadDir(memPath(name))
+}
+
+func (m *MemFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.files.Stat(memPath(name))
+}
+
+// OverlayFS reads through to Base but keeps every write in memory, leaving Base
+// untouched. Used for dry runs against a real workspace.
+type OverlayFS struct {
+	Base  FS
+	Upper *MemFS
+}
+
+func NewOverlayFS(base FS) *OverlayFS {
+	return &OverlayFS{Base: base, Upper: NewMemFS(nil)}
+}
+
+func (o *OverlayFS) ReadFile(name string) ([]byte, error) {
+	if data, err := o.Upper.ReadFile(name); err == nil {
+		return data, nil
+	}
+	return o.Base.ReadFile(name)
+}
+
+func (o *OverlayFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return o.Upper.WriteFile(name, data, perm)
+}
+
+// Remove deletes files written to the overlay. Files of Base can't be deleted,
+// as the overlay has no way to hide them.
+func (o *OverlayFS) Remove(name string) error {
+	if _, err := o.Base.Stat(name); err == nil {
+		return &fs.PathError{Op: "remove", Path: name, Err: fmt.Errorf("files of the underlying filesystem can't be deleted in a dry run")}
+	}
+	return o.Upper.Remove(name)
+}
+
+func (o *OverlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	baseEntries, baseErr := o.Base.ReadDir(name)
+	upperEntries, upperErr := o.Upper.ReadDir(name)
+	if baseErr != nil && upperErr != nil {
+		return nil, baseErr
+	}
+
+	merged := map[string]fs.DirEntry{}
+	for _, entry := range baseEntries {
+		merged[entry.Name()] = entry
+	}
+	for _, entry := range upperEntries {
+		merged[entry.Name()] = entry
+	}
+
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, entry := range merged {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (o *OverlayFS) Stat(name string) (fs.FileInfo, error) {
+	if info, err := o.Upper.Stat(name); err == nil {
+		return info, nil
+	}
+	return o.Base.Stat(name)
+}
+
+// Changes describes every file written to the overlay against Base, sorted by path.
+func (o *OverlayFS) Changes() []FileChange {
+	o.Upper.mu.RLock()
+	written := map[string][]byte{}
+	for name, file := range o.Upper.files {
+		if !file.Mode.IsDir() {
+			written[name] = file.Data
+		}
+	}
+	o.Upper.mu.RUnlock()
+
+	changes := []FileChange{}
+	for name, data := range written {
+		before, err := o.Base.ReadFile(name)
+		if string(before) == string(data) {
+			continue
+		}
+		changes = append(changes, newFileChange(name, string(before), string(data), err == nil))
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// ReadOnlyFS rejects all writes.
+type ReadOnlyFS struct {
+	FS
+}
+
+func (r ReadOnlyFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	return &fs.PathError{Op: "write", Path: name, Err: fmt.Errorf("filesystem is read-only")}
+}
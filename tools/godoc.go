@@ -0,0 +1,344 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Longest declaration shown per identifier in check_doc_comments results.
+const maxDeclarationLength = 120
+
+// exportedDecl is an exported identifier of a Go file and its doc comment.
+type exportedDecl struct {
+	name        string // e.g. "Client.Do" for a method
+	kind        string // func, method, type, const or var
+	declaration string // its first line of source
+	line        int    // 1-based line the doc comment starts or goes on
+	docLines    int
+	indent      string
+	doc         *ast.CommentGroup
+	// A doc comment on the enclosing group, e.g. const ( ... ), documents it too.
+	groupDoc bool
+	// Several names declared together, e.g. var A, B int, share a comment.
+	shared bool
+}
+
+// problem returns what's wrong with the identifier's documentation, or "" if nothing is.
+func (d exportedDecl) problem() string {
+	if d.doc == nil {
+		if d.groupDoc {
+			return ""
+		}
+		return "no doc comment"
+	}
+	if d.shared || docStartsWith(d.doc.Text(), d.name) {
+		return ""
+	}
+	return fmt.Sprintf("doc comment should start with %s", bareName(d.name))
+}
+
+// bareName is the name a doc comment starts with: the method's for methods.
+func bareName(name string) string {
+	if _, method, ok := strings.Cut(name, "."); ok {
+		return method
+	}
+	return name
+}
+
+// docStartsWith reports whether text starts with the identifier's name, after
+// an optional article as in "A Client sends requests".
+func docStartsWith(text string, name string) bool {
+	fields := strings.Fields(text)
+	if len(fields) > 1 && (fields[0] == "A" || fields[0] == "An" || fields[0] == "The") {
+		fields = fields[1:]
+	}
+	return len(fields) > 0 && strings.TrimRight(fields[0], ".,:;") == bareName(name)
+}
+
+// exportedDecls parses a Go file and returns its exported identifiers in order.
+// Files of package main and test files have no API to document.
+func exportedDecls(filename string, content string) ([]exportedDecl, error) {
+	if strings.HasSuffix(filename, "_test.go") {
+		return nil, nil
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, content, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	if file.Name.Name == "main" {
+		return nil, nil
+	}
+
+	lines := strings.Split(content, "\n")
+	at := func(pos token.Pos) (int, string, string) {
+		line := fset.Position(pos).Line
+		text := lines[line-1]
+		indent := text[:len(text)-len(strings.TrimLeft(text, " \t"))]
+		declaration := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(text), "{"))
+		if len(declaration) > maxDeclarationLength {
+			declaration = declaration[:maxDeclarationLength] + "..."
+		}
+		return line, indent, declaration
+	}
+
+	var decls []exportedDecl
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if !decl.Name.IsExported() {
+				continue
+			}
+			d := exportedDecl{name: decl.Name.Name, kind: "func", doc: decl.Doc}
+			if decl.Recv != nil && len(decl.Recv.List) > 0 {
+				receiver := receiverType(decl.Recv.List[0].Type)
+				if !ast.IsExported(receiver) {
+					continue
+				}
+				d.name, d.kind = receiver+"."+decl.Name.Name, "method"
+			}
+			d.line, d.indent, d.declaration = at(decl.Pos())
+			decls = append(decls, d)
+		case *ast.GenDecl:
+			if decl.Tok == token.IMPORT {
+				continue
+			}
+			grouped := decl.Lparen.IsValid()
+			for _, spec := range decl.Specs {
+				var names []*ast.Ident
+				var doc *ast.CommentGroup
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					names, doc = []*ast.Ident{spec.Name}, spec.Doc
+				case *ast.ValueSpec:
+					names, doc = spec.Names, spec.Doc
+				}
+				pos := spec.Pos()
+				if !grouped {
+					// The comment of an ungrouped declaration goes above its keyword.
+					doc, pos = decl.Doc, decl.Pos()
+				}
+				line, indent, declaration := at(pos)
+				for _, name := range names {
+					if !name.IsExported() {
+						continue
+					}
+					decls = append(decls, exportedDecl{
+						name: name.Name, kind: decl.Tok.String(), declaration: declaration, line: line, indent: indent,
+						doc: doc, groupDoc: grouped && decl.Doc != nil, shared: len(names) > 1,
+					})
+				}
+			}
+		}
+	}
+	// A doc comment is replaced whole, so its lines are what's replaced.
+	for i, d := range decls {
+		if d.doc != nil {
+			decls[i].line = fset.Position(d.doc.Pos()).Line
+			decls[i].docLines = fset.Position(d.doc.End()).Line - decls[i].line + 1
+		}
+	}
+	return decls, nil
+}
+
+// receiverType returns the type name of a method receiver, e.g. Client for *Client[T].
+func receiverType(expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.StarExpr:
+		return receiverType(expr.X)
+	case *ast.IndexExpr:
+		return receiverType(expr.X)
+	case *ast.IndexListExpr:
+		return receiverType(expr.X)
+	case *ast.Ident:
+		return expr.Name
+	}
+	return ""
+}
+
+// CheckDocComments tool for finding exported Go identifiers without proper doc comments
+type CheckDocCommentsInput struct {
+	Path string `json:"path,omitempty" jsonschema:"default=." jsonschema_description:"A Go file, or a package directory to check all its non-test files. Defaults to the current directory."`
+}
+
+var CheckDocCommentsInputSchema = GenerateSchema[CheckDocCommentsInput]()
+
+func (f *Files) CheckDocCommentsDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "check_doc_comments",
+		Description: "List the exported functions, methods, types, constants and variables of a Go file or package that have no doc comment, or a doc comment that doesn't start with the identifier's name, with their declarations and lines. Package main and test files are skipped. Use add_doc_comments to document them.",
+		InputSchema: CheckDocCommentsInputSchema,
+		Function:    f.CheckDocComments,
+		Category:    CategoryRead,
+		Examples: []ToolExample{
+			{Input: `{"path": "client.go"}`, Output: "client.go: 2 of 5 exported identifiers need doc comments\n  12: func NewClient: no doc comment\n      func NewClient(baseURL string) *Client\n  30: method Client.Do: doc comment should start with Do\n      func (c *Client) Do(req *Request) (*Response, error)"},
+		},
+	}
+}
+
+func (f *Files) CheckDocComments(ctx context.Context, input json.RawMessage) (string, error) {
+	checkInput := CheckDocCommentsInput{}
+	if err := json.Unmarshal(input, &checkInput); err != nil {
+		return "", err
+	}
+	if checkInput.Path == "" {
+		checkInput.Path = "."
+	}
+
+	files := []string{checkInput.Path}
+	if info, err := f.fs.Stat(checkInput.Path); err != nil {
+		return "", err
+	} else if info.IsDir() {
+		entries, err := f.fs.ReadDir(checkInput.Path)
+		if err != nil {
+			return "", err
+		}
+		files = nil
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".go") && !strings.HasSuffix(entry.Name(), "_test.go") {
+				files = append(files, path.Join(checkInput.Path, entry.Name()))
+			}
+		}
+		sort.Strings(files)
+		if len(files) == 0 {
+			return "", fmt.Errorf("%s has no Go files", checkInput.Path)
+		}
+	}
+
+	var result strings.Builder
+	total, flagged := 0, 0
+	for _, name := range files {
+		data, err := f.fs.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		content, _ := decodeText(data)
+		decls, err := exportedDecls(name, content)
+		if err != nil {
+			fmt.Fprintf(&result, "%s: doesn't parse: %v\n", name, err)
+			continue
+		}
+
+		var problems []string
+		for _, d := range decls {
+			if problem := d.problem(); problem != "" {
+				problems = append(problems, fmt.Sprintf("  %d: %s %s: %s\n      %s", d.line, d.kind, d.name, problem, d.declaration))
+			}
+		}
+		total += len(decls)
+		flagged += len(problems)
+		if len(problems) > 0 {
+			fmt.Fprintf(&result, "%s: %d of %d exported identifiers need doc comments\n%s\n", name, len(problems), len(decls), strings.Join(problems, "\n"))
+		}
+	}
+	if flagged == 0 && result.Len() == 0 {
+		return fmt.Sprintf("All %d exported identifiers in %s have doc comments.", total, checkInput.Path), nil
+	}
+	return strings.TrimSuffix(result.String(), "\n"), nil
+}
+
+// AddDocComments tool for documenting exported Go identifiers in place
+type AddDocCommentsInput struct {
+	Path     string       `json:"path" jsonschema:"minLength=1" jsonschema_description:"The Go file to document."`
+	Comments []DocComment `json:"comments" jsonschema:"minItems=1" jsonschema_description:"The doc comments to add."`
+}
+
+type DocComment struct {
+	Name string `json:"name" jsonschema:"minLength=1" jsonschema_description:"The identifier, as check_doc_comments lists it, e.g. NewClient or Client.Do for a method."`
+	Text string `json:"text" jsonschema:"minLength=1" jsonschema_description:"The comment text without // markers, starting with the identifier's name, e.g. NewClient returns a client for the API at baseURL."`
+}
+
+var AddDocCommentsInputSchema = GenerateSchema[AddDocCommentsInput]()
+
+func (f *Files) AddDocCommentsDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "add_doc_comments",
+		Description: "Add doc comments to exported identifiers of a Go file, each inserted right above its declaration without touching the rest of the file. A doc comment that doesn't start with the identifier's name is replaced; identifiers that are already properly documented are left alone. Find what needs documenting with check_doc_comments, and read the code first so the comments say what it does.",
+		InputSchema: AddDocCommentsInputSchema,
+		Function:    f.AddDocComments,
+		Category:    CategoryWrite,
+		Examples: []ToolExample{
+			{Input: `{"path": "client.go", "comments": [{"name": "NewClient", "text": "NewClient returns a client for the API at baseURL."}]}`, Output: "Added 1 doc comment to client.go: NewClient"},
+		},
+	}
+}
+
+func (f *Files) AddDocComments(ctx context.Context, input json.RawMessage) (string, error) {
+	addInput := AddDocCommentsInput{}
+	if err := json.Unmarshal(input, &addInput); err != nil {
+		return "", err
+	}
+	for _, comment := range addInput.Comments {
+		if !docStartsWith(comment.Text, comment.Name) {
+			return "", fmt.Errorf("the comment for %s should start with %s, e.g. %q", comment.Name, bareName(comment.Name), bareName(comment.Name)+" returns ...")
+		}
+	}
+
+	var added []string
+	change, err := f.edit(ctx, addInput.Path, func(content string) (string, error) {
+		decls, err := exportedDecls(addInput.Path, content)
+		if err != nil {
+			return "", fmt.Errorf("%s doesn't parse: %v", addInput.Path, err)
+		}
+		byName := map[string]exportedDecl{}
+		for _, d := range decls {
+			byName[d.name] = d
+		}
+
+		// Edits go bottom-up so earlier line numbers stay valid.
+		type insertion struct {
+			start, end int // 0-based lines replaced, end exclusive
+			lines      []string
+		}
+		var insertions []insertion
+		for _, comment := range addInput.Comments {
+			d, ok := byName[comment.Name]
+			if !ok {
+				return "", fmt.Errorf("%s has no exported identifier %s", addInput.Path, comment.Name)
+			}
+			if d.problem() == "" {
+				return "", fmt.Errorf("%s already has a doc comment", comment.Name)
+			}
+			var lines []string
+			for _, line := range strings.Split(strings.TrimSpace(comment.Text), "\n") {
+				line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "//"))
+				lines = append(lines, strings.TrimRight(d.indent+"// "+line, " "))
+			}
+			start := d.line - 1
+			for _, other := range insertions {
+				if other.start == start {
+					return "", fmt.Errorf("%s is declared together with another identifier given a comment; give the declaration one comment", comment.Name)
+				}
+			}
+			insertions = append(insertions, insertion{start: start, end: start + d.docLines, lines: lines})
+			added = append(added, comment.Name)
+		}
+		sort.Slice(insertions, func(i, j int) bool { return insertions[i].start > insertions[j].start })
+
+		lines := strings.Split(content, "\n")
+		for _, in := range insertions {
+			lines = append(append(append([]string{}, lines[:in.start]...), in.lines...), lines[in.end:]...)
+		}
+		result := strings.Join(lines, "\n")
+		if _, err := parser.ParseFile(token.NewFileSet(), addInput.Path, result, parser.ParseComments); err != nil {
+			return "", fmt.Errorf("the comments would break %s: %v", addInput.Path, err)
+		}
+		return result, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	noun := "doc comments"
+	if len(added) == 1 {
+		noun = "doc comment"
+	}
+	return withFileChange(fmt.Sprintf("Added %d %s to %s: %s", len(added), noun, addInput.Path, strings.Join(added, ", ")), change), nil
+}
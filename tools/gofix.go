@@ -0,0 +1,152 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"path"
+	"slices"
+	"strings"
+)
+
+// GoFixes are applied to the Go files the file tools write, so the module
+// keeps building between turns.
+type GoFixes struct {
+	// Imports runs goimports on the file before it's written, adding missing
+	// imports and removing unused ones.
+	Imports bool
+	// Tidy runs go mod tidy after a write changes a file's imports.
+	Tidy bool
+}
+
+type goFixesKey struct{}
+
+type goFixer struct {
+	GoFixes
+	run CommandRunner
+}
+
+// WithGoFixes returns a context in which the file tools apply fixes to the Go
+// files they write, running goimports and go through run.
+func WithGoFixes(ctx context.Context, fixes GoFixes, run CommandRunner) context.Context {
+	if !fixes.Imports && !fixes.Tidy {
+		return ctx
+	}
+	return context.WithValue(ctx, goFixesKey{}, &goFixer{GoFixes: fixes, run: run})
+}
+
+func goFixesFor(ctx context.Context, path string) *goFixer {
+	fixer, _ := ctx.Value(goFixesKey{}).(*goFixer)
+	if fixer == nil || !strings.HasSuffix(path, ".go") {
+		return nil
+	}
+	return fixer
+}
+
+// fixGoSource runs goimports on content about to be written to path, if
+// enabled. It returns the content to write and a note on what changed, or why
+// nothing could be done.
+func fixGoSource(ctx context.Context, path string, content string) (string, string) {
+	fixer := goFixesFor(ctx, path)
+	if fixer == nil || !fixer.Imports {
+		return content, ""
+	}
+
+	// From stdin, so the file tools still do the writing; -srcdir picks imports
+	// as if the file were in its directory.
+	cmd := fixer.run(ctx, "goimports", "-srcdir", path)
+	cmd.Stdin = strings.NewReader(content)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	fixed, err := cmd.Output()
+	if notInstalled(err) {
+		return content, "\n\ngoimports is not installed, so imports weren't fixed."
+	}
+	if err != nil {
+		problem := strings.ReplaceAll(strings.TrimSpace(stderr.String()), "<standard input>", path)
+		return content, fmt.Sprintf("\n\ngoimports couldn't fix %s, which was written as it was:\n%s", path, problem)
+	}
+	if string(fixed) == content {
+		return content, ""
+	}
+	return string(fixed), fmt.Sprintf("\n\ngoimports fixed the imports and formatting of %s:\n%s", path, UnifiedDiff(recordKey(path), content, string(fixed)))
+}
+
+// tidyGoModule runs go mod tidy in the module of name, if enabled and the
+// write changed the file's imports, and adds what it changed to result.
+func tidyGoModule(ctx context.Context, fsys FS, result string, name string, before string, after string) string {
+	fixer := goFixesFor(ctx, name)
+	if fixer == nil || !fixer.Tidy || slices.Equal(goImports(before), goImports(after)) {
+		return result
+	}
+
+	dir, ok := ModuleDir(fsys, name)
+	if !ok {
+		return result
+	}
+
+	files := []string{path.Join(dir, "go.mod"), path.Join(dir, "go.sum")}
+	original := make([]string, len(files))
+	for i, file := range files {
+		data, _ := fsys.ReadFile(file)
+		original[i] = string(data)
+	}
+
+	cmd := fixer.run(ctx, "go", "mod", "tidy")
+	if dir != "." {
+		cmd = fixer.run(ctx, "sh", "-c", `cd "$0" && exec go mod tidy`, dir)
+	}
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Sprintf("%s\n\ngo mod tidy failed in %s: %v\n%s", result, dir, err, strings.TrimSpace(string(output)))
+	}
+
+	var changes []FileChange
+	var changed []string
+	for i, file := range files {
+		data, err := fsys.ReadFile(file)
+		if err != nil || string(data) == original[i] {
+			continue
+		}
+		changes = append(changes, newFileChange(file, original[i], string(data), original[i] != ""))
+		changed = append(changed, file)
+	}
+	if len(changes) == 0 {
+		return result
+	}
+	result = fmt.Sprintf("%s\n\ngo mod tidy updated %s.", result, strings.Join(changed, " and "))
+	for _, change := range changes {
+		result = withFileChange(result, change)
+	}
+	return result
+}
+
+// ModuleDir returns the directory of the go.mod of the module name is in.
+func ModuleDir(fsys FS, name string) (string, bool) {
+	for dir := path.Dir(name); ; dir = path.Dir(dir) {
+		if _, err := fsys.Stat(path.Join(dir, "go.mod")); err == nil {
+			return dir, true
+		}
+		if dir == "." || dir == "/" {
+			return "", false
+		}
+	}
+}
+
+// goImports returns the sorted import paths of a Go file, or nil if it can't
+// be parsed.
+func goImports(source string) []string {
+	if source == "" {
+		return nil
+	}
+	file, err := parser.ParseFile(token.NewFileSet(), "", source, parser.ImportsOnly)
+	if err != nil {
+		return nil
+	}
+	imports := make([]string, len(file.Imports))
+	for i, spec := range file.Imports {
+		imports[i] = spec.Path.Value
+	}
+	slices.Sort(imports)
+	return imports
+}
@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+)
+
+// CommandRunner builds the commands the Go toolchain tools run, e.g. inside a
+// workspace's container. It has the signature of workspace.Workspace.Command.
+type CommandRunner func(ctx context.Context, name string, args ...string) *exec.Cmd
+
+// LocalRunner runs commands on the host, in dir (the current directory if empty).
+func LocalRunner(dir string) CommandRunner {
+	return func(ctx context.Context, name string, args ...string) *exec.Cmd {
+		cmd := exec.CommandContext(ctx, name, args...)
+		cmd.Dir = dir
+		return cmd
+	}
+}
+
+// GoTools holds the tools that run the Go toolchain against the module being worked on.
+type GoTools struct {
+	run CommandRunner
+}
+
+func NewGoTools(run CommandRunner) *GoTools {
+	return &GoTools{run: run}
+}
+
+func (g *GoTools) Definitions() []ToolDefinition {
+	return []ToolDefinition{
+		g.CheckVulnerabilitiesDefinition(),
+		g.AnalyzeCoverageDefinition(),
+		g.RunBenchmarksDefinition(),
+		g.ProfileCodeDefinition(),
+		g.ImportGraphDefinition(),
+	}
+}
+
+// output runs a command and returns its stdout, and its stderr as part of the error if it fails.
+func (g *GoTools) output(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := g.run(ctx, name, args...)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.Output()
+	if err != nil {
+		return stdout, &commandError{command: name + " " + strings.Join(args, " "), err: err, stderr: strings.TrimSpace(stderr.String())}
+	}
+	return stdout, nil
+}
+
+type commandError struct {
+	command string
+	err     error
+	stderr  string
+}
+
+func (e *commandError) Error() string {
+	if e.stderr == "" {
+		return e.command + ": " + e.err.Error()
+	}
+	return e.command + ": " + e.err.Error() + ": " + e.stderr
+}
+
+func (e *commandError) Unwrap() error {
+	return e.err
+}
+
+// notInstalled reports whether err means the command's executable doesn't exist,
+// either on the host or inside a container (where docker exec exits with 127).
+func notInstalled(err error) bool {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode() == 127
+	}
+	return errors.Is(err, exec.ErrNotFound)
+}
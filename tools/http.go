@@ -0,0 +1,110 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kartikx/agent/netpolicy"
+)
+
+// Most bytes of a response body returned to the model.
+const maxResponseBody = 10_000
+
+// HTTPRequest tool for exercising HTTP servers
+type HTTPRequestInput struct {
+	Method         string            `json:"method,omitempty" jsonschema:"enum=GET,enum=HEAD,enum=POST,enum=PUT,enum=PATCH,enum=DELETE,enum=OPTIONS,default=GET" jsonschema_description:"HTTP method."`
+	URL            string            `json:"url" jsonschema:"minLength=1" jsonschema_description:"URL to request, e.g. http://localhost:8080/users. Only localhost and hosts in NETWORK_ALLOWED_HOSTS may be requested."`
+	Headers        map[string]string `json:"headers,omitempty" jsonschema_description:"Request headers."`
+	Body           string            `json:"body,omitempty" jsonschema_description:"Request body."`
+	TimeoutSeconds int               `json:"timeout_seconds,omitempty" jsonschema:"default=10,minimum=1,maximum=60" jsonschema_description:"How long to wait for the response."`
+}
+
+var HTTPRequestInputSchema = GenerateSchema[HTTPRequestInput]()
+
+var HTTPRequestDefinition = ToolDefinition{
+	Name:        "http_request",
+	Description: "Send an HTTP request and return the response status, headers and body (truncated to 10KB). Use this to exercise servers you're building, e.g. after starting one with go run. Only localhost and explicitly allowed hosts can be requested.",
+	InputSchema: HTTPRequestInputSchema,
+	Function:    HTTPRequest,
+	Untrusted:   true,
+	Network:     true,
+	Examples: []ToolExample{
+		{Input: `{"method": "POST", "url": "http://localhost:8080/users", "headers": {"Content-Type": "application/json"}, "body": "{\"name\": \"ada\"}"}`, Output: "HTTP 201 Created\nContent-Type: application/json\n\n{\"id\": 1, \"name\": \"ada\"}"},
+	},
+}
+
+// httpPolicy allows localhost and the hosts in NETWORK_ALLOWED_HOSTS.
+func httpPolicy() *netpolicy.Policy {
+	return netpolicy.FromEnv(netpolicy.Loopback...)
+}
+
+func HTTPRequest(ctx context.Context, input json.RawMessage) (string, error) {
+	requestInput := HTTPRequestInput{}
+
+	err := json.Unmarshal(input, &requestInput)
+	if err != nil {
+		return "", err
+	}
+	if requestInput.Method == "" {
+		requestInput.Method = http.MethodGet
+	}
+	if requestInput.TimeoutSeconds == 0 {
+		requestInput.TimeoutSeconds = 10
+	}
+
+	target, err := url.Parse(requestInput.URL)
+	if err != nil {
+		return "", fmt.Errorf("invalid URL: %v", err)
+	}
+	policy := httpPolicy()
+	if err := policy.CheckURL(target); err != nil {
+		return "", err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, requestInput.Method, target.String(), strings.NewReader(requestInput.Body))
+	if err != nil {
+		return "", err
+	}
+	for name, value := range requestInput.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := policy.Client(time.Duration(requestInput.TimeoutSeconds) * time.Second).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %v", err)
+	}
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("HTTP %s\n", resp.Status))
+
+	names := make([]string, 0, len(resp.Header))
+	for name := range resp.Header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		result.WriteString(fmt.Sprintf("%s: %s\n", name, strings.Join(resp.Header[name], ", ")))
+	}
+
+	result.WriteString("\n")
+	if len(body) > maxResponseBody {
+		result.Write(body[:maxResponseBody])
+		result.WriteString("\n\n[body truncated to 10KB]")
+	} else {
+		result.Write(body)
+	}
+	return result.String(), nil
+}
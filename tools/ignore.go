@@ -0,0 +1,206 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Directories never worth showing the model.
+var defaultIgnored = []string{".git/", "node_modules/", ".agent-coverage.out"}
+
+// ignorePattern is one line of a .gitignore file.
+type ignorePattern struct {
+	base     string // directory of the .gitignore, relative to the listing root
+	pattern  string
+	dirOnly  bool
+	anchored bool // contains a slash, so it matches the path relative to base
+	negate   bool
+}
+
+// ignoreRules decides which paths a listing skips, from .gitignore files found
+// while walking. Only the common gitignore syntax is supported: globs, leading
+// "/" anchors, trailing "/" for directories and "!" negation.
+type ignoreRules struct {
+	patterns []ignorePattern
+}
+
+func newIgnoreRules() *ignoreRules {
+	rules := &ignoreRules{}
+	rules.add("", strings.Join(defaultIgnored, "\n"))
+	return rules
+}
+
+// add parses the content of an ignore file found in dir.
+func (r *ignoreRules) add(dir string, content string) {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		pattern := ignorePattern{base: dir}
+		if strings.HasPrefix(line, "!") {
+			pattern.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			pattern.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		pattern.anchored = strings.Contains(line, "/")
+		pattern.pattern = strings.TrimPrefix(line, "/")
+		r.patterns = append(r.patterns, pattern)
+	}
+}
+
+// ignored reports whether relative (a slash-separated path from the listing root) is ignored.
+func (r *ignoreRules) ignored(relative string, isDir bool) bool {
+	ignored := false
+	for _, pattern := range r.patterns {
+		if pattern.dirOnly && !isDir {
+			continue
+		}
+		if pattern.base != "" && !strings.HasPrefix(relative, pattern.base+"/") {
+			continue
+		}
+
+		var matched bool
+		if pattern.anchored {
+			matched, _ = path.Match(pattern.pattern, strings.TrimPrefix(relative, pattern.base+"/"))
+		} else {
+			matched, _ = path.Match(pattern.pattern, path.Base(relative))
+		}
+		if matched {
+			ignored = !pattern.negate
+		}
+	}
+	return ignored
+}
+
+// AgentIgnoreFile, at the root of the workspace, lists in gitignore syntax the
+// paths the agent never reads, lists or writes, e.g. secrets and build output.
+const AgentIgnoreFile = ".agentignore"
+
+// ErrIgnored is returned for paths excluded by the workspace's .agentignore.
+var ErrIgnored = errors.New("excluded by " + AgentIgnoreFile)
+
+// IgnoreFS hides the paths matched by the .agentignore at the root of FS: they're
+// left out of listings, and reading or writing them fails with ErrIgnored. The
+// file is read again whenever it changes, but can't be written or removed
+// through IgnoreFS, so the agent can't lift its own exclusions.
+type IgnoreFS struct {
+	FS
+
+	mu      sync.Mutex
+	version string // size and modification time of the .agentignore the rules come from
+	rules   *ignoreRules
+}
+
+// NewIgnoreFS wraps fsys, unless it's already wrapped.
+func NewIgnoreFS(fsys FS) *IgnoreFS {
+	if ignoring, ok := fsys.(*IgnoreFS); ok {
+		return ignoring
+	}
+	return &IgnoreFS{FS: fsys}
+}
+
+// currentRules returns the rules of the current .agentignore, nil if there is none.
+func (i *IgnoreFS) currentRules() *ignoreRules {
+	version := ""
+	if info, err := i.FS.Stat(AgentIgnoreFile); err == nil {
+		version = fmt.Sprintf("%d %d", info.Size(), info.ModTime().UnixNano())
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if version != i.version {
+		i.version, i.rules = version, nil
+		if data, err := i.FS.ReadFile(AgentIgnoreFile); err == nil {
+			i.rules = &ignoreRules{}
+			i.rules.add("", string(data))
+		}
+	}
+	return i.rules
+}
+
+// Excluded reports whether .agentignore excludes name, directly or through one
+// of its parent directories.
+func (i *IgnoreFS) Excluded(name string, isDir bool) bool {
+	return i.currentRules().excludes(name, isDir)
+}
+
+// excludes reports whether name or one of its parent directories is ignored. A
+// nil ignoreRules excludes nothing.
+func (rules *ignoreRules) excludes(name string, isDir bool) bool {
+	if rules == nil {
+		return false
+	}
+	relative := path.Clean(strings.TrimPrefix(filepath.ToSlash(name), "/"))
+	if relative == "." {
+		return false
+	}
+	parts := strings.Split(relative, "/")
+	for n := 1; n < len(parts); n++ {
+		if rules.ignored(strings.Join(parts[:n], "/"), true) {
+			return true
+		}
+	}
+	return rules.ignored(relative, isDir)
+}
+
+// isIgnoreFile reports whether name is the .agentignore the rules come from.
+func isIgnoreFile(name string) bool {
+	return memPath(name) == AgentIgnoreFile
+}
+
+func (i *IgnoreFS) ReadFile(name string) ([]byte, error) {
+	if i.Excluded(name, false) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrIgnored}
+	}
+	return i.FS.ReadFile(name)
+}
+
+func (i *IgnoreFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	if isIgnoreFile(name) || i.Excluded(name, false) {
+		return &fs.PathError{Op: "write", Path: name, Err: ErrIgnored}
+	}
+	return i.FS.WriteFile(name, data, perm)
+}
+
+func (i *IgnoreFS) Remove(name string) error {
+	if isIgnoreFile(name) || i.Excluded(name, false) {
+		return &fs.PathError{Op: "remove", Path: name, Err: ErrIgnored}
+	}
+	return Remove(i.FS, name)
+}
+
+func (i *IgnoreFS) Stat(name string) (fs.FileInfo, error) {
+	info, err := i.FS.Stat(name)
+	if err == nil && i.Excluded(name, info.IsDir()) {
+		return nil, &fs.PathError{Op: "stat", Path: name, Err: ErrIgnored}
+	}
+	return info, err
+}
+
+func (i *IgnoreFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if i.Excluded(name, true) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: ErrIgnored}
+	}
+	entries, err := i.FS.ReadDir(name)
+	if err != nil {
+		return nil, err
+	}
+	rules := i.currentRules()
+	visible := entries[:0:0]
+	for _, entry := range entries {
+		if !rules.excludes(path.Join(filepath.ToSlash(name), entry.Name()), entry.IsDir()) {
+			visible = append(visible, entry)
+		}
+	}
+	return visible, nil
+}
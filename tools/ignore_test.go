@@ -0,0 +1,72 @@
+package tools
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIgnoreFS(t *testing.T) {
+	ignoring := NewIgnoreFS(NewMemFS(map[string]string{
+		AgentIgnoreFile:       "secrets/\n*.pem\n!public.pem\n/build\n",
+		"main.go":             "package main",
+		"secrets/token":       "hunter2",
+		"config/server.pem":   "key",
+		"config/public.pem":   "cert",
+		"build/out":           "binary",
+		"cmd/build/main.go":   "package main",
+		"docs/secrets/readme": "nested",
+	}))
+
+	reads := []struct {
+		name     string
+		excluded bool
+	}{
+		{"main.go", false},
+		{"secrets/token", true},
+		{"/secrets/token", true},
+		{"./secrets/../secrets/token", true},
+		{"docs/secrets/readme", true},
+		{"config/server.pem", true},
+		{"config/public.pem", false},
+		{"build/out", true},
+		{"cmd/build/main.go", false},
+		{AgentIgnoreFile, false},
+	}
+	for _, read := range reads {
+		_, err := ignoring.ReadFile(read.name)
+		if errors.Is(err, ErrIgnored) != read.excluded {
+			t.Errorf("ReadFile(%q) = %v, want excluded %v", read.name, err, read.excluded)
+		}
+	}
+
+	entries, err := ignoring.ReadDir("config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != "public.pem" {
+		t.Errorf("ReadDir(config) lists %v, want only public.pem", entries)
+	}
+	if _, err := ignoring.ReadDir("secrets"); !errors.Is(err, ErrIgnored) {
+		t.Errorf("ReadDir(secrets) = %v, want excluded", err)
+	}
+
+	// Emptying or deleting .agentignore would expose everything it excludes.
+	for _, name := range []string{AgentIgnoreFile, "./" + AgentIgnoreFile, "/" + AgentIgnoreFile, "config/../" + AgentIgnoreFile} {
+		if err := ignoring.WriteFile(name, nil, 0644); !errors.Is(err, ErrIgnored) {
+			t.Errorf("WriteFile(%q) = %v, want excluded", name, err)
+		}
+		if err := ignoring.Remove(name); !errors.Is(err, ErrIgnored) {
+			t.Errorf("Remove(%q) = %v, want excluded", name, err)
+		}
+	}
+	if _, err := ignoring.ReadFile("secrets/token"); !errors.Is(err, ErrIgnored) {
+		t.Errorf("secrets/token is readable after trying to change %s: %v", AgentIgnoreFile, err)
+	}
+
+	if err := ignoring.WriteFile("secrets/new", []byte("x"), 0644); !errors.Is(err, ErrIgnored) {
+		t.Errorf("WriteFile(secrets/new) = %v, want excluded", err)
+	}
+	if err := ignoring.WriteFile("main.go", []byte("package main\n"), 0644); err != nil {
+		t.Errorf("WriteFile(main.go) = %v", err)
+	}
+}
@@ -0,0 +1,179 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Build log lines kept for the result, and layers listed by size.
+const maxBuildLogLines = 60
+const maxImageLayers = 5
+
+// Lines of a build log starting a step, for BuildKit's plain progress and the legacy builder.
+var buildStepLine = regexp.MustCompile(`^(#\d+ \[[^\]]+\] |Step \d+/\d+ : )`)
+
+// BuildImage tool for building a container image
+type BuildImageInput struct {
+	Context    string            `json:"context,omitempty" jsonschema:"default=." jsonschema_description:"Build context directory. Defaults to the workspace root."`
+	Dockerfile string            `json:"dockerfile,omitempty" jsonschema_description:"Path of the Dockerfile, if not <context>/Dockerfile."`
+	Tag        string            `json:"tag,omitempty" jsonschema:"default=agent-build:dev" jsonschema_description:"Name and tag for the image."`
+	Target     string            `json:"target,omitempty" jsonschema_description:"Stage to build, for multi-stage Dockerfiles."`
+	BuildArgs  map[string]string `json:"build_args,omitempty" jsonschema_description:"Values for the Dockerfile's ARGs."`
+	NoCache    bool              `json:"no_cache,omitempty" jsonschema:"default=false" jsonschema_description:"Build every step again instead of using cached layers."`
+}
+
+var BuildImageInputSchema = GenerateSchema[BuildImageInput]()
+
+func (p *ProjectTools) BuildImageDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "build_image",
+		Description: "Build a container image with docker build, streaming the log while it runs. Reports the build time, the image size and its largest layers, or the failing step and the end of the log. Use this to check Dockerfile changes.",
+		InputSchema: BuildImageInputSchema,
+		Function:    p.BuildImage,
+		Examples: []ToolExample{
+			{Input: `{"tag": "api:dev"}`, Output: "Built api:dev in 41s.\nSize: 24.3M\n\nLargest layers:\n  18.1M  COPY /out/api /api # buildkit\n  5.9M   ADD rootfs.tar.xz / # buildkit\n\nSteps:\n#5 [build 1/4] FROM golang:1.23\n..."},
+		},
+	}
+}
+
+func (p *ProjectTools) BuildImage(ctx context.Context, input json.RawMessage) (string, error) {
+	buildInput := BuildImageInput{}
+	if err := json.Unmarshal(input, &buildInput); err != nil {
+		return "", err
+	}
+	if buildInput.Context == "" {
+		buildInput.Context = "."
+	}
+	if buildInput.Tag == "" {
+		buildInput.Tag = "agent-build:dev"
+	}
+
+	args := []string{"build", "--progress=plain", "-t", buildInput.Tag}
+	if buildInput.Dockerfile != "" {
+		args = append(args, "-f", buildInput.Dockerfile)
+	}
+	if buildInput.Target != "" {
+		args = append(args, "--target", buildInput.Target)
+	}
+	if buildInput.NoCache {
+		args = append(args, "--no-cache")
+	}
+	names := make([]string, 0, len(buildInput.BuildArgs))
+	for name := range buildInput.BuildArgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "--build-arg", name+"="+buildInput.BuildArgs[name])
+	}
+	args = append(args, buildInput.Context)
+
+	start := time.Now()
+	steps, tail, err := p.streamBuild(ctx, args)
+	elapsed := time.Since(start).Round(time.Second)
+	if notInstalled(err) {
+		return "", fmt.Errorf("docker is not installed")
+	}
+	if err != nil {
+		return "", fmt.Errorf("docker build failed after %s: %v\n\nEnd of the build log:\n%s", elapsed, err, strings.Join(tail, "\n"))
+	}
+
+	var result strings.Builder
+	fmt.Fprintf(&result, "Built %s in %s.\n", buildInput.Tag, elapsed)
+	if size, err := p.imageSize(ctx, buildInput.Tag); err == nil {
+		fmt.Fprintf(&result, "Size: %s\n", formatSize(size))
+	}
+	if layers := p.largestLayers(ctx, buildInput.Tag); len(layers) > 0 {
+		result.WriteString("\nLargest layers:\n" + strings.Join(layers, "\n") + "\n")
+	}
+	if len(steps) > 0 {
+		result.WriteString("\nSteps:\n" + strings.Join(steps, "\n") + "\n")
+	}
+	return result.String(), nil
+}
+
+// streamBuild runs docker with args, streaming its log as it comes, and returns
+// the lines starting steps and the end of the log.
+func (p *ProjectTools) streamBuild(ctx context.Context, args []string) ([]string, []string, error) {
+	cmd := p.run(ctx, "docker", args...)
+	reader, writer := io.Pipe()
+	cmd.Stdout, cmd.Stderr = writer, writer
+
+	var steps, tail []string
+	stream := outputStream(ctx)
+	defer stream.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			fmt.Fprintln(stream, line)
+			if buildStepLine.MatchString(line) {
+				steps = append(steps, line)
+			}
+			if tail = append(tail, line); len(tail) > maxBuildLogLines {
+				tail = tail[1:]
+			}
+		}
+		// Drain whatever a too long line left, so docker isn't blocked.
+		io.Copy(io.Discard, reader)
+	}()
+
+	err := cmd.Run()
+	writer.Close()
+	<-done
+	return steps, tail, err
+}
+
+func (p *ProjectTools) imageSize(ctx context.Context, tag string) (int64, error) {
+	output, err := p.run(ctx, "docker", "image", "inspect", "--format", "{{.Size}}", tag).Output()
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(output)), 10, 64)
+}
+
+// largestLayers lists the image's biggest layers with the instruction creating each.
+func (p *ProjectTools) largestLayers(ctx context.Context, tag string) []string {
+	output, err := p.run(ctx, "docker", "history", "--no-trunc", "--human=false", "--format", "{{.Size}}\t{{.CreatedBy}}", tag).Output()
+	if err != nil {
+		return nil
+	}
+	type layer struct {
+		size      int64
+		createdBy string
+	}
+	var layers []layer
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		sizeText, createdBy, _ := strings.Cut(line, "\t")
+		size, err := strconv.ParseInt(sizeText, 10, 64)
+		if err != nil || size == 0 {
+			continue
+		}
+		createdBy = strings.TrimPrefix(strings.TrimSpace(createdBy), "/bin/sh -c ")
+		if len(createdBy) > 120 {
+			createdBy = createdBy[:120] + "..."
+		}
+		layers = append(layers, layer{size, createdBy})
+	}
+	sort.SliceStable(layers, func(i, j int) bool { return layers[i].size > layers[j].size })
+
+	var lines []string
+	for i, l := range layers {
+		if i == maxImageLayers {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("  %-6s %s", formatSize(l.size), l.createdBy))
+	}
+	return lines
+}
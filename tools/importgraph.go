@@ -0,0 +1,433 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Most packages listed in an import graph answer.
+const maxGraphEntries = 100
+
+// ImportGraph tool for finding what imports what
+type ImportGraphInput struct {
+	Query      string `json:"query,omitempty" jsonschema:"enum=overview,enum=imports,enum=imported_by,enum=cycles,default=overview" jsonschema_description:"overview lists the module's packages with their imports in the module; imports and imported_by list what package imports or what imports it; cycles finds import cycles."`
+	Package    string `json:"package,omitempty" jsonschema_description:"For imports and imported_by: an import path, a directory like ./internal/parser, or the end of an import path like parser."`
+	Transitive bool   `json:"transitive,omitempty" jsonschema_description:"Follow imports of imports, e.g. for everything that breaks if package changes."`
+	Tests      bool   `json:"tests,omitempty" jsonschema_description:"Count the imports of test files too."`
+}
+
+var ImportGraphInputSchema = GenerateSchema[ImportGraphInput]()
+
+func (g *GoTools) ImportGraphDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "import_graph",
+		Description: "Answer questions about the import graph of the Go module instead of grepping for import lines: which packages import a package (directly or transitively), what a package imports from the module, other modules and the standard library, and whether there are import cycles. Use this to plan moves, splits and renames of packages.",
+		InputSchema: ImportGraphInputSchema,
+		Function:    g.ImportGraph,
+		Examples: []ToolExample{
+			{Input: `{"query": "imported_by", "package": "./internal/store", "transitive": true}`, Output: "Imported by example.com/app/internal/store (transitively):\n  example.com/app/cmd/server\n  example.com/app/internal/api"},
+		},
+	}
+}
+
+// importGraph is the package graph of a module and its dependencies.
+type importGraph struct {
+	packages map[string]*listedPackage
+	// Imports of each package, with whether only its tests import it.
+	imports map[string]map[string]bool
+}
+
+// listedPackage is the part of go list -json output the graph uses.
+type listedPackage struct {
+	ImportPath   string
+	Dir          string
+	Standard     bool
+	Imports      []string
+	TestImports  []string
+	XTestImports []string
+	Module       *struct {
+		Path string
+		Dir  string
+		Main bool
+	}
+}
+
+func (p *listedPackage) inModule() bool {
+	return p.Module != nil && p.Module.Main
+}
+
+func (g *GoTools) ImportGraph(ctx context.Context, input json.RawMessage) (string, error) {
+	graphInput := ImportGraphInput{}
+	if err := json.Unmarshal(input, &graphInput); err != nil {
+		return "", err
+	}
+
+	// -e reports broken packages, e.g. ones in a cycle, instead of failing.
+	output, err := g.output(ctx, "go", "list", "-e", "-deps", "-json=ImportPath,Dir,Standard,Imports,TestImports,XTestImports,Module", "./...")
+	if notInstalled(err) {
+		return "", fmt.Errorf("go is not installed")
+	}
+	if err != nil && len(output) == 0 {
+		return "", err
+	}
+	graph, err := parseImportGraph(output, graphInput.Tests)
+	if err != nil {
+		return "", err
+	}
+
+	switch graphInput.Query {
+	case "", "overview":
+		return graph.overview(), nil
+	case "cycles":
+		return graph.cycles(), nil
+	}
+
+	if graphInput.Package == "" {
+		return "", fmt.Errorf("set package to the package whose %s to list", strings.ReplaceAll(graphInput.Query, "_", " "))
+	}
+	pkg, err := graph.resolve(graphInput.Package)
+	if err != nil {
+		return "", err
+	}
+	if graphInput.Query == "imports" {
+		return graph.describeImports(pkg, graphInput.Transitive), nil
+	}
+	return graph.describeImporters(pkg, graphInput.Transitive), nil
+}
+
+func parseImportGraph(output []byte, tests bool) (*importGraph, error) {
+	graph := &importGraph{packages: map[string]*listedPackage{}, imports: map[string]map[string]bool{}}
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var pkg listedPackage
+		if err := decoder.Decode(&pkg); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("unexpected go list output: %v", err)
+		}
+		graph.packages[pkg.ImportPath] = &pkg
+
+		imports := map[string]bool{}
+		if tests && pkg.inModule() {
+			for _, imported := range append(pkg.TestImports, pkg.XTestImports...) {
+				imports[imported] = true
+			}
+		}
+		for _, imported := range pkg.Imports {
+			imports[imported] = false
+		}
+		// An external test package imports the package it tests.
+		delete(imports, pkg.ImportPath)
+		delete(imports, "C")
+		graph.imports[pkg.ImportPath] = imports
+	}
+	return graph, nil
+}
+
+// resolve finds the package meant by an import path, a directory relative to
+// the module root or the end of an import path.
+func (g *importGraph) resolve(name string) (string, error) {
+	if _, ok := g.packages[name]; ok {
+		return name, nil
+	}
+
+	var matches []string
+	dir := filepath.Clean(name)
+	for path, pkg := range g.packages {
+		if !pkg.inModule() {
+			continue
+		}
+		if rel, err := filepath.Rel(pkg.Module.Dir, pkg.Dir); err == nil && rel == dir {
+			return path, nil
+		}
+		if strings.HasSuffix(path, "/"+strings.TrimPrefix(name, "./")) {
+			matches = append(matches, path)
+		}
+	}
+	sort.Strings(matches)
+	switch len(matches) {
+	case 1:
+		return matches[0], nil
+	case 0:
+		return "", fmt.Errorf("no package %s in the module or its dependencies", name)
+	}
+	return "", fmt.Errorf("%s could be any of: %s", name, strings.Join(matches, ", "))
+}
+
+// reachable returns the packages reachable from pkg along next, without pkg.
+func reachable(pkg string, next func(string) []string) []string {
+	seen := map[string]bool{pkg: true}
+	queue := []string{pkg}
+	var found []string
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, other := range next(current) {
+			if !seen[other] {
+				seen[other] = true
+				found = append(found, other)
+				queue = append(queue, other)
+			}
+		}
+	}
+	return found
+}
+
+func (g *importGraph) importsOf(pkg string) []string {
+	var imports []string
+	for imported := range g.imports[pkg] {
+		imports = append(imports, imported)
+	}
+	return imports
+}
+
+func (g *importGraph) importersOf(pkg string) []string {
+	var importers []string
+	for importer, imports := range g.imports {
+		if _, ok := imports[pkg]; ok {
+			importers = append(importers, importer)
+		}
+	}
+	return importers
+}
+
+func (g *importGraph) describeImports(pkg string, transitive bool) string {
+	imports := g.importsOf(pkg)
+	heading := "Imports of " + pkg
+	if transitive {
+		imports = reachable(pkg, g.importsOf)
+		heading += " (transitively)"
+	}
+
+	groups := map[string][]string{}
+	for _, imported := range imports {
+		group := "From other modules"
+		listed, ok := g.packages[imported]
+		switch {
+		case ok && listed.inModule():
+			group = "In the module"
+		case ok && listed.Standard, !ok && standardPackage(imported):
+			// Packages only tests import aren't listed.
+			group = "Standard library"
+		}
+		groups[group] = append(groups[group], imported+g.testNote(pkg, imported, transitive))
+	}
+
+	var result strings.Builder
+	result.WriteString(heading + ":\n")
+	if len(imports) == 0 {
+		result.WriteString("  nothing\n")
+	}
+	for _, group := range []string{"In the module", "From other modules", "Standard library"} {
+		if len(groups[group]) > 0 {
+			result.WriteString(fmt.Sprintf("%s:\n%s", group, listPackages(groups[group])))
+		}
+	}
+	return result.String()
+}
+
+func (g *importGraph) describeImporters(pkg string, transitive bool) string {
+	importers := g.importersOf(pkg)
+	heading := "Imported by " + pkg
+	if transitive {
+		importers = reachable(pkg, g.importersOf)
+		heading += " (transitively)"
+	}
+
+	// Other modules importing pkg are only listed as dependencies of the module, so leave them out.
+	var listed []string
+	for _, importer := range importers {
+		if g.packages[importer].inModule() {
+			listed = append(listed, importer+g.testNote(importer, pkg, transitive))
+		}
+	}
+	if len(listed) == 0 {
+		return heading + ": no package in the module\n"
+	}
+	return heading + ":\n" + listPackages(listed)
+}
+
+// testNote marks imports only made by tests.
+func (g *importGraph) testNote(importer, imported string, transitive bool) string {
+	if !transitive && g.imports[importer][imported] {
+		return " (tests)"
+	}
+	return ""
+}
+
+func (g *importGraph) overview() string {
+	var paths []string
+	modules := map[string]bool{}
+	for path, pkg := range g.packages {
+		switch {
+		case pkg.inModule():
+			paths = append(paths, path)
+		case pkg.Module != nil:
+			modules[pkg.Module.Path] = true
+		}
+	}
+	sort.Strings(paths)
+
+	var lines []string
+	for _, path := range paths {
+		var internal []string
+		for _, imported := range g.importsOf(path) {
+			if pkg, ok := g.packages[imported]; ok && pkg.inModule() {
+				internal = append(internal, imported+g.testNote(path, imported, false))
+			}
+		}
+		sort.Strings(internal)
+		line := fmt.Sprintf("%s (imported by %d)", path, len(g.importersOf(path)))
+		if len(internal) > 0 {
+			line += "\n    imports " + strings.Join(internal, ", ")
+		}
+		lines = append(lines, line)
+	}
+
+	result := fmt.Sprintf("%d packages in the module, depending on %d other modules:\n", len(paths), len(modules))
+	return result + listPackages(lines)
+}
+
+// cycles finds the import cycles among the module's packages, as the strongly
+// connected components of its graph, and shows one cycle through each.
+func (g *importGraph) cycles() string {
+	next := func(pkg string) []string {
+		var imports []string
+		for _, imported := range g.importsOf(pkg) {
+			if listed, ok := g.packages[imported]; ok && listed.inModule() {
+				imports = append(imports, imported)
+			}
+		}
+		sort.Strings(imports)
+		return imports
+	}
+	var paths []string
+	for path, pkg := range g.packages {
+		if pkg.inModule() {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	// Tarjan's algorithm.
+	index := map[string]int{}
+	lowlink := map[string]int{}
+	onStack := map[string]bool{}
+	var stack []string
+	var components [][]string
+	var visit func(pkg string)
+	visit = func(pkg string) {
+		index[pkg] = len(index)
+		lowlink[pkg] = index[pkg]
+		stack = append(stack, pkg)
+		onStack[pkg] = true
+		for _, imported := range next(pkg) {
+			if _, visited := index[imported]; !visited {
+				visit(imported)
+				lowlink[pkg] = min(lowlink[pkg], lowlink[imported])
+			} else if onStack[imported] {
+				lowlink[pkg] = min(lowlink[pkg], index[imported])
+			}
+		}
+		if lowlink[pkg] != index[pkg] {
+			return
+		}
+		var component []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == pkg {
+				break
+			}
+		}
+		if len(component) > 1 {
+			sort.Strings(component)
+			components = append(components, component)
+		}
+	}
+	for _, path := range paths {
+		if _, visited := index[path]; !visited {
+			visit(path)
+		}
+	}
+
+	if len(components) == 0 {
+		return "No import cycles among the module's packages.\n"
+	}
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("%d import cycle(s):\n", len(components)))
+	for _, component := range components {
+		inComponent := map[string]bool{}
+		for _, pkg := range component {
+			inComponent[pkg] = true
+		}
+		cycle := shortestCycle(component[0], func(pkg string) []string {
+			var within []string
+			for _, imported := range next(pkg) {
+				if inComponent[imported] {
+					within = append(within, imported)
+				}
+			}
+			return within
+		})
+		result.WriteString("  " + strings.Join(cycle, " -> ") + "\n")
+		if len(component) > len(cycle)-1 {
+			result.WriteString(fmt.Sprintf("    (%d packages are involved: %s)\n", len(component), strings.Join(component, ", ")))
+		}
+	}
+	return result.String()
+}
+
+// shortestCycle returns the shortest path from start back to itself, e.g.
+// [a b a], breadth first along next.
+func shortestCycle(start string, next func(string) []string) []string {
+	previous := map[string]string{}
+	queue := []string{start}
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		for _, other := range next(current) {
+			if other == start {
+				cycle := []string{start}
+				for pkg := current; pkg != start; pkg = previous[pkg] {
+					cycle = append([]string{pkg}, cycle...)
+				}
+				return append([]string{start}, cycle...)
+			}
+			if _, seen := previous[other]; !seen {
+				previous[other] = current
+				queue = append(queue, other)
+			}
+		}
+	}
+	return []string{start}
+}
+
+// standardPackage reports whether path is in the standard library, whose paths
+// have no dot in their first element.
+func standardPackage(path string) bool {
+	first, _, _ := strings.Cut(path, "/")
+	return !strings.Contains(first, ".")
+}
+
+// listPackages lists packages one per line, sorted, up to maxGraphEntries.
+func listPackages(packages []string) string {
+	sort.Strings(packages)
+	var result strings.Builder
+	for i, pkg := range packages {
+		if i == maxGraphEntries {
+			result.WriteString(fmt.Sprintf("  ... and %d more\n", len(packages)-i))
+			break
+		}
+		result.WriteString("  " + pkg + "\n")
+	}
+	return result.String()
+}
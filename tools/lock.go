@@ -0,0 +1,21 @@
+package tools
+
+import "sync"
+
+// lockPath serializes access to path across concurrent tool calls, so a read
+// never sees a half-done write and two writes can't interleave their conflict
+// check and write. It returns the unlock function.
+func (f *Files) lockPath(path string) func() {
+	key := recordKey(path)
+
+	f.locksMu.Lock()
+	lock, ok := f.locks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		f.locks[key] = lock
+	}
+	f.locksMu.Unlock()
+
+	lock.Lock()
+	return lock.Unlock
+}
@@ -0,0 +1,165 @@
+package tools
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Root is one named workspace root.
+type Root struct {
+	FS       FS
+	ReadOnly bool
+}
+
+// MultiRootFS serves several named roots; paths are addressed as root:relative/path.
+// Listing "." (or an empty path) shows the roots themselves.
+type MultiRootFS struct {
+	Roots map[string]Root
+}
+
+// ParseRoots parses "name=path[:ro];name=path[:ro]" into OS-backed roots.
+func ParseRoots(spec string) (*MultiRootFS, error) {
+	multi := &MultiRootFS{Roots: map[string]Root{}}
+
+	for _, entry := range strings.Split(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		name, dir, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || dir == "" {
+			return nil, fmt.Errorf("invalid root %q, expected name=path[:ro]", entry)
+		}
+
+		readOnly := false
+		if trimmed, found := strings.CutSuffix(dir, ":ro"); found {
+			dir, readOnly = trimmed, true
+		}
+
+		info, err := os.Stat(dir)
+		if err != nil {
+			return nil, fmt.Errorf("root %s: %v", name, err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("root %s: %s is not a directory", name, dir)
+		}
+
+		var root FS = OSFS{Root: dir}
+		if readOnly {
+			root = ReadOnlyFS{FS: root}
+		}
+		multi.Roots[name] = Root{FS: root, ReadOnly: readOnly}
+	}
+
+	if len(multi.Roots) == 0 {
+		return nil, fmt.Errorf("no roots in %q", spec)
+	}
+	return multi, nil
+}
+
+func (m *MultiRootFS) names() []string {
+	names := make([]string, 0, len(m.Roots))
+	for name := range m.Roots {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// split resolves root:relative/path to the root's filesystem and the relative path.
+func (m *MultiRootFS) split(name string) (Root, string, error) {
+	rootName, relative, ok := strings.Cut(name, ":")
+	if !ok {
+		return Root{}, "", fmt.Errorf("path %q must be addressed as root:relative/path (roots: %s)", name, strings.Join(m.names(), ", "))
+	}
+
+	root, ok := m.Roots[rootName]
+	if !ok {
+		return Root{}, "", fmt.Errorf("unknown root %q (roots: %s)", rootName, strings.Join(m.names(), ", "))
+	}
+
+	if relative == "" {
+		relative = "."
+	}
+	return root, relative, nil
+}
+
+func isTopLevel(name string) bool {
+	return name == "" || name == "." || name == "/"
+}
+
+func (m *MultiRootFS) ReadFile(name string) ([]byte, error) {
+	root, relative, err := m.split(name)
+	if err != nil {
+		return nil, err
+	}
+	return root.FS.ReadFile(relative)
+}
+
+func (m *MultiRootFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	root, relative, err := m.split(name)
+	if err != nil {
+		return err
+	}
+	return root.FS.WriteFile(relative, data, perm)
+}
+
+func (m *MultiRootFS) Remove(name string) error {
+	root, relative, err := m.split(name)
+	if err != nil {
+		return err
+	}
+	return Remove(root.FS, relative)
+}
+
+func (m *MultiRootFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	if isTopLevel(name) {
+		entries := []fs.DirEntry{}
+		for _, rootName := range m.names() {
+			entries = append(entries, fs.FileInfoToDirEntry(rootInfo{name: rootName + ":", readOnly: m.Roots[rootName].ReadOnly}))
+		}
+		return entries, nil
+	}
+
+	root, relative, err := m.split(name)
+	if err != nil {
+		return nil, err
+	}
+	return root.FS.ReadDir(relative)
+}
+
+func (m *MultiRootFS) Stat(name string) (fs.FileInfo, error) {
+	if isTopLevel(name) {
+		return rootInfo{name: "."}, nil
+	}
+
+	root, relative, err := m.split(name)
+	if err != nil {
+		return nil, err
+	}
+	return root.FS.Stat(filepath.Clean(relative))
+}
+
+// rootInfo describes a root in the top-level listing.
+type rootInfo struct {
+	name     string
+	readOnly bool
+}
+
+func (r rootInfo) Name() string { return r.name }
+func (r rootInfo) Size() int64  { return 0 }
+func (r rootInfo) Mode() fs.FileMode {
+	if r.readOnly {
+		return fs.ModeDir | 0555
+	}
+	return fs.ModeDir | 0755
+}
+func (r rootInfo) ModTime() time.Time { return time.Time{} }
+func (r rootInfo) IsDir() bool        { return true }
+func (r rootInfo) Sys() any           { return nil }
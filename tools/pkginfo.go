@@ -0,0 +1,150 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/kartikx/agent/docsource"
+)
+
+// PackageInfo tool for vetting dependencies before adding them
+type PackageInfoInput struct {
+	Packages []string `json:"packages" jsonschema:"minItems=1,maxItems=10" jsonschema_description:"Import paths of Go packages, e.g. github.com/spf13/cobra"`
+}
+
+var PackageInfoInputSchema = GenerateSchema[PackageInfoInput]()
+
+var PackageInfoDefinition = ToolDefinition{
+	Name:        "package_info",
+	Description: "Look up Go packages on pkg.go.dev: their latest version, when it was published, their license and their source repository. Use this before recommending or adding a dependency, to check its license is acceptable and that it's maintained.",
+	InputSchema: PackageInfoInputSchema,
+	Function:    PackageInfo,
+	Category:    CategoryRead,
+	Untrusted:   true,
+	Network:     true,
+	Examples: []ToolExample{
+		{Input: `{"packages": ["github.com/spf13/cobra"]}`, Output: "github.com/spf13/cobra\nVersion: v1.8.1\nPublished: 2024-06-12\nLicense: Apache-2.0\nRepository: https://github.com/spf13/cobra"},
+	},
+}
+
+func PackageInfo(ctx context.Context, input json.RawMessage) (string, error) {
+	infoInput := PackageInfoInput{}
+	if err := json.Unmarshal(input, &infoInput); err != nil {
+		return "", err
+	}
+
+	described := make([]string, len(infoInput.Packages))
+	var wg sync.WaitGroup
+	for i, pkg := range infoInput.Packages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			info, err := docsource.GoMetadata(ctx, pkg)
+			if err != nil {
+				described[i] = fmt.Sprintf("%s\nError: %v", pkg, err)
+				return
+			}
+			described[i] = pkg + "\n" + info.String()
+		}()
+	}
+	wg.Wait()
+	return strings.Join(described, "\n\n"), nil
+}
+
+// ComparePackages tool for choosing between candidate dependencies
+type ComparePackagesInput struct {
+	Packages []string `json:"packages" jsonschema:"minItems=2,maxItems=6" jsonschema_description:"Import paths of the candidate Go packages, e.g. github.com/go-chi/chi/v5 and github.com/gin-gonic/gin"`
+}
+
+var ComparePackagesInputSchema = GenerateSchema[ComparePackagesInput]()
+
+var ComparePackagesDefinition = ToolDefinition{
+	Name:        "compare_packages",
+	Description: "Compare candidate Go packages side by side from pkg.go.dev: their latest version and when it was published, license, how many packages import them, how many packages they import, and the size of their API (exported functions, types and methods), with what each is for. Use this to answer which of several libraries to use; read the documentation of the front-runners before recommending one.",
+	InputSchema: ComparePackagesInputSchema,
+	Function:    ComparePackages,
+	Category:    CategoryRead,
+	Untrusted:   true,
+	Network:     true,
+	Examples: []ToolExample{
+		{Input: `{"packages": ["github.com/go-chi/chi/v5", "github.com/gin-gonic/gin"]}`, Output: "| Package | Version | Published | License | Imported by | Imports | Functions | Types | Methods |\n|---|---|---|---|---|---|---|---|---|\n| github.com/go-chi/chi/v5 | v5.2.1 | 2025-02-11 | MIT | 9,124 | 0 | 31 | 11 | 42 |\n..."},
+	},
+}
+
+func ComparePackages(ctx context.Context, input json.RawMessage) (string, error) {
+	compareInput := ComparePackagesInput{}
+	if err := json.Unmarshal(input, &compareInput); err != nil {
+		return "", err
+	}
+	if len(compareInput.Packages) < 2 {
+		return "", fmt.Errorf("give at least two packages to compare")
+	}
+
+	profiles := make([]docsource.GoPackageProfile, len(compareInput.Packages))
+	errs := make([]error, len(compareInput.Packages))
+	var wg sync.WaitGroup
+	for i, pkg := range compareInput.Packages {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			profiles[i], errs[i] = docsource.GoProfile(ctx, pkg)
+		}()
+	}
+	wg.Wait()
+
+	var table, synopses, failures strings.Builder
+	failed := 0
+	table.WriteString("| Package | Version | Published | License | Imported by | Imports | Functions | Types | Methods |\n|---|---|---|---|---|---|---|---|---|\n")
+	for i, pkg := range compareInput.Packages {
+		if errs[i] != nil {
+			fmt.Fprintf(&failures, "- %s: %v\n", pkg, errs[i])
+			failed++
+			continue
+		}
+		p := profiles[i]
+		fmt.Fprintf(&table, "| %s | %s | %s | %s | %s | %s | %d | %d | %d |\n", pkg, orUnknown(p.Version), orUnknown(p.Published), orElse(p.License, "none detected"), formatCount(p.ImportedBy), formatCount(p.Imports), p.Functions, p.Types, p.Methods)
+		if p.Synopsis != "" {
+			fmt.Fprintf(&synopses, "- %s: %s\n", pkg, p.Synopsis)
+		}
+	}
+	if failed == len(compareInput.Packages) {
+		return "", fmt.Errorf("no package could be looked up:\n%s", failures.String())
+	}
+
+	result := table.String()
+	if synopses.Len() > 0 {
+		result += "\nWhat they're for:\n" + synopses.String()
+	}
+	if failed > 0 {
+		result += "\nCouldn't look up:\n" + failures.String()
+	}
+	return result, nil
+}
+
+func orUnknown(value string) string {
+	return orElse(value, "unknown")
+}
+
+func orElse(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
+
+// formatCount writes a count with thousands separators, e.g. 12,345, or
+// "unknown" for -1.
+func formatCount(n int) string {
+	if n < 0 {
+		return "unknown"
+	}
+	digits := strconv.Itoa(n)
+	for i := len(digits) - 3; i > 0; i -= 3 {
+		digits = digits[:i] + "," + digits[i:]
+	}
+	return digits
+}
@@ -0,0 +1,373 @@
+package tools
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// How long a plugin may take to answer a call unless PLUGIN_TIMEOUT says otherwise.
+const defaultPluginTimeout = 2 * time.Minute
+
+// Longest line a plugin may write, i.e. the largest response.
+const maxPluginMessage = 16 << 20
+
+// Plugin is an executable providing tools over stdio, so tools can be written in
+// any language. The agent writes one JSON request per line to its stdin and reads
+// one JSON response per line from its stdout; stderr is passed through to the
+// agent's log:
+//
+//	{"id": 1, "method": "describe"}
+//	{"id": 1, "result": {"tools": [{"name": "lint_sql", "description": "...", "input_schema": {...}, "category": "read"}]}}
+//	{"id": 2, "method": "invoke", "params": {"tool": "lint_sql", "input": {"path": "schema.sql"}}}
+//	{"id": 2, "result": {"output": "2 problems found ..."}}
+//	{"id": 3, "error": "no such file: schema.sql"}
+//
+// Requests may be sent before earlier ones are answered, and responses may come
+// in any order. The plugin should exit when its stdin is closed. A plugin that
+// exits is started again by the next call.
+type Plugin struct {
+	path    string
+	timeout time.Duration
+	tools   []ToolDefinition
+
+	// The running process; nil once it exited.
+	mu      sync.Mutex
+	process *pluginProcess
+	nextID  int64
+}
+
+type pluginProcess struct {
+	cmd    *exec.Cmd
+	exited chan struct{}
+
+	// Held while writing a request, so requests don't interleave.
+	writeMu sync.Mutex
+	stdin   io.WriteCloser
+
+	// Calls waiting for their response, by request ID.
+	mu      sync.Mutex
+	pending map[int64]chan pluginResponse
+	err     error
+}
+
+type pluginRequest struct {
+	ID     int64  `json:"id"`
+	Method string `json:"method"`
+	Params any    `json:"params,omitempty"`
+}
+
+type pluginResponse struct {
+	ID     int64           `json:"id"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  string          `json:"error,omitempty"`
+}
+
+// pluginTool is a tool as a plugin describes it.
+type pluginTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema json.RawMessage `json:"input_schema"`
+	Category    ToolCategory    `json:"category"`
+}
+
+// PluginTimeout reads PLUGIN_TIMEOUT, e.g. "30s".
+func PluginTimeout() time.Duration {
+	if value := os.Getenv("PLUGIN_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err == nil && timeout > 0 {
+			return timeout
+		}
+		fmt.Printf("Invalid PLUGIN_TIMEOUT %q, using %s\n", value, defaultPluginTimeout)
+	}
+	return defaultPluginTimeout
+}
+
+// StartPlugin starts the executable at path and asks it for its tools.
+func StartPlugin(path string, timeout time.Duration) (*Plugin, error) {
+	p := &Plugin{path: path, timeout: timeout}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	result, err := p.call(ctx, "describe", nil)
+	if err != nil {
+		p.Close()
+		return nil, fmt.Errorf("plugin %s: describe failed: %v", path, err)
+	}
+	var description struct {
+		Tools []pluginTool `json:"tools"`
+	}
+	if err := json.Unmarshal(result, &description); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("plugin %s: invalid describe result: %v", path, err)
+	}
+
+	for _, tool := range description.Tools {
+		definition, err := p.definition(tool)
+		if err != nil {
+			p.Close()
+			return nil, fmt.Errorf("plugin %s: %v", path, err)
+		}
+		p.tools = append(p.tools, definition)
+	}
+	return p, nil
+}
+
+// Definitions returns the tools the plugin provides.
+func (p *Plugin) Definitions() []ToolDefinition {
+	return p.tools
+}
+
+func (p *Plugin) definition(tool pluginTool) (ToolDefinition, error) {
+	if !commandToolName.MatchString(tool.Name) {
+		return ToolDefinition{}, fmt.Errorf("invalid tool name %q: use lowercase letters, digits and _", tool.Name)
+	}
+	if strings.TrimSpace(tool.Description) == "" {
+		return ToolDefinition{}, fmt.Errorf("tool %s: description is required", tool.Name)
+	}
+
+	schema := anthropic.ToolInputSchemaParam{Properties: map[string]any{}}
+	if len(tool.InputSchema) > 0 {
+		var parameters struct {
+			Properties map[string]any `json:"properties"`
+			Required   []string       `json:"required"`
+		}
+		if err := json.Unmarshal(tool.InputSchema, &parameters); err != nil {
+			return ToolDefinition{}, fmt.Errorf("tool %s: invalid input_schema: %v", tool.Name, err)
+		}
+		if parameters.Properties != nil {
+			schema.Properties = parameters.Properties
+		}
+		schema.Required = parameters.Required
+	}
+
+	category := tool.Category
+	switch category {
+	case "":
+		category = CategoryExecute
+	case CategoryRead, CategoryWrite, CategoryExecute:
+	default:
+		return ToolDefinition{}, fmt.Errorf("tool %s: category must be read, write or execute, got %q", tool.Name, category)
+	}
+
+	name := tool.Name
+	return ToolDefinition{
+		Name:        name,
+		Description: tool.Description,
+		InputSchema: schema,
+		Category:    category,
+		Function: func(ctx context.Context, input json.RawMessage) (string, error) {
+			return p.invoke(ctx, name, input)
+		},
+	}, nil
+}
+
+func (p *Plugin) invoke(ctx context.Context, tool string, input json.RawMessage) (string, error) {
+	if len(strings.TrimSpace(string(input))) == 0 {
+		input = json.RawMessage("{}")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+
+	result, err := p.call(ctx, "invoke", map[string]any{"tool": tool, "input": input})
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "", fmt.Errorf("plugin %s did not answer within %s", filepath.Base(p.path), p.timeout)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	var output struct {
+		Output string `json:"output"`
+	}
+	if err := json.Unmarshal(result, &output); err != nil {
+		return "", fmt.Errorf("invalid result from plugin %s: %v", filepath.Base(p.path), err)
+	}
+	return output.Output, nil
+}
+
+// call sends a request, starting the plugin if it isn't running, and waits for its response.
+func (p *Plugin) call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	p.mu.Lock()
+	if p.process == nil {
+		process, err := startPluginProcess(p.path)
+		if err != nil {
+			p.mu.Unlock()
+			return nil, err
+		}
+		p.process = process
+		go func() {
+			<-process.exited
+			p.mu.Lock()
+			if p.process == process {
+				p.process = nil
+			}
+			p.mu.Unlock()
+		}()
+	}
+	process := p.process
+	p.nextID++
+	id := p.nextID
+	p.mu.Unlock()
+
+	responses := make(chan pluginResponse, 1)
+	process.mu.Lock()
+	if process.err != nil {
+		process.mu.Unlock()
+		return nil, process.err
+	}
+	process.pending[id] = responses
+	process.mu.Unlock()
+
+	line, err := json.Marshal(pluginRequest{ID: id, Method: method, Params: params})
+	if err == nil {
+		process.writeMu.Lock()
+		_, err = process.stdin.Write(append(line, '\n'))
+		process.writeMu.Unlock()
+	}
+	if err != nil {
+		process.mu.Lock()
+		delete(process.pending, id)
+		process.mu.Unlock()
+		return nil, fmt.Errorf("failed to send to plugin %s: %v", filepath.Base(p.path), err)
+	}
+
+	select {
+	case response := <-responses:
+		if response.Error != "" {
+			return nil, errors.New(response.Error)
+		}
+		return response.Result, nil
+	case <-process.exited:
+		return nil, process.exitError()
+	case <-ctx.Done():
+		process.mu.Lock()
+		delete(process.pending, id)
+		process.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the plugin by closing its stdin, killing it if it doesn't exit.
+func (p *Plugin) Close() error {
+	p.mu.Lock()
+	process := p.process
+	p.process = nil
+	p.mu.Unlock()
+
+	if process == nil {
+		return nil
+	}
+	process.stdin.Close()
+	select {
+	case <-process.exited:
+	case <-time.After(5 * time.Second):
+		process.cmd.Process.Kill()
+		<-process.exited
+	}
+	return nil
+}
+
+func startPluginProcess(path string) (*pluginProcess, error) {
+	cmd := exec.Command(path)
+	cmd.Stderr = &prefixWriter{prefix: fmt.Sprintf("[plugin %s] ", filepath.Base(path)), w: os.Stdout}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start plugin %s: %v", path, err)
+	}
+
+	process := &pluginProcess{cmd: cmd, stdin: stdin, exited: make(chan struct{}), pending: map[int64]chan pluginResponse{}}
+	go process.readResponses(stdout, filepath.Base(path))
+	return process, nil
+}
+
+// readResponses hands each response line to the call waiting for it, until the plugin exits.
+func (p *pluginProcess) readResponses(stdout io.Reader, name string) {
+	scanner := bufio.NewScanner(stdout)
+	scanner.Buffer(make([]byte, 64*1024), maxPluginMessage)
+	for scanner.Scan() {
+		var response pluginResponse
+		if err := json.Unmarshal(scanner.Bytes(), &response); err != nil {
+			fmt.Printf("[plugin %s] ignoring invalid response: %v\n", name, err)
+			continue
+		}
+
+		p.mu.Lock()
+		responses, ok := p.pending[response.ID]
+		delete(p.pending, response.ID)
+		p.mu.Unlock()
+		if ok {
+			responses <- response
+		}
+	}
+
+	// A response too long to read leaves the plugin unusable.
+	scanErr := scanner.Err()
+	if scanErr != nil {
+		p.cmd.Process.Kill()
+	}
+	err := p.cmd.Wait()
+
+	p.mu.Lock()
+	switch {
+	case scanErr != nil:
+		p.err = fmt.Errorf("plugin %s stopped: %v", name, scanErr)
+	case err != nil:
+		p.err = fmt.Errorf("plugin %s exited: %v", name, err)
+	default:
+		p.err = fmt.Errorf("plugin %s exited", name)
+	}
+	p.mu.Unlock()
+	close(p.exited)
+}
+
+func (p *pluginProcess) exitError() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// prefixWriter writes each line with a prefix, e.g. a plugin's stderr to the agent's log.
+type prefixWriter struct {
+	prefix string
+	w      io.Writer
+
+	mu      sync.Mutex
+	partial []byte
+}
+
+func (w *prefixWriter) Write(data []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.partial = append(w.partial, data...)
+	for {
+		i := strings.IndexByte(string(w.partial), '\n')
+		if i < 0 {
+			break
+		}
+		fmt.Fprintf(w.w, "%s%s\n", w.prefix, w.partial[:i])
+		w.partial = w.partial[i+1:]
+	}
+	return len(data), nil
+}
@@ -0,0 +1,103 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Profile written by profile_code in the module directory, removed afterwards.
+const profileFile = ".agent-profile.out"
+
+// ProfileCode tool for finding hot spots with pprof
+type ProfileCodeInput struct {
+	Kind    string `json:"kind,omitempty" jsonschema:"enum=cpu,enum=heap,default=cpu" jsonschema_description:"cpu for where time is spent, heap for where memory is allocated."`
+	Package string `json:"package,omitempty" jsonschema_description:"Profile this package's tests or benchmarks, e.g. ./parser. Set this or url."`
+	Run     string `json:"run,omitempty" jsonschema_description:"Regular expression selecting the tests to run while profiling, as for go test -run."`
+	Bench   string `json:"bench,omitempty" jsonschema_description:"Regular expression selecting the benchmarks to run while profiling, as for go test -bench. Benchmarks usually give more useful profiles than tests."`
+	URL     string `json:"url,omitempty" jsonschema_description:"Capture from a running program serving net/http/pprof instead, e.g. http://localhost:6060."`
+	Seconds int    `json:"seconds,omitempty" jsonschema:"default=10,minimum=1,maximum=120" jsonschema_description:"How long to capture a CPU profile from url."`
+	Top     int    `json:"top,omitempty" jsonschema:"default=20,minimum=1,maximum=100" jsonschema_description:"Number of functions to list."`
+}
+
+var ProfileCodeInputSchema = GenerateSchema[ProfileCodeInput]()
+
+func (g *GoTools) ProfileCodeDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "profile_code",
+		Description: "Profile CPU time or heap allocations with pprof and list the hottest functions: flat is the cost in the function itself, cum includes everything it calls. Profile a package's tests or benchmarks, or capture from a running program that serves net/http/pprof.",
+		InputSchema: ProfileCodeInputSchema,
+		Function:    g.ProfileCode,
+		Examples: []ToolExample{
+			{Input: `{"package": "./parser", "bench": "Parse"}`, Output: "Showing nodes accounting for 1.2s, 85% of 1.41s total\n      flat  flat%   sum%        cum   cum%\n     0.5s 35.46% 35.46%      0.9s 63.83%  parser.(*lexer).next\n..."},
+		},
+	}
+}
+
+func (g *GoTools) ProfileCode(ctx context.Context, input json.RawMessage) (string, error) {
+	profileInput := ProfileCodeInput{}
+
+	err := json.Unmarshal(input, &profileInput)
+	if err != nil {
+		return "", err
+	}
+	if (profileInput.Package == "") == (profileInput.URL == "") {
+		return "", fmt.Errorf("set exactly one of package or url")
+	}
+	if profileInput.Kind == "" {
+		profileInput.Kind = "cpu"
+	}
+	if profileInput.Seconds == 0 {
+		profileInput.Seconds = 10
+	}
+	if profileInput.Top == 0 {
+		profileInput.Top = 20
+	}
+
+	pprofArgs := []string{"tool", "pprof", "-top", "-nodecount=" + strconv.Itoa(profileInput.Top)}
+	if profileInput.Kind == "heap" {
+		pprofArgs = append(pprofArgs, "-sample_index=alloc_space")
+	}
+
+	if profileInput.URL != "" {
+		source := strings.TrimSuffix(profileInput.URL, "/") + "/debug/pprof/profile?seconds=" + strconv.Itoa(profileInput.Seconds)
+		if profileInput.Kind == "heap" {
+			source = strings.TrimSuffix(profileInput.URL, "/") + "/debug/pprof/heap"
+		}
+
+		output, err := g.output(ctx, "go", append(pprofArgs, source)...)
+		if err != nil {
+			return "", err
+		}
+		return string(output), nil
+	}
+
+	defer g.run(context.Background(), "rm", "-f", profileFile).Run()
+
+	testArgs := []string{"test", "-run=" + profileInput.Run}
+	if profileInput.Run == "" && profileInput.Bench != "" {
+		testArgs = []string{"test", "-run=^$"}
+	}
+	if profileInput.Bench != "" {
+		testArgs = append(testArgs, "-bench="+profileInput.Bench)
+	}
+	if profileInput.Kind == "heap" {
+		testArgs = append(testArgs, "-memprofile="+profileFile)
+	} else {
+		testArgs = append(testArgs, "-cpuprofile="+profileFile)
+	}
+	testArgs = append(testArgs, "-o=/dev/null", profileInput.Package)
+
+	testOutput, err := g.run(ctx, "go", testArgs...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("profiled tests failed: %v\n%s", err, testOutput)
+	}
+
+	output, err := g.output(ctx, "go", append(pprofArgs, profileFile)...)
+	if err != nil {
+		return "", err
+	}
+	return string(output), nil
+}
@@ -0,0 +1,329 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Depth below the workspace root searched for project manifests.
+const projectMaxDepth = 2
+
+// Most build, test or format output returned; longer output is compacted.
+const maxProjectOutput = 20_000
+
+// Directories never searched for projects.
+var projectSkipped = map[string]bool{"node_modules": true, "vendor": true, "target": true, "testdata": true, "build": true, "dist": true}
+
+// Project is a project found in the workspace by its manifest, with the
+// commands its ecosystem builds, tests and formats it with.
+type Project struct {
+	Dir       string // relative to the workspace root, "." for the root
+	Ecosystem string // go, node, rust or maven
+	Manifest  string
+	// Commands, nil if the project has none for the job.
+	Build  []string
+	Test   []string
+	Format []string
+	// Arguments added to Test to run only the tests matching a filter, which replaces %s.
+	TestFilter []string
+}
+
+// DetectProjects finds Go modules, npm packages, Cargo crates and Maven
+// projects in the root and the directories below it, so the same tools work in
+// mixed-language repositories.
+func DetectProjects(fsys FS) []Project {
+	var projects []Project
+	var walk func(dir string, depth int)
+	walk = func(dir string, depth int) {
+		entries, err := fsys.ReadDir(dir)
+		if err != nil {
+			return
+		}
+		names := map[string]bool{}
+		for _, entry := range entries {
+			names[entry.Name()] = true
+		}
+		if project, ok := detectProject(fsys, dir, names); ok {
+			projects = append(projects, project)
+		}
+		if depth == projectMaxDepth {
+			return
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() && !projectSkipped[name] && !strings.HasPrefix(name, ".") && !strings.HasPrefix(name, "_") {
+				walk(path.Join(dir, name), depth+1)
+			}
+		}
+	}
+	walk(".", 0)
+	sort.Slice(projects, func(i, j int) bool { return projects[i].Dir < projects[j].Dir })
+	return projects
+}
+
+func detectProject(fsys FS, dir string, names map[string]bool) (Project, bool) {
+	switch {
+	case names["go.mod"]:
+		return Project{
+			Dir: dir, Ecosystem: "go", Manifest: "go.mod",
+			Build:      []string{"go", "build", "./..."},
+			Test:       []string{"go", "test", "./..."},
+			Format:     []string{"gofmt", "-l", "-w", "."},
+			TestFilter: []string{"-run", "%s"},
+		}, true
+	case names["Cargo.toml"]:
+		return Project{
+			Dir: dir, Ecosystem: "rust", Manifest: "Cargo.toml",
+			Build:      []string{"cargo", "build"},
+			Test:       []string{"cargo", "test"},
+			Format:     []string{"cargo", "fmt"},
+			TestFilter: []string{"%s"},
+		}, true
+	case names["pom.xml"]:
+		project := Project{
+			Dir: dir, Ecosystem: "maven", Manifest: "pom.xml",
+			Build:      []string{"mvn", "-q", "-B", "compile"},
+			Test:       []string{"mvn", "-q", "-B", "test"},
+			TestFilter: []string{"-Dtest=%s", "-Dsurefire.failIfNoSpecifiedTests=false"},
+		}
+		if pom, err := fsys.ReadFile(path.Join(dir, "pom.xml")); err == nil && strings.Contains(string(pom), "spotless-maven-plugin") {
+			project.Format = []string{"mvn", "-q", "-B", "spotless:apply"}
+		}
+		return project, true
+	case names["package.json"]:
+		return nodeProject(fsys, dir, names), true
+	}
+	return Project{}, false
+}
+
+// nodeProject uses the package manager whose lockfile is there, and the
+// package's own scripts where it has them.
+func nodeProject(fsys FS, dir string, names map[string]bool) Project {
+	manager := "npm"
+	if names["pnpm-lock.yaml"] {
+		manager = "pnpm"
+	} else if names["yarn.lock"] {
+		manager = "yarn"
+	}
+
+	var manifest struct {
+		Scripts         map[string]string `json:"scripts"`
+		Dependencies    map[string]string `json:"dependencies"`
+		DevDependencies map[string]string `json:"devDependencies"`
+	}
+	if data, err := fsys.ReadFile(path.Join(dir, "package.json")); err == nil {
+		json.Unmarshal(data, &manifest)
+	}
+
+	project := Project{Dir: dir, Ecosystem: "node", Manifest: "package.json"}
+	if _, ok := manifest.Scripts["build"]; ok {
+		project.Build = []string{manager, "run", "build"}
+	}
+	if _, ok := manifest.Scripts["test"]; ok {
+		project.Test = []string{manager, "test"}
+		// npm passes arguments on to the script only after --.
+		project.TestFilter = []string{"%s"}
+		if manager == "npm" {
+			project.TestFilter = []string{"--", "%s"}
+		}
+	}
+	if _, ok := manifest.Scripts["format"]; ok {
+		project.Format = []string{manager, "run", "format"}
+	} else if _, ok := manifest.DevDependencies["prettier"]; ok {
+		project.Format = []string{"npx", "prettier", "--write", "."}
+	} else if _, ok := manifest.Dependencies["prettier"]; ok {
+		project.Format = []string{"npx", "prettier", "--write", "."}
+	}
+	return project
+}
+
+// ProjectTools holds the tools that build, test and format the projects in the
+// workspace with their own toolchains, list their Makefile targets and the like,
+// and refactor their code.
+type ProjectTools struct {
+	fs    FS
+	files *Files // for edits, e.g. by rename_symbol
+	run   CommandRunner
+}
+
+func NewProjectTools(fsys FS, run CommandRunner) *ProjectTools {
+	fsys = NewIgnoreFS(fsys)
+	return &ProjectTools{fs: fsys, files: NewFiles(fsys, nil), run: run}
+}
+
+func (p *ProjectTools) Definitions() []ToolDefinition {
+	return []ToolDefinition{
+		p.BuildProjectDefinition(),
+		p.RunTestsDefinition(),
+		p.FormatCodeDefinition(),
+		p.ListTargetsDefinition(),
+		p.BuildImageDefinition(),
+		p.RenameSymbolDefinition(),
+	}
+}
+
+// ProjectInput selects the project a tool works on.
+type ProjectInput struct {
+	Project string `json:"project,omitempty" jsonschema_description:"Directory of the project, e.g. web. Can be left out when the workspace has one project."`
+}
+
+var ProjectInputSchema = GenerateSchema[ProjectInput]()
+
+// RunTests tool for running a project's tests
+type RunTestsInput struct {
+	Project string `json:"project,omitempty" jsonschema_description:"Directory of the project, e.g. web. Can be left out when the workspace has one project."`
+	Filter  string `json:"filter,omitempty" jsonschema_description:"Only run the tests matching this, e.g. a test name or pattern."`
+}
+
+var RunTestsInputSchema = GenerateSchema[RunTestsInput]()
+
+func (p *ProjectTools) BuildProjectDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "build_project",
+		Description: "Build a project in the workspace with its own toolchain: go build for Go modules, the build script for npm packages, cargo build for Rust crates and mvn compile for Maven projects. Use this to check that changes compile.",
+		InputSchema: ProjectInputSchema,
+		Function:    p.BuildProject,
+		Examples: []ToolExample{
+			{Input: `{"project": "web"}`, Output: "Command: npm run build (in web)\nOutput:\n> web@1.0.0 build\n> vite build\n..."},
+		},
+	}
+}
+
+func (p *ProjectTools) RunTestsDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "run_tests",
+		Description: "Run a project's tests with its own toolchain: go test for Go modules, the test script for npm packages, cargo test for Rust crates and mvn test for Maven projects. Fails with the output if any test fails.",
+		InputSchema: RunTestsInputSchema,
+		Function:    p.RunTests,
+		Examples: []ToolExample{
+			{Input: `{"project": ".", "filter": "TestParse"}`, Output: "Command: go test ./... -run TestParse\nOutput:\nok  \texample.com/parser\t0.012s"},
+		},
+	}
+}
+
+func (p *ProjectTools) FormatCodeDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "format_code",
+		Description: "Format a project's code in place with its ecosystem's formatter: gofmt, the format script or prettier for npm packages, cargo fmt, or spotless for Maven projects. Run this after editing files.",
+		InputSchema: ProjectInputSchema,
+		Function:    p.FormatCode,
+		Category:    CategoryWrite,
+	}
+}
+
+func (p *ProjectTools) BuildProject(ctx context.Context, input json.RawMessage) (string, error) {
+	projectInput := ProjectInput{}
+	if err := json.Unmarshal(input, &projectInput); err != nil {
+		return "", err
+	}
+	project, err := p.project(projectInput.Project)
+	if err != nil {
+		return "", err
+	}
+	if project.Build == nil {
+		return "", fmt.Errorf("%s has no build step; its package.json has no build script", project.Dir)
+	}
+	return p.runIn(ctx, project, project.Build)
+}
+
+func (p *ProjectTools) RunTests(ctx context.Context, input json.RawMessage) (string, error) {
+	testsInput := RunTestsInput{}
+	if err := json.Unmarshal(input, &testsInput); err != nil {
+		return "", err
+	}
+	project, err := p.project(testsInput.Project)
+	if err != nil {
+		return "", err
+	}
+	if project.Test == nil {
+		return "", fmt.Errorf("%s has no tests; its package.json has no test script", project.Dir)
+	}
+
+	command := project.Test
+	if testsInput.Filter != "" {
+		command = append([]string{}, command...)
+		for _, arg := range project.TestFilter {
+			command = append(command, strings.ReplaceAll(arg, "%s", testsInput.Filter))
+		}
+	}
+	return p.runIn(ctx, project, command)
+}
+
+func (p *ProjectTools) FormatCode(ctx context.Context, input json.RawMessage) (string, error) {
+	projectInput := ProjectInput{}
+	if err := json.Unmarshal(input, &projectInput); err != nil {
+		return "", err
+	}
+	project, err := p.project(projectInput.Project)
+	if err != nil {
+		return "", err
+	}
+	if project.Format == nil {
+		return "", fmt.Errorf("no formatter is set up for %s (%s)", project.Dir, project.Ecosystem)
+	}
+	return p.runIn(ctx, project, project.Format)
+}
+
+// project finds the project in dir, or the only project if dir is empty.
+func (p *ProjectTools) project(dir string) (Project, error) {
+	projects := DetectProjects(p.fs)
+	if len(projects) == 0 {
+		return Project{}, fmt.Errorf("no project found: the workspace has no go.mod, package.json, Cargo.toml or pom.xml")
+	}
+
+	if dir == "" {
+		if len(projects) == 1 {
+			return projects[0], nil
+		}
+		return Project{}, fmt.Errorf("the workspace has several projects, set project to one of: %s", DescribeProjects(projects))
+	}
+	dir = path.Clean(strings.TrimPrefix(dir, "./"))
+	for _, project := range projects {
+		if project.Dir == dir {
+			return project, nil
+		}
+	}
+	return Project{}, fmt.Errorf("no project in %s; the projects are: %s", dir, DescribeProjects(projects))
+}
+
+// DescribeProjects lists projects as "dir (ecosystem)", e.g. ". (go), web (node)".
+func DescribeProjects(projects []Project) string {
+	described := make([]string, len(projects))
+	for i, project := range projects {
+		described[i] = fmt.Sprintf("%s (%s)", project.Dir, project.Ecosystem)
+	}
+	return strings.Join(described, ", ")
+}
+
+// runIn runs a command in the project's directory and returns its output. The
+// output is part of the error if the command fails, e.g. because tests failed.
+func (p *ProjectTools) runIn(ctx context.Context, project Project, command []string) (string, error) {
+	name, args := command[0], command[1:]
+	description := strings.Join(command, " ")
+	if project.Dir != "." {
+		// The runner starts commands in the workspace root, which may be inside a container.
+		name, args = "sh", append([]string{"-c", `cd "$0" && exec "$@"`, project.Dir}, command...)
+		description += " (in " + project.Dir + ")"
+	}
+
+	cmd := p.run(ctx, name, args...)
+	var output strings.Builder
+	stream := outputStream(ctx)
+	cmd.Stdout = io.MultiWriter(&output, stream)
+	cmd.Stderr = cmd.Stdout
+	err := cmd.Run()
+	stream.Close()
+	result := fmt.Sprintf("Command: %s\nOutput:\n%s", description, CompactOutput(output.String(), maxProjectOutput))
+	if notInstalled(err) {
+		return "", fmt.Errorf("%s is not installed", command[0])
+	}
+	if err != nil {
+		return "", fmt.Errorf("%v\n%s", err, result)
+	}
+	return result, nil
+}
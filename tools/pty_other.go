@@ -0,0 +1,18 @@
+//go:build !linux
+
+package tools
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+)
+
+// openPTY isn't implemented outside Linux; shells fall back to pipes.
+func openPTY() (*os.File, *os.File, error) {
+	return nil, nil, errors.New("pseudo-terminals are only supported on Linux")
+}
+
+func attachTTY(cmd *exec.Cmd, tty *os.File) {
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = tty, tty, tty
+}
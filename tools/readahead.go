@@ -0,0 +1,116 @@
+package tools
+
+import (
+	"io/fs"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits of what ReadAheadFS prefetches.
+const (
+	readAheadMaxSize    = 32 << 10 // bytes per file
+	readAheadPerListing = 8
+	readAheadMaxCached  = 256
+)
+
+// Files nearly always read after their directory is listed.
+var readAheadNames = map[string]bool{
+	"go.mod": true, "main.go": true, "doc.go": true, "README.md": true, "Makefile": true,
+	"Dockerfile": true, "package.json": true, "Cargo.toml": true, "pyproject.toml": true,
+}
+
+// ReadAheadFS prefetches small, obviously relevant files (go.mod, main.go, the
+// file named after its package directory, ...) in the background whenever a
+// directory is listed, so the read_file call that usually follows is served from
+// memory. Cached files are checked against the file's size and modification time.
+type ReadAheadFS struct {
+	FS
+
+	mu    sync.Mutex
+	cache map[string]prefetchedFile
+}
+
+type prefetchedFile struct {
+	data    []byte
+	size    int64
+	modTime time.Time
+}
+
+func NewReadAheadFS(fsys FS) *ReadAheadFS {
+	return &ReadAheadFS{FS: fsys, cache: map[string]prefetchedFile{}}
+}
+
+func (r *ReadAheadFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	entries, err := r.FS.ReadDir(name)
+	if err == nil {
+		go r.prefetch(name, entries)
+	}
+	return entries, err
+}
+
+func (r *ReadAheadFS) ReadFile(name string) ([]byte, error) {
+	r.mu.Lock()
+	cached, ok := r.cache[recordKey(name)]
+	r.mu.Unlock()
+
+	if ok {
+		if info, err := r.FS.Stat(name); err == nil && info.Size() == cached.size && info.ModTime().Equal(cached.modTime) {
+			return append([]byte{}, cached.data...), nil
+		}
+	}
+	return r.FS.ReadFile(name)
+}
+
+func (r *ReadAheadFS) WriteFile(name string, data []byte, perm fs.FileMode) error {
+	r.mu.Lock()
+	delete(r.cache, recordKey(name))
+	r.mu.Unlock()
+
+	return r.FS.WriteFile(name, data, perm)
+}
+
+func (r *ReadAheadFS) Remove(name string) error {
+	r.mu.Lock()
+	delete(r.cache, recordKey(name))
+	r.mu.Unlock()
+
+	return Remove(r.FS, name)
+}
+
+// prefetch reads the likely-needed files among a listed directory's entries.
+func (r *ReadAheadFS) prefetch(dir string, entries []fs.DirEntry) {
+	packageFile := path.Base(dir) + ".go"
+	fetched := 0
+
+	for _, entry := range entries {
+		if fetched >= readAheadPerListing {
+			return
+		}
+		if entry.IsDir() || !(readAheadNames[entry.Name()] || entry.Name() == packageFile || strings.HasPrefix(entry.Name(), "README")) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.Size() > readAheadMaxSize {
+			continue
+		}
+
+		name := path.Join(dir, entry.Name())
+		data, err := r.FS.ReadFile(name)
+		if err != nil {
+			continue
+		}
+		fetched++
+
+		r.mu.Lock()
+		if len(r.cache) >= readAheadMaxCached {
+			for key := range r.cache {
+				delete(r.cache, key)
+				break
+			}
+		}
+		r.cache[recordKey(name)] = prefetchedFile{data: data, size: info.Size(), modTime: info.ModTime()}
+		r.mu.Unlock()
+	}
+}
@@ -0,0 +1,231 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"go/scanner"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RenameSymbol tool for renaming Go identifiers everywhere they're used
+type RenameSymbolInput struct {
+	Path    string `json:"path" jsonschema:"minLength=1" jsonschema_description:"Go file declaring or using the symbol, e.g. internal/store/store.go"`
+	Symbol  string `json:"symbol" jsonschema:"minLength=1" jsonschema_description:"Current name, e.g. Open. For a method or field just its name, not Type.Name."`
+	Line    int    `json:"line,omitempty" jsonschema_description:"Line of the file the symbol is on, when its first occurrence in the file isn't the one meant, e.g. a local variable used in several functions."`
+	NewName string `json:"new_name" jsonschema:"minLength=1" jsonschema_description:"New name, e.g. OpenStore"`
+}
+
+var RenameSymbolInputSchema = GenerateSchema[RenameSymbolInput]()
+
+func (p *ProjectTools) RenameSymbolDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "rename_symbol",
+		Description: "Rename a Go identifier (function, type, method, field, variable, constant or package-level name) and every reference to it across the module, using gopls, which understands types: same-named identifiers elsewhere are left alone and conflicts are refused. Much safer than editing references one by one. Returns the changed files.",
+		InputSchema: RenameSymbolInputSchema,
+		Function:    p.RenameSymbol,
+		Examples: []ToolExample{
+			{Input: `{"path": "store/store.go", "symbol": "Open", "new_name": "OpenStore"}`, Output: "Renamed Open to OpenStore in 3 files:\n  store/store.go (+1 -1)\n  cmd/server/main.go (+1 -1)\n  store/store_test.go (+2 -2)"},
+		},
+	}
+}
+
+func (p *ProjectTools) RenameSymbol(ctx context.Context, input json.RawMessage) (string, error) {
+	renameInput := RenameSymbolInput{}
+	if err := json.Unmarshal(input, &renameInput); err != nil {
+		return "", err
+	}
+	if !token.IsIdentifier(renameInput.NewName) {
+		return "", fmt.Errorf("%q is not a valid Go identifier", renameInput.NewName)
+	}
+	path := filepath.Clean(renameInput.Path)
+	if filepath.Ext(path) != ".go" {
+		return "", fmt.Errorf("%s is not a Go file", renameInput.Path)
+	}
+
+	content, err := p.fs.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	offset, err := identifierOffset(content, renameInput.Symbol, renameInput.Line)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", path, err)
+	}
+
+	// gopls prints the edits as a diff; they're applied through the file tools
+	// so they land wherever those write, and are reported like other edits.
+	cmd := p.run(ctx, "gopls", "rename", "-d", fmt.Sprintf("%s:#%d", path, offset), renameInput.NewName)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	diff, err := cmd.Output()
+	if notInstalled(err) {
+		return "", fmt.Errorf("gopls is not installed; install it with go install golang.org/x/tools/gopls@latest")
+	}
+	if err != nil {
+		return "", fmt.Errorf("gopls could not rename %s: %s", renameInput.Symbol, strings.TrimSpace(stderr.String()))
+	}
+	patches, err := parseUnifiedDiff(string(diff))
+	if err != nil {
+		return "", fmt.Errorf("unexpected gopls output: %v", err)
+	}
+
+	// gopls names files by absolute path; the file the symbol is in gives away the root.
+	root, found := "", false
+	files := make([]string, 0, len(patches))
+	for file := range patches {
+		files = append(files, file)
+		if file == path {
+			found = true
+		} else if strings.HasSuffix(file, "/"+path) {
+			root, found = strings.TrimSuffix(file, path), true
+		}
+	}
+	if !found {
+		return "", fmt.Errorf("gopls didn't rename %s in %s:\n%s", renameInput.Symbol, path, diff)
+	}
+	sort.Strings(files)
+
+	var summary strings.Builder
+	var changes []FileChange
+	for _, file := range files {
+		rel := file
+		if root != "" {
+			rel, err = filepath.Rel(root, file)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				return "", fmt.Errorf("gopls would also change %s, outside the workspace", file)
+			}
+		}
+		change, err := p.files.edit(ctx, rel, func(before string) (string, error) {
+			return applyHunks(before, patches[file])
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to rename in %s, after changing %d other files: %w", rel, len(changes), err)
+		}
+		changes = append(changes, change)
+		fmt.Fprintf(&summary, "\n  %s (+%d -%d)", rel, change.Added, change.Removed)
+	}
+
+	result := fmt.Sprintf("Renamed %s to %s in %d files:%s", renameInput.Symbol, renameInput.NewName, len(changes), summary.String())
+	for _, change := range changes {
+		result = withFileChange(result, change)
+	}
+	return result, nil
+}
+
+// identifierOffset finds the byte offset of the first identifier named name in
+// a Go file, on line if it's set. Comments and strings are skipped.
+func identifierOffset(content []byte, name string, line int) (int, error) {
+	fset := token.NewFileSet()
+	file := fset.AddFile("", fset.Base(), len(content))
+	var s scanner.Scanner
+	s.Init(file, content, nil, 0)
+	for {
+		pos, tok, lit := s.Scan()
+		if tok == token.EOF {
+			break
+		}
+		if tok == token.IDENT && lit == name && (line == 0 || file.Line(pos) == line) {
+			return file.Offset(pos), nil
+		}
+	}
+	if line != 0 {
+		return 0, fmt.Errorf("no identifier %s on line %d", name, line)
+	}
+	return 0, fmt.Errorf("no identifier %s", name)
+}
+
+// hunk is one @@ section of a unified diff.
+type hunk struct {
+	start int      // first line of the old text, from 1
+	lines []string // with their " ", "-" or "+" prefix
+}
+
+var hunkHeader = regexp.MustCompile(`^@@ -(\d+)(?:,(\d+))? \+\d+(?:,(\d+))? @@`)
+
+// parseUnifiedDiff splits a unified diff into the hunks of each file.
+func parseUnifiedDiff(diff string) (map[string][]hunk, error) {
+	patches := map[string][]hunk{}
+	file := ""
+	// Lines of the current hunk still to come, counted from its header so
+	// that a removed line starting with "--" isn't taken for a file header.
+	oldLeft, newLeft := 0, 0
+	count := func(match string) int {
+		if match == "" {
+			return 1
+		}
+		n, _ := strconv.Atoi(match)
+		return n
+	}
+	for _, line := range strings.Split(diff, "\n") {
+		inHunk := oldLeft > 0 || newLeft > 0
+		switch {
+		case inHunk && line != "" && strings.ContainsRune(" -+", rune(line[0])),
+			strings.HasPrefix(line, `\`) && len(patches[file]) > 0:
+			hunks := patches[file]
+			hunks[len(hunks)-1].lines = append(hunks[len(hunks)-1].lines, line)
+			if line[0] != '+' && line[0] != '\\' {
+				oldLeft--
+			}
+			if line[0] != '-' && line[0] != '\\' {
+				newLeft--
+			}
+		case inHunk:
+			return nil, fmt.Errorf("hunk ends early at %q", line)
+		case strings.HasPrefix(line, "+++ "):
+			// Diff tools may append a timestamp after a tab.
+			file, _, _ = strings.Cut(strings.TrimPrefix(line, "+++ "), "\t")
+		case strings.HasPrefix(line, "@@"):
+			match := hunkHeader.FindStringSubmatch(line)
+			if match == nil || file == "" {
+				return nil, fmt.Errorf("invalid hunk header %q", line)
+			}
+			start, _ := strconv.Atoi(match[1])
+			oldLeft, newLeft = count(match[2]), count(match[3])
+			patches[file] = append(patches[file], hunk{start: start})
+		}
+	}
+	return patches, nil
+}
+
+// applyHunks applies a file's hunks to its content, failing if the lines they
+// change aren't there.
+func applyHunks(content string, hunks []hunk) (string, error) {
+	old := strings.SplitAfter(content, "\n")
+	var patched []string
+	next := 0 // index in old of the first line not yet copied
+	for _, h := range hunks {
+		at := max(h.start-1, 0)
+		if at < next || at > len(old) {
+			return "", fmt.Errorf("hunk at line %d is out of order", h.start)
+		}
+		patched = append(patched, old[next:at]...)
+		next = at
+		for i, line := range h.lines {
+			if strings.HasPrefix(line, `\`) {
+				// "\ No newline at end of file" belongs to the line before.
+				if i > 0 && strings.HasPrefix(h.lines[i-1], "+") {
+					patched[len(patched)-1] = strings.TrimSuffix(patched[len(patched)-1], "\n")
+				}
+				continue
+			}
+			text := line[1:]
+			if line[0] == '+' {
+				patched = append(patched, text+"\n")
+				continue
+			}
+			if next >= len(old) || strings.TrimSuffix(old[next], "\n") != text {
+				return "", fmt.Errorf("line %d has changed since gopls read it", next+1)
+			}
+			if line[0] == ' ' {
+				patched = append(patched, old[next])
+			}
+			next++
+		}
+	}
+	return strings.Join(append(patched, old[next:]...), ""), nil
+}
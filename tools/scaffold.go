@@ -0,0 +1,331 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+//go:embed templates
+var builtinTemplates embed.FS
+
+// ScaffoldTemplate is a set of files generated together, read from a
+// directory with a template.json and the files' text/template sources.
+type ScaffoldTemplate struct {
+	Description string             `json:"description"`
+	Variables   []ScaffoldVariable `json:"variables"`
+	// Sources by the path they're generated at, relative to the target
+	// directory. Paths are templates too, e.g. "{{.name}}/{{.name}}.go".
+	Files map[string]string `json:"files"`
+
+	fs fs.FS
+}
+
+type ScaffoldVariable struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	// Value used if none is given, itself a template, e.g. "{{base .dir}}".
+	// Variables without one are required.
+	Default *string `json:"default,omitempty"`
+}
+
+// Functions available in templates, for deriving identifiers from a name like "list orders".
+var scaffoldFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"title": func(s string) string {
+		if s == "" {
+			return s
+		}
+		runes := []rune(s)
+		runes[0] = unicode.ToUpper(runes[0])
+		return string(runes)
+	},
+	"pascal": func(s string) string { return joinWords(nameWords(s), "", capitalize) },
+	"camel": func(s string) string {
+		words := nameWords(s)
+		if len(words) == 0 {
+			return ""
+		}
+		return strings.ToLower(words[0]) + joinWords(words[1:], "", capitalize)
+	},
+	"snake": func(s string) string { return joinWords(nameWords(s), "_", strings.ToLower) },
+	"kebab": func(s string) string { return joinWords(nameWords(s), "-", strings.ToLower) },
+	"base":  path.Base,
+}
+
+// nameWords splits "list orders", "list-orders", "listOrders" and "ListOrders"
+// into the same words.
+func nameWords(s string) []string {
+	var words []string
+	var word []rune
+	runes := []rune(s)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			if len(word) > 0 {
+				words, word = append(words, string(word)), nil
+			}
+			continue
+		}
+		// A new word starts at an upper-case letter after a lower-case one, or
+		// before a lower-case one in a run of capitals (HTTPServer).
+		if unicode.IsUpper(r) && len(word) > 0 && (unicode.IsLower(word[len(word)-1]) || i+1 < len(runes) && unicode.IsLower(runes[i+1])) {
+			words, word = append(words, string(word)), nil
+		}
+		word = append(word, r)
+	}
+	if len(word) > 0 {
+		words = append(words, string(word))
+	}
+	return words
+}
+
+func joinWords(words []string, separator string, transform func(string) string) string {
+	transformed := make([]string, len(words))
+	for i, word := range words {
+		transformed[i] = transform(word)
+	}
+	return strings.Join(transformed, separator)
+}
+
+// capitalize upper-cases the first letter and lower-cases the rest, keeping
+// initialisms like ID and HTTP as they are.
+func capitalize(word string) string {
+	if strings.ToUpper(word) == word {
+		return word
+	}
+	runes := []rune(strings.ToLower(word))
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+// ScaffoldTemplates returns the built-in templates and those in the
+// subdirectories of SCAFFOLD_TEMPLATES, which replace built-in ones of the same name.
+func ScaffoldTemplates() (map[string]*ScaffoldTemplate, error) {
+	builtin, _ := fs.Sub(builtinTemplates, "templates")
+	templates, err := loadScaffoldTemplates(builtin)
+	if err != nil {
+		return nil, err
+	}
+	if dir := os.Getenv("SCAFFOLD_TEMPLATES"); dir != "" {
+		custom, err := loadScaffoldTemplates(os.DirFS(dir))
+		if err != nil {
+			return nil, fmt.Errorf("invalid SCAFFOLD_TEMPLATES: %v", err)
+		}
+		for name, custom := range custom {
+			templates[name] = custom
+		}
+	}
+	return templates, nil
+}
+
+func loadScaffoldTemplates(fsys fs.FS) (map[string]*ScaffoldTemplate, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	templates := map[string]*ScaffoldTemplate{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		data, err := fs.ReadFile(fsys, path.Join(entry.Name(), "template.json"))
+		if err != nil {
+			continue
+		}
+		scaffold := &ScaffoldTemplate{}
+		if err := json.Unmarshal(data, scaffold); err != nil {
+			return nil, fmt.Errorf("%s/template.json: %v", entry.Name(), err)
+		}
+		scaffold.fs, _ = fs.Sub(fsys, entry.Name())
+		templates[entry.Name()] = scaffold
+	}
+	return templates, nil
+}
+
+// Generate renders the template's files with vars, which may leave out
+// variables with defaults. dir is the directory the files are generated in,
+// available to templates as .dir.
+func (t *ScaffoldTemplate) Generate(dir string, vars map[string]string) (map[string]string, error) {
+	values := map[string]string{"dir": path.Clean(dir)}
+	known := map[string]bool{}
+	var missing []string
+	for _, variable := range t.Variables {
+		known[variable.Name] = true
+		if value, ok := vars[variable.Name]; ok && value != "" {
+			values[variable.Name] = value
+			continue
+		}
+		if variable.Default == nil {
+			missing = append(missing, fmt.Sprintf("%s (%s)", variable.Name, variable.Description))
+			continue
+		}
+		// Defaults may use the variables before them.
+		value, err := render("default of "+variable.Name, *variable.Default, values)
+		if err != nil {
+			return nil, err
+		}
+		values[variable.Name] = value
+	}
+	for name := range vars {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown variable %s; the variables are: %s", name, t.variableNames())
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing variables: %s", strings.Join(missing, ", "))
+	}
+
+	files := map[string]string{}
+	for target, source := range t.Files {
+		name, err := render(target, target, values)
+		if err != nil {
+			return nil, err
+		}
+		text, err := fs.ReadFile(t.fs, source)
+		if err != nil {
+			return nil, err
+		}
+		content, err := render(source, string(text), values)
+		if err != nil {
+			return nil, err
+		}
+		files[path.Join(values["dir"], name)] = content
+	}
+	return files, nil
+}
+
+func (t *ScaffoldTemplate) variableNames() string {
+	names := make([]string, len(t.Variables))
+	for i, variable := range t.Variables {
+		names[i] = variable.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func render(name string, text string, values map[string]string) (string, error) {
+	tmpl, err := template.New(name).Funcs(scaffoldFuncs).Option("missingkey=error").Parse(text)
+	if err != nil {
+		return "", err
+	}
+	var output bytes.Buffer
+	if err := tmpl.Execute(&output, values); err != nil {
+		return "", err
+	}
+	return output.String(), nil
+}
+
+// Scaffold tool for generating boilerplate from templates
+type ScaffoldInput struct {
+	Template  string            `json:"template,omitempty" jsonschema_description:"Name of the template. Leave out to list the templates and their variables."`
+	Dir       string            `json:"dir,omitempty" jsonschema:"default=." jsonschema_description:"Directory to generate the files in, e.g. internal or cmd."`
+	Variables map[string]string `json:"variables,omitempty" jsonschema_description:"Values of the template's variables, e.g. {\"name\": \"list orders\"}."`
+}
+
+var ScaffoldInputSchema = GenerateSchema[ScaffoldInput]()
+
+func (f *Files) ScaffoldDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "scaffold",
+		Description: "Generate boilerplate files from a template instead of writing them out: a new Go package with a test (package), a cobra subcommand (cobra-command), or a net/http handler with a table-driven test (http-handler), plus any project templates. Call it without a template to list the templates and their variables. Existing files are never overwritten.",
+		InputSchema: ScaffoldInputSchema,
+		Function:    f.Scaffold,
+		Category:    CategoryWrite,
+		Examples: []ToolExample{
+			{Input: `{"template": "http-handler", "dir": "internal/api", "variables": {"name": "list orders"}}`, Output: "Generated 2 files from http-handler:\n  internal/api/list_orders.go\n  internal/api/list_orders_test.go"},
+		},
+	}
+}
+
+func (f *Files) Scaffold(ctx context.Context, input json.RawMessage) (string, error) {
+	scaffoldInput := ScaffoldInput{}
+	if err := json.Unmarshal(input, &scaffoldInput); err != nil {
+		return "", err
+	}
+	templates, err := ScaffoldTemplates()
+	if err != nil {
+		return "", err
+	}
+	if scaffoldInput.Template == "" {
+		return describeScaffoldTemplates(templates), nil
+	}
+	scaffold, ok := templates[scaffoldInput.Template]
+	if !ok {
+		return "", fmt.Errorf("no template %s\n%s", scaffoldInput.Template, describeScaffoldTemplates(templates))
+	}
+	if scaffoldInput.Dir == "" {
+		scaffoldInput.Dir = "."
+	}
+
+	files, err := scaffold.Generate(scaffoldInput.Dir, scaffoldInput.Variables)
+	if err != nil {
+		return "", err
+	}
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		if _, err := f.fs.Stat(path); err == nil {
+			return "", fmt.Errorf("%s already exists; nothing was generated", path)
+		}
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	result := fmt.Sprintf("Generated %d files from %s:\n  %s", len(paths), scaffoldInput.Template, strings.Join(paths, "\n  "))
+	var changes []FileChange
+	for _, path := range paths {
+		content, fixed := fixGoSource(ctx, path, files[path])
+		result += fixed
+		unlock := f.lockPath(path)
+		err := f.fs.WriteFile(path, []byte(content), 0644)
+		unlock()
+		if err != nil {
+			return "", err
+		}
+		f.recordRead(path, []byte(content))
+		seenFiles(ctx).record(path, content)
+		files[path] = content
+		changes = append(changes, newFileChange(path, "", content, false))
+	}
+	for _, change := range changes {
+		result = withFileChange(result, change)
+	}
+	// One tidy covers all the files, as they're generated in one directory.
+	for _, path := range paths {
+		if goImports(files[path]) != nil {
+			return tidyGoModule(ctx, f.fs, result, path, "", files[path]), nil
+		}
+	}
+	return result, nil
+}
+
+func describeScaffoldTemplates(templates map[string]*ScaffoldTemplate) string {
+	names := make([]string, 0, len(templates))
+	for name := range templates {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var result strings.Builder
+	result.WriteString("Templates:\n")
+	for _, name := range names {
+		scaffold := templates[name]
+		fmt.Fprintf(&result, "- %s: %s\n", name, scaffold.Description)
+		for _, variable := range scaffold.Variables {
+			note := "required"
+			if variable.Default != nil {
+				note = "default " + *variable.Default
+			}
+			fmt.Fprintf(&result, "    %s (%s): %s\n", variable.Name, note, variable.Description)
+		}
+	}
+	return result.String()
+}
@@ -0,0 +1,759 @@
+package tools
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Most shells open at once in one session.
+	maxShells = 5
+	// How long run_in_shell waits for a command unless told otherwise, and at most.
+	defaultShellTimeout = time.Minute
+	maxShellTimeout     = 10 * time.Minute
+	// How long an interrupted command gets to stop before its shell is closed.
+	shellInterruptGrace = 5 * time.Second
+	// How long a command's output must stop, mid-line, for it to count as waiting for input.
+	promptIdle = 2 * time.Second
+	// How long a shell gets to start and run its setup.
+	shellStartTimeout = 15 * time.Second
+	// Most output of a command returned to the model; longer output is compacted.
+	maxShellOutput = 20_000
+	// Longest line a terminal reads; longer ones are cut off.
+	maxTerminalLine = 4000
+)
+
+// Starts bash with no startup files or line editing, or sh where there's no bash.
+const shellLauncher = `if command -v bash >/dev/null 2>&1; then exec bash --noprofile --norc --noediting -i; else exec sh -i; fi`
+
+// Setup run in every new shell: no prompts, echo, history file or pagers.
+const shellSetup = `unset HISTFILE; PS1=''; PS2=''; export TERM=dumb PAGER=cat GIT_PAGER=cat; stty -echo -onlcr 2>/dev/null`
+
+var envName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Shells holds the shells opened in one session, so one session can't see or
+// use another's.
+type Shells struct {
+	mu     sync.Mutex
+	shells map[string]*shell
+	next   int
+}
+
+func NewShells() *Shells {
+	return &Shells{shells: map[string]*shell{}}
+}
+
+// Shells of callers that don't run in a session, e.g. the CLI's coder tools.
+var sharedShells = NewShells()
+
+type shellsKey struct{}
+
+// WithShells returns a context carrying the shells of the current session.
+func WithShells(ctx context.Context, shells *Shells) context.Context {
+	return context.WithValue(ctx, shellsKey{}, shells)
+}
+
+func shellsFor(ctx context.Context) *Shells {
+	if shells, ok := ctx.Value(shellsKey{}).(*Shells); ok {
+		return shells
+	}
+	return sharedShells
+}
+
+// Close closes every shell, e.g. when their session is evicted.
+func (s *Shells) Close() {
+	s.mu.Lock()
+	shells := s.shells
+	s.shells = map[string]*shell{}
+	s.mu.Unlock()
+
+	for _, sh := range shells {
+		sh.close()
+	}
+}
+
+func (s *Shells) add(sh *shell) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.shells) >= maxShells {
+		return "", fmt.Errorf("%d shells are open already; close one with close_shell first", maxShells)
+	}
+	s.next++
+	id := strconv.Itoa(s.next)
+	s.shells[id] = sh
+	return id, nil
+}
+
+// get returns the shell with the given ID, or the only open shell if id is empty.
+func (s *Shells) get(id string) (string, *shell, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if id == "" {
+		if len(s.shells) > 1 {
+			return "", nil, fmt.Errorf("%s, so name one", s.describe())
+		}
+		for id, sh := range s.shells {
+			return id, sh, nil
+		}
+		return "", nil, errors.New(s.describe())
+	}
+	sh, ok := s.shells[id]
+	if !ok {
+		return "", nil, fmt.Errorf("no shell %s: %s", id, s.describe())
+	}
+	return id, sh, nil
+}
+
+func (s *Shells) remove(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.shells, id)
+}
+
+// describe lists the open shells, for errors. s.mu must be held.
+func (s *Shells) describe() string {
+	if len(s.shells) == 0 {
+		return "no shell is open; open one with open_shell"
+	}
+	ids := make([]string, 0, len(s.shells))
+	for id := range s.shells {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return "the open shells are " + strings.Join(ids, ", ")
+}
+
+// shell is a long-lived shell process, on a pseudo-terminal where there is one.
+// Commands are written to its input followed by a line printing a marker with
+// their exit status and the working directory, which ends their output.
+type shell struct {
+	cmd    *exec.Cmd
+	input  io.WriteCloser
+	output io.Closer
+	tty    bool
+	marker *regexp.Regexp
+	id     string
+
+	// Held while a command runs or is waited for; seq numbers the commands, so
+	// a marker printed late for an interrupted one isn't taken for the next one's.
+	busy    sync.Mutex
+	seq     int
+	command string
+	waiting bool
+	prompt  string // end of the output a waiting command stopped at
+
+	mu         sync.Mutex
+	buffer     []byte
+	lastOutput time.Time
+	exited     bool
+	stream     *lineStream // where the output of the command being waited for goes as well
+	changed    chan struct{}
+	readDone   chan struct{}
+	done       chan struct{}
+
+	closeOnce sync.Once
+}
+
+// startShell starts a shell through run, in dir relative to where run starts
+// commands, with env exported. It returns the shell and its working directory.
+func startShell(run CommandRunner, dir string, env map[string]string) (*shell, string, error) {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		if !envName.MatchString(name) {
+			return nil, "", fmt.Errorf("invalid environment variable name %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	marker := make([]byte, 8)
+	rand.Read(marker)
+	sh := &shell{
+		id:       "__agent_shell_" + hex.EncodeToString(marker),
+		changed:  make(chan struct{}, 1),
+		readDone: make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	sh.marker = regexp.MustCompile(`(?m)^` + sh.id + ` (\d+) (\d+) (.*?)\r?$\n?`)
+
+	// The shell outlives the tool call starting it.
+	cmd := run(context.Background(), "sh", "-c", shellLauncher)
+	var reader io.ReadCloser
+	var childEnd *os.File
+	if master, tty, err := openPTY(); err == nil {
+		attachTTY(cmd, tty)
+		sh.input, reader, childEnd, sh.tty = master, master, tty, true
+	} else {
+		r, w, err := os.Pipe()
+		if err != nil {
+			return nil, "", err
+		}
+		if sh.input, err = cmd.StdinPipe(); err != nil {
+			r.Close()
+			w.Close()
+			return nil, "", err
+		}
+		cmd.Stdout, cmd.Stderr = w, w
+		reader, childEnd = r, w
+	}
+	interactive(cmd, sh.tty)
+	sh.cmd, sh.output = cmd, reader
+
+	err := cmd.Start()
+	childEnd.Close()
+	if err != nil {
+		reader.Close()
+		sh.input.Close()
+		return nil, "", err
+	}
+	go sh.read(reader)
+	go sh.reap()
+
+	ctx, cancel := context.WithTimeout(context.Background(), shellStartTimeout)
+	defer cancel()
+	// The setup turns echo off, so it runs by itself: its own output is just that echo.
+	if _, err := sh.run(ctx, shellSetup, shellStartTimeout); err != nil {
+		sh.close()
+		return nil, "", fmt.Errorf("starting the shell: %v", err)
+	}
+
+	setup := []string{"true"}
+	for _, name := range names {
+		setup = append(setup, "export "+name+"="+shellQuote(env[name]))
+	}
+	if dir != "" {
+		setup = append(setup, "cd "+shellQuote(dir))
+	}
+	result, err := sh.run(ctx, strings.Join(setup, " && "), shellStartTimeout)
+	if err == nil && result.status != 0 {
+		err = errors.New(strings.TrimSpace(result.output))
+	}
+	if err != nil {
+		sh.close()
+		return nil, "", err
+	}
+	return sh, result.dir, nil
+}
+
+// interactive keeps a docker exec command's stdin open, as workspace runners
+// don't, and gives it a terminal if it has one.
+func interactive(cmd *exec.Cmd, tty bool) {
+	if filepath.Base(cmd.Path) != "docker" || len(cmd.Args) < 2 || cmd.Args[1] != "exec" {
+		return
+	}
+	flags := []string{"-i"}
+	if tty {
+		flags = append(flags, "-t")
+	}
+	cmd.Args = append(append([]string{cmd.Args[0], "exec"}, flags...), cmd.Args[2:]...)
+}
+
+func (sh *shell) read(reader io.Reader) {
+	defer close(sh.readDone)
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := reader.Read(chunk)
+		if n > 0 {
+			sh.mu.Lock()
+			sh.buffer = append(sh.buffer, chunk[:n]...)
+			sh.lastOutput = time.Now()
+			// Only the end of a command's output is returned anyway.
+			if excess := len(sh.buffer) - 4*maxShellOutput; excess > 0 {
+				sh.buffer = append(sh.buffer[:0], sh.buffer[excess:]...)
+			}
+			stream := sh.stream
+			sh.mu.Unlock()
+			stream.Write(chunk[:n])
+			sh.notify()
+		}
+		// A terminal's master fails with EIO once the shell and its children are gone.
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (sh *shell) reap() {
+	sh.cmd.Wait()
+	// Give the reader a moment for the last of the output, but not forever:
+	// background jobs may keep the output open.
+	select {
+	case <-sh.readDone:
+	case <-time.After(time.Second):
+	}
+	sh.mu.Lock()
+	sh.exited = true
+	sh.mu.Unlock()
+	sh.notify()
+	close(sh.done)
+}
+
+func (sh *shell) notify() {
+	select {
+	case sh.changed <- struct{}{}:
+	default:
+	}
+}
+
+// close ends the shell: hanging up its terminal or closing its input, then
+// killing it if it's still there.
+func (sh *shell) close() {
+	sh.closeOnce.Do(func() {
+		sh.input.Close()
+		select {
+		case <-sh.done:
+		case <-time.After(2 * time.Second):
+			sh.cmd.Process.Kill()
+			<-sh.done
+		}
+		sh.output.Close()
+	})
+}
+
+// shellResult is how a command in a shell ended, or where it stopped.
+type shellResult struct {
+	output      string
+	status      int
+	dir         string // working directory after the command
+	interrupted bool
+	// The command is still running, apparently waiting for input.
+	waiting bool
+}
+
+var (
+	errShellBusy    = errors.New("the shell is still running a command")
+	errShellWaiting = errors.New("a command in the shell is waiting for input")
+	errNotWaiting   = errors.New("no command in the shell is waiting for input")
+)
+
+// run runs command in the shell and waits for it; see wait.
+func (sh *shell) run(ctx context.Context, command string, timeout time.Duration) (shellResult, error) {
+	if !sh.busy.TryLock() {
+		return shellResult{}, errShellBusy
+	}
+	defer sh.busy.Unlock()
+	if sh.waiting {
+		return shellResult{}, errShellWaiting
+	}
+	sh.seq++
+	sh.command = command
+
+	// The command is read whole by eval, so what it reads from stdin can't
+	// swallow the marker line, and a syntax error in it is just a failure.
+	delimiter := sh.id + "_EOF"
+	script := fmt.Sprintf("eval \"$(cat <<'%s'\n%s\n%s\n)\"; __agent_status=$?; printf '\\n%%s %%d %%d %%s\\n' %s %d \"$__agent_status\" \"$PWD\"\n",
+		delimiter, command, delimiter, sh.id, sh.seq)
+	if _, err := io.WriteString(sh.input, script); err != nil {
+		return shellResult{}, fmt.Errorf("writing to the shell: %w", err)
+	}
+	return sh.wait(ctx, timeout)
+}
+
+// send types input into the command waiting for it, and waits for the command again.
+func (sh *shell) send(ctx context.Context, input string, timeout time.Duration) (shellResult, error) {
+	if !sh.busy.TryLock() {
+		return shellResult{}, errShellBusy
+	}
+	defer sh.busy.Unlock()
+	if !sh.waiting {
+		return shellResult{}, errNotWaiting
+	}
+	if _, err := io.WriteString(sh.input, input); err != nil {
+		return shellResult{}, fmt.Errorf("writing to the shell: %w", err)
+	}
+	return sh.wait(ctx, timeout)
+}
+
+// wait waits up to timeout for the current command to finish, or until ctx is
+// done. A command whose output stops for promptIdle without ending in a
+// newline is taken to be waiting for input and left running. A command running
+// too long is interrupted with Ctrl-C; if that doesn't stop it, or the shell
+// has no terminal to send it, the shell is closed. sh.busy must be held.
+func (sh *shell) wait(ctx context.Context, timeout time.Duration) (shellResult, error) {
+	seq := strconv.Itoa(sh.seq)
+	sh.waiting = false
+	start := time.Now()
+
+	stream := outputStream(ctx)
+	if stream != nil {
+		stream.skip = sh.marker.MatchString
+	}
+	sh.mu.Lock()
+	sh.stream = stream
+	sh.mu.Unlock()
+	defer func() {
+		sh.mu.Lock()
+		sh.stream = nil
+		sh.mu.Unlock()
+		stream.Close()
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	idle := time.NewTimer(promptIdle)
+	defer idle.Stop()
+	cancelled := ctx.Done()
+
+	var result shellResult
+	for {
+		sh.mu.Lock()
+		text := strings.ReplaceAll(string(sh.buffer), "\r\n", "\n")
+		exited := sh.exited
+		var match []string
+		var end int
+		for _, loc := range sh.marker.FindAllStringSubmatchIndex(text, -1) {
+			if text[loc[2]:loc[3]] == seq {
+				match, end = []string{text[loc[4]:loc[5]], text[loc[6]:loc[7]]}, loc[1]
+				text = text[:loc[0]]
+				break
+			}
+		}
+		quiet := time.Since(start) >= promptIdle && time.Since(sh.lastOutput) >= promptIdle
+		prompting := match == nil && !exited && !result.interrupted && quiet && looksLikePrompt(text)
+		switch {
+		case match != nil:
+			sh.buffer = []byte(strings.ReplaceAll(string(sh.buffer), "\r\n", "\n")[end:])
+		case exited || prompting:
+			sh.buffer = nil
+		}
+		sh.mu.Unlock()
+
+		// Drop markers printed late for earlier commands.
+		result.output = sh.marker.ReplaceAllString(text, "")
+		switch {
+		case match != nil:
+			result.status, _ = strconv.Atoi(match[0])
+			result.dir = match[1]
+			result.output = strings.TrimSuffix(result.output, "\n")
+			return result, nil
+		case exited:
+			return result, errors.New("the shell exited")
+		case prompting:
+			sh.waiting, sh.prompt = true, lastLines(result.output, 10)
+			result.waiting = true
+			return result, nil
+		}
+
+		select {
+		case <-sh.changed:
+			idle.Reset(promptIdle)
+			continue
+		case <-idle.C:
+			continue
+		case <-cancelled:
+			cancelled = nil
+		case <-timer.C:
+		}
+		if result.interrupted || !sh.tty {
+			sh.close()
+			sh.mu.Lock()
+			text := strings.ReplaceAll(string(sh.buffer), "\r\n", "\n")
+			sh.mu.Unlock()
+			result.output += sh.marker.ReplaceAllString(text, "")
+			if !sh.tty {
+				return result, fmt.Errorf("the command didn't finish in %s and without a terminal it can't be interrupted", timeout)
+			}
+			return result, errors.New("the command didn't stop on Ctrl-C")
+		}
+		// Interactive shells drop the rest of the line on Ctrl-C, so the marker
+		// is printed again afterwards.
+		result.interrupted = true
+		fmt.Fprintf(sh.input, "\x03")
+		// Give the shell time to take the signal, or a command reading input gets the line.
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprintf(sh.input, "printf '\\n%%s %%s %%d %%s\\n' %s %s 130 \"$PWD\"\n", sh.id, seq)
+		timer.Reset(shellInterruptGrace)
+	}
+}
+
+// looksLikePrompt reports whether output ends like a prompt: in a line without
+// its newline, e.g. "Password: " or "package name: (api) ".
+func looksLikePrompt(output string) bool {
+	return output != "" && !strings.HasSuffix(output, "\n") && !strings.HasSuffix(output, "\r")
+}
+
+// ShellTools holds the tools that run commands, one at a time or in persistent
+// shells keeping the working directory, environment and activated virtualenvs
+// between calls.
+type ShellTools struct {
+	run CommandRunner
+}
+
+func NewShellTools(run CommandRunner) *ShellTools {
+	return &ShellTools{run: run}
+}
+
+func (t *ShellTools) Definitions() []ToolDefinition {
+	return []ToolDefinition{
+		t.ExecuteCommandDefinition(),
+		t.OpenShellDefinition(),
+		t.RunInShellDefinition(),
+		t.SendInputDefinition(),
+		t.CloseShellDefinition(),
+	}
+}
+
+// OpenShell tool for starting a persistent shell
+type OpenShellInput struct {
+	Dir string            `json:"dir,omitempty" jsonschema_description:"Directory to start in, relative to the workspace root. Defaults to the root."`
+	Env map[string]string `json:"env,omitempty" jsonschema_description:"Environment variables to export in the shell."`
+}
+
+var OpenShellInputSchema = GenerateSchema[OpenShellInput]()
+
+func (t *ShellTools) OpenShellDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "open_shell",
+		Description: fmt.Sprintf("Open a persistent shell. Unlike execute_command, it keeps its working directory, exported variables and activated virtualenvs between run_in_shell calls. At most %d can be open; close them with close_shell when done.", maxShells),
+		InputSchema: OpenShellInputSchema,
+		Function:    t.OpenShell,
+		Examples: []ToolExample{
+			{Input: `{"dir": "web", "env": {"NODE_ENV": "test"}}`, Output: "Opened shell 1 in /src/web."},
+		},
+	}
+}
+
+func (t *ShellTools) OpenShell(ctx context.Context, input json.RawMessage) (string, error) {
+	openInput := OpenShellInput{}
+	if err := json.Unmarshal(input, &openInput); err != nil {
+		return "", err
+	}
+
+	sh, dir, err := startShell(t.run, openInput.Dir, openInput.Env)
+	if err != nil {
+		return "", err
+	}
+	id, err := shellsFor(ctx).add(sh)
+	if err != nil {
+		sh.close()
+		return "", err
+	}
+	if !sh.tty {
+		return fmt.Sprintf("Opened shell %s in %s. It has no terminal, so commands that time out can't be interrupted and close it.", id, dir), nil
+	}
+	return fmt.Sprintf("Opened shell %s in %s.", id, dir), nil
+}
+
+// RunInShell tool for running a command in a persistent shell
+type RunInShellInput struct {
+	Shell   string `json:"shell,omitempty" jsonschema_description:"ID of the shell, from open_shell. Can be left out when one shell is open."`
+	Command string `json:"command" jsonschema:"minLength=1" jsonschema_description:"Command to run, e.g. source .venv/bin/activate or cd api && make test. Can span several lines."`
+	Timeout int    `json:"timeout_seconds,omitempty" jsonschema:"default=60,maximum=600" jsonschema_description:"How long to wait for the command before interrupting it with Ctrl-C."`
+}
+
+var RunInShellInputSchema = GenerateSchema[RunInShellInput]()
+
+func (t *ShellTools) RunInShellDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "run_in_shell",
+		Description: "Run a command in a shell opened with open_shell, as if typed at its prompt: cd, export, source and the like last for later commands. Returns the output, the exit status and the working directory. A command that stops at a prompt, e.g. for a confirmation, is left running for send_input to answer; prefer flags like --yes where there are some.",
+		InputSchema: RunInShellInputSchema,
+		Function:    t.RunInShell,
+		Examples: []ToolExample{
+			{Input: `{"shell": "1", "command": "source .venv/bin/activate && pytest -q tests/test_api.py"}`, Output: "Command: source .venv/bin/activate && pytest -q tests/test_api.py\nOutput:\n4 passed in 0.31s\nExit status 0 in /src"},
+		},
+	}
+}
+
+func (t *ShellTools) RunInShell(ctx context.Context, input json.RawMessage) (string, error) {
+	runInput := RunInShellInput{}
+	if err := json.Unmarshal(input, &runInput); err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(runInput.Command) == "" {
+		return "", fmt.Errorf("command is empty")
+	}
+	timeout := defaultShellTimeout
+	if runInput.Timeout > 0 {
+		timeout = min(time.Duration(runInput.Timeout)*time.Second, maxShellTimeout)
+	}
+
+	shells := shellsFor(ctx)
+	id, sh, err := shells.get(runInput.Shell)
+	if err != nil {
+		return "", err
+	}
+	if sh.tty {
+		for _, line := range strings.Split(runInput.Command, "\n") {
+			if len(line) > maxTerminalLine {
+				return "", fmt.Errorf("a line of the command is longer than the %d characters a terminal takes; write it to a script and run that", maxTerminalLine)
+			}
+		}
+	}
+
+	result, err := sh.run(ctx, runInput.Command, timeout)
+	return shells.report(id, sh, result, err, timeout)
+}
+
+// report renders how the command in a shell ended or stopped, closing the
+// shell if it's broken.
+func (s *Shells) report(id string, sh *shell, result shellResult, err error, timeout time.Duration) (string, error) {
+	output := CompactOutput(result.output, maxShellOutput)
+	text := fmt.Sprintf("Command: %s\nOutput:\n%s", sh.command, strings.TrimSuffix(output, "\n"))
+	switch {
+	case errors.Is(err, errShellBusy):
+		return "", fmt.Errorf("shell %s is still running a command; use another shell", id)
+	case errors.Is(err, errShellWaiting):
+		return "", fmt.Errorf("%s in shell %s is waiting for input; answer it with send_input, or stop it with the key ctrl-c", sh.command, id)
+	case errors.Is(err, errNotWaiting):
+		return "", fmt.Errorf("no command in shell %s is waiting for input", id)
+	case err != nil:
+		s.remove(id)
+		sh.close()
+		return "", fmt.Errorf("%v, so shell %s is closed\n%s", err, id, text)
+	case result.waiting:
+		return fmt.Sprintf("%s\n[Still running in shell %s and apparently waiting for input: the output stopped mid-line for %s. Answer with send_input.]", text, id, promptIdle), nil
+	case result.interrupted:
+		return "", fmt.Errorf("interrupted after %s with Ctrl-C; shell %s is still open in %s\n%s", timeout, id, result.dir, text)
+	case result.status != 0:
+		return "", fmt.Errorf("exit status %d in %s\n%s", result.status, result.dir, text)
+	}
+	return fmt.Sprintf("%s\nExit status 0 in %s", text, result.dir), nil
+}
+
+// Keys send_input can press, with what a terminal sends for them.
+var shellKeys = map[string]string{
+	"none":   "",
+	"enter":  "\n",
+	"ctrl-c": "\x03",
+	"ctrl-d": "\x04",
+	"tab":    "\t",
+	"escape": "\x1b",
+	"up":     "\x1b[A",
+	"down":   "\x1b[B",
+}
+
+// SendInput tool for answering a command's prompts
+type SendInputInput struct {
+	Shell   string `json:"shell,omitempty" jsonschema_description:"ID of the shell. Can be left out when one shell is open."`
+	Input   string `json:"input,omitempty" jsonschema_description:"Text to type, e.g. an answer to the prompt."`
+	Key     string `json:"key,omitempty" jsonschema:"enum=enter,enum=none,enum=ctrl-c,enum=ctrl-d,enum=tab,enum=escape,enum=up,enum=down,default=enter" jsonschema_description:"Key pressed after the input. Defaults to enter; ctrl-c stops the command, and none just waits longer for a command that wasn't really asking for input."`
+	Timeout int    `json:"timeout_seconds,omitempty" jsonschema:"default=60,maximum=600" jsonschema_description:"How long to wait for the command afterwards before interrupting it with Ctrl-C."`
+}
+
+var SendInputInputSchema = GenerateSchema[SendInputInput]()
+
+func (t *ShellTools) SendInputDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "send_input",
+		Description: "Type into a command that run_in_shell reported as waiting for input, e.g. answering npm init's questions or confirming with y, then wait for it to finish or ask again. An empty input with the default key just presses Enter, e.g. to accept a default.",
+		InputSchema: SendInputInputSchema,
+		Function:    t.SendInput,
+		Examples: []ToolExample{
+			{Input: `{"shell": "1", "input": "y"}`, Output: "Command: npx create-vite web\nOutput:\nScaffolding project in /src/web...\nDone.\nExit status 0 in /src"},
+		},
+	}
+}
+
+func (t *ShellTools) SendInput(ctx context.Context, input json.RawMessage) (string, error) {
+	sendInput := SendInputInput{}
+	if err := json.Unmarshal(input, &sendInput); err != nil {
+		return "", err
+	}
+	if sendInput.Key == "" {
+		sendInput.Key = "enter"
+	}
+	key, ok := shellKeys[sendInput.Key]
+	if !ok {
+		return "", fmt.Errorf("unknown key %q", sendInput.Key)
+	}
+	timeout := defaultShellTimeout
+	if sendInput.Timeout > 0 {
+		timeout = min(time.Duration(sendInput.Timeout)*time.Second, maxShellTimeout)
+	}
+
+	shells := shellsFor(ctx)
+	id, sh, err := shells.get(sendInput.Shell)
+	if err != nil {
+		return "", err
+	}
+	result, err := sh.send(ctx, sendInput.Input+key, timeout)
+	return shells.report(id, sh, result, err, timeout)
+}
+
+// WaitingCommand returns the command waiting for input in a shell of the
+// session of ctx, and the output it stopped at, e.g. to show a person answering it.
+func WaitingCommand(ctx context.Context, id string) (string, string, error) {
+	_, sh, err := shellsFor(ctx).get(id)
+	if err != nil {
+		return "", "", err
+	}
+	if !sh.busy.TryLock() {
+		return "", "", errShellBusy
+	}
+	defer sh.busy.Unlock()
+	if !sh.waiting {
+		return "", "", errNotWaiting
+	}
+	return sh.command, sh.prompt, nil
+}
+
+// AnswerPrompt types line and Enter into the command waiting for input in a
+// shell of the session of ctx, like send_input. It also reports whether the
+// command is waiting for input again.
+func AnswerPrompt(ctx context.Context, id string, line string) (string, bool, error) {
+	shells := shellsFor(ctx)
+	id, sh, err := shells.get(id)
+	if err != nil {
+		return "", false, err
+	}
+	result, err := sh.send(ctx, line+"\n", defaultShellTimeout)
+	text, err := shells.report(id, sh, result, err, defaultShellTimeout)
+	return text, result.waiting && err == nil, err
+}
+
+// CloseShell tool for ending a persistent shell
+type CloseShellInput struct {
+	Shell string `json:"shell,omitempty" jsonschema_description:"ID of the shell. Can be left out when one shell is open."`
+}
+
+var CloseShellInputSchema = GenerateSchema[CloseShellInput]()
+
+func (t *ShellTools) CloseShellDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "close_shell",
+		Description: "Close a shell opened with open_shell, ending whatever it still runs.",
+		InputSchema: CloseShellInputSchema,
+		Function:    t.CloseShell,
+	}
+}
+
+func (t *ShellTools) CloseShell(ctx context.Context, input json.RawMessage) (string, error) {
+	closeInput := CloseShellInput{}
+	if err := json.Unmarshal(input, &closeInput); err != nil {
+		return "", err
+	}
+	shells := shellsFor(ctx)
+	id, sh, err := shells.get(closeInput.Shell)
+	if err != nil {
+		return "", err
+	}
+	shells.remove(id)
+	sh.close()
+	return fmt.Sprintf("Closed shell %s.", id), nil
+}
+
+// lastLines returns the last n lines of text.
+func lastLines(text string, n int) string {
+	lines := strings.Split(text, "\n")
+	if len(lines) > n {
+		lines = lines[len(lines)-n:]
+	}
+	return strings.Join(lines, "\n")
+}
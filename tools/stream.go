@@ -0,0 +1,166 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// How long streamed output may wait to be sent with the lines after it.
+	streamInterval = 250 * time.Millisecond
+	// Most output sent in one piece.
+	maxStreamChunk = 8 * 1024
+)
+
+type outputStreamKey struct{}
+
+// WithOutputStream returns a context whose commands send their output to
+// stream while they run, a few complete lines at a time, e.g. to show the
+// progress of a long test run.
+func WithOutputStream(ctx context.Context, stream func(text string)) context.Context {
+	return context.WithValue(ctx, outputStreamKey{}, stream)
+}
+
+// outputStream returns a writer for the stream of ctx, or nil if it has none.
+// Its methods do nothing on nil, so it can always be written to.
+func outputStream(ctx context.Context) *lineStream {
+	stream, _ := ctx.Value(outputStreamKey{}).(func(string))
+	if stream == nil {
+		return nil
+	}
+	return &lineStream{send: stream}
+}
+
+// lineStream passes what's written to it on in whole lines, batching lines
+// written in quick succession.
+type lineStream struct {
+	send func(string)
+	// Lines for which skip returns true aren't sent.
+	skip func(line string) bool
+
+	mu      sync.Mutex
+	partial string
+	pending strings.Builder
+	timer   *time.Timer
+}
+
+func (s *lineStream) Write(p []byte) (int, error) {
+	if s == nil {
+		return len(p), nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	text := s.partial + strings.ReplaceAll(string(p), "\r\n", "\n")
+	end := strings.LastIndexByte(text, '\n') + 1
+	s.partial = text[end:]
+	for _, line := range strings.SplitAfter(text[:end], "\n") {
+		if line != "" && (s.skip == nil || !s.skip(strings.TrimSuffix(line, "\n"))) {
+			s.pending.WriteString(line)
+		}
+	}
+
+	if s.pending.Len() >= maxStreamChunk {
+		s.flushLocked()
+	} else if s.pending.Len() > 0 && s.timer == nil {
+		s.timer = time.AfterFunc(streamInterval, s.Flush)
+	}
+	return len(p), nil
+}
+
+// Flush sends what's pending, including a last line without its newline.
+func (s *lineStream) Flush() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.flushLocked()
+}
+
+func (s *lineStream) flushLocked() {
+	if s.timer != nil {
+		s.timer.Stop()
+		s.timer = nil
+	}
+	if s.pending.Len() > 0 {
+		s.send(s.pending.String())
+		s.pending.Reset()
+	}
+}
+
+// Close sends what's left, including a last line without its newline.
+func (s *lineStream) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.partial != "" && (s.skip == nil || !s.skip(s.partial)) {
+		s.pending.WriteString(s.partial)
+	}
+	s.partial = ""
+	s.flushLocked()
+	return nil
+}
+
+// Lines worth keeping when long output is compacted: failures, errors and
+// the file:line locations that usually follow them.
+var notableLine = regexp.MustCompile(`(?i)(\b(fail(ed|ure|ures)?|errors?|panic|fatal|exception|traceback)\b|^\s*\S+\.\w+:\d+)`)
+
+// Lines kept from the start and end of compacted output, and around each notable line.
+const (
+	compactHead    = 10
+	compactTail    = 40
+	compactContext = 2
+)
+
+// CompactOutput shortens a command's output to about limit bytes for the
+// model: the start, the end, and the failures and errors in between with a
+// little context, noting how many lines were left out. Short output is
+// returned as it is.
+func CompactOutput(output string, limit int) string {
+	if len(output) <= limit {
+		return output
+	}
+	lines := strings.Split(output, "\n")
+	keep := make([]bool, len(lines))
+	for i := range lines {
+		if i < compactHead || i >= len(lines)-compactTail {
+			keep[i] = true
+		}
+	}
+	for i, line := range lines {
+		if notableLine.MatchString(line) {
+			for j := i; j <= i+compactContext && j < len(lines); j++ {
+				keep[j] = true
+			}
+		}
+	}
+
+	var compacted strings.Builder
+	omitted := 0
+	for i, line := range lines {
+		if !keep[i] {
+			omitted++
+			continue
+		}
+		if omitted > 0 {
+			fmt.Fprintf(&compacted, "[... %d lines omitted]\n", omitted)
+			omitted = 0
+		}
+		compacted.WriteString(line)
+		if i < len(lines)-1 {
+			compacted.WriteString("\n")
+		}
+	}
+	// With failures everywhere, fall back to the end, where summaries usually are.
+	if result := compacted.String(); len(result) <= limit {
+		return result
+	}
+	return "[... output truncated]\n" + output[len(output)-limit:]
+}
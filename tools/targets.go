@@ -0,0 +1,307 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Most command lines shown per target.
+const maxTargetCommands = 10
+
+// taskFile is a kind of file declaring a project's workflows.
+type taskFile struct {
+	names  []string
+	runner string // command running a target, e.g. make
+	parse  func(data []byte) []target
+}
+
+var taskFiles = []taskFile{
+	{names: []string{"Makefile", "makefile", "GNUmakefile"}, runner: "make", parse: parseMakefile},
+	{names: []string{"Taskfile.yml", "Taskfile.yaml", "taskfile.yml", "taskfile.yaml"}, runner: "task", parse: parseTaskfile},
+	{names: []string{"justfile", "Justfile", ".justfile"}, runner: "just", parse: parseJustfile},
+}
+
+// target is a workflow a task file declares.
+type target struct {
+	name        string
+	description string
+	commands    []string
+}
+
+// ListTargets tool for discovering a project's own workflows
+type ListTargetsInput struct {
+	Dir string `json:"dir,omitempty" jsonschema:"default=." jsonschema_description:"Directory to look for a Makefile, Taskfile or justfile in. Defaults to the workspace root."`
+}
+
+var ListTargetsInputSchema = GenerateSchema[ListTargetsInput]()
+
+func (p *ProjectTools) ListTargetsDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "list_targets",
+		Description: "List the targets of the Makefile, Taskfile and justfile in a directory, with their descriptions and the commands they run. Use this before running build, test, lint or deploy commands, and prefer the project's own targets, e.g. make test, over raw commands.",
+		InputSchema: ListTargetsInputSchema,
+		Function:    p.ListTargets,
+		Category:    CategoryRead,
+		Examples: []ToolExample{
+			{Input: `{}`, Output: "Makefile (run with make <target>):\n- build: Build the agent binary\n    go build -o bin/agent ./cmd/agent\n- test\n    go test -race ./..."},
+		},
+	}
+}
+
+func (p *ProjectTools) ListTargets(ctx context.Context, input json.RawMessage) (string, error) {
+	targetsInput := ListTargetsInput{}
+	if err := json.Unmarshal(input, &targetsInput); err != nil {
+		return "", err
+	}
+	if targetsInput.Dir == "" {
+		targetsInput.Dir = "."
+	}
+
+	var result strings.Builder
+	for _, kind := range taskFiles {
+		for _, name := range kind.names {
+			data, err := p.fs.ReadFile(path.Join(targetsInput.Dir, name))
+			if err != nil {
+				continue
+			}
+			if result.Len() > 0 {
+				result.WriteString("\n")
+			}
+			fmt.Fprintf(&result, "%s (run with %s <target>):\n", name, kind.runner)
+			targets := kind.parse(data)
+			if len(targets) == 0 {
+				result.WriteString("No targets found.\n")
+			}
+			for _, t := range targets {
+				result.WriteString("- " + t.name)
+				if t.description != "" {
+					result.WriteString(": " + t.description)
+				}
+				result.WriteString("\n")
+				for i, command := range t.commands {
+					if i == maxTargetCommands {
+						fmt.Fprintf(&result, "    ... %d more lines\n", len(t.commands)-i)
+						break
+					}
+					result.WriteString("    " + command + "\n")
+				}
+			}
+			// make, task and just read only the first of these names they find.
+			break
+		}
+	}
+	if result.Len() == 0 {
+		return fmt.Sprintf("No Makefile, Taskfile or justfile in %s.", targetsInput.Dir), nil
+	}
+	return result.String(), nil
+}
+
+// TaskFileNames returns the Makefile, Taskfile and justfile in dir.
+func TaskFileNames(fsys FS, dir string) []string {
+	var found []string
+	for _, kind := range taskFiles {
+		for _, name := range kind.names {
+			if _, err := fsys.Stat(path.Join(dir, name)); err == nil {
+				found = append(found, name)
+				break
+			}
+		}
+	}
+	return found
+}
+
+var (
+	makeRule       = regexp.MustCompile(`^([A-Za-z0-9_./-]+(?:[ \t]+[A-Za-z0-9_./-]+)*)[ \t]*::?([^=].*)?$`)
+	makeHelpSuffix = regexp.MustCompile(`##+\s*(.*)$`)
+)
+
+// parseMakefile finds explicit rules, skipping special targets like .PHONY and
+// pattern rules. A target's description is a "## ..." comment on its rule line,
+// the common self-documenting convention, or the comment right above it.
+func parseMakefile(data []byte) []target {
+	var targets []target
+	index := map[string]int{}
+	var current []int
+	comment := ""
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if strings.HasPrefix(line, "\t") {
+			command := strings.TrimSpace(line)
+			for _, i := range current {
+				if command != "" {
+					targets[i].commands = append(targets[i].commands, command)
+				}
+			}
+			continue
+		}
+
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			comment = ""
+			continue
+		}
+		if strings.HasPrefix(trimmed, "#") {
+			comment = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+			continue
+		}
+		match := makeRule.FindStringSubmatch(line)
+		if match == nil {
+			current, comment = nil, ""
+			continue
+		}
+
+		description := comment
+		if help := makeHelpSuffix.FindStringSubmatch(match[2]); help != nil {
+			description = strings.TrimSpace(help[1])
+		}
+		current, comment = nil, ""
+		for _, name := range strings.Fields(match[1]) {
+			if strings.HasPrefix(name, ".") || strings.Contains(name, "%") {
+				continue
+			}
+			i, ok := index[name]
+			if !ok {
+				i = len(targets)
+				index[name] = i
+				targets = append(targets, target{name: name})
+			}
+			if targets[i].description == "" {
+				targets[i].description = description
+			}
+			current = append(current, i)
+		}
+	}
+	return targets
+}
+
+// parseTaskfile reads the tasks of a Taskfile (taskfile.dev), leaving out internal ones.
+func parseTaskfile(data []byte) []target {
+	var taskfile struct {
+		Tasks map[string]yaml.Node `yaml:"tasks"`
+	}
+	if err := yaml.Unmarshal(data, &taskfile); err != nil {
+		return nil
+	}
+
+	var targets []target
+	for name, node := range taskfile.Tasks {
+		var task struct {
+			Desc     string      `yaml:"desc"`
+			Internal bool        `yaml:"internal"`
+			Cmds     []yaml.Node `yaml:"cmds"`
+			Cmd      string      `yaml:"cmd"`
+		}
+		switch node.Kind {
+		case yaml.ScalarNode:
+			// "build: go build ./..." is short for a task with one command.
+			task.Cmd = node.Value
+		case yaml.SequenceNode:
+			node.Decode(&task.Cmds)
+		default:
+			node.Decode(&task)
+		}
+		if task.Internal {
+			continue
+		}
+
+		t := target{name: name, description: task.Desc}
+		if task.Cmd != "" {
+			t.commands = append(t.commands, task.Cmd)
+		}
+		for _, cmd := range task.Cmds {
+			if command := taskfileCommand(cmd); command != "" {
+				t.commands = append(t.commands, command)
+			}
+		}
+		targets = append(targets, t)
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].name < targets[j].name })
+	return targets
+}
+
+// taskfileCommand renders one entry of cmds: a command, {cmd: ...} or a call of another task.
+func taskfileCommand(node yaml.Node) string {
+	if node.Kind == yaml.ScalarNode {
+		return strings.TrimSpace(node.Value)
+	}
+	var cmd struct {
+		Cmd  string `yaml:"cmd"`
+		Task string `yaml:"task"`
+	}
+	if node.Decode(&cmd) != nil {
+		return ""
+	}
+	if cmd.Task != "" {
+		return "task " + cmd.Task
+	}
+	return strings.TrimSpace(cmd.Cmd)
+}
+
+var justRecipe = regexp.MustCompile(`^@?([A-Za-z_][A-Za-z0-9_-]*)([^:]*):([^=].*)?$`)
+
+// parseJustfile finds the recipes of a justfile, leaving out private ones
+// (starting with _ or marked [private]). A comment right above a recipe is its
+// description, as just --list shows it.
+func parseJustfile(data []byte) []target {
+	var targets []target
+	current := -1
+	comment := ""
+	private := false
+	for _, line := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed != "" && (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) {
+			// Indented lines are the body of the recipe above.
+			if current >= 0 && !strings.HasPrefix(trimmed, "#") {
+				targets[current].commands = append(targets[current].commands, trimmed)
+			}
+			continue
+		}
+
+		switch {
+		case trimmed == "":
+			comment = ""
+			continue
+		case strings.HasPrefix(trimmed, "#"):
+			comment = strings.TrimSpace(strings.TrimLeft(trimmed, "#"))
+			continue
+		case strings.HasPrefix(trimmed, "["):
+			if strings.Contains(trimmed, "private") {
+				private = true
+			}
+			continue
+		}
+
+		current = -1
+		match := justRecipe.FindStringSubmatch(line)
+		if match == nil || strings.Contains(line, ":=") || isJustKeyword(match[1]) {
+			comment, private = "", false
+			continue
+		}
+		if !private && !strings.HasPrefix(match[1], "_") {
+			name := match[1]
+			if params := strings.TrimSpace(match[2]); params != "" {
+				name += " " + params
+			}
+			current = len(targets)
+			targets = append(targets, target{name: name, description: comment})
+		}
+		comment, private = "", false
+	}
+	return targets
+}
+
+// isJustKeyword reports whether a line starting with word is a setting or
+// declaration rather than a recipe.
+func isJustKeyword(word string) bool {
+	switch word {
+	case "set", "alias", "export", "import", "mod":
+		return true
+	}
+	return false
+}
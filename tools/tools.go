@@ -0,0 +1,146 @@
+// Package tools contains the tool definitions agents expose to the model.
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/anthropics/anthropic-sdk-go"
+	"github.com/invopop/jsonschema"
+)
+
+// Anthropic Tool Definition.
+type ToolDefinition struct {
+	Name        string                                                           `json:"name"`
+	Description string                                                           `json:"description"`
+	InputSchema anthropic.ToolInputSchemaParam                                   `json:"input_schema"`
+	Function    func(ctx context.Context, input json.RawMessage) (string, error) `json:"-"`
+	// What the tool does, for ordering calls made in the same turn. Defaults to CategoryExecute.
+	Category ToolCategory `json:"-"`
+	// Whether results hold text from outside the project, e.g. web pages, which
+	// may try to give the model instructions. The agent marks them as untrusted.
+	Untrusted bool `json:"-"`
+	// Whether the tool sends requests to other hosts, e.g. to fetch
+	// documentation; its calls are audited even if it only reads.
+	Network bool `json:"-"`
+	// Sample calls shown to the model after the description.
+	Examples []ToolExample `json:"examples,omitempty"`
+}
+
+// ToolCategory classifies a tool by its side effects.
+type ToolCategory string
+
+const (
+	// CategoryRead tools only look at files or other state, and can run in any order.
+	CategoryRead ToolCategory = "read"
+	// CategoryWrite tools change files or other state.
+	CategoryWrite ToolCategory = "write"
+	// CategoryExecute tools run commands or programs whose outcome may depend on any file.
+	CategoryExecute ToolCategory = "execute"
+)
+
+// ToolExample is a sample call: the JSON input and (an excerpt of) the result.
+type ToolExample struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+}
+
+// FullDescription is the description sent to the model, including any examples.
+func (t ToolDefinition) FullDescription() string {
+	if len(t.Examples) == 0 {
+		return t.Description
+	}
+
+	var description strings.Builder
+	description.WriteString(t.Description)
+	description.WriteString("\n\nExamples:")
+	for _, example := range t.Examples {
+		description.WriteString(fmt.Sprintf("\nInput: %s\nOutput: %s\n", example.Input, example.Output))
+	}
+	return strings.TrimRight(description.String(), "\n")
+}
+
+// Generates InputSchema for a given tool handler function.
+//
+// Fields are required unless their json tag has omitempty (or jsonschema:"required"
+// forces them). Constraints come from jsonschema tags, for example:
+//
+//	Mode  string `json:"mode,omitempty" jsonschema:"enum=fast,enum=thorough,default=fast"`
+//	Limit int    `json:"limit,omitempty" jsonschema:"minimum=1,maximum=100,default=20"`
+//	Name  string `json:"name" jsonschema:"minLength=1,maxLength=64"`
+func GenerateSchema[T any]() anthropic.ToolInputSchemaParam {
+	var reflector = jsonschema.Reflector{
+		AllowAdditionalProperties: false,
+		DoNotReference:            true,
+	}
+
+	var v T
+
+	schema := reflector.Reflect(v)
+
+	return anthropic.ToolInputSchemaParam{
+		Properties: schema.Properties,
+		Required:   schema.Required,
+	}
+}
+
+// Registry is a set of tools, looked up by name.
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]ToolDefinition
+	order []string
+}
+
+func NewRegistry(definitions ...ToolDefinition) *Registry {
+	registry := &Registry{tools: map[string]ToolDefinition{}}
+	for _, definition := range definitions {
+		registry.Register(definition)
+	}
+	return registry
+}
+
+// Register adds a tool, replacing any existing tool with the same name.
+func (r *Registry) Register(definition ToolDefinition) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.tools[definition.Name]; !exists {
+		r.order = append(r.order, definition.Name)
+	}
+	r.tools[definition.Name] = definition
+}
+
+// Lookup returns the tool with the given name.
+func (r *Registry) Lookup(name string) (ToolDefinition, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	definition, ok := r.tools[name]
+	return definition, ok
+}
+
+// Definitions returns all tools in registration order.
+func (r *Registry) Definitions() []ToolDefinition {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	definitions := make([]ToolDefinition, 0, len(r.order))
+	for _, name := range r.order {
+		definitions = append(definitions, r.tools[name])
+	}
+	return definitions
+}
+
+// Names returns the sorted names of all tools.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := append([]string{}, r.order...)
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,131 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+)
+
+// FileTree tool for a compact, recursive listing
+type FileTreeInput struct {
+	Path       string `json:"path,omitempty" jsonschema:"default=." jsonschema_description:"Directory to list. Defaults to the current directory."`
+	Depth      int    `json:"depth,omitempty" jsonschema:"default=3,minimum=1,maximum=10" jsonschema_description:"How many directory levels to descend. Deeper directories are shown with their entry count."`
+	MaxEntries int    `json:"max_entries,omitempty" jsonschema:"default=200,minimum=1,maximum=2000" jsonschema_description:"Most entries to show; the rest are counted."`
+}
+
+var FileTreeInputSchema = GenerateSchema[FileTreeInput]()
+
+func (f *Files) FileTreeDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "file_tree",
+		Description: "Show a directory tree as a compact indented listing with file sizes, skipping files matched by .gitignore. Use this to explore a project in one call instead of calling list_files on each directory.",
+		InputSchema: FileTreeInputSchema,
+		Function:    f.FileTree,
+		Category:    CategoryRead,
+		Examples: []ToolExample{
+			{Input: `{"path": ".", "depth": 2}`, Output: "./\n  cmd/\n    agent/ (2 entries)\n  go.mod 412\n  main.go 3.1K\n3 directories, 2 files"},
+		},
+	}
+}
+
+func (f *Files) FileTree(ctx context.Context, input json.RawMessage) (string, error) {
+	fileTreeInput := FileTreeInput{}
+
+	err := json.Unmarshal(input, &fileTreeInput)
+	if err != nil {
+		return "", err
+	}
+	if fileTreeInput.Path == "" {
+		fileTreeInput.Path = "."
+	}
+	if fileTreeInput.Depth == 0 {
+		fileTreeInput.Depth = 3
+	}
+	if fileTreeInput.MaxEntries == 0 {
+		fileTreeInput.MaxEntries = 200
+	}
+
+	tree := &treeListing{files: f, rules: newIgnoreRules(), maxEntries: fileTreeInput.MaxEntries}
+	tree.result.WriteString(strings.TrimSuffix(fileTreeInput.Path, "/") + "/\n")
+	if err := tree.walk(fileTreeInput.Path, "", 1, fileTreeInput.Depth); err != nil {
+		return "", err
+	}
+
+	fmt.Fprintf(&tree.result, "%d directories, %d files", tree.dirs, tree.fileCount)
+	if tree.omitted > 0 {
+		fmt.Fprintf(&tree.result, " (%d more entries not shown; list a subdirectory or raise max_entries)", tree.omitted)
+	}
+	return tree.result.String(), nil
+}
+
+// treeListing accumulates a file_tree result.
+type treeListing struct {
+	files      *Files
+	rules      *ignoreRules
+	maxEntries int
+
+	result    strings.Builder
+	shown     int
+	omitted   int
+	dirs      int
+	fileCount int
+}
+
+// walk lists dir (relative to the tree's root) at the given level, descending up to depth.
+func (t *treeListing) walk(dir string, relative string, level int, depth int) error {
+	entries, err := t.files.fs.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if entry.Name() == ".gitignore" && !entry.IsDir() {
+			if content, err := t.files.fs.ReadFile(path.Join(dir, entry.Name())); err == nil {
+				t.rules.add(relative, string(content))
+			}
+		}
+	}
+
+	indent := strings.Repeat("  ", level)
+	for _, entry := range entries {
+		entryRelative := path.Join(relative, entry.Name())
+		if t.rules.ignored(entryRelative, entry.IsDir()) {
+			continue
+		}
+
+		if t.shown >= t.maxEntries {
+			t.omitted++
+			continue
+		}
+		t.shown++
+
+		if !entry.IsDir() {
+			t.fileCount++
+			size := ""
+			if info, err := entry.Info(); err == nil {
+				size = " " + formatSize(info.Size())
+			}
+			fmt.Fprintf(&t.result, "%s%s%s\n", indent, entry.Name(), size)
+			continue
+		}
+
+		t.dirs++
+		if level >= depth {
+			children, err := t.files.fs.ReadDir(path.Join(dir, entry.Name()))
+			if err != nil {
+				fmt.Fprintf(&t.result, "%s%s/\n", indent, entry.Name())
+			} else {
+				fmt.Fprintf(&t.result, "%s%s/ (%d entries)\n", indent, entry.Name(), len(children))
+			}
+			continue
+		}
+
+		fmt.Fprintf(&t.result, "%s%s/\n", indent, entry.Name())
+		if err := t.walk(path.Join(dir, entry.Name()), entryRelative, level+1, depth); err != nil {
+			fmt.Fprintf(&t.result, "%s  [unreadable: %v]\n", indent, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,178 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/anthropics/anthropic-sdk-go"
+)
+
+// propertySchema is the subset of JSON schema checked before a tool runs.
+type propertySchema struct {
+	Type       string                     `json:"type"`
+	Enum       []any                      `json:"enum"`
+	Minimum    *float64                   `json:"minimum"`
+	Maximum    *float64                   `json:"maximum"`
+	MinLength  *int                       `json:"minLength"`
+	MaxLength  *int                       `json:"maxLength"`
+	Items      *propertySchema            `json:"items"`
+	Properties map[string]*propertySchema `json:"properties"`
+	Required   []string                   `json:"required"`
+}
+
+// ValidateInput checks a tool call's input against the tool's schema, so the model
+// gets a precise error it can correct instead of an unmarshal failure.
+func ValidateInput(schema anthropic.ToolInputSchemaParam, input json.RawMessage) error {
+	root := propertySchema{Type: "object", Required: schema.Required}
+
+	if schema.Properties != nil {
+		properties, err := json.Marshal(schema.Properties)
+		if err != nil {
+			return fmt.Errorf("invalid tool schema: %v", err)
+		}
+		if err := json.Unmarshal(properties, &root.Properties); err != nil {
+			return fmt.Errorf("invalid tool schema: %v", err)
+		}
+	}
+
+	if len(bytes.TrimSpace(input)) == 0 {
+		input = json.RawMessage("{}")
+	}
+
+	var value any
+	decoder := json.NewDecoder(bytes.NewReader(input))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return fmt.Errorf("input is not valid JSON: %v", err)
+	}
+
+	problems := root.validate("input", value)
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid tool input:\n- %s", strings.Join(problems, "\n- "))
+	}
+	return nil
+}
+
+func (s *propertySchema) validate(path string, value any) []string {
+	problems := []string{}
+
+	if !matchesType(s.Type, value) {
+		return append(problems, fmt.Sprintf("%s must be of type %s, got %s", path, s.Type, jsonType(value)))
+	}
+
+	if len(s.Enum) > 0 && !inEnum(s.Enum, value) {
+		allowed := []string{}
+		for _, option := range s.Enum {
+			allowed = append(allowed, fmt.Sprintf("%v", option))
+		}
+		problems = append(problems, fmt.Sprintf("%s must be one of [%s], got %v", path, strings.Join(allowed, ", "), value))
+	}
+
+	switch v := value.(type) {
+	case json.Number:
+		number, _ := v.Float64()
+		if s.Minimum != nil && number < *s.Minimum {
+			problems = append(problems, fmt.Sprintf("%s must be >= %v, got %v", path, *s.Minimum, v))
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			problems = append(problems, fmt.Sprintf("%s must be <= %v, got %v", path, *s.Maximum, v))
+		}
+	case string:
+		if s.MinLength != nil && len(v) < *s.MinLength {
+			problems = append(problems, fmt.Sprintf("%s must be at least %d characters", path, *s.MinLength))
+		}
+		if s.MaxLength != nil && len(v) > *s.MaxLength {
+			problems = append(problems, fmt.Sprintf("%s must be at most %d characters", path, *s.MaxLength))
+		}
+	case []any:
+		if s.Items != nil {
+			for i, item := range v {
+				problems = append(problems, s.Items.validate(fmt.Sprintf("%s[%d]", path, i), item)...)
+			}
+		}
+	case map[string]any:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				problems = append(problems, fmt.Sprintf("%s is missing required field %q", path, name))
+			}
+		}
+
+		if s.Properties != nil {
+			names := make([]string, 0, len(v))
+			for name := range v {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			for _, name := range names {
+				property, ok := s.Properties[name]
+				if !ok {
+					problems = append(problems, fmt.Sprintf("%s has unknown field %q (expected one of: %s)", path, name, strings.Join(s.propertyNames(), ", ")))
+					continue
+				}
+				problems = append(problems, property.validate(path+"."+name, v[name])...)
+			}
+		}
+	}
+
+	return problems
+}
+
+func (s *propertySchema) propertyNames() []string {
+	names := make([]string, 0, len(s.Properties))
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func matchesType(schemaType string, value any) bool {
+	switch schemaType {
+	case "":
+		return true
+	case "integer":
+		number, ok := value.(json.Number)
+		if !ok {
+			return false
+		}
+		_, err := number.Int64()
+		return err == nil
+	case "number":
+		_, ok := value.(json.Number)
+		return ok
+	default:
+		return jsonType(value) == schemaType
+	}
+}
+
+func jsonType(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func inEnum(enum []any, value any) bool {
+	for _, option := range enum {
+		if fmt.Sprintf("%v", option) == fmt.Sprintf("%v", value) {
+			return true
+		}
+	}
+	return false
+}
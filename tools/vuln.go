@@ -0,0 +1,318 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/kartikx/agent/netpolicy"
+)
+
+// Most vulnerabilities looked up in detail when falling back to the OSV API.
+const maxOSVDetails = 20
+
+// CheckVulnerabilities tool for finding known vulnerabilities in dependencies
+type CheckVulnerabilitiesInput struct {
+	Pattern string `json:"pattern,omitempty" jsonschema:"default=./..." jsonschema_description:"Packages to analyze, as passed to go list. Defaults to ./..."`
+}
+
+var CheckVulnerabilitiesInputSchema = GenerateSchema[CheckVulnerabilitiesInput]()
+
+func (g *GoTools) CheckVulnerabilitiesDefinition() ToolDefinition {
+	return ToolDefinition{
+		Name:        "check_vulnerabilities",
+		Description: "Check the Go module for dependencies with known vulnerabilities, using govulncheck (or the OSV database if govulncheck isn't installed). Reports each vulnerability with the affected module version, the version that fixes it, and which vulnerable functions the code actually calls. Use this before and after upgrading dependencies.",
+		InputSchema: CheckVulnerabilitiesInputSchema,
+		Function:    g.CheckVulnerabilities,
+		Examples: []ToolExample{
+			{Input: `{}`, Output: "GO-2024-2687 (CVE-2023-45288): HTTP/2 CONTINUATION flood in net/http\n  golang.org/x/net@v0.17.0, fixed in v0.23.0\n  called: golang.org/x/net/http2.Server.ServeConn"},
+		},
+	}
+}
+
+func (g *GoTools) CheckVulnerabilities(ctx context.Context, input json.RawMessage) (string, error) {
+	checkInput := CheckVulnerabilitiesInput{}
+
+	err := json.Unmarshal(input, &checkInput)
+	if err != nil {
+		return "", err
+	}
+	if checkInput.Pattern == "" {
+		checkInput.Pattern = "./..."
+	}
+
+	// govulncheck exits non-zero when it finds vulnerabilities, so only a missing binary is fatal.
+	output, err := g.output(ctx, "govulncheck", "-json", checkInput.Pattern)
+	if notInstalled(err) {
+		return g.checkWithOSV(ctx)
+	}
+	if err != nil && len(output) == 0 {
+		return "", err
+	}
+
+	vulns, err := parseGovulncheck(output)
+	if err != nil {
+		return "", err
+	}
+	return formatVulnerabilities(vulns, "govulncheck"), nil
+}
+
+// vulnerability is one advisory affecting the module.
+type vulnerability struct {
+	ID      string
+	Aliases []string
+	Summary string
+	Module  string
+	Version string
+	Fixed   string
+	Called  map[string]bool // vulnerable functions reachable from the module's code
+}
+
+// parseGovulncheck reads govulncheck's stream of JSON messages.
+func parseGovulncheck(output []byte) (map[string]*vulnerability, error) {
+	type frame struct {
+		Module   string `json:"module"`
+		Version  string `json:"version"`
+		Package  string `json:"package"`
+		Function string `json:"function"`
+		Receiver string `json:"receiver"`
+	}
+	type message struct {
+		OSV *struct {
+			ID      string   `json:"id"`
+			Aliases []string `json:"aliases"`
+			Summary string   `json:"summary"`
+		} `json:"osv"`
+		Finding *struct {
+			OSV          string  `json:"osv"`
+			FixedVersion string  `json:"fixed_version"`
+			Trace        []frame `json:"trace"`
+		} `json:"finding"`
+	}
+
+	summaries := map[string]*vulnerability{}
+	found := map[string]*vulnerability{}
+
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var msg message
+		err := decoder.Decode(&msg)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse govulncheck output: %v", err)
+		}
+
+		if msg.OSV != nil {
+			summaries[msg.OSV.ID] = &vulnerability{ID: msg.OSV.ID, Aliases: msg.OSV.Aliases, Summary: msg.OSV.Summary}
+		}
+		if msg.Finding == nil || len(msg.Finding.Trace) == 0 {
+			continue
+		}
+
+		vuln, ok := found[msg.Finding.OSV]
+		if !ok {
+			vuln = &vulnerability{ID: msg.Finding.OSV, Called: map[string]bool{}}
+			found[msg.Finding.OSV] = vuln
+		}
+		top := msg.Finding.Trace[0]
+		vuln.Module, vuln.Version, vuln.Fixed = top.Module, top.Version, msg.Finding.FixedVersion
+		if top.Function != "" {
+			symbol := top.Package + "." + top.Function
+			if top.Receiver != "" {
+				symbol = top.Package + "." + strings.TrimPrefix(top.Receiver, "*") + "." + top.Function
+			}
+			vuln.Called[symbol] = true
+		}
+	}
+
+	for id, vuln := range found {
+		if summary, ok := summaries[id]; ok {
+			vuln.Aliases, vuln.Summary = summary.Aliases, summary.Summary
+		}
+	}
+	return found, nil
+}
+
+// checkWithOSV looks up every module in the build list in the OSV database.
+// Unlike govulncheck it can't tell whether the vulnerable code is actually used.
+func (g *GoTools) checkWithOSV(ctx context.Context) (string, error) {
+	output, err := g.output(ctx, "go", "list", "-m", "-json", "all")
+	if err != nil {
+		return "", err
+	}
+
+	type module struct {
+		Path    string `json:"Path"`
+		Version string `json:"Version"`
+	}
+	var modules []module
+	decoder := json.NewDecoder(bytes.NewReader(output))
+	for {
+		var m module
+		err := decoder.Decode(&m)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to parse go list output: %v", err)
+		}
+		if m.Version != "" {
+			modules = append(modules, m)
+		}
+	}
+
+	type query struct {
+		Package struct {
+			Name      string `json:"name"`
+			Ecosystem string `json:"ecosystem"`
+		} `json:"package"`
+		Version string `json:"version"`
+	}
+	batch := struct {
+		Queries []query `json:"queries"`
+	}{}
+	for _, m := range modules {
+		q := query{Version: m.Version}
+		q.Package.Name, q.Package.Ecosystem = m.Path, "Go"
+		batch.Queries = append(batch.Queries, q)
+	}
+
+	var results struct {
+		Results []struct {
+			Vulns []struct {
+				ID string `json:"id"`
+			} `json:"vulns"`
+		} `json:"results"`
+	}
+	if err := postOSV(ctx, "https://api.osv.dev/v1/querybatch", batch, &results); err != nil {
+		return "", err
+	}
+
+	vulns := map[string]*vulnerability{}
+	for i, result := range results.Results {
+		for _, v := range result.Vulns {
+			if len(vulns) == maxOSVDetails {
+				break
+			}
+			vuln := &vulnerability{ID: v.ID, Module: modules[i].Path, Version: modules[i].Version}
+			vulns[v.ID] = vuln
+
+			var details struct {
+				Summary  string   `json:"summary"`
+				Aliases  []string `json:"aliases"`
+				Affected []struct {
+					Package struct {
+						Name string `json:"name"`
+					} `json:"package"`
+					Ranges []struct {
+						Events []struct {
+							Fixed string `json:"fixed"`
+						} `json:"events"`
+					} `json:"ranges"`
+				} `json:"affected"`
+			}
+			if err := getOSV(ctx, "https://api.osv.dev/v1/vulns/"+v.ID, &details); err != nil {
+				continue
+			}
+			vuln.Summary, vuln.Aliases = details.Summary, details.Aliases
+			for _, affected := range details.Affected {
+				if affected.Package.Name != vuln.Module {
+					continue
+				}
+				for _, r := range affected.Ranges {
+					for _, event := range r.Events {
+						if event.Fixed != "" {
+							vuln.Fixed = "v" + strings.TrimPrefix(event.Fixed, "v")
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return formatVulnerabilities(vulns, "the OSV database (govulncheck is not installed, so reachability is unknown)"), nil
+}
+
+func postOSV(ctx context.Context, url string, body any, result any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return doOSV(req, result)
+}
+
+func getOSV(ctx context.Context, url string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return doOSV(req, result)
+}
+
+func doOSV(req *http.Request, result any) error {
+	resp, err := netpolicy.FromEnv("api.osv.dev").Client(0).Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to query OSV: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("failed to query OSV: status %d", resp.StatusCode)
+	}
+	return json.NewDecoder(bufio.NewReader(resp.Body)).Decode(result)
+}
+
+func formatVulnerabilities(vulns map[string]*vulnerability, source string) string {
+	if len(vulns) == 0 {
+		return fmt.Sprintf("No known vulnerabilities found (checked with %s).", source)
+	}
+
+	ids := make([]string, 0, len(vulns))
+	for id := range vulns {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	var result strings.Builder
+	result.WriteString(fmt.Sprintf("%d known vulnerabilities found (checked with %s):\n", len(vulns), source))
+	for _, id := range ids {
+		vuln := vulns[id]
+
+		title := vuln.ID
+		if len(vuln.Aliases) > 0 {
+			title += " (" + strings.Join(vuln.Aliases, ", ") + ")"
+		}
+		result.WriteString(fmt.Sprintf("\n%s: %s\n", title, vuln.Summary))
+
+		fixed := "no fixed version"
+		if vuln.Fixed != "" {
+			fixed = "fixed in " + vuln.Fixed
+		}
+		result.WriteString(fmt.Sprintf("  %s@%s, %s\n", vuln.Module, vuln.Version, fixed))
+
+		if len(vuln.Called) > 0 {
+			symbols := make([]string, 0, len(vuln.Called))
+			for symbol := range vuln.Called {
+				symbols = append(symbols, symbol)
+			}
+			sort.Strings(symbols)
+			result.WriteString(fmt.Sprintf("  called: %s\n", strings.Join(symbols, ", ")))
+		} else if vuln.Called != nil {
+			result.WriteString("  not called: the module is a dependency but its vulnerable code isn't reachable from this module\n")
+		}
+	}
+	return result.String()
+}
@@ -0,0 +1,270 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/kartikx/agent/netpolicy"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+	"github.com/tetratelabs/wazero/sys"
+)
+
+// Memory a WASM tool may use unless its declaration says otherwise.
+const defaultWasmMemoryMB = 64
+
+// Most bytes of an HTTP response body handed to a WASM tool.
+const maxWasmResponseBody = 10 << 20
+
+// WasmMount gives a WASM tool access to a host directory.
+type WasmMount struct {
+	// Directory on the host, relative to the agent's working directory.
+	Host string `json:"host"`
+	// Where the tool sees it, e.g. /data.
+	Guest    string `json:"guest"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+}
+
+// wasmTool runs a WASM module compiled for WASI (wasip1) as a tool. The module
+// is sandboxed: it gets the call's arguments as JSON on stdin and its stdout is
+// the result, it sees only the directories mounted for it, and it can make HTTP
+// requests only to its allowed hosts, through two functions it imports from the
+// "agent" module:
+//
+//	http_request(ptr, len u32) u32  sends the JSON request at ptr, e.g.
+//	  {"method": "GET", "url": "https://api.example.com/x", "headers": {}, "body": ""},
+//	  and returns the length of the JSON response, {"status": 200, "headers": {...},
+//	  "body": "..."} or {"error": "..."}
+//	http_response(ptr u32)          copies that response to ptr
+//
+// A non-zero exit code fails the call, with stderr as the error.
+type wasmTool struct {
+	name    string
+	runtime wazero.Runtime
+	module  wazero.CompiledModule
+	mounts  []WasmMount
+	// Hosts the module may send requests to.
+	policy  *netpolicy.Policy
+	env     map[string]string
+	timeout time.Duration
+}
+
+type wasmCallKey struct{}
+
+// wasmCall holds the HTTP response waiting to be copied into the module's memory.
+type wasmCall struct {
+	tool     *wasmTool
+	response []byte
+}
+
+// newWasmTool compiles the declaration's module, checking its mounts.
+func newWasmTool(c CommandTool, timeout time.Duration) (*wasmTool, error) {
+	code, err := os.ReadFile(c.Wasm)
+	if err != nil {
+		return nil, err
+	}
+	for _, mount := range c.Mounts {
+		if !strings.HasPrefix(mount.Guest, "/") {
+			return nil, fmt.Errorf("mount %s: guest path must be absolute", mount.Host)
+		}
+		if info, err := os.Stat(mount.Host); err != nil || !info.IsDir() {
+			return nil, fmt.Errorf("mount %s is not a directory", mount.Host)
+		}
+	}
+	memoryMB := c.MemoryMB
+	if memoryMB == 0 {
+		memoryMB = defaultWasmMemoryMB
+	}
+
+	ctx := context.Background()
+	// A WASM page is 64KiB.
+	config := wazero.NewRuntimeConfig().WithCloseOnContextDone(true).WithMemoryLimitPages(uint32(memoryMB * 16))
+	runtime := wazero.NewRuntimeWithConfig(ctx, config)
+	tool := &wasmTool{name: c.Name, runtime: runtime, mounts: c.Mounts, policy: netpolicy.New(c.AllowedHosts...), env: c.Env, timeout: timeout}
+
+	wasi_snapshot_preview1.MustInstantiate(ctx, runtime)
+	_, err = runtime.NewHostModuleBuilder("agent").
+		NewFunctionBuilder().WithFunc(wasmHTTPRequest).Export("http_request").
+		NewFunctionBuilder().WithFunc(wasmHTTPResponse).Export("http_response").
+		Instantiate(ctx)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+
+	tool.module, err = runtime.CompileModule(ctx, code)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("invalid WASM module %s: %v", c.Wasm, err)
+	}
+	return tool, nil
+}
+
+// run instantiates a fresh copy of the module for the call, so calls share no state.
+func (t *wasmTool) run(ctx context.Context, input json.RawMessage) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, wasmCallKey{}, &wasmCall{tool: t})
+
+	fsConfig := wazero.NewFSConfig()
+	for _, mount := range t.mounts {
+		if mount.ReadOnly {
+			fsConfig = fsConfig.WithReadOnlyDirMount(mount.Host, mount.Guest)
+		} else {
+			fsConfig = fsConfig.WithDirMount(mount.Host, mount.Guest)
+		}
+	}
+
+	var stdout, stderr limitedBuffer
+	stdout.limit, stderr.limit = maxCommandToolOutput, maxCommandToolOutput
+	config := wazero.NewModuleConfig().
+		WithName("").
+		WithArgs(t.name).
+		WithStdin(bytes.NewReader(input)).
+		WithStdout(&stdout).
+		WithStderr(&stderr).
+		WithFSConfig(fsConfig).
+		WithSysWalltime().
+		WithSysNanotime().
+		WithRandSource(rand.Reader)
+	for name, value := range t.env {
+		config = config.WithEnv(name, value)
+	}
+
+	module, err := t.runtime.InstantiateModule(ctx, t.module, config)
+	if module != nil {
+		module.Close(ctx)
+	}
+
+	var exitErr *sys.ExitError
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return "", fmt.Errorf("%s did not finish within %s", t.name, t.timeout)
+	case errors.As(err, &exitErr) && exitErr.ExitCode() != 0:
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = strings.TrimSpace(stdout.String())
+		}
+		return "", fmt.Errorf("%s exited with code %d: %s", t.name, exitErr.ExitCode(), message)
+	case err != nil && !errors.As(err, &exitErr):
+		return "", fmt.Errorf("%s failed: %v", t.name, err)
+	}
+	return stdout.String(), nil
+}
+
+// allowed reports whether the tool may send requests to target.
+func (t *wasmTool) allowed(target *url.URL) error {
+	if target.Scheme != "http" && target.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme %q", target.Scheme)
+	}
+	if t.policy.Allows(target.Hostname()) {
+		return nil
+	}
+	return fmt.Errorf("host %s is not allowed for %s", target.Hostname(), t.name)
+}
+
+// wasmHTTPRequest implements agent.http_request.
+func wasmHTTPRequest(ctx context.Context, module api.Module, ptr uint32, length uint32) uint32 {
+	call := ctx.Value(wasmCallKey{}).(*wasmCall)
+
+	var response any
+	request, ok := module.Memory().Read(ptr, length)
+	if !ok {
+		response = map[string]string{"error": "request is outside memory"}
+	} else {
+		response = call.tool.httpRequest(ctx, request)
+	}
+	call.response, _ = json.Marshal(response)
+	return uint32(len(call.response))
+}
+
+// wasmHTTPResponse implements agent.http_response.
+func wasmHTTPResponse(ctx context.Context, module api.Module, ptr uint32) {
+	call := ctx.Value(wasmCallKey{}).(*wasmCall)
+	if !module.Memory().Write(ptr, call.response) {
+		panic("http_response: buffer is outside memory")
+	}
+}
+
+func (t *wasmTool) httpRequest(ctx context.Context, data []byte) any {
+	var request struct {
+		Method  string            `json:"method"`
+		URL     string            `json:"url"`
+		Headers map[string]string `json:"headers"`
+		Body    string            `json:"body"`
+	}
+	if err := json.Unmarshal(data, &request); err != nil {
+		return map[string]string{"error": fmt.Sprintf("invalid request: %v", err)}
+	}
+	if request.Method == "" {
+		request.Method = http.MethodGet
+	}
+
+	target, err := url.Parse(request.URL)
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("invalid URL: %v", err)}
+	}
+	if err := t.allowed(target); err != nil {
+		return map[string]string{"error": err.Error()}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, request.Method, target.String(), strings.NewReader(request.Body))
+	if err != nil {
+		return map[string]string{"error": err.Error()}
+	}
+	for name, value := range request.Headers {
+		req.Header.Set(name, value)
+	}
+	// The client checks the addresses the hosts resolve to, and redirects.
+	resp, err := t.policy.Client(0).Do(req)
+	if err != nil {
+		return map[string]string{"error": err.Error()}
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxWasmResponseBody))
+	if err != nil {
+		return map[string]string{"error": fmt.Sprintf("failed to read response body: %v", err)}
+	}
+	headers := map[string]string{}
+	for name := range resp.Header {
+		headers[name] = resp.Header.Get(name)
+	}
+	return map[string]any{"status": resp.StatusCode, "headers": headers, "body": string(body)}
+}
+
+// limitedBuffer keeps the first limit bytes written to it and drops the rest.
+type limitedBuffer struct {
+	bytes.Buffer
+	limit     int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(data []byte) (int, error) {
+	if room := b.limit - b.Len(); room < len(data) {
+		b.truncated = true
+		if room > 0 {
+			b.Buffer.Write(data[:room])
+		}
+		return len(data), nil
+	}
+	return b.Buffer.Write(data)
+}
+
+func (b *limitedBuffer) String() string {
+	if b.truncated {
+		return b.Buffer.String() + "\n[output truncated]"
+	}
+	return b.Buffer.String()
+}
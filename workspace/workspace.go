@@ -0,0 +1,240 @@
+// Package workspace provisions disposable workspaces: a repository checked out
+// into a temporary directory, optionally mounted into a Docker container.
+package workspace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Workspace is one provisioned checkout.
+type Workspace struct {
+	ID          string
+	Dir         string // host directory, mounted at /workspace in the container
+	Repository  string
+	Ref         string
+	ContainerID string // empty when containers are disabled
+}
+
+// Manager creates and tears down workspaces.
+type Manager struct {
+	// Image the container is started from; containers are disabled when empty.
+	Image string
+	// Directory workspaces are created in; defaults to the OS temp dir.
+	BaseDir string
+
+	mu         sync.Mutex
+	workspaces map[string]*Workspace
+}
+
+func NewManager(image string, baseDir string) *Manager {
+	return &Manager{
+		Image:      image,
+		BaseDir:    baseDir,
+		workspaces: map[string]*Workspace{},
+	}
+}
+
+// NewManagerFromEnv reads WORKSPACE_IMAGE (default golang:1.23, "none" disables
+// containers) and WORKSPACE_DIR.
+func NewManagerFromEnv() *Manager {
+	image := os.Getenv("WORKSPACE_IMAGE")
+	switch image {
+	case "":
+		image = "golang:1.23"
+	case "none":
+		image = ""
+	}
+	return NewManager(image, os.Getenv("WORKSPACE_DIR"))
+}
+
+// Create clones repository at ref (a branch, tag or commit; empty for the default
+// branch) into a new workspace and, if enabled, starts its container.
+// depth limits history; 0 clones everything.
+func (m *Manager) Create(ctx context.Context, repository string, ref string, depth int) (*Workspace, error) {
+	if repository != "" {
+		if err := checkRepository(repository, ref); err != nil {
+			return nil, err
+		}
+	}
+
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	dir, err := os.MkdirTemp(m.BaseDir, "workspace-"+id+"-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create workspace directory: %v", err)
+	}
+
+	workspace := &Workspace{ID: id, Dir: dir, Repository: repository, Ref: ref}
+
+	if repository != "" {
+		if err := clone(ctx, repository, ref, depth, dir); err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+	}
+
+	if m.Image != "" {
+		output, err := exec.CommandContext(ctx, "docker", "run", "-d", "--rm",
+			"--name", "agent-workspace-"+id,
+			"-v", dir+":/workspace", "-w", "/workspace",
+			m.Image, "sleep", "infinity").CombinedOutput()
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("failed to start workspace container: %v: %s", err, strings.TrimSpace(string(output)))
+		}
+		workspace.ContainerID = strings.TrimSpace(string(output))
+	}
+
+	m.mu.Lock()
+	m.workspaces[id] = workspace
+	m.mu.Unlock()
+
+	fmt.Printf("Created workspace %s in %s\n", id, dir)
+	return workspace, nil
+}
+
+// Get returns the workspace with the given ID.
+func (m *Manager) Get(id string) (*Workspace, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	workspace, ok := m.workspaces[id]
+	return workspace, ok
+}
+
+// Destroy stops the workspace's container and deletes its files.
+func (m *Manager) Destroy(id string) error {
+	m.mu.Lock()
+	workspace, ok := m.workspaces[id]
+	delete(m.workspaces, id)
+	m.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("unknown workspace: %s", id)
+	}
+
+	var errs []string
+	if workspace.ContainerID != "" {
+		if output, err := exec.Command("docker", "rm", "-f", workspace.ContainerID).CombinedOutput(); err != nil {
+			errs = append(errs, fmt.Sprintf("failed to remove container: %v: %s", err, strings.TrimSpace(string(output))))
+		}
+	}
+	if err := os.RemoveAll(workspace.Dir); err != nil {
+		errs = append(errs, fmt.Sprintf("failed to remove directory: %v", err))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	fmt.Printf("Destroyed workspace %s\n", id)
+	return nil
+}
+
+// DestroyAll tears down every workspace, e.g. on shutdown.
+func (m *Manager) DestroyAll() error {
+	m.mu.Lock()
+	ids := make([]string, 0, len(m.workspaces))
+	for id := range m.workspaces {
+		ids = append(ids, id)
+	}
+	m.mu.Unlock()
+
+	var errs []string
+	for _, id := range ids {
+		if err := m.Destroy(id); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Command returns a command that runs inside the workspace: in its container
+// if there is one, otherwise in its directory on the host.
+func (w *Workspace) Command(ctx context.Context, name string, args ...string) *exec.Cmd {
+	if w.ContainerID != "" {
+		return exec.CommandContext(ctx, "docker", append([]string{"exec", "-w", "/workspace", w.ContainerID, name}, args...)...)
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Dir = w.Dir
+	return cmd
+}
+
+// scp-like SSH address of a repository, e.g. git@github.com:owner/repo.git.
+var scpRepository = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*@[A-Za-z0-9][A-Za-z0-9.-]*:[^\s]+$`)
+
+// checkRepository accepts only remote repositories, over HTTPS or SSH, and refs
+// that can't be taken for git options. Local paths, file:// and transports
+// like ext:: would let whoever names the repository read the host's files or
+// run commands on it.
+func checkRepository(repository string, ref string) error {
+	if strings.HasPrefix(ref, "-") {
+		return fmt.Errorf("invalid ref %q", ref)
+	}
+	if scpRepository.MatchString(repository) {
+		return nil
+	}
+	parsed, err := url.Parse(repository)
+	if err != nil || (parsed.Scheme != "https" && parsed.Scheme != "ssh") || parsed.Host == "" || strings.HasPrefix(parsed.Host, "-") {
+		return fmt.Errorf("invalid repository %q: use an https:// or ssh:// URL, or user@host:path", repository)
+	}
+	return nil
+}
+
+func clone(ctx context.Context, repository string, ref string, depth int, dir string) error {
+	args := []string{"clone"}
+	if depth > 0 {
+		args = append(args, "--depth", strconv.Itoa(depth), "--no-single-branch")
+	}
+	args = append(args, "--", repository, dir)
+
+	if output, err := exec.CommandContext(ctx, "git", args...).CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to clone %s: %v: %s", repository, err, strings.TrimSpace(string(output)))
+	}
+
+	if ref == "" {
+		return nil
+	}
+
+	checkout := exec.CommandContext(ctx, "git", "checkout", ref)
+	checkout.Dir = dir
+	if output, err := checkout.CombinedOutput(); err != nil {
+		// A commit outside the shallow history has to be fetched first.
+		fetch := exec.CommandContext(ctx, "git", "fetch", "--depth", strconv.Itoa(max(depth, 1)), "origin", ref)
+		fetch.Dir = dir
+		if fetchOutput, fetchErr := fetch.CombinedOutput(); fetchErr != nil {
+			return fmt.Errorf("failed to check out %s: %v: %s %s", ref, err, strings.TrimSpace(string(output)), strings.TrimSpace(string(fetchOutput)))
+		}
+
+		checkout = exec.CommandContext(ctx, "git", "checkout", "FETCH_HEAD")
+		checkout.Dir = dir
+		if output, err := checkout.CombinedOutput(); err != nil {
+			return fmt.Errorf("failed to check out %s: %v: %s", ref, err, strings.TrimSpace(string(output)))
+		}
+	}
+	return nil
+}
+
+func newID() (string, error) {
+	bytes := make([]byte, 6)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}